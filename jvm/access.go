@@ -0,0 +1,114 @@
+package jvm
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Access control (JVMS §5.4.4), including the nestmate rules of Java 11 and
+// the sealed classes of Java 17
+
+// NestHost returns the host of the nest the class claims to belong to,
+// empty if it has no NestHost attribute
+func (c *JavaClass) NestHost() string {
+	attr := FindAttribute(c.Attributes, NestHostAttr)
+	if attr == nil {
+		return ""
+	}
+	return attr.Data.(NestHostAttribute).HostClass
+}
+
+// NestMembers returns the classes a nest host lists as members of its nest
+func (c *JavaClass) NestMembers() []string {
+	attr := FindAttribute(c.Attributes, NestMembersAttr)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(ClassListAttribute).Classes
+}
+
+// IsSealed reports whether the class restricts its direct subclasses
+func (c *JavaClass) IsSealed() bool {
+	return FindAttribute(c.Attributes, PermittedSubclassesAttr) != nil
+}
+
+// PermittedSubclasses returns the only classes allowed to directly extend or
+// implement a sealed class
+func (c *JavaClass) PermittedSubclasses() []string {
+	attr := FindAttribute(c.Attributes, PermittedSubclassesAttr)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(ClassListAttribute).Classes
+}
+
+// NestHostOf returns the nest host of class. A class whose claimed host
+// can't be loaded, lives in another package or doesn't list it as a member
+// is the host of its own nest
+func (jvm *Jvm) NestHostOf(class *JavaClass) *JavaClass {
+	hostName := class.NestHost()
+	if hostName == "" || hostName == class.Name() || packageName(hostName) != packageName(class.Name()) {
+		return class
+	}
+	host, err := jvm.LoadClass(hostName)
+	if err != nil || !slices.Contains(host.NestMembers(), class.Name()) {
+		return class
+	}
+	return host
+}
+
+// AreNestmates reports whether both classes belong to the same nest, and so
+// can access the private members of each other
+func (jvm *Jvm) AreNestmates(a, b *JavaClass) bool {
+	return a == b || jvm.NestHostOf(a) == jvm.NestHostOf(b)
+}
+
+// isSubclassOf walks the loaded super classes of class looking for super
+func (jvm *Jvm) isSubclassOf(class, super *JavaClass) bool {
+	for ancestor := class; ancestor != nil; ancestor = jvm.Classes[ancestor.SuperName()] {
+		if ancestor == super {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckClassAccess fails with IllegalAccessError if accessor can't see class
+func (jvm *Jvm) CheckClassAccess(accessor, class *JavaClass) error {
+	if class.AccessFlags&AccPublic != 0 || packageName(accessor.Name()) == packageName(class.Name()) {
+		return nil
+	}
+	return &LinkageError{
+		ErrorClass: "java.lang.IllegalAccessError",
+		Message:    fmt.Sprintf("class %s cannot access its superclass or class %s", accessor.Name(), class.Name()),
+	}
+}
+
+// CheckMemberAccess fails with IllegalAccessError if accessor can't use the
+// member called name, declared by owner with the given access flags
+func (jvm *Jvm) CheckMemberAccess(accessor, owner *JavaClass, name string, flags AccessFlag) error {
+	samePackage := packageName(accessor.Name()) == packageName(owner.Name())
+	visibility := "package-private"
+	switch {
+	case flags&AccPublic != 0:
+		return nil
+	case flags&AccPrivate != 0:
+		if jvm.AreNestmates(accessor, owner) {
+			return nil
+		}
+		visibility = "private"
+	case flags&AccProtected != 0:
+		if samePackage || jvm.isSubclassOf(accessor, owner) {
+			return nil
+		}
+		visibility = "protected"
+	default:
+		if samePackage {
+			return nil
+		}
+	}
+	return &LinkageError{
+		ErrorClass: "java.lang.IllegalAccessError",
+		Message:    fmt.Sprintf("class %s tried to access %s member %s.%s", accessor.Name(), visibility, owner.Name(), name),
+	}
+}
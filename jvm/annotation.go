@@ -0,0 +1,565 @@
+package jvm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+type ElementValueTag byte
+
+const (
+	ElementValueByte       ElementValueTag = 'B'
+	ElementValueChar       ElementValueTag = 'C'
+	ElementValueDouble     ElementValueTag = 'D'
+	ElementValueFloat      ElementValueTag = 'F'
+	ElementValueInt        ElementValueTag = 'I'
+	ElementValueLong       ElementValueTag = 'J'
+	ElementValueShort      ElementValueTag = 'S'
+	ElementValueBoolean    ElementValueTag = 'Z'
+	ElementValueString     ElementValueTag = 's'
+	ElementValueEnum       ElementValueTag = 'e'
+	ElementValueClass      ElementValueTag = 'c'
+	ElementValueAnnotation ElementValueTag = '@'
+	ElementValueArray      ElementValueTag = '['
+)
+
+type ElementValue struct {
+	Tag ElementValueTag
+	// Primitive and string constants
+	ConstValueIndex uint16
+	ConstValue      interface{}
+	// Enum constants, TypeName is a field descriptor
+	EnumTypeName  string
+	EnumConstName string
+	// Class literals, as a return descriptor so void.class is V
+	ClassInfo string
+	// Nested annotation
+	Annotation *Annotation
+	// Array elements
+	Values []ElementValue
+}
+
+type ElementValuePair struct {
+	NameIndex uint16
+	Name      string
+	Value     ElementValue
+}
+
+type Annotation struct {
+	TypeIndex uint16
+	// Field descriptor of the annotation interface
+	Type              string
+	ElementValuePairs []ElementValuePair
+}
+
+type RuntimeAnnotationsAttribute []Annotation
+
+// One list of annotations per formal parameter
+type ParameterAnnotationsAttribute [][]Annotation
+
+type AnnotationDefaultAttribute struct {
+	DefaultValue ElementValue
+}
+
+type TypeAnnotationTargetType uint8
+
+const (
+	TargetClassTypeParameter       TypeAnnotationTargetType = 0x00
+	TargetMethodTypeParameter      TypeAnnotationTargetType = 0x01
+	TargetClassExtends             TypeAnnotationTargetType = 0x10
+	TargetClassTypeParameterBound  TypeAnnotationTargetType = 0x11
+	TargetMethodTypeParameterBound TypeAnnotationTargetType = 0x12
+	TargetField                    TypeAnnotationTargetType = 0x13
+	TargetMethodReturn             TypeAnnotationTargetType = 0x14
+	TargetMethodReceiver           TypeAnnotationTargetType = 0x15
+	TargetMethodFormalParameter    TypeAnnotationTargetType = 0x16
+	TargetThrows                   TypeAnnotationTargetType = 0x17
+	TargetLocalVariable            TypeAnnotationTargetType = 0x40
+	TargetResourceVariable         TypeAnnotationTargetType = 0x41
+	TargetExceptionParameter       TypeAnnotationTargetType = 0x42
+	TargetInstanceof               TypeAnnotationTargetType = 0x43
+	TargetNew                      TypeAnnotationTargetType = 0x44
+	TargetConstructorReference     TypeAnnotationTargetType = 0x45
+	TargetMethodReference          TypeAnnotationTargetType = 0x46
+	TargetCast                     TypeAnnotationTargetType = 0x47
+	TargetConstructorInvocationArg TypeAnnotationTargetType = 0x48
+	TargetMethodInvocationArg      TypeAnnotationTargetType = 0x49
+	TargetConstructorReferenceArg  TypeAnnotationTargetType = 0x4A
+	TargetMethodReferenceTypeArg   TypeAnnotationTargetType = 0x4B
+)
+
+type LocalVarTargetEntry struct {
+	StartPc uint16
+	Length  uint16
+	Index   uint16
+}
+
+// TypeAnnotationTarget holds the target_info union, only the fields used by
+// the target type are set
+type TypeAnnotationTarget struct {
+	// type_parameter_target and type_parameter_bound_target
+	TypeParameterIndex uint8
+	// type_parameter_bound_target
+	BoundIndex uint8
+	// supertype_target, 65535 for the super class
+	SupertypeIndex uint16
+	// formal_parameter_target
+	FormalParameterIndex uint8
+	// throws_target
+	ThrowsTypeIndex uint16
+	// localvar_target
+	LocalVarTable []LocalVarTargetEntry
+	// catch_target
+	ExceptionTableIndex uint16
+	// offset_target and type_argument_target
+	Offset uint16
+	// type_argument_target
+	TypeArgumentIndex uint8
+}
+
+type TypePathKind uint8
+
+const (
+	TypePathArray         TypePathKind = 0
+	TypePathNested        TypePathKind = 1
+	TypePathWildcardBound TypePathKind = 2
+	TypePathTypeArgument  TypePathKind = 3
+)
+
+type TypePathEntry struct {
+	TypePathKind      TypePathKind
+	TypeArgumentIndex uint8
+}
+
+type TypeAnnotation struct {
+	TargetType TypeAnnotationTargetType
+	TargetInfo TypeAnnotationTarget
+	TargetPath []TypePathEntry
+	Annotation
+}
+
+type RuntimeTypeAnnotationsAttribute []TypeAnnotation
+
+// attributeReader decodes the body of an attribute, failing instead of
+// panicking on truncated data
+type attributeReader struct {
+	info   []byte
+	offset int
+}
+
+func (r *attributeReader) u1() (uint8, error) {
+	if r.offset+1 > len(r.info) {
+		return 0, fmt.Errorf("truncated attribute")
+	}
+	v := r.info[r.offset]
+	r.offset += 1
+	return v, nil
+}
+
+func (r *attributeReader) u2() (uint16, error) {
+	if r.offset+2 > len(r.info) {
+		return 0, fmt.Errorf("truncated attribute")
+	}
+	v := binary.BigEndian.Uint16(r.info[r.offset:])
+	r.offset += 2
+	return v, nil
+}
+
+func (r *attributeReader) u4() (uint32, error) {
+	if r.offset+4 > len(r.info) {
+		return 0, fmt.Errorf("truncated attribute")
+	}
+	v := binary.BigEndian.Uint32(r.info[r.offset:])
+	r.offset += 4
+	return v, nil
+}
+
+func (r *attributeReader) utf8(constantPool []*ConstantInfo) (uint16, string, error) {
+	index, err := r.u2()
+	if err != nil {
+		return 0, "", err
+	}
+	if index == 0 || int(index) > len(constantPool) || constantPool[index-1] == nil || constantPool[index-1].Tag != ConstantUtf8Tag {
+		return 0, "", fmt.Errorf("invalid utf8 constant index %d", index)
+	}
+	return index, constantPool[index-1].Data.(ConstantUtf8), nil
+}
+
+func readElementValue(constantPool []*ConstantInfo, r *attributeReader) (ElementValue, error) {
+	tag, err := r.u1()
+	if err != nil {
+		return ElementValue{}, err
+	}
+	value := ElementValue{Tag: ElementValueTag(tag)}
+	switch value.Tag {
+	case ElementValueByte, ElementValueChar, ElementValueInt, ElementValueShort, ElementValueBoolean,
+		ElementValueDouble, ElementValueFloat, ElementValueLong, ElementValueString:
+		if value.ConstValueIndex, err = r.u2(); err != nil {
+			return value, err
+		}
+		expected := map[ElementValueTag]ConstantPoolTag{
+			ElementValueDouble: ConstantDoubleTag, ElementValueFloat: ConstantFloatTag,
+			ElementValueLong: ConstantLongTag, ElementValueString: ConstantUtf8Tag,
+		}[value.Tag]
+		if expected == 0 {
+			expected = ConstantIntegerTag
+		}
+		index := value.ConstValueIndex
+		if index == 0 || int(index) > len(constantPool) || constantPool[index-1] == nil || constantPool[index-1].Tag != expected {
+			return value, fmt.Errorf("invalid constant index %d for element value %c", index, tag)
+		}
+		value.ConstValue = constantPool[index-1].Data
+	case ElementValueEnum:
+		if _, value.EnumTypeName, err = r.utf8(constantPool); err != nil {
+			return value, err
+		}
+		if _, value.EnumConstName, err = r.utf8(constantPool); err != nil {
+			return value, err
+		}
+	case ElementValueClass:
+		if _, value.ClassInfo, err = r.utf8(constantPool); err != nil {
+			return value, err
+		}
+	case ElementValueAnnotation:
+		annotation, err := readAnnotation(constantPool, r)
+		if err != nil {
+			return value, err
+		}
+		value.Annotation = &annotation
+	case ElementValueArray:
+		numValues, err := r.u2()
+		if err != nil {
+			return value, err
+		}
+		value.Values = make([]ElementValue, numValues)
+		for i := range numValues {
+			if value.Values[i], err = readElementValue(constantPool, r); err != nil {
+				return value, err
+			}
+		}
+	default:
+		return value, fmt.Errorf("invalid element value tag %q", tag)
+	}
+	return value, nil
+}
+
+func readAnnotation(constantPool []*ConstantInfo, r *attributeReader) (Annotation, error) {
+	var annotation Annotation
+	var err error
+	if annotation.TypeIndex, annotation.Type, err = r.utf8(constantPool); err != nil {
+		return annotation, err
+	}
+	numPairs, err := r.u2()
+	if err != nil {
+		return annotation, err
+	}
+	annotation.ElementValuePairs = make([]ElementValuePair, numPairs)
+	for i := range numPairs {
+		pair := &annotation.ElementValuePairs[i]
+		if pair.NameIndex, pair.Name, err = r.utf8(constantPool); err != nil {
+			return annotation, err
+		}
+		if pair.Value, err = readElementValue(constantPool, r); err != nil {
+			return annotation, err
+		}
+	}
+	return annotation, nil
+}
+
+func readAnnotations(constantPool []*ConstantInfo, r *attributeReader) ([]Annotation, error) {
+	numAnnotations, err := r.u2()
+	if err != nil {
+		return nil, err
+	}
+	annotations := make([]Annotation, numAnnotations)
+	for i := range numAnnotations {
+		if annotations[i], err = readAnnotation(constantPool, r); err != nil {
+			return nil, err
+		}
+	}
+	return annotations, nil
+}
+
+func ReadRuntimeAnnotations(constantPool []*ConstantInfo, info []byte) (RuntimeAnnotationsAttribute, error) {
+	return readAnnotations(constantPool, &attributeReader{info: info})
+}
+
+func ReadParameterAnnotations(constantPool []*ConstantInfo, info []byte) (ParameterAnnotationsAttribute, error) {
+	r := &attributeReader{info: info}
+	numParameters, err := r.u1()
+	if err != nil {
+		return nil, err
+	}
+	parameters := make(ParameterAnnotationsAttribute, numParameters)
+	for i := range numParameters {
+		if parameters[i], err = readAnnotations(constantPool, r); err != nil {
+			return nil, err
+		}
+	}
+	return parameters, nil
+}
+
+func ReadAnnotationDefault(constantPool []*ConstantInfo, info []byte) (AnnotationDefaultAttribute, error) {
+	value, err := readElementValue(constantPool, &attributeReader{info: info})
+	return AnnotationDefaultAttribute{DefaultValue: value}, err
+}
+
+func readTypeAnnotationTarget(r *attributeReader, targetType TypeAnnotationTargetType) (TypeAnnotationTarget, error) {
+	var target TypeAnnotationTarget
+	var err error
+	switch targetType {
+	case TargetClassTypeParameter, TargetMethodTypeParameter:
+		target.TypeParameterIndex, err = r.u1()
+	case TargetClassExtends:
+		target.SupertypeIndex, err = r.u2()
+	case TargetClassTypeParameterBound, TargetMethodTypeParameterBound:
+		if target.TypeParameterIndex, err = r.u1(); err != nil {
+			break
+		}
+		target.BoundIndex, err = r.u1()
+	case TargetField, TargetMethodReturn, TargetMethodReceiver:
+	case TargetMethodFormalParameter:
+		target.FormalParameterIndex, err = r.u1()
+	case TargetThrows:
+		target.ThrowsTypeIndex, err = r.u2()
+	case TargetLocalVariable, TargetResourceVariable:
+		var tableLength uint16
+		if tableLength, err = r.u2(); err != nil {
+			break
+		}
+		target.LocalVarTable = make([]LocalVarTargetEntry, tableLength)
+		for i := range tableLength {
+			entry := &target.LocalVarTable[i]
+			if entry.StartPc, err = r.u2(); err != nil {
+				break
+			}
+			if entry.Length, err = r.u2(); err != nil {
+				break
+			}
+			if entry.Index, err = r.u2(); err != nil {
+				break
+			}
+		}
+	case TargetExceptionParameter:
+		target.ExceptionTableIndex, err = r.u2()
+	case TargetInstanceof, TargetNew, TargetConstructorReference, TargetMethodReference:
+		target.Offset, err = r.u2()
+	case TargetCast, TargetConstructorInvocationArg, TargetMethodInvocationArg,
+		TargetConstructorReferenceArg, TargetMethodReferenceTypeArg:
+		if target.Offset, err = r.u2(); err != nil {
+			break
+		}
+		target.TypeArgumentIndex, err = r.u1()
+	default:
+		return target, fmt.Errorf("invalid type annotation target type 0x%02X", uint8(targetType))
+	}
+	return target, err
+}
+
+func ReadRuntimeTypeAnnotations(constantPool []*ConstantInfo, info []byte) (RuntimeTypeAnnotationsAttribute, error) {
+	r := &attributeReader{info: info}
+	numAnnotations, err := r.u2()
+	if err != nil {
+		return nil, err
+	}
+	annotations := make(RuntimeTypeAnnotationsAttribute, numAnnotations)
+	for i := range numAnnotations {
+		annotation := &annotations[i]
+		targetType, err := r.u1()
+		if err != nil {
+			return nil, err
+		}
+		annotation.TargetType = TypeAnnotationTargetType(targetType)
+		if annotation.TargetInfo, err = readTypeAnnotationTarget(r, annotation.TargetType); err != nil {
+			return nil, err
+		}
+
+		pathLength, err := r.u1()
+		if err != nil {
+			return nil, err
+		}
+		annotation.TargetPath = make([]TypePathEntry, pathLength)
+		for j := range pathLength {
+			kind, err := r.u1()
+			if err != nil {
+				return nil, err
+			}
+			argumentIndex, err := r.u1()
+			if err != nil {
+				return nil, err
+			}
+			if kind > uint8(TypePathTypeArgument) {
+				return nil, fmt.Errorf("invalid type path kind %d", kind)
+			}
+			annotation.TargetPath[j] = TypePathEntry{TypePathKind: TypePathKind(kind), TypeArgumentIndex: argumentIndex}
+		}
+
+		if annotation.Annotation, err = readAnnotation(constantPool, r); err != nil {
+			return nil, err
+		}
+	}
+	return annotations, nil
+}
+
+func typeNameOf(fieldDescriptor string) string {
+	if fieldDescriptor == "V" {
+		return "void"
+	}
+	t, err := descriptor.ParseField(fieldDescriptor)
+	if err != nil {
+		return fieldDescriptor
+	}
+	return t.String()
+}
+
+// String formats the value as written in Java source
+func (v ElementValue) String() string {
+	switch v.Tag {
+	case ElementValueBoolean:
+		return fmt.Sprintf("%t", v.ConstValue.(ConstantInteger) != 0)
+	case ElementValueChar:
+		return fmt.Sprintf("%q", rune(v.ConstValue.(ConstantInteger)))
+	case ElementValueByte, ElementValueShort, ElementValueInt, ElementValueDouble:
+		return fmt.Sprintf("%v", v.ConstValue)
+	case ElementValueLong:
+		return fmt.Sprintf("%dL", v.ConstValue)
+	case ElementValueFloat:
+		return fmt.Sprintf("%vf", v.ConstValue)
+	case ElementValueString:
+		return fmt.Sprintf("%q", v.ConstValue)
+	case ElementValueEnum:
+		return typeNameOf(v.EnumTypeName) + "." + v.EnumConstName
+	case ElementValueClass:
+		return typeNameOf(v.ClassInfo) + ".class"
+	case ElementValueAnnotation:
+		return v.Annotation.String()
+	case ElementValueArray:
+		values := make([]string, len(v.Values))
+		for i, value := range v.Values {
+			values[i] = value.String()
+		}
+		return "{" + strings.Join(values, ", ") + "}"
+	}
+	return fmt.Sprintf("<invalid element value %q>", byte(v.Tag))
+}
+
+// String formats the annotation as written in Java source, like
+// `@java.lang.Deprecated(since="9")`
+func (a Annotation) String() string {
+	if len(a.ElementValuePairs) == 0 {
+		return "@" + typeNameOf(a.Type)
+	}
+	pairs := make([]string, len(a.ElementValuePairs))
+	for i, pair := range a.ElementValuePairs {
+		pairs[i] = pair.Name + "=" + pair.Value.String()
+	}
+	return fmt.Sprintf("@%s(%s)", typeNameOf(a.Type), strings.Join(pairs, ", "))
+}
+
+// annotationsOf collects the annotations of the given attribute type
+func annotationsOf(attributes []*AttributeInfo, attributeType AttributeType) []Annotation {
+	attr := FindAttribute(attributes, attributeType)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(RuntimeAnnotationsAttribute)
+}
+
+func typeAnnotationsOf(attributes []*AttributeInfo, attributeType AttributeType) []TypeAnnotation {
+	attr := FindAttribute(attributes, attributeType)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(RuntimeTypeAnnotationsAttribute)
+}
+
+func parameterAnnotationsOf(attributes []*AttributeInfo, attributeType AttributeType) [][]Annotation {
+	attr := FindAttribute(attributes, attributeType)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(ParameterAnnotationsAttribute)
+}
+
+// Annotations returns the annotations visible at run time
+func (c *JavaClass) Annotations() []Annotation {
+	return annotationsOf(c.Attributes, RuntimeVisibleAnnotationsAttr)
+}
+
+// InvisibleAnnotations returns the annotations only kept in the class file
+func (c *JavaClass) InvisibleAnnotations() []Annotation {
+	return annotationsOf(c.Attributes, RuntimeInvisibleAnnotationsAttr)
+}
+
+func (c *JavaClass) TypeAnnotations() []TypeAnnotation {
+	return typeAnnotationsOf(c.Attributes, RuntimeVisibleTypeAnnotationsAttr)
+}
+
+func (c *JavaClass) InvisibleTypeAnnotations() []TypeAnnotation {
+	return typeAnnotationsOf(c.Attributes, RuntimeInvisibleTypeAnnotationsAttr)
+}
+
+func (f *FieldInfo) Annotations() []Annotation {
+	return annotationsOf(f.Attributes, RuntimeVisibleAnnotationsAttr)
+}
+
+func (f *FieldInfo) InvisibleAnnotations() []Annotation {
+	return annotationsOf(f.Attributes, RuntimeInvisibleAnnotationsAttr)
+}
+
+func (f *FieldInfo) TypeAnnotations() []TypeAnnotation {
+	return typeAnnotationsOf(f.Attributes, RuntimeVisibleTypeAnnotationsAttr)
+}
+
+func (f *FieldInfo) InvisibleTypeAnnotations() []TypeAnnotation {
+	return typeAnnotationsOf(f.Attributes, RuntimeInvisibleTypeAnnotationsAttr)
+}
+
+func (m *MethodInfo) Annotations() []Annotation {
+	return annotationsOf(m.Attributes, RuntimeVisibleAnnotationsAttr)
+}
+
+func (m *MethodInfo) InvisibleAnnotations() []Annotation {
+	return annotationsOf(m.Attributes, RuntimeInvisibleAnnotationsAttr)
+}
+
+// ParameterAnnotations returns the visible annotations of each parameter
+func (m *MethodInfo) ParameterAnnotations() [][]Annotation {
+	return parameterAnnotationsOf(m.Attributes, RuntimeVisibleParameterAnnotationsAttr)
+}
+
+func (m *MethodInfo) InvisibleParameterAnnotations() [][]Annotation {
+	return parameterAnnotationsOf(m.Attributes, RuntimeInvisibleParameterAnnotationsAttr)
+}
+
+// TypeAnnotations returns the visible type annotations of the method
+// signature and of its code
+func (m *MethodInfo) TypeAnnotations() []TypeAnnotation {
+	annotations := typeAnnotationsOf(m.Attributes, RuntimeVisibleTypeAnnotationsAttr)
+	if code := m.Code(); code != nil {
+		annotations = append(annotations, typeAnnotationsOf(code.Attributes, RuntimeVisibleTypeAnnotationsAttr)...)
+	}
+	return annotations
+}
+
+func (m *MethodInfo) InvisibleTypeAnnotations() []TypeAnnotation {
+	annotations := typeAnnotationsOf(m.Attributes, RuntimeInvisibleTypeAnnotationsAttr)
+	if code := m.Code(); code != nil {
+		annotations = append(annotations, typeAnnotationsOf(code.Attributes, RuntimeInvisibleTypeAnnotationsAttr)...)
+	}
+	return annotations
+}
+
+// AnnotationDefault returns the default value of an annotation interface
+// element, nil if it has none
+func (m *MethodInfo) AnnotationDefault() *ElementValue {
+	attr := FindAttribute(m.Attributes, AnnotationDefaultAttr)
+	if attr == nil {
+		return nil
+	}
+	value := attr.Data.(AnnotationDefaultAttribute).DefaultValue
+	return &value
+}
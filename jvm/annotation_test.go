@@ -0,0 +1,135 @@
+package jvm
+
+import "testing"
+
+func TestReadAnnotations(t *testing.T) {
+	constantPool := []*ConstantInfo{
+		{Tag: ConstantUtf8Tag, Data: "Ljava/lang/Deprecated;"},
+		{Tag: ConstantUtf8Tag, Data: "since"},
+		{Tag: ConstantUtf8Tag, Data: "9"},
+		{Tag: ConstantUtf8Tag, Data: "LOuter;"},
+		{Tag: ConstantUtf8Tag, Data: "inner"},
+		{Tag: ConstantUtf8Tag, Data: "LInner;"},
+		{Tag: ConstantUtf8Tag, Data: "values"},
+		{Tag: ConstantIntegerTag, Data: ConstantInteger(42)},
+		// A long takes two entries
+		{Tag: ConstantLongTag, Data: ConstantLong(7)},
+		nil,
+		{Tag: ConstantUtf8Tag, Data: "Ljava/lang/annotation/RetentionPolicy;"},
+		{Tag: ConstantUtf8Tag, Data: "RUNTIME"},
+		{Tag: ConstantUtf8Tag, Data: "Ljava/lang/String;"},
+		{Tag: ConstantUtf8Tag, Data: "V"},
+		{Tag: ConstantUtf8Tag, Data: string(AnnotationDefaultAttr)},
+		{Tag: ConstantIntegerTag, Data: ConstantInteger(1)},
+		{Tag: ConstantUtf8Tag, Data: "[I"},
+		{Tag: ConstantIntegerTag, Data: ConstantInteger('x')},
+	}
+	tests := []struct {
+		name string
+		info []byte
+		// The annotations formatted, or the error
+		want string
+	}{
+		{
+			name: "string element",
+			info: []byte{0, 1, 0, 1, 0, 1, 0, 2, 's', 0, 3},
+			want: `@java.lang.Deprecated(since="9")`,
+		},
+		{
+			name: "no elements",
+			info: []byte{0, 1, 0, 1, 0, 0},
+			want: `@java.lang.Deprecated`,
+		},
+		{
+			name: "nested annotation with an array",
+			info: []byte{0, 1, 0, 4, 0, 1, 0, 5, '@', 0, 6, 0, 1, 0, 7, '[', 0, 2, 'I', 0, 8, 'J', 0, 9},
+			want: `@Outer(inner=@Inner(values={42, 7L}))`,
+		},
+		{
+			name: "enum constants and class values",
+			info: []byte{0, 1, 0, 4, 0, 1, 0, 7, '[', 0, 4, 'e', 0, 11, 0, 12, 'c', 0, 13, 'c', 0, 14, 'c', 0, 17},
+			want: `@Outer(values={java.lang.annotation.RetentionPolicy.RUNTIME, java.lang.String.class, void.class, int[].class})`,
+		},
+		{
+			name: "boolean and char",
+			info: []byte{0, 1, 0, 4, 0, 1, 0, 7, '[', 0, 2, 'Z', 0, 16, 'C', 0, 18},
+			want: `@Outer(values={true, 'x'})`,
+		},
+		{
+			name: "empty array",
+			info: []byte{0, 1, 0, 4, 0, 1, 0, 7, '[', 0, 0},
+			want: `@Outer(values={})`,
+		},
+		{name: "empty", info: nil, want: "truncated attribute"},
+		{name: "count past the payload", info: []byte{0, 1}, want: "truncated attribute"},
+		{name: "pairs past the payload", info: []byte{0, 1, 0, 1, 0, 2, 0, 2, 's', 0, 3}, want: "truncated attribute"},
+		{name: "type not a Utf8 constant", info: []byte{0, 1, 0, 8, 0, 0}, want: "invalid utf8 constant index 8"},
+		{name: "element name index 0", info: []byte{0, 1, 0, 1, 0, 1, 0, 0, 's', 0, 3}, want: "invalid utf8 constant index 0"},
+		{name: "invalid element tag", info: []byte{0, 1, 0, 1, 0, 1, 0, 2, 'q', 0, 3}, want: "invalid element value tag 'q'"},
+		{name: "constant of another type", info: []byte{0, 1, 0, 1, 0, 1, 0, 2, 'I', 0, 3}, want: "invalid constant index 3 for element value I"},
+		{name: "long constant index on its second entry", info: []byte{0, 1, 0, 1, 0, 1, 0, 2, 'J', 0, 10}, want: "invalid constant index 10 for element value J"},
+		{name: "enum constant truncated", info: []byte{0, 1, 0, 4, 0, 1, 0, 7, 'e', 0, 11}, want: "truncated attribute"},
+		{name: "array past the payload", info: []byte{0, 1, 0, 4, 0, 1, 0, 7, '[', 0, 2, 'I', 0, 8}, want: "truncated attribute"},
+		{name: "nested annotation truncated", info: []byte{0, 1, 0, 4, 0, 1, 0, 5, '@', 0, 6, 0, 1}, want: "truncated attribute"},
+	}
+	for _, test := range tests {
+		annotations, err := ReadRuntimeAnnotations(constantPool, test.info)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else if len(annotations) != 1 {
+			t.Errorf("%s: read %d annotations, want 1", test.name, len(annotations))
+			continue
+		} else {
+			got = annotations[0].String()
+		}
+		if got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+
+	// Parameter annotations, one list per parameter
+	parameters, err := ReadParameterAnnotations(constantPool, []byte{2, 0, 0, 0, 1, 0, 1, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parameters) != 2 || len(parameters[0]) != 0 || len(parameters[1]) != 1 || parameters[1][0].String() != "@java.lang.Deprecated" {
+		t.Errorf("parameter annotations = %v", parameters)
+	}
+	if _, err := ReadParameterAnnotations(constantPool, []byte{2, 0, 0}); err == nil || err.Error() != "truncated attribute" {
+		t.Errorf("parameter annotations past the payload: error = %v, want truncated attribute", err)
+	}
+}
+
+func TestReadAnnotationDefault(t *testing.T) {
+	constantPool := []*ConstantInfo{
+		{Tag: ConstantUtf8Tag, Data: string(AnnotationDefaultAttr)},
+		{Tag: ConstantUtf8Tag, Data: "Ljava/lang/annotation/RetentionPolicy;"},
+		{Tag: ConstantUtf8Tag, Data: "CLASS"},
+		{Tag: ConstantFloatTag, Data: ConstantFloat(1.5)},
+	}
+	tests := []struct {
+		name string
+		info []byte
+		want string
+	}{
+		{"enum constant", []byte{'e', 0, 2, 0, 3}, "java.lang.annotation.RetentionPolicy.CLASS"},
+		{"float", []byte{'F', 0, 4}, "1.5f"},
+		{"array of floats", []byte{'[', 0, 2, 'F', 0, 4, 'F', 0, 4}, "{1.5f, 1.5f}"},
+		{"empty", nil, "truncated attribute"},
+		{"enum constant truncated", []byte{'e', 0, 2}, "truncated attribute"},
+		{"float of an enum", []byte{'F', 0, 2}, "invalid constant index 2 for element value F"},
+	}
+	for _, test := range tests {
+		attribute, err := readTestAttribute(constantPool, 1, test.info...)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = attribute.Data.(AnnotationDefaultAttribute).DefaultValue.String()
+		}
+		if got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
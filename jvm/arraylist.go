@@ -0,0 +1,281 @@
+package jvm
+
+import (
+	"maps"
+	"slices"
+)
+
+const (
+	listElements = "java/util/ArrayList.elementData"
+	listSize     = "java/util/ArrayList.size"
+	itrList      = "java/util/ArrayList$Itr.this$0"
+	itrCursor    = "java/util/ArrayList$Itr.cursor"
+	itrLastRet   = "java/util/ArrayList$Itr.lastRet"
+)
+
+// listContents returns the elements of an ArrayList, sharing its buffer
+func listContents(list *Object) []StackData {
+	elementData, _ := list.Fields[listElements].Data.(*Array)
+	if elementData == nil {
+		return nil
+	}
+	return elementData.Elements[:list.Fields[listSize].Int()]
+}
+
+// setListContents makes elements the content of an ArrayList. The buffer
+// grows by half, starting at 10 elements, like the one of the JDK
+func setListContents(list *Object, elements []StackData) {
+	elementData, _ := list.Fields[listElements].Data.(*Array)
+	size := int(list.Fields[listSize].Int())
+	if elementData == nil || len(elementData.Elements) < len(elements) {
+		capacity := 0
+		if elementData != nil {
+			capacity = len(elementData.Elements)
+		}
+		grown := NewArray("[Ljava/lang/Object;", max(capacity+capacity>>1, 10, len(elements)))
+		copy(grown.Elements, elements)
+		list.Fields[listElements] = referenceValue(grown)
+	} else {
+		copy(elementData.Elements, elements)
+		for i := len(elements); i < size; i++ {
+			elementData.Elements[i] = nullReference
+		}
+	}
+	list.Fields[listSize] = intValue(int32(len(elements)))
+}
+
+func indexOutOfBounds(format string, a ...interface{}) error {
+	return throwable("java/lang/IndexOutOfBoundsException", format, a...)
+}
+
+// checkIndex throws the IndexOutOfBoundsException of Objects.checkIndex
+func checkIndex(index, length int) error {
+	if index < 0 || index >= length {
+		return indexOutOfBounds("Index %d out of bounds for length %d", index, length)
+	}
+	return nil
+}
+
+// indexOfElement returns the index of the first element equal to value,
+// -1 if there is none
+func (jvm *Jvm) indexOfElement(elements []StackData, value StackData) (int, error) {
+	for i, element := range elements {
+		if equal, err := jvm.javaEquals(value, element); err != nil || equal {
+			return i, err
+		}
+	}
+	return -1, nil
+}
+
+func init() {
+	const listClass = "java/util/ArrayList"
+	list := func(call *NativeCall) *Object {
+		return call.Object(0)
+	}
+	construct := func(call *NativeCall) (StackData, error) {
+		switch call.Descriptor {
+		case "(I)V":
+			if call.Int(1) < 0 {
+				return StackData{}, throwable("java/lang/IllegalArgumentException", "Illegal Capacity: %d", call.Int(1))
+			}
+			list(call).Fields[listElements] = referenceValue(NewArray("[Ljava/lang/Object;", int(call.Int(1))))
+		case "(Ljava/util/Collection;)V":
+			elements, err := call.Jvm.collectionElements(call.Args[1])
+			if err != nil {
+				return StackData{}, err
+			}
+			setListContents(list(call), elements)
+		}
+		return StackData{}, nil
+	}
+	for _, methodDescriptor := range []string{"()V", "(I)V", "(Ljava/util/Collection;)V"} {
+		RegisterNative(listClass, "<init>", methodDescriptor, construct)
+	}
+
+	RegisterNative(listClass, "size", "()I", func(call *NativeCall) (StackData, error) {
+		return list(call).Fields[listSize], nil
+	})
+	RegisterNative(listClass, "isEmpty", "()Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(list(call).Fields[listSize].Int() == 0), nil
+	})
+	RegisterNative(listClass, "get", "(I)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		elements, index := listContents(list(call)), int(call.Int(1))
+		if err := checkIndex(index, len(elements)); err != nil {
+			return StackData{}, err
+		}
+		return elements[index], nil
+	})
+	RegisterNative(listClass, "set", "(ILjava/lang/Object;)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		elements, index := listContents(list(call)), int(call.Int(1))
+		if err := checkIndex(index, len(elements)); err != nil {
+			return StackData{}, err
+		}
+		old := elements[index]
+		elements[index] = call.Args[2]
+		return old, nil
+	})
+	RegisterNative(listClass, "add", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		setListContents(list(call), append(listContents(list(call)), call.Args[1]))
+		return booleanValue(true), nil
+	})
+	RegisterNative(listClass, "add", "(ILjava/lang/Object;)V", func(call *NativeCall) (StackData, error) {
+		elements, index := listContents(list(call)), int(call.Int(1))
+		if index < 0 || index > len(elements) {
+			return StackData{}, indexOutOfBounds("Index: %d, Size: %d", index, len(elements))
+		}
+		setListContents(list(call), slices.Insert(elements, index, call.Args[2]))
+		return StackData{}, nil
+	})
+	RegisterNative(listClass, "addAll", "(Ljava/util/Collection;)Z", func(call *NativeCall) (StackData, error) {
+		added, err := call.Jvm.collectionElements(call.Args[1])
+		if err != nil {
+			return StackData{}, err
+		}
+		setListContents(list(call), append(listContents(list(call)), added...))
+		return booleanValue(len(added) > 0), nil
+	})
+	RegisterNative(listClass, "remove", "(I)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		elements, index := listContents(list(call)), int(call.Int(1))
+		if err := checkIndex(index, len(elements)); err != nil {
+			return StackData{}, err
+		}
+		old := elements[index]
+		setListContents(list(call), slices.Delete(elements, index, index+1))
+		return old, nil
+	})
+	RegisterNative(listClass, "remove", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		elements := listContents(list(call))
+		index, err := call.Jvm.indexOfElement(elements, call.Args[1])
+		if err != nil || index < 0 {
+			return booleanValue(false), err
+		}
+		setListContents(list(call), slices.Delete(elements, index, index+1))
+		return booleanValue(true), nil
+	})
+	RegisterNative(listClass, "clear", "()V", func(call *NativeCall) (StackData, error) {
+		setListContents(list(call), nil)
+		return StackData{}, nil
+	})
+	RegisterNative(listClass, "indexOf", "(Ljava/lang/Object;)I", func(call *NativeCall) (StackData, error) {
+		index, err := call.Jvm.indexOfElement(listContents(list(call)), call.Args[1])
+		return intValue(int32(index)), err
+	})
+	RegisterNative(listClass, "lastIndexOf", "(Ljava/lang/Object;)I", func(call *NativeCall) (StackData, error) {
+		elements := listContents(list(call))
+		for i := len(elements) - 1; i >= 0; i-- {
+			if equal, err := call.Jvm.javaEquals(call.Args[1], elements[i]); err != nil || equal {
+				return intValue(int32(i)), err
+			}
+		}
+		return intValue(-1), nil
+	})
+	RegisterNative(listClass, "contains", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		index, err := call.Jvm.indexOfElement(listContents(list(call)), call.Args[1])
+		return booleanValue(index >= 0), err
+	})
+	RegisterNative(listClass, "toArray", "()[Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		elements := listContents(list(call))
+		array := NewArray("[Ljava/lang/Object;", len(elements))
+		copy(array.Elements, elements)
+		return referenceValue(array), nil
+	})
+	RegisterNative(listClass, "iterator", "()Ljava/util/Iterator;", func(call *NativeCall) (StackData, error) {
+		iterator, err := call.Jvm.libraryObject("java/util/ArrayList$Itr")
+		if err != nil {
+			return StackData{}, err
+		}
+		iterator.Fields[itrList] = call.Args[0]
+		iterator.Fields[itrLastRet] = intValue(-1)
+		return referenceValue(iterator), nil
+	})
+	RegisterNative(listClass, "forEach", "(Ljava/util/function/Consumer;)V", func(call *NativeCall) (StackData, error) {
+		for _, element := range slices.Clone(listContents(list(call))) {
+			if _, err := call.Jvm.applyFunction(call.Args[1], "java/util/function/Consumer", "accept", "(Ljava/lang/Object;)V", element); err != nil {
+				return StackData{}, err
+			}
+		}
+		return StackData{}, nil
+	})
+	RegisterNative(listClass, "sort", "(Ljava/util/Comparator;)V", func(call *NativeCall) (StackData, error) {
+		// Stable, like the TimSort of the JDK
+		var err error
+		slices.SortStableFunc(listContents(list(call)), func(a, b StackData) int {
+			if err != nil {
+				return 0
+			}
+			var result int32
+			result, err = call.Jvm.compareElements(call.Args[1], a, b)
+			return int(result)
+		})
+		return StackData{}, err
+	})
+	RegisterNative(listClass, "clone", "()Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		// The copy has its own elements
+		clone := &Object{Class: list(call).Class, Fields: maps.Clone(list(call).Fields)}
+		clone.Fields[listElements] = nullReference
+		setListContents(clone, slices.Clone(listContents(list(call))))
+		return referenceValue(clone), nil
+	})
+	RegisterNative(listClass, "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return call.Jvm.collectionString(call.Args[0], listContents(list(call)))
+	})
+	RegisterNative(listClass, "equals", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		if sameReference(call.Args[0], call.Args[1]) {
+			return booleanValue(true), nil
+		}
+		if !call.Jvm.isInstance(call.Args[1], "java/util/List") {
+			return booleanValue(false), nil
+		}
+		elements := listContents(list(call))
+		others, err := call.Jvm.collectionElements(call.Args[1])
+		if err != nil || len(elements) != len(others) {
+			return booleanValue(false), err
+		}
+		for i := range elements {
+			if equal, err := call.Jvm.javaEquals(elements[i], others[i]); err != nil || !equal {
+				return booleanValue(false), err
+			}
+		}
+		return booleanValue(true), nil
+	})
+	RegisterNative(listClass, "hashCode", "()I", func(call *NativeCall) (StackData, error) {
+		hash := int32(1)
+		for _, element := range listContents(list(call)) {
+			elementHash, err := call.Jvm.javaHashCode(element)
+			if err != nil {
+				return StackData{}, err
+			}
+			hash = 31*hash + elementHash
+		}
+		return intValue(hash), nil
+	})
+
+	const itrClass = "java/util/ArrayList$Itr"
+	RegisterNative(itrClass, "hasNext", "()Z", func(call *NativeCall) (StackData, error) {
+		iterator := call.Object(0)
+		return booleanValue(iterator.Fields[itrCursor].Int() < iterator.Fields[itrList].Data.(*Object).Fields[listSize].Int()), nil
+	})
+	RegisterNative(itrClass, "next", "()Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		iterator := call.Object(0)
+		elements := listContents(iterator.Fields[itrList].Data.(*Object))
+		cursor := iterator.Fields[itrCursor].Int()
+		if int(cursor) >= len(elements) {
+			return StackData{}, throwable("java/util/NoSuchElementException", "")
+		}
+		iterator.Fields[itrCursor] = intValue(cursor + 1)
+		iterator.Fields[itrLastRet] = intValue(cursor)
+		return elements[cursor], nil
+	})
+	RegisterNative(itrClass, "remove", "()V", func(call *NativeCall) (StackData, error) {
+		iterator := call.Object(0)
+		lastRet := int(iterator.Fields[itrLastRet].Int())
+		if lastRet < 0 {
+			return StackData{}, throwable("java/lang/IllegalStateException", "")
+		}
+		owner := iterator.Fields[itrList].Data.(*Object)
+		setListContents(owner, slices.Delete(listContents(owner), lastRet, lastRet+1))
+		iterator.Fields[itrCursor] = intValue(int32(lastRet))
+		iterator.Fields[itrLastRet] = intValue(-1)
+		return StackData{}, nil
+	})
+}
@@ -0,0 +1,124 @@
+package jvm
+
+import "github.com/Stolkerve/go-jvm/jvm/descriptor"
+
+// The threads of the vm run one at a time and only switch while holding no
+// value of the heap in a register: when one blocks or reaches a safepoint,
+// releasing the lock of the vm which the next one acquires. Every write a
+// thread makes before it releases the lock happens before every read
+// another thread makes after acquiring it, so the program sees its memory
+// as if its accesses were interleaved in some total order. That is stronger
+// than the Java Memory Model requires of volatile fields, of the final
+// fields a constructor froze and of the atomic operations of Unsafe, which
+// need no fence of their own and are all plain accesses. A compare and set
+// only has to compare and set without reaching a safepoint in between
+
+// atomicClasses are the classes of java.util.concurrent.atomic the embedded
+// class library implements, keyed by name with the descriptor of their
+// value field
+var atomicClasses = map[string]string{
+	"java/util/concurrent/atomic/AtomicInteger":   "I",
+	"java/util/concurrent/atomic/AtomicLong":      "J",
+	"java/util/concurrent/atomic/AtomicBoolean":   "Z",
+	"java/util/concurrent/atomic/AtomicReference": "Ljava/lang/Object;",
+}
+
+// compareAndSet sets the value of a field to update if it is expect,
+// comparing references by identity and primitives by value, and returns
+// the value it found
+func compareAndSet(object *Object, key string, expect, update StackData) StackData {
+	witness := object.Fields[key]
+	if sameReference(witness, expect) {
+		object.Fields[key] = update
+	}
+	return witness
+}
+
+func init() {
+	for class, valueDescriptor := range atomicClasses {
+		valueKey := class + ".value"
+		value := func(call *NativeCall) StackData {
+			return call.Object(0).Fields[valueKey]
+		}
+		RegisterNative(class, "<init>", "()V", func(call *NativeCall) (StackData, error) {
+			call.Object(0).Fields[valueKey] = zeroValue(valueDescriptor)
+			return StackData{}, nil
+		})
+		RegisterNative(class, "<init>", "("+valueDescriptor+")V", func(call *NativeCall) (StackData, error) {
+			call.Object(0).Fields[valueKey] = call.Args[1]
+			return StackData{}, nil
+		})
+		// The memory orders of the plain, opaque, acquire and release
+		// accesses are the volatile one
+		for _, name := range []string{"get", "getPlain", "getOpaque", "getAcquire"} {
+			RegisterNative(class, name, "()"+valueDescriptor, func(call *NativeCall) (StackData, error) {
+				return value(call), nil
+			})
+		}
+		for _, name := range []string{"set", "lazySet", "setPlain", "setOpaque", "setRelease"} {
+			RegisterNative(class, name, "("+valueDescriptor+")V", func(call *NativeCall) (StackData, error) {
+				call.Object(0).Fields[valueKey] = call.Args[1]
+				return StackData{}, nil
+			})
+		}
+		RegisterNative(class, "getAndSet", "("+valueDescriptor+")"+valueDescriptor, func(call *NativeCall) (StackData, error) {
+			old := value(call)
+			call.Object(0).Fields[valueKey] = call.Args[1]
+			return old, nil
+		})
+		casDescriptor := "(" + valueDescriptor + valueDescriptor + ")"
+		for _, name := range []string{"compareAndSet", "weakCompareAndSet", "weakCompareAndSetPlain", "weakCompareAndSetVolatile", "weakCompareAndSetAcquire", "weakCompareAndSetRelease"} {
+			RegisterNative(class, name, casDescriptor+"Z", func(call *NativeCall) (StackData, error) {
+				witness := compareAndSet(call.Object(0), valueKey, call.Args[1], call.Args[2])
+				return booleanValue(sameReference(witness, call.Args[1])), nil
+			})
+		}
+		for _, name := range []string{"compareAndExchange", "compareAndExchangeAcquire", "compareAndExchangeRelease"} {
+			RegisterNative(class, name, casDescriptor+valueDescriptor, func(call *NativeCall) (StackData, error) {
+				return compareAndSet(call.Object(0), valueKey, call.Args[1], call.Args[2]), nil
+			})
+		}
+		valueType, _ := descriptor.ParseField(valueDescriptor)
+		RegisterNative(class, "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+			s, err := call.Jvm.javaString(value(call), valueType)
+			return referenceValue(NewString(s)), err
+		})
+		if valueType != descriptor.Int && valueType != descriptor.Long {
+			continue
+		}
+
+		// The arithmetic of AtomicInteger and AtomicLong wraps around
+		one, minusOne := convertNumber(intValue(1), valueType.(descriptor.BaseType)), convertNumber(intValue(-1), valueType.(descriptor.BaseType))
+		increment := func(*NativeCall) StackData { return one }
+		decrement := func(*NativeCall) StackData { return minusOne }
+		argument := func(call *NativeCall) StackData { return call.Args[1] }
+		add := func(a, b StackData) StackData {
+			if valueType == descriptor.Int {
+				return intValue(a.Int() + b.Int())
+			}
+			return longValue(a.Long() + b.Long())
+		}
+		update := func(name, parameters string, delta func(call *NativeCall) StackData, returnsOld bool) {
+			RegisterNative(class, name, parameters+valueDescriptor, func(call *NativeCall) (StackData, error) {
+				old := value(call)
+				updated := add(old, delta(call))
+				call.Object(0).Fields[valueKey] = updated
+				if returnsOld {
+					return old, nil
+				}
+				return updated, nil
+			})
+		}
+		update("getAndIncrement", "()", increment, true)
+		update("getAndDecrement", "()", decrement, true)
+		update("getAndAdd", "("+valueDescriptor+")", argument, true)
+		update("incrementAndGet", "()", increment, false)
+		update("decrementAndGet", "()", decrement, false)
+		update("addAndGet", "("+valueDescriptor+")", argument, false)
+		for _, number := range []descriptor.BaseType{descriptor.Int, descriptor.Long, descriptor.Float, descriptor.Double} {
+			RegisterNative(class, number.String()+"Value", "()"+number.Descriptor(), func(call *NativeCall) (StackData, error) {
+				return convertNumber(value(call), number), nil
+			})
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package jvm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Litmus tests of the memory model atomic.go describes. Each one runs
+// threads sharing the static fields of a class named Shared, then prints
+// the fields holding what they saw
+
+// litmusRuns is how many times each litmus test runs
+const litmusRuns = 20
+
+// branch writes a branch instruction jumping to the instruction at target
+func branch(c *codeBuilder, op Opcode, target int) {
+	c.op(op, int16(target-c.code.Len()))
+}
+
+// runnable generates a class implementing Runnable whose run method runs
+// the code written by body
+func runnable(name string, maxStack, maxLocals uint16, body func(c *codeBuilder)) *classBuilder {
+	class := newClassBuilder(name, "java/lang/Object", AccSuper)
+	class.interfaces = []string{"java/lang/Runnable"}
+	init := class.addMethod(AccPublic, "<init>", "()V")
+	init.maxStack, init.maxLocals = 1, 1
+	init.op(OpAload0)
+	init.op(OpInvokespecial, class.methodRef("java/lang/Object", "<init>", "()V", false))
+	init.op(OpReturn)
+	run := class.addMethod(AccPublic, "run", "()V")
+	run.maxStack, run.maxLocals = maxStack, maxLocals
+	body(run)
+	run.op(OpReturn)
+	return class
+}
+
+// sharedInt writes an access to the int field of Shared
+func sharedInt(c *codeBuilder, op Opcode, name string) {
+	c.op(op, c.class.fieldRef("Shared", name, "I"))
+}
+
+// sharedResult pushes the int field of Shared holding a result
+func sharedResult(name string) func(c *codeBuilder) {
+	return func(c *codeBuilder) { sharedInt(c, OpGetstatic, name) }
+}
+
+// runLitmus runs the threads of the given Runnable classes until they all
+// end, and returns the ints the code written by results pushes, separated
+// by spaces
+func runLitmus(t *testing.T, classes []*classBuilder, threads []string, results ...func(c *codeBuilder)) string {
+	t.Helper()
+	path := buildProgram(t, func(p programBuilder) {
+		for i, thread := range threads {
+			p.op(OpNew, p.class.class("java/lang/Thread"))
+			p.op(OpDup)
+			p.newObject(thread)
+			p.op(OpInvokespecial, p.class.methodRef("java/lang/Thread", "<init>", "(Ljava/lang/Runnable;)V", false))
+			p.op(OpDup)
+			p.op(OpAstore, uint8(i+1))
+			p.invoke(false, "java/lang/Thread", "start", "()V")
+		}
+		for i := range threads {
+			p.op(OpAload, uint8(i+1))
+			p.invoke(false, "java/lang/Thread", "join", "()V")
+		}
+		for _, result := range results {
+			p.println("(I)V", func() { result(p.codeBuilder) })
+		}
+	}, classes...)
+	stdout, stderr := runProgram(t, path)
+	if stderr != "" {
+		t.Fatalf("stderr = %q", stderr)
+	}
+	stdout, ok := strings.CutPrefix(stdout, "Running main function code\n")
+	if !ok {
+		t.Fatalf("stdout = %q", stdout)
+	}
+	return strings.Join(strings.Fields(stdout), " ")
+}
+
+// sharedClass generates the Shared class with the given int fields
+func sharedClass(fields ...string) *classBuilder {
+	shared := newClassBuilder("Shared", "java/lang/Object", AccSuper)
+	for _, field := range fields {
+		shared.addField(AccStatic, field, "I")
+	}
+	return shared
+}
+
+// checkOutcomes runs a litmus test litmusRuns times and fails when an
+// outcome is not one of allowed
+func checkOutcomes(t *testing.T, allowed []string, run func() string) {
+	t.Helper()
+	seen := map[string]int{}
+	for range litmusRuns {
+		outcome := run()
+		if !slices.Contains(allowed, outcome) {
+			t.Fatalf("outcome %q, allowed %q", outcome, allowed)
+		}
+		seen[outcome]++
+	}
+	t.Log(seen)
+}
+
+func TestStoreBuffering(t *testing.T) {
+	// volatile int x, y; int r1, r2
+	shared := sharedClass("r1", "r2")
+	shared.addField(AccStatic|AccVolatile, "x", "I")
+	shared.addField(AccStatic|AccVolatile, "y", "I")
+	// x = 1; Thread.yield(); r1 = y, and the other way around
+	storeLoad := func(name, store, load, result string) *classBuilder {
+		return runnable(name, 1, 1, func(c *codeBuilder) {
+			c.op(OpIconst1)
+			sharedInt(c, OpPutstatic, store)
+			c.op(OpInvokestatic, c.class.methodRef("java/lang/Thread", "yield", "()V", false))
+			sharedInt(c, OpGetstatic, load)
+			sharedInt(c, OpPutstatic, result)
+		})
+	}
+	classes := []*classBuilder{shared, storeLoad("T1", "x", "y", "r1"), storeLoad("T2", "y", "x", "r2")}
+	// Both threads reading 0 needs a store to be reordered after a load
+	checkOutcomes(t, []string{"0 1", "1 0", "1 1"}, func() string {
+		return runLitmus(t, classes, []string{"T1", "T2"}, sharedResult("r1"), sharedResult("r2"))
+	})
+}
+
+func TestMessagePassing(t *testing.T) {
+	// int data, r; volatile int flag
+	shared := sharedClass("data", "r")
+	shared.addField(AccStatic|AccVolatile, "flag", "I")
+	// data = 42; flag = 1
+	writer := runnable("Writer", 1, 1, func(c *codeBuilder) {
+		c.op(OpBipush, int8(42))
+		sharedInt(c, OpPutstatic, "data")
+		c.op(OpIconst1)
+		sharedInt(c, OpPutstatic, "flag")
+	})
+	// while (flag == 0); r = data
+	reader := runnable("Reader", 1, 1, func(c *codeBuilder) {
+		loop := c.code.Len()
+		sharedInt(c, OpGetstatic, "flag")
+		branch(c, OpIfeq, loop)
+		sharedInt(c, OpGetstatic, "data")
+		sharedInt(c, OpPutstatic, "r")
+	})
+	classes := []*classBuilder{shared, writer, reader}
+	// The reader seeing the flag sees the data written before it
+	checkOutcomes(t, []string{"42"}, func() string {
+		return runLitmus(t, classes, []string{"Reader", "Writer"}, sharedResult("r"))
+	})
+}
+
+func TestCompareAndSetCounter(t *testing.T) {
+	const threads, increments = 3, 1000
+	atomicInteger := "java/util/concurrent/atomic/AtomicInteger"
+	// static AtomicInteger counter = new AtomicInteger()
+	shared := sharedClass()
+	shared.addField(AccStatic, "counter", "L"+atomicInteger+";")
+	clinit := shared.addMethod(AccStatic, "<clinit>", "()V")
+	clinit.maxStack = 2
+	clinit.op(OpNew, shared.class(atomicInteger))
+	clinit.op(OpDup)
+	clinit.op(OpInvokespecial, shared.methodRef(atomicInteger, "<init>", "()V", false))
+	clinit.op(OpPutstatic, shared.fieldRef("Shared", "counter", "L"+atomicInteger+";"))
+	clinit.op(OpReturn)
+
+	classes := []*classBuilder{shared}
+	var names []string
+	for i := range threads {
+		name := fmt.Sprintf("Incrementer%d", i)
+		names = append(names, name)
+		// for (int i = increments; i != 0; i--) {
+		//     int v;
+		//     do v = counter.get(); while (!counter.compareAndSet(v, v + 1));
+		// }
+		classes = append(classes, runnable(name, 4, 3, func(c *codeBuilder) {
+			counter := c.class.fieldRef("Shared", "counter", "L"+atomicInteger+";")
+			c.op(OpSipush, int16(increments))
+			c.op(OpIstore1)
+			loop := c.code.Len()
+			c.op(OpGetstatic, counter)
+			c.op(OpInvokevirtual, c.class.methodRef(atomicInteger, "get", "()I", false))
+			c.op(OpIstore2)
+			c.op(OpGetstatic, counter)
+			c.op(OpIload2)
+			c.op(OpIload2)
+			c.op(OpIconst1)
+			c.op(OpIadd)
+			c.op(OpInvokevirtual, c.class.methodRef(atomicInteger, "compareAndSet", "(II)Z", false))
+			branch(c, OpIfeq, loop)
+			c.op(OpIinc, uint8(1), int8(-1))
+			c.op(OpIload1)
+			branch(c, OpIfne, loop)
+		}))
+	}
+	// counter.get(), once the threads ended
+	count := func(c *codeBuilder) {
+		c.op(OpGetstatic, c.class.fieldRef("Shared", "counter", "L"+atomicInteger+";"))
+		c.op(OpInvokevirtual, c.class.methodRef(atomicInteger, "get", "()I", false))
+	}
+	// No increment is lost
+	checkOutcomes(t, []string{fmt.Sprint(threads * increments)}, func() string {
+		return runLitmus(t, classes, names, count)
+	})
+}
+
+func TestFinalFieldPublication(t *testing.T) {
+	// class Holder { final int x; Holder() { x = 42; } }
+	holder := newClassBuilder("Holder", "java/lang/Object", AccSuper)
+	holder.addField(AccFinal, "x", "I")
+	init := holder.addMethod(AccPublic, "<init>", "()V")
+	init.maxStack, init.maxLocals = 2, 1
+	init.op(OpAload0)
+	init.op(OpInvokespecial, holder.methodRef("java/lang/Object", "<init>", "()V", false))
+	init.op(OpAload0)
+	init.op(OpBipush, int8(42))
+	init.op(OpPutfield, holder.fieldRef("Holder", "x", "I"))
+	init.op(OpReturn)
+
+	// static Holder holder, published without synchronization; int r
+	shared := sharedClass("r")
+	shared.addField(AccStatic, "holder", "LHolder;")
+	sharedHolder := func(c *codeBuilder, op Opcode) {
+		c.op(op, c.class.fieldRef("Shared", "holder", "LHolder;"))
+	}
+	// holder = new Holder()
+	publisher := runnable("Publisher", 2, 1, func(c *codeBuilder) {
+		c.op(OpNew, c.class.class("Holder"))
+		c.op(OpDup)
+		c.op(OpInvokespecial, c.class.methodRef("Holder", "<init>", "()V", false))
+		sharedHolder(c, OpPutstatic)
+	})
+	// Holder h; while ((h = holder) == null); r = h.x
+	reader := runnable("Reader", 1, 2, func(c *codeBuilder) {
+		loop := c.code.Len()
+		sharedHolder(c, OpGetstatic)
+		c.op(OpAstore1)
+		c.op(OpAload1)
+		branch(c, OpIfnull, loop)
+		c.op(OpAload1)
+		c.op(OpGetfield, c.class.fieldRef("Holder", "x", "I"))
+		sharedInt(c, OpPutstatic, "r")
+	})
+	classes := []*classBuilder{holder, shared, publisher, reader}
+	// A thread seeing the object sees its final field as the constructor
+	// left it
+	checkOutcomes(t, []string{"42"}, func() string {
+		return runLitmus(t, classes, []string{"Reader", "Publisher"}, sharedResult("r"))
+	})
+}
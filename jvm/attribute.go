@@ -31,6 +31,16 @@ const (
 	RuntimeInvisibleParameterAnnotationsAttr AttributeType = "RuntimeInvisibleParameterAnnotations"
 	AnnotationDefaultAttr                    AttributeType = "AnnotationDefault"
 	BootstrapMethodsAttr                     AttributeType = "BootstrapMethods"
+	RuntimeVisibleTypeAnnotationsAttr        AttributeType = "RuntimeVisibleTypeAnnotations"
+	RuntimeInvisibleTypeAnnotationsAttr      AttributeType = "RuntimeInvisibleTypeAnnotations"
+	MethodParametersAttr                     AttributeType = "MethodParameters"
+	ModuleAttr                               AttributeType = "Module"
+	ModulePackagesAttr                       AttributeType = "ModulePackages"
+	ModuleMainClassAttr                      AttributeType = "ModuleMainClass"
+	NestHostAttr                             AttributeType = "NestHost"
+	NestMembersAttr                          AttributeType = "NestMembers"
+	RecordAttr                               AttributeType = "Record"
+	PermittedSubclassesAttr                  AttributeType = "PermittedSubclasses"
 )
 
 func IsAttributeType(attr AttributeType) bool {
@@ -75,23 +85,72 @@ func IsAttributeType(attr AttributeType) bool {
 		return true
 	case SyntheticAttr:
 		return true
+	case RuntimeVisibleTypeAnnotationsAttr:
+		return true
+	case RuntimeInvisibleTypeAnnotationsAttr:
+		return true
+	case MethodParametersAttr:
+		return true
+	case ModuleAttr:
+		return true
+	case ModulePackagesAttr:
+		return true
+	case ModuleMainClassAttr:
+		return true
+	case NestHostAttr:
+		return true
+	case NestMembersAttr:
+		return true
+	case RecordAttr:
+		return true
+	case PermittedSubclassesAttr:
+		return true
 	default:
 		return false
 	}
 }
 
+type ExceptionTableEntry struct {
+	StartPc   uint16
+	EndPc     uint16
+	HandlerPc uint16
+	CatchType uint16
+}
+
 type CodeAttribute struct {
 	MaxStack        uint16
 	MaxLocals       uint16
 	CodeLength      uint32
 	Code            []byte
-	ExceptionsTable []struct {
-		StartPc   uint16
-		EndPc     uint16
-		HandlerPc uint16
-		CatchType uint16
+	ExceptionsTable []ExceptionTableEntry
+	Attributes      []*AttributeInfo
+}
+
+// StackMapTable returns the frames of the code, nil if it has none
+func (c *CodeAttribute) StackMapTable() StackMapTableAttribute {
+	for _, attr := range c.Attributes {
+		if attr.AttributeType == StackMapTableAttr {
+			return attr.Data.(StackMapTableAttribute)
+		}
+	}
+	return nil
+}
+
+// LineNumber returns the source line of the instruction at pc, -1 if the
+// code has no line numbers
+func (c *CodeAttribute) LineNumber(pc int) int {
+	line, start := -1, -1
+	for _, attr := range c.Attributes {
+		if attr.AttributeType != LineNumberTableAttr {
+			continue
+		}
+		for _, entry := range attr.Data.(LineNumberTableAttribute) {
+			if int(entry.StartPc) <= pc && int(entry.StartPc) > start {
+				line, start = int(entry.LineNumber), int(entry.StartPc)
+			}
+		}
 	}
-	Attributes []*AttributeInfo
+	return line
 }
 
 type SourceFileAttribute struct {
@@ -99,6 +158,83 @@ type SourceFileAttribute struct {
 	Sourcefile      string
 }
 
+type ExceptionsAttribute struct {
+	ExceptionIndexTable []uint16
+	// Internal names of the checked exceptions
+	Exceptions []string
+}
+
+type InnerClassEntry struct {
+	InnerClassInfoIndex uint16
+	InnerClass          string
+	// Zero, with an empty OuterClass, for local and anonymous classes
+	OuterClassInfoIndex uint16
+	OuterClass          string
+	// Zero, with an empty InnerName, for anonymous classes
+	InnerNameIndex        uint16
+	InnerName             string
+	InnerClassAccessFlags AccessFlag
+}
+
+type InnerClassesAttribute []InnerClassEntry
+
+type EnclosingMethodAttribute struct {
+	ClassIndex uint16
+	Class      string
+	// Zero, with an empty name and descriptor, when the class is not
+	// enclosed by a method or constructor
+	MethodIndex      uint16
+	MethodName       string
+	MethodDescriptor string
+}
+
+type ConstantValueAttribute struct {
+	ConstantValueIndex uint16
+	// ConstantInteger, ConstantLong, ConstantFloat, ConstantDouble or the
+	// string itself for String constants
+	Value interface{}
+}
+
+type SourceDebugExtensionAttribute struct {
+	// Usually a JSR-45 SMAP
+	DebugExtension string
+}
+
+type BootstrapMethod struct {
+	// Index of the ConstantMethodHandle of the bootstrap method
+	BootstrapMethodRef uint16
+	// Indexes of the static arguments passed to the bootstrap method
+	BootstrapArguments []uint16
+}
+
+type BootstrapMethodsAttribute []BootstrapMethod
+
+type MethodParameter struct {
+	// Zero, with an empty Name, for a parameter without a name
+	NameIndex   uint16
+	Name        string
+	AccessFlags AccessFlag
+}
+
+type MethodParametersAttribute []MethodParameter
+
+type NestHostAttribute struct {
+	HostClassIndex uint16
+	HostClass      string
+}
+
+// ClassListAttribute is the body shared by the attributes made of a list of
+// ConstantClass indexes, NestMembers and PermittedSubclasses
+type ClassListAttribute struct {
+	ClassIndexes []uint16
+	Classes      []string
+}
+
+type SignatureAttribute struct {
+	SignatureIndex uint16
+	Signature      string
+}
+
 type AttributeInfo struct {
 	AttributeNameIndex uint16
 	AttributeType      AttributeType
@@ -129,13 +265,23 @@ func ReadAttribute(constantPool []*ConstantInfo, javaClassFile *bufio.Reader, re
 	}
 	attributeLength := binary.BigEndian.Uint32(readBuffer)
 	info := make([]byte, attributeLength)
-	if _, err := javaClassFile.Read(info); err != nil {
+	if err := ReadSection(javaClassFile, info); err != nil {
 		return nil, err
 	}
 
 	switch attribute.AttributeType {
 	case AnnotationDefaultAttr:
+		annotationDefault, err := ReadAnnotationDefault(constantPool, info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = annotationDefault
 	case BootstrapMethodsAttr:
+		bootstrapMethods, err := readBootstrapMethods(info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = bootstrapMethods
 	case CodeAttr:
 		codeAttr := CodeAttribute{}
 		codeAttr.MaxStack = binary.BigEndian.Uint16(info)
@@ -145,7 +291,17 @@ func ReadAttribute(constantPool []*ConstantInfo, javaClassFile *bufio.Reader, re
 
 		offset := 8 + codeAttr.CodeLength
 		exceptionTableLength := binary.BigEndian.Uint16(info[offset:])
-		offset += 2 + (uint32(exceptionTableLength) * 8)
+		offset += 2
+		codeAttr.ExceptionsTable = make([]ExceptionTableEntry, exceptionTableLength)
+		for i := range exceptionTableLength {
+			codeAttr.ExceptionsTable[i] = ExceptionTableEntry{
+				StartPc:   binary.BigEndian.Uint16(info[offset:]),
+				EndPc:     binary.BigEndian.Uint16(info[offset+2:]),
+				HandlerPc: binary.BigEndian.Uint16(info[offset+4:]),
+				CatchType: binary.BigEndian.Uint16(info[offset+6:]),
+			}
+			offset += 8
+		}
 		attributesCount := binary.BigEndian.Uint16(info[offset:])
 		offset += 2
 
@@ -157,14 +313,87 @@ func ReadAttribute(constantPool []*ConstantInfo, javaClassFile *bufio.Reader, re
 				return nil, err
 			}
 			codeAttr.Attributes[i] = attr
+			// Skip the name index, the length and the attribute itself
+			offset += 6 + binary.BigEndian.Uint32(info[offset+2:])
 		}
 
 		attribute.Data = codeAttr
 	case ConstantValueAttr:
+		constantValueAttr, err := readConstantValue(constantPool, info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = constantValueAttr
 	case DeprecatedAttr:
 	case EnclosingMethodAttr:
+		r := &attributeReader{info: info}
+		enclosingMethodAttr := EnclosingMethodAttribute{}
+		var err error
+		if enclosingMethodAttr.ClassIndex, err = r.u2(); err != nil {
+			return nil, err
+		}
+		if enclosingMethodAttr.MethodIndex, err = r.u2(); err != nil {
+			return nil, err
+		}
+		enclosingMethodAttr.Class = GetClassName(constantPool, enclosingMethodAttr.ClassIndex)
+		if enclosingMethodAttr.MethodIndex != 0 {
+			enclosingMethodAttr.MethodName, enclosingMethodAttr.MethodDescriptor = GetNameAndType(constantPool, enclosingMethodAttr.MethodIndex)
+		}
+		attribute.Data = enclosingMethodAttr
 	case ExceptionsAttr:
+		indexes, exceptions, err := readIndexes(constantPool, &attributeReader{info: info}, GetClassName)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = ExceptionsAttribute{ExceptionIndexTable: indexes, Exceptions: exceptions}
 	case InnerClassesAttr:
+		innerClasses, err := readInnerClasses(constantPool, info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = innerClasses
+	case MethodParametersAttr:
+		methodParameters, err := readMethodParameters(constantPool, info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = methodParameters
+	case ModuleAttr:
+		module, err := ReadModule(constantPool, info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = module
+	case ModulePackagesAttr:
+		indexes, packages, err := readIndexes(constantPool, &attributeReader{info: info}, GetPackageName)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = ModulePackagesAttribute{PackageIndexes: indexes, Packages: packages}
+	case ModuleMainClassAttr:
+		index, err := (&attributeReader{info: info}).u2()
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = ModuleMainClassAttribute{MainClassIndex: index, MainClass: GetClassName(constantPool, index)}
+	case NestHostAttr:
+		index, err := (&attributeReader{info: info}).u2()
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = NestHostAttribute{HostClassIndex: index, HostClass: GetClassName(constantPool, index)}
+	case NestMembersAttr, PermittedSubclassesAttr:
+		indexes, classes, err := readIndexes(constantPool, &attributeReader{info: info}, GetClassName)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = ClassListAttribute{ClassIndexes: indexes, Classes: classes}
+	case RecordAttr:
+		record, err := ReadRecord(constantPool, info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = record
 	case LineNumberTableAttr:
 		lenght := binary.BigEndian.Uint16(info)
 		lineNumberTable := make(LineNumberTableAttribute, lenght)
@@ -178,20 +407,160 @@ func ReadAttribute(constantPool []*ConstantInfo, javaClassFile *bufio.Reader, re
 		attribute.Data = lineNumberTable
 	case LocalVariableTableAttr:
 	case LocalVariableTypeTableAttr:
-	case RuntimeInvisibleAnnotationsAttr:
-	case RuntimeInvisibleParameterAnnotationsAttr:
-	case RuntimeVisibleAnnotationsAttr:
-	case RuntimeVisibleParameterAnnotationsAttr:
+	case RuntimeInvisibleAnnotationsAttr, RuntimeVisibleAnnotationsAttr:
+		annotations, err := ReadRuntimeAnnotations(constantPool, info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = annotations
+	case RuntimeInvisibleParameterAnnotationsAttr, RuntimeVisibleParameterAnnotationsAttr:
+		parameterAnnotations, err := ReadParameterAnnotations(constantPool, info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = parameterAnnotations
+	case RuntimeInvisibleTypeAnnotationsAttr, RuntimeVisibleTypeAnnotationsAttr:
+		typeAnnotations, err := ReadRuntimeTypeAnnotations(constantPool, info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = typeAnnotations
 	case SignatureAttr:
+		signatureAttr := SignatureAttribute{}
+		signatureAttr.SignatureIndex = binary.BigEndian.Uint16(info)
+		signatureAttr.Signature = constantPool[signatureAttr.SignatureIndex-1].Data.(ConstantUtf8)
+		attribute.Data = signatureAttr
 	case SourceDebugExtensionAttr:
+		attribute.Data = SourceDebugExtensionAttribute{DebugExtension: string(info)}
 	case SourceFileAttr:
 		sourceAttr := SourceFileAttribute{}
 		sourceAttr.SourcefileIndex = binary.BigEndian.Uint16(info)
 		sourceAttr.Sourcefile = constantPool[sourceAttr.SourcefileIndex-1].Data.(ConstantUtf8)
 		attribute.Data = sourceAttr
 	case StackMapTableAttr:
+		stackMapTable, err := ReadStackMapTable(info)
+		if err != nil {
+			return nil, err
+		}
+		attribute.Data = stackMapTable
 	case SyntheticAttr:
 	}
 
 	return &attribute, nil
 }
+
+func readConstantValue(constantPool []*ConstantInfo, info []byte) (ConstantValueAttribute, error) {
+	r := &attributeReader{info: info}
+	constantValueAttr := ConstantValueAttribute{}
+	var err error
+	if constantValueAttr.ConstantValueIndex, err = r.u2(); err != nil {
+		return constantValueAttr, err
+	}
+	index := constantValueAttr.ConstantValueIndex
+	if index == 0 || int(index) > len(constantPool) || constantPool[index-1] == nil {
+		return constantValueAttr, fmt.Errorf("invalid ConstantValue index %d", index)
+	}
+	constant := constantPool[index-1]
+	switch constant.Tag {
+	case ConstantIntegerTag, ConstantLongTag, ConstantFloatTag, ConstantDoubleTag:
+		constantValueAttr.Value = constant.Data
+	case ConstantStringTag:
+		str, ok := constant.Data.(ConstantString)
+		if !ok || str.StringIndex == 0 || int(str.StringIndex) > len(constantPool) ||
+			constantPool[str.StringIndex-1] == nil || constantPool[str.StringIndex-1].Tag != ConstantUtf8Tag {
+			return constantValueAttr, fmt.Errorf("invalid ConstantValue string at index %d", index)
+		}
+		constantValueAttr.Value = constantPool[str.StringIndex-1].Data.(ConstantUtf8)
+	default:
+		return constantValueAttr, fmt.Errorf("invalid ConstantValue tag %s", constant.Tag)
+	}
+	return constantValueAttr, nil
+}
+
+func readInnerClasses(constantPool []*ConstantInfo, info []byte) (InnerClassesAttribute, error) {
+	r := &attributeReader{info: info}
+	count, err := r.u2()
+	if err != nil {
+		return nil, err
+	}
+	innerClasses := make(InnerClassesAttribute, count)
+	for i := range innerClasses {
+		innerClass := &innerClasses[i]
+		if innerClass.InnerClassInfoIndex, err = r.u2(); err != nil {
+			return nil, err
+		}
+		if innerClass.OuterClassInfoIndex, err = r.u2(); err != nil {
+			return nil, err
+		}
+		if innerClass.InnerNameIndex, err = r.u2(); err != nil {
+			return nil, err
+		}
+		flags, err := r.u2()
+		if err != nil {
+			return nil, err
+		}
+		innerClass.InnerClassAccessFlags = AccessFlag(flags)
+		innerClass.InnerClass = GetClassName(constantPool, innerClass.InnerClassInfoIndex)
+		innerClass.OuterClass = GetClassName(constantPool, innerClass.OuterClassInfoIndex)
+		innerClass.InnerName = GetUtf8(constantPool, innerClass.InnerNameIndex)
+	}
+	return innerClasses, nil
+}
+
+func readBootstrapMethods(info []byte) (BootstrapMethodsAttribute, error) {
+	r := &attributeReader{info: info}
+	count, err := r.u2()
+	if err != nil {
+		return nil, err
+	}
+	bootstrapMethods := make(BootstrapMethodsAttribute, count)
+	for i := range bootstrapMethods {
+		bootstrapMethod := &bootstrapMethods[i]
+		if bootstrapMethod.BootstrapMethodRef, err = r.u2(); err != nil {
+			return nil, err
+		}
+		argumentsCount, err := r.u2()
+		if err != nil {
+			return nil, err
+		}
+		bootstrapMethod.BootstrapArguments = make([]uint16, argumentsCount)
+		for j := range bootstrapMethod.BootstrapArguments {
+			if bootstrapMethod.BootstrapArguments[j], err = r.u2(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return bootstrapMethods, nil
+}
+
+func readMethodParameters(constantPool []*ConstantInfo, info []byte) (MethodParametersAttribute, error) {
+	r := &attributeReader{info: info}
+	count, err := r.u1()
+	if err != nil {
+		return nil, err
+	}
+	methodParameters := make(MethodParametersAttribute, count)
+	for i := range methodParameters {
+		parameter := &methodParameters[i]
+		if parameter.NameIndex, err = r.u2(); err != nil {
+			return nil, err
+		}
+		flags, err := r.u2()
+		if err != nil {
+			return nil, err
+		}
+		parameter.AccessFlags = AccessFlag(flags)
+		parameter.Name = GetUtf8(constantPool, parameter.NameIndex)
+	}
+	return methodParameters, nil
+}
+
+// FindAttribute returns the first attribute of the given type, nil if there is none
+func FindAttribute(attributes []*AttributeInfo, attributeType AttributeType) *AttributeInfo {
+	for _, attr := range attributes {
+		if attr.AttributeType == attributeType {
+			return attr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package jvm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// readTestAttribute reads an attribute named by the constant at nameIndex
+// with info as its body
+func readTestAttribute(constantPool []*ConstantInfo, nameIndex uint16, info ...byte) (*AttributeInfo, error) {
+	var attribute bytes.Buffer
+	binary.Write(&attribute, binary.BigEndian, nameIndex)
+	binary.Write(&attribute, binary.BigEndian, uint32(len(info)))
+	attribute.Write(info)
+	return ReadAttribute(constantPool, bufio.NewReader(&attribute), make([]byte, 4))
+}
+
+func TestReadAttributeErrors(t *testing.T) {
+	constantPool := []*ConstantInfo{
+		{Tag: ConstantUtf8Tag, Data: string(ConstantValueAttr)},
+		{Tag: ConstantUtf8Tag, Data: string(ExceptionsAttr)},
+		{Tag: ConstantUtf8Tag, Data: string(InnerClassesAttr)},
+		{Tag: ConstantUtf8Tag, Data: string(EnclosingMethodAttr)},
+		{Tag: ConstantIntegerTag, Data: ConstantInteger(42)},
+		// A String constant whose value is not a Utf8 constant
+		{Tag: ConstantStringTag, Data: ConstantString{StringIndex: 5}},
+		{Tag: ConstantUtf8Tag, Data: "hi"},
+		{Tag: ConstantStringTag, Data: ConstantString{StringIndex: 7}},
+		{Tag: ConstantUtf8Tag, Data: string(MethodParametersAttr)},
+		{Tag: ConstantUtf8Tag, Data: string(ModulePackagesAttr)},
+		{Tag: ConstantUtf8Tag, Data: string(ModuleMainClassAttr)},
+		{Tag: ConstantUtf8Tag, Data: string(NestHostAttr)},
+		{Tag: ConstantUtf8Tag, Data: string(NestMembersAttr)},
+		{Tag: ConstantUtf8Tag, Data: string(PermittedSubclassesAttr)},
+		{Tag: ConstantUtf8Tag, Data: string(BootstrapMethodsAttr)},
+	}
+	tests := []struct {
+		name      string
+		nameIndex uint16
+		info      []byte
+		want      string
+	}{
+		{"ConstantValue truncated", 1, []byte{0}, "truncated attribute"},
+		{"ConstantValue index 0", 1, []byte{0, 0}, "invalid ConstantValue index 0"},
+		{"ConstantValue index past the pool", 1, []byte{0, 99}, "invalid ConstantValue index 99"},
+		{"ConstantValue bad string", 1, []byte{0, 6}, "invalid ConstantValue string at index 6"},
+		{"ConstantValue bad tag", 1, []byte{0, 7}, "invalid ConstantValue tag ConstantUtf8"},
+		{"Exceptions count past the payload", 2, []byte{0, 2, 0, 1}, "truncated attribute"},
+		{"InnerClasses count past the payload", 3, []byte{0, 1, 0, 1, 0, 0}, "truncated attribute"},
+		{"EnclosingMethod truncated", 4, []byte{0, 1}, "truncated attribute"},
+		{"MethodParameters empty", 9, nil, "truncated attribute"},
+		{"MethodParameters count past the payload", 9, []byte{2, 0, 7, 0, 0}, "truncated attribute"},
+		{"ModulePackages count past the payload", 10, []byte{0, 1}, "truncated attribute"},
+		{"ModuleMainClass empty", 11, nil, "truncated attribute"},
+		{"NestHost truncated", 12, []byte{0}, "truncated attribute"},
+		{"NestMembers empty", 13, nil, "truncated attribute"},
+		{"PermittedSubclasses count past the payload", 14, []byte{0, 2, 0, 1}, "truncated attribute"},
+		{"BootstrapMethods empty", 15, nil, "truncated attribute"},
+		{"BootstrapMethods count past the payload", 15, []byte{0, 2, 0, 1, 0, 0}, "truncated attribute"},
+		{"BootstrapMethods arguments past the payload", 15, []byte{0, 1, 0, 1, 0, 2, 0, 5}, "truncated attribute"},
+	}
+	for _, test := range tests {
+		_, err := readTestAttribute(constantPool, test.nameIndex, test.info...)
+		if err == nil {
+			t.Errorf("%s: read, want %s", test.name, test.want)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, err, test.want)
+		}
+	}
+
+	attribute, err := readTestAttribute(constantPool, 1, 0, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := attribute.Data.(ConstantValueAttribute).Value; value != "hi" {
+		t.Errorf("ConstantValue = %v, want hi", value)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/signature"
 )
 
 type AccessFlag uint16
@@ -25,6 +28,11 @@ const (
 	AccSynthetic  AccessFlag = 0x1000
 	AccAnnotation AccessFlag = 0x2000
 	AccEnum       AccessFlag = 0x4000
+	AccModule     AccessFlag = 0x8000
+	// Implicitly declared parameter, shares its bit with AccModule
+	AccMandated AccessFlag = 0x8000
+	// Method holding a monitor while it runs, shares its bit with AccSuper
+	AccSynchronized AccessFlag = 0x0020
 )
 
 func (f AccessFlag) String() string {
@@ -59,13 +67,24 @@ func (f AccessFlag) String() string {
 		return "transient"
 	case AccVolatile:
 		return "volatile"
+	case AccModule:
+		return "module"
 	default:
-		panic(fmt.Sprintf("unexpected jvm.AccessFlag: %#v", f))
+		// Several flags set at once
+		names := make([]string, 0)
+		for flag := AccPublic; flag != 0; flag <<= 1 {
+			if f&flag != 0 {
+				names = append(names, flag.String())
+			}
+		}
+		return strings.Join(names, " ")
 	}
 }
 
 type JavaClass struct {
 	Version      string
+	MajorVersion uint16
+	MinorVersion uint16
 	ConstantPool []*ConstantInfo
 	Interfaces   []uint16
 	Fields       []*FieldInfo
@@ -96,6 +115,8 @@ func NewJavaClass(javaClassFile *bufio.Reader) (*JavaClass, error) {
 	minorVersion := binary.BigEndian.Uint16(sectionsReadBuffer[:2])
 	majorVersion := binary.BigEndian.Uint16(sectionsReadBuffer[2:])
 	javaClass.Version = fmt.Sprintf("%d.%d", majorVersion, minorVersion)
+	javaClass.MajorVersion = majorVersion
+	javaClass.MinorVersion = minorVersion
 
 	// Decode constant pool count
 	if err := ReadSection(javaClassFile, sectionsReadBuffer[:2]); err != nil {
@@ -105,12 +126,16 @@ func NewJavaClass(javaClassFile *bufio.Reader) (*JavaClass, error) {
 	javaClass.ConstantPool = make([]*ConstantInfo, constantPoolCount-1)
 
 	// Decode constant pool
-	for i := range constantPoolCount - 1 {
+	for i := 0; i < int(constantPoolCount-1); i++ {
 		constant, err := ReadConstantPool(javaClassFile, make([]byte, 4))
 		if err != nil {
 			return nil, err
 		}
 		javaClass.ConstantPool[i] = constant
+		// Longs and doubles take two entries, the second one is unusable
+		if constant.Tag == ConstantLongTag || constant.Tag == ConstantDoubleTag {
+			i++
+		}
 		// fmt.Println(i+1, constant.Tag.String())
 	}
 
@@ -190,10 +215,81 @@ func NewJavaClass(javaClassFile *bufio.Reader) (*JavaClass, error) {
 	return &javaClass, nil
 }
 
+// Name returns the internal name of the class
+func (c *JavaClass) Name() string {
+	return GetClassName(c.ConstantPool, c.ThisClass)
+}
+
+// SuperName returns the internal name of the super class, empty for java/lang/Object
+func (c *JavaClass) SuperName() string {
+	if c.SuperClass == 0 {
+		return ""
+	}
+	return GetClassName(c.ConstantPool, c.SuperClass)
+}
+
+// Signature returns the generic signature of the class, nil if it has none
+func (c *JavaClass) Signature() (*signature.ClassSignature, error) {
+	attr := FindAttribute(c.Attributes, SignatureAttr)
+	if attr == nil {
+		return nil, nil
+	}
+	return signature.ParseClass(attr.Data.(SignatureAttribute).Signature)
+}
+
+// BootstrapMethods returns the bootstrap methods used by the invokedynamic
+// instructions and dynamic constants of the class
+func (c *JavaClass) BootstrapMethods() BootstrapMethodsAttribute {
+	attr := FindAttribute(c.Attributes, BootstrapMethodsAttr)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(BootstrapMethodsAttribute)
+}
+
+// InnerClasses returns the nested classes referenced by the class
+func (c *JavaClass) InnerClasses() InnerClassesAttribute {
+	attr := FindAttribute(c.Attributes, InnerClassesAttr)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(InnerClassesAttribute)
+}
+
+// EnclosingMethod returns the class and method enclosing a local or
+// anonymous class, nil for any other class
+func (c *JavaClass) EnclosingMethod() *EnclosingMethodAttribute {
+	attr := FindAttribute(c.Attributes, EnclosingMethodAttr)
+	if attr == nil {
+		return nil
+	}
+	enclosingMethod := attr.Data.(EnclosingMethodAttribute)
+	return &enclosingMethod
+}
+
+// SourceFile returns the name of the source file the class was compiled
+// from, empty if it is unknown
+func (c *JavaClass) SourceFile() string {
+	attr := FindAttribute(c.Attributes, SourceFileAttr)
+	if attr == nil {
+		return ""
+	}
+	return attr.Data.(SourceFileAttribute).Sourcefile
+}
+
+// SourceDebugExtension returns the raw debug extension, empty if it has none
+func (c *JavaClass) SourceDebugExtension() string {
+	attr := FindAttribute(c.Attributes, SourceDebugExtensionAttr)
+	if attr == nil {
+		return ""
+	}
+	return attr.Data.(SourceDebugExtensionAttribute).DebugExtension
+}
+
 func (c *JavaClass) String() string {
 	var output bytes.Buffer
 	fmt.Fprintf(&output, "Version: %s\n", c.Version)
-	fmt.Fprintf(&output, "Access flag: (0x%X) %s\n", c.AccessFlags, c.AccessFlags)
+	fmt.Fprintf(&output, "Access flag: (0x%X) %s\n", uint16(c.AccessFlags), c.AccessFlags)
 
 	thisClass := c.ConstantPool[c.ThisClass-1].Data.(ConstantClass)
 	thisClassName := c.ConstantPool[thisClass.NameIndex-1].Data.(ConstantUtf8)
@@ -205,14 +301,36 @@ func (c *JavaClass) String() string {
 
 	fmt.Fprintf(&output, "Interfaces: (%d)\n", len(c.Interfaces))
 	fmt.Fprintf(&output, "Fields: (%d)\n", len(c.Fields))
+	for i, f := range c.Fields {
+		fmt.Fprintf(&output, "\t#%d %s %s", i+1, f.Name, f.Descriptor)
+		if value := f.ConstantValue(); value != nil {
+			fmt.Fprintf(&output, " = %v", value)
+		}
+		fmt.Fprintf(&output, "\n")
+	}
 	fmt.Fprintf(&output, "Methods: (%d)\n", len(c.Methods))
 
 	for i, m := range c.Methods {
-		fmt.Fprintf(&output, "\t#%d %s: \n", i+1, m.Name)
+		fmt.Fprintf(&output, "\t#%d %s: ", i+1, m.Name)
+		if methodSignature, err := m.Signature(); err != nil {
+			fmt.Fprintf(&output, "%s", err)
+		} else if methodSignature != nil {
+			fmt.Fprintf(&output, "%s", methodSignature.Format(m.Name))
+		}
+		for _, parameter := range m.Parameters() {
+			fmt.Fprintf(&output, " %s", parameter.Name)
+		}
+		if exceptions := m.Exceptions(); len(exceptions) != 0 {
+			fmt.Fprintf(&output, " throws %s", strings.Join(exceptions, ", "))
+		}
+		fmt.Fprintf(&output, "\n")
 	}
 
 	fmt.Fprintf(&output, "Constant pool: (%d)\n", len(c.ConstantPool))
 	for i, constant := range c.ConstantPool {
+		if constant == nil {
+			continue
+		}
 		fmt.Fprintf(&output, "\t#%d %s: ", i+1, constant.Tag)
 		switch constant.Tag {
 		case ConstantClassTag:
@@ -236,12 +354,15 @@ func (c *JavaClass) String() string {
 		case ConstantInvokeDynamicTag:
 			invokeDynamic := constant.Data.(ConstantInvokeDynamic)
 			fmt.Fprintf(&output, "#%d #%d", invokeDynamic.BootstrapMethodAttrIndex, invokeDynamic.NameAndTypeIndex)
+		case ConstantDynamicTag:
+			dynamic := constant.Data.(ConstantDynamic)
+			fmt.Fprintf(&output, "#%d #%d", dynamic.BootstrapMethodAttrIndex, dynamic.NameAndTypeIndex)
 		case ConstantLongTag:
 			long := constant.Data.(ConstantLong)
 			fmt.Fprintf(&output, "%d", long)
 		case ConstantMethodHandleTag:
 			methodHandle := constant.Data.(ConstantMethodHandle)
-			fmt.Fprintf(&output, "#%d #%d", methodHandle.ReferenceKind, methodHandle.ReferenceIndex)
+			fmt.Fprintf(&output, "%s #%d", ReferenceKind(methodHandle.ReferenceKind), methodHandle.ReferenceIndex)
 		case ConstantMethodRefTag:
 			methodRef := constant.Data.(*ConstantMethodRef)
 			className := c.ConstantPool[c.ConstantPool[methodRef.ClassIndex-1].Data.(ConstantClass).NameIndex-1].Data.(ConstantUtf8)
@@ -262,6 +383,12 @@ func (c *JavaClass) String() string {
 			fmt.Fprintf(&output, "#%d %s", string.StringIndex, c.ConstantPool[string.StringIndex-1].Data.(ConstantUtf8))
 		case ConstantUtf8Tag:
 			fmt.Fprintf(&output, "%s", constant.Data.(ConstantUtf8))
+		case ConstantModuleTag:
+			module := constant.Data.(ConstantModule)
+			fmt.Fprintf(&output, "#%d %s", module.NameIndex, c.ConstantPool[module.NameIndex-1].Data.(ConstantUtf8))
+		case ConstantPackageTag:
+			pkg := constant.Data.(ConstantPackage)
+			fmt.Fprintf(&output, "#%d %s", pkg.NameIndex, c.ConstantPool[pkg.NameIndex-1].Data.(ConstantUtf8))
 		}
 		fmt.Fprintf(&output, "\n")
 	}
@@ -273,6 +400,56 @@ func (c *JavaClass) String() string {
 		case SourceFileAttr:
 			source := attr.Data.(SourceFileAttribute)
 			fmt.Fprintf(&output, "%s", source.Sourcefile)
+		case SignatureAttr:
+			classSignature, err := signature.ParseClass(attr.Data.(SignatureAttribute).Signature)
+			if err != nil {
+				fmt.Fprintf(&output, "%s", err)
+				break
+			}
+			fmt.Fprintf(&output, "%s", classSignature.Format(c.Name()))
+		case RuntimeVisibleAnnotationsAttr, RuntimeInvisibleAnnotationsAttr:
+			for _, annotation := range attr.Data.(RuntimeAnnotationsAttribute) {
+				fmt.Fprintf(&output, "%s ", annotation)
+			}
+		case InnerClassesAttr:
+			for _, innerClass := range attr.Data.(InnerClassesAttribute) {
+				fmt.Fprintf(&output, "\n\t\t(0x%X) %s", uint16(innerClass.InnerClassAccessFlags), innerClass.InnerClass)
+				if innerClass.OuterClass != "" {
+					fmt.Fprintf(&output, " of %s", innerClass.OuterClass)
+				}
+				if innerClass.InnerName != "" {
+					fmt.Fprintf(&output, " as %s", innerClass.InnerName)
+				}
+			}
+		case EnclosingMethodAttr:
+			enclosingMethod := attr.Data.(EnclosingMethodAttribute)
+			fmt.Fprintf(&output, "%s", enclosingMethod.Class)
+			if enclosingMethod.MethodIndex != 0 {
+				fmt.Fprintf(&output, ".%s", ParseDescriptor(enclosingMethod.MethodDescriptor, enclosingMethod.MethodName))
+			}
+		case BootstrapMethodsAttr:
+			for j, bootstrapMethod := range attr.Data.(BootstrapMethodsAttribute) {
+				fmt.Fprintf(&output, "\n\t\t%d: #%d", j, bootstrapMethod.BootstrapMethodRef)
+				for _, argument := range bootstrapMethod.BootstrapArguments {
+					fmt.Fprintf(&output, " #%d", argument)
+				}
+			}
+		case NestHostAttr:
+			fmt.Fprintf(&output, "%s", attr.Data.(NestHostAttribute).HostClass)
+		case NestMembersAttr, PermittedSubclassesAttr:
+			fmt.Fprintf(&output, "%s", strings.Join(attr.Data.(ClassListAttribute).Classes, ", "))
+		case RecordAttr:
+			for _, component := range attr.Data.(RecordAttribute) {
+				fmt.Fprintf(&output, "\n\t\t%s", ParseDescriptor(component.Descriptor, component.Name))
+			}
+		case ModuleAttr:
+			fmt.Fprintf(&output, "%s", attr.Data.(ModuleAttribute))
+		case ModulePackagesAttr:
+			fmt.Fprintf(&output, "%s", strings.Join(attr.Data.(ModulePackagesAttribute).Packages, ", "))
+		case ModuleMainClassAttr:
+			fmt.Fprintf(&output, "%s", attr.Data.(ModuleMainClassAttribute).MainClass)
+		case SourceDebugExtensionAttr:
+			fmt.Fprintf(&output, "\n%s", attr.Data.(SourceDebugExtensionAttribute).DebugExtension)
 		}
 		fmt.Fprintf(&output, "\n")
 	}
@@ -0,0 +1,306 @@
+package jvm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// classBuilder assembles the class files the vm generates at run time, like
+// the classes of lambdas
+type classBuilder struct {
+	name       string
+	superName  string
+	flags      AccessFlag
+	interfaces []string
+	fields     []builderMember
+	methods    []builderMember
+
+	constants     bytes.Buffer
+	constantCount uint16
+	// Indexes of the constants already added, keyed by tag and value
+	constantIndexes map[string]uint16
+}
+
+type builderMember struct {
+	flags      AccessFlag
+	name       string
+	descriptor string
+	// Code of methods, nil for fields, abstract and native methods
+	code *codeBuilder
+}
+
+func newClassBuilder(name, superName string, flags AccessFlag) *classBuilder {
+	return &classBuilder{
+		name:            name,
+		superName:       superName,
+		flags:           flags,
+		constantCount:   1,
+		constantIndexes: map[string]uint16{},
+	}
+}
+
+func (b *classBuilder) constant(tag ConstantPoolTag, key string, data ...interface{}) uint16 {
+	key = fmt.Sprintf("%d:%s", tag, key)
+	if index, ok := b.constantIndexes[key]; ok {
+		return index
+	}
+	b.constants.WriteByte(byte(tag))
+	for _, v := range data {
+		binary.Write(&b.constants, binary.BigEndian, v)
+	}
+	index := b.constantCount
+	b.constantIndexes[key] = index
+	b.constantCount++
+	return index
+}
+
+func (b *classBuilder) utf8(s string) uint16 {
+	return b.constant(ConstantUtf8Tag, s, uint16(len(s)), []byte(s))
+}
+
+func (b *classBuilder) class(name string) uint16 {
+	return b.constant(ConstantClassTag, name, b.utf8(name))
+}
+
+func (b *classBuilder) string(s string) uint16 {
+	return b.constant(ConstantStringTag, s, b.utf8(s))
+}
+
+func (b *classBuilder) integer(v int32) uint16 {
+	return b.constant(ConstantIntegerTag, fmt.Sprint(v), v)
+}
+
+func (b *classBuilder) nameAndType(name, memberDescriptor string) uint16 {
+	return b.constant(ConstantNameAndTypeTag, name+":"+memberDescriptor, b.utf8(name), b.utf8(memberDescriptor))
+}
+
+func (b *classBuilder) fieldRef(class, name, fieldDescriptor string) uint16 {
+	return b.constant(ConstantFieldRefTag, class+"."+name+":"+fieldDescriptor, b.class(class), b.nameAndType(name, fieldDescriptor))
+}
+
+func (b *classBuilder) methodRef(class, name, methodDescriptor string, isInterface bool) uint16 {
+	tag := ConstantMethodRefTag
+	if isInterface {
+		tag = ConstantInterfaceMethodRefTag
+	}
+	return b.constant(tag, class+"."+name+methodDescriptor, b.class(class), b.nameAndType(name, methodDescriptor))
+}
+
+func (b *classBuilder) addField(flags AccessFlag, name, fieldDescriptor string) {
+	b.fields = append(b.fields, builderMember{flags: flags, name: name, descriptor: fieldDescriptor})
+}
+
+// addMethod adds a method whose code is written to the returned builder
+func (b *classBuilder) addMethod(flags AccessFlag, name, methodDescriptor string) *codeBuilder {
+	code := &codeBuilder{class: b}
+	b.methods = append(b.methods, builderMember{flags: flags, name: name, descriptor: methodDescriptor, code: code})
+	return code
+}
+
+// addNativeMethod declares a method implemented by a registered native
+func (b *classBuilder) addNativeMethod(flags AccessFlag, name, methodDescriptor string) {
+	b.methods = append(b.methods, builderMember{flags: flags | AccNative, name: name, descriptor: methodDescriptor})
+}
+
+// Bytes returns the class file
+func (b *classBuilder) Bytes() []byte {
+	// Every constant has to be added before the constant pool is written
+	// java.lang.Object is the only class without a super class
+	this, super := b.class(b.name), uint16(0)
+	if b.superName != "" {
+		super = b.class(b.superName)
+	}
+	interfaces := make([]uint16, len(b.interfaces))
+	for i, name := range b.interfaces {
+		interfaces[i] = b.class(name)
+	}
+	codeName := b.utf8(string(CodeAttr))
+	members := func(list []builderMember) [][]uint16 {
+		indexes := make([][]uint16, len(list))
+		for i, m := range list {
+			indexes[i] = []uint16{b.utf8(m.name), b.utf8(m.descriptor)}
+		}
+		return indexes
+	}
+	fieldIndexes, methodIndexes := members(b.fields), members(b.methods)
+
+	var out bytes.Buffer
+	write := func(data ...interface{}) {
+		for _, v := range data {
+			binary.Write(&out, binary.BigEndian, v)
+		}
+	}
+	write(uint32(0xCAFEBABE), uint16(0), uint16(52), b.constantCount, b.constants.Bytes())
+	write(uint16(b.flags), this, super, uint16(len(interfaces)), interfaces)
+	write(uint16(len(b.fields)))
+	for i, f := range b.fields {
+		write(uint16(f.flags), fieldIndexes[i][0], fieldIndexes[i][1], uint16(0))
+	}
+	write(uint16(len(b.methods)))
+	for i, m := range b.methods {
+		write(uint16(m.flags), methodIndexes[i][0], methodIndexes[i][1])
+		if m.code == nil {
+			write(uint16(0))
+			continue
+		}
+		code := m.code.code.Bytes()
+		// max_stack, max_locals, code_length, code, exception table and
+		// no attributes
+		handlers := m.code.handlers
+		write(uint16(1), codeName, uint32(2+2+4+len(code)+2+8*len(handlers)+2))
+		write(m.code.maxStack, m.code.maxLocals, uint32(len(code)), code, uint16(len(handlers)), handlers, uint16(0))
+	}
+	// No class attributes
+	write(uint16(0))
+	return out.Bytes()
+}
+
+// Define parses the generated class file and defines the class
+func (b *classBuilder) Define(jvm *Jvm) (*JavaClass, error) {
+	class, err := NewJavaClass(bufio.NewReader(bytes.NewReader(b.Bytes())))
+	if err != nil {
+		return nil, err
+	}
+	if err := jvm.DefineClass(class); err != nil {
+		return nil, err
+	}
+	return class, nil
+}
+
+// codeBuilder writes the code of a generated method. The code has no
+// branches, so it needs no stack map frames
+type codeBuilder struct {
+	class     *classBuilder
+	code      bytes.Buffer
+	maxStack  uint16
+	maxLocals uint16
+	handlers  []ExceptionTableEntry
+}
+
+func (c *codeBuilder) op(op Opcode, operands ...interface{}) {
+	c.code.WriteByte(byte(op))
+	for _, v := range operands {
+		binary.Write(&c.code, binary.BigEndian, v)
+	}
+}
+
+// pc returns the offset of the next instruction
+func (c *codeBuilder) pc() uint16 {
+	return uint16(c.code.Len())
+}
+
+// catch makes the code at handler catch the exceptions of class thrown
+// between start and end, any exception for an empty class
+func (c *codeBuilder) catch(start, end, handler uint16, class string) {
+	entry := ExceptionTableEntry{StartPc: start, EndPc: end, HandlerPc: handler}
+	if class != "" {
+		entry.CatchType = c.class.class(class)
+	}
+	c.handlers = append(c.handlers, entry)
+}
+
+// load pushes the local variable at slot
+func (c *codeBuilder) load(t descriptor.Type, slot int) {
+	op := OpAload
+	switch t {
+	case descriptor.Long:
+		op = OpLload
+	case descriptor.Float:
+		op = OpFload
+	case descriptor.Double:
+		op = OpDload
+	case descriptor.Boolean, descriptor.Byte, descriptor.Char, descriptor.Short, descriptor.Int:
+		op = OpIload
+	}
+	c.op(op, uint8(slot))
+}
+
+// ret returns a value of type t
+func (c *codeBuilder) ret(t descriptor.Type) {
+	op := OpAreturn
+	switch t {
+	case descriptor.Void:
+		op = OpReturn
+	case descriptor.Long:
+		op = OpLreturn
+	case descriptor.Float:
+		op = OpFreturn
+	case descriptor.Double:
+		op = OpDreturn
+	case descriptor.Boolean, descriptor.Byte, descriptor.Char, descriptor.Short, descriptor.Int:
+		op = OpIreturn
+	}
+	c.op(op)
+}
+
+// checkcast casts the reference on top of the stack to t
+func (c *codeBuilder) checkcast(t descriptor.Type) {
+	switch t := t.(type) {
+	case *descriptor.ObjectType:
+		if t.ClassName != "java/lang/Object" {
+			c.op(OpCheckcast, c.class.class(t.ClassName))
+		}
+	case *descriptor.ArrayType:
+		c.op(OpCheckcast, c.class.class(t.Descriptor()))
+	}
+}
+
+var wideningOpcodes = map[[2]descriptor.BaseType]Opcode{
+	{descriptor.Int, descriptor.Long}:     OpI2l,
+	{descriptor.Int, descriptor.Float}:    OpI2f,
+	{descriptor.Int, descriptor.Double}:   OpI2d,
+	{descriptor.Long, descriptor.Float}:   OpL2f,
+	{descriptor.Long, descriptor.Double}:  OpL2d,
+	{descriptor.Float, descriptor.Double}: OpF2d,
+}
+
+// widen applies a widening primitive conversion to the value on top of the
+// stack
+func (c *codeBuilder) widen(from, to descriptor.BaseType) {
+	switch from {
+	case descriptor.Boolean, descriptor.Byte, descriptor.Char, descriptor.Short:
+		from = descriptor.Int
+	}
+	if op, ok := wideningOpcodes[[2]descriptor.BaseType{from, to}]; ok {
+		c.op(op)
+	}
+}
+
+// convert converts the value on top of the stack between types the way
+// MethodHandle.asType does, boxing and unboxing primitives
+func (c *codeBuilder) convert(from, to descriptor.Type) {
+	if from.Descriptor() == to.Descriptor() {
+		return
+	}
+	fromBase, fromPrimitive := from.(descriptor.BaseType)
+	toBase, toPrimitive := to.(descriptor.BaseType)
+	switch {
+	case fromPrimitive && toPrimitive:
+		c.widen(fromBase, toBase)
+	case fromPrimitive:
+		wrapper := wrapperClasses[fromBase]
+		c.op(OpInvokestatic, c.class.methodRef(wrapper, "valueOf", fmt.Sprintf("(%c)L%s;", fromBase, wrapper), false))
+		c.checkcast(to)
+	case toPrimitive:
+		// Unboxed as the primitive of the source wrapper, if it is one, then
+		// widened
+		unboxed := toBase
+		if object, ok := from.(*descriptor.ObjectType); ok {
+			for base, wrapper := range wrapperClasses {
+				if wrapper == object.ClassName && isWidening(base, toBase) {
+					unboxed = base
+				}
+			}
+		}
+		wrapper := wrapperClasses[unboxed]
+		c.checkcast(&descriptor.ObjectType{ClassName: wrapper})
+		c.op(OpInvokevirtual, c.class.methodRef(wrapper, unboxed.String()+"Value", "()"+unboxed.Descriptor(), false))
+		c.widen(unboxed, toBase)
+	default:
+		c.checkcast(to)
+	}
+}
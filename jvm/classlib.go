@@ -0,0 +1,393 @@
+package jvm
+
+import (
+	"os"
+	"strings"
+)
+
+// libraryClass describes a class of the class library embedded in the vm,
+// used when no JDK is. Its methods are natives found by name, so a class
+// only declares what the vm needs to create, subclass and type check its
+// instances
+type libraryClass struct {
+	flags      AccessFlag
+	super      string
+	interfaces []string
+	// Instance fields as name:descriptor
+	fields []string
+	// Static fields as name:descriptor, set by a native <clinit> registered
+	// for the class
+	staticFields []string
+}
+
+func libraryInterface(superInterfaces ...string) libraryClass {
+	return libraryClass{flags: AccInterface | AccAbstract, super: "java/lang/Object", interfaces: superInterfaces}
+}
+
+var libraryClasses = map[string]libraryClass{
+	"java/lang/Object":        {},
+	"java/io/Serializable":    libraryInterface(),
+	"java/lang/Cloneable":     libraryInterface(),
+	"java/lang/Comparable":    libraryInterface(),
+	"java/lang/CharSequence":  libraryInterface(),
+	"java/lang/Appendable":    libraryInterface(),
+	"java/lang/Iterable":      libraryInterface(),
+	"java/lang/Runnable":      libraryInterface(),
+	"java/lang/AutoCloseable": libraryInterface(),
+	"java/io/Closeable":       libraryInterface("java/lang/AutoCloseable"),
+	"java/io/Flushable":       libraryInterface(),
+	"java/util/Iterator":      libraryInterface(),
+	"java/util/Collection":    libraryInterface("java/lang/Iterable"),
+	"java/util/List":          libraryInterface("java/util/Collection"),
+	"java/util/Set":           libraryInterface("java/util/Collection"),
+	"java/util/RandomAccess":  libraryInterface(),
+	"java/util/Map":           libraryInterface(),
+	"java/util/Map$Entry":     libraryInterface(),
+	"java/util/Comparator":    libraryInterface(),
+
+	"java/util/function/Consumer":   libraryInterface(),
+	"java/util/function/BiConsumer": libraryInterface(),
+	"java/util/function/Function":   libraryInterface(),
+	"java/util/function/BiFunction": libraryInterface(),
+	"java/util/function/Supplier":   libraryInterface(),
+	"java/util/function/Predicate":  libraryInterface(),
+
+	"java/lang/String": {
+		flags:      AccFinal,
+		super:      "java/lang/Object",
+		interfaces: []string{"java/io/Serializable", "java/lang/Comparable", "java/lang/CharSequence"},
+	},
+	"java/lang/Math":   {flags: AccFinal, super: "java/lang/Object"},
+	"java/lang/Number": {flags: AccAbstract, super: "java/lang/Object", interfaces: []string{"java/io/Serializable"}},
+	"java/lang/Integer": {
+		flags:      AccFinal,
+		super:      "java/lang/Number",
+		interfaces: []string{"java/lang/Comparable"},
+		fields:     []string{"value:I"},
+	},
+	"java/lang/Long": {
+		flags:      AccFinal,
+		super:      "java/lang/Number",
+		interfaces: []string{"java/lang/Comparable"},
+		fields:     []string{"value:J"},
+	},
+	"java/lang/Double": {
+		flags:      AccFinal,
+		super:      "java/lang/Number",
+		interfaces: []string{"java/lang/Comparable"},
+		fields:     []string{"value:D"},
+	},
+	"java/lang/Float": {
+		flags:      AccFinal,
+		super:      "java/lang/Number",
+		interfaces: []string{"java/lang/Comparable"},
+		fields:     []string{"value:F"},
+	},
+	"java/lang/Short": {
+		flags:      AccFinal,
+		super:      "java/lang/Number",
+		interfaces: []string{"java/lang/Comparable"},
+		fields:     []string{"value:S"},
+	},
+	"java/lang/Byte": {
+		flags:      AccFinal,
+		super:      "java/lang/Number",
+		interfaces: []string{"java/lang/Comparable"},
+		fields:     []string{"value:B"},
+	},
+	"java/lang/Character": {
+		flags:      AccFinal,
+		super:      "java/lang/Object",
+		interfaces: []string{"java/io/Serializable", "java/lang/Comparable"},
+		fields:     []string{"value:C"},
+	},
+	"java/lang/Boolean": {
+		flags:        AccFinal,
+		super:        "java/lang/Object",
+		interfaces:   []string{"java/io/Serializable", "java/lang/Comparable"},
+		fields:       []string{"value:Z"},
+		staticFields: []string{"TRUE:Ljava/lang/Boolean;", "FALSE:Ljava/lang/Boolean;"},
+	},
+	// The boxes valueOf shares, created when first asked for
+	"java/lang/Integer$IntegerCache":     {super: "java/lang/Object", staticFields: []string{"cache:[Ljava/lang/Integer;"}},
+	"java/lang/Long$LongCache":           {super: "java/lang/Object", staticFields: []string{"cache:[Ljava/lang/Long;"}},
+	"java/lang/Short$ShortCache":         {super: "java/lang/Object", staticFields: []string{"cache:[Ljava/lang/Short;"}},
+	"java/lang/Byte$ByteCache":           {super: "java/lang/Object", staticFields: []string{"cache:[Ljava/lang/Byte;"}},
+	"java/lang/Character$CharacterCache": {super: "java/lang/Object", staticFields: []string{"cache:[Ljava/lang/Character;"}},
+	"java/util/concurrent/atomic/AtomicInteger": {
+		super:      "java/lang/Number",
+		interfaces: []string{"java/io/Serializable"},
+		fields:     []string{"value:I"},
+	},
+	"java/util/concurrent/atomic/AtomicLong": {
+		super:      "java/lang/Number",
+		interfaces: []string{"java/io/Serializable"},
+		fields:     []string{"value:J"},
+	},
+	"java/util/concurrent/atomic/AtomicBoolean": {
+		super:      "java/lang/Object",
+		interfaces: []string{"java/io/Serializable"},
+		fields:     []string{"value:Z"},
+	},
+	"java/util/concurrent/atomic/AtomicReference": {
+		super:      "java/lang/Object",
+		interfaces: []string{"java/io/Serializable"},
+		fields:     []string{"value:Ljava/lang/Object;"},
+	},
+	"java/lang/AbstractStringBuilder": {
+		flags:      AccAbstract,
+		super:      "java/lang/Object",
+		interfaces: []string{"java/lang/Appendable", "java/lang/CharSequence"},
+		fields:     []string{"value:[C", "count:I"},
+	},
+	"java/lang/StringBuilder": {
+		flags:      AccFinal,
+		super:      "java/lang/AbstractStringBuilder",
+		interfaces: []string{"java/io/Serializable", "java/lang/Comparable"},
+	},
+	"java/lang/StringBuffer": {
+		flags:      AccFinal,
+		super:      "java/lang/AbstractStringBuilder",
+		interfaces: []string{"java/io/Serializable", "java/lang/Comparable"},
+	},
+
+	"java/lang/System": {
+		flags:        AccFinal,
+		super:        "java/lang/Object",
+		staticFields: []string{"in:Ljava/io/InputStream;", "out:Ljava/io/PrintStream;", "err:Ljava/io/PrintStream;"},
+	},
+	"java/lang/Runtime": {
+		super:        "java/lang/Object",
+		staticFields: []string{"currentRuntime:Ljava/lang/Runtime;"},
+	},
+	// threadStatus is the ThreadState of a thread, NEW until it starts
+	"java/lang/Thread": {
+		super:      "java/lang/Object",
+		interfaces: []string{"java/lang/Runnable"},
+		fields: []string{"name:Ljava/lang/String;", "tid:J", "priority:I", "daemon:Z", "interrupted:Z", "threadStatus:I",
+			"target:Ljava/lang/Runnable;", "uncaughtExceptionHandler:Ljava/lang/Thread$UncaughtExceptionHandler;"},
+		staticFields: []string{"defaultUncaughtExceptionHandler:Ljava/lang/Thread$UncaughtExceptionHandler;"},
+	},
+	"java/lang/Thread$UncaughtExceptionHandler": libraryInterface(),
+	"java/lang/ref/Reference": {
+		flags:  AccAbstract,
+		super:  "java/lang/Object",
+		fields: []string{"referent:Ljava/lang/Object;", "queue:Ljava/lang/ref/ReferenceQueue;", "next:Ljava/lang/ref/Reference;"},
+	},
+	// timestamp is the clock of the heap when the reference was last used
+	"java/lang/ref/SoftReference":    {super: "java/lang/ref/Reference", fields: []string{"timestamp:J"}},
+	"java/lang/ref/WeakReference":    {super: "java/lang/ref/Reference"},
+	"java/lang/ref/PhantomReference": {super: "java/lang/ref/Reference"},
+	// A stack of references linked by next, ENQUEUED is the queue of the
+	// ones in a queue
+	"java/lang/ref/ReferenceQueue": {
+		super:        "java/lang/Object",
+		fields:       []string{"head:Ljava/lang/ref/Reference;", "queueLength:J"},
+		staticFields: []string{"ENQUEUED:Ljava/lang/ref/ReferenceQueue;"},
+	},
+	// The cleanables of a cleaner are in a list until they are cleaned
+	"java/lang/ref/Cleaner": {
+		flags:  AccFinal,
+		super:  "java/lang/Object",
+		fields: []string{"queue:Ljava/lang/ref/ReferenceQueue;", "list:Ljdk/internal/ref/PhantomCleanable;"},
+	},
+	"java/lang/ref/Cleaner$Cleanable": libraryInterface(),
+	"jdk/internal/ref/PhantomCleanable": {
+		super:      "java/lang/ref/PhantomReference",
+		interfaces: []string{"java/lang/ref/Cleaner$Cleanable"},
+		fields:     []string{"action:Ljava/lang/Runnable;", "cleaner:Ljava/lang/ref/Cleaner;", "prev:Ljdk/internal/ref/PhantomCleanable;", "next:Ljdk/internal/ref/PhantomCleanable;"},
+	},
+	"java/io/InputStream":  {flags: AccAbstract, super: "java/lang/Object", interfaces: []string{"java/io/Closeable"}},
+	"java/io/OutputStream": {flags: AccAbstract, super: "java/lang/Object", interfaces: []string{"java/io/Closeable", "java/io/Flushable"}},
+	// The standard streams, fd is the file descriptor they use. A
+	// PrintStream writes to out instead when it is set
+	"java/io/FileInputStream": {super: "java/io/InputStream", fields: []string{"fd:I"}},
+	"java/io/PrintStream": {
+		super:      "java/io/OutputStream",
+		interfaces: []string{"java/lang/Appendable", "java/io/Closeable"},
+		fields:     []string{"fd:I", "out:Ljava/io/OutputStream;", "autoFlush:Z", "trouble:Z"},
+	},
+
+	"java/util/AbstractCollection": {flags: AccAbstract, super: "java/lang/Object", interfaces: []string{"java/util/Collection"}},
+	"java/util/AbstractList":       {flags: AccAbstract, super: "java/util/AbstractCollection", interfaces: []string{"java/util/List"}},
+	"java/util/ArrayList": {
+		super:      "java/util/AbstractList",
+		interfaces: []string{"java/util/List", "java/util/RandomAccess", "java/lang/Cloneable", "java/io/Serializable"},
+		fields:     []string{"elementData:[Ljava/lang/Object;", "size:I"},
+	},
+	"java/util/ArrayList$Itr": {
+		super:      "java/lang/Object",
+		interfaces: []string{"java/util/Iterator"},
+		fields:     []string{"this$0:Ljava/util/ArrayList;", "cursor:I", "lastRet:I"},
+	},
+	"java/util/AbstractMap": {flags: AccAbstract, super: "java/lang/Object", interfaces: []string{"java/util/Map"}},
+	"java/util/HashMap": {
+		super:      "java/util/AbstractMap",
+		interfaces: []string{"java/util/Map", "java/lang/Cloneable", "java/io/Serializable"},
+		fields:     []string{"table:[Ljava/util/HashMap$Node;", "size:I", "threshold:I"},
+	},
+	"java/util/HashMap$Node": {
+		super:      "java/lang/Object",
+		interfaces: []string{"java/util/Map$Entry"},
+		fields:     []string{"hash:I", "key:Ljava/lang/Object;", "value:Ljava/lang/Object;", "next:Ljava/util/HashMap$Node;"},
+	},
+	// Views of a map, kind tells keys, values and entries apart
+	"java/util/HashMap$KeySet": {
+		flags:      AccFinal,
+		super:      "java/util/AbstractCollection",
+		interfaces: []string{"java/util/Set"},
+		fields:     []string{"this$0:Ljava/util/HashMap;"},
+	},
+	"java/util/HashMap$Values": {
+		flags:  AccFinal,
+		super:  "java/util/AbstractCollection",
+		fields: []string{"this$0:Ljava/util/HashMap;"},
+	},
+	"java/util/HashMap$EntrySet": {
+		flags:      AccFinal,
+		super:      "java/util/AbstractCollection",
+		interfaces: []string{"java/util/Set"},
+		fields:     []string{"this$0:Ljava/util/HashMap;"},
+	},
+	"java/util/HashMap$HashIterator": {
+		super:      "java/lang/Object",
+		interfaces: []string{"java/util/Iterator"},
+		fields:     []string{"this$0:Ljava/util/HashMap;", "next:Ljava/util/HashMap$Node;", "current:Ljava/util/HashMap$Node;", "index:I", "kind:I"},
+	},
+
+	"java/lang/Throwable": {
+		super:      "java/lang/Object",
+		interfaces: []string{"java/io/Serializable"},
+		fields:     []string{"detailMessage:Ljava/lang/String;", "cause:Ljava/lang/Throwable;"},
+	},
+}
+
+// libraryThrowables are the throwable classes of the embedded library and
+// their super classes
+var libraryThrowables = map[string]string{
+	"java/lang/Exception":                              "java/lang/Throwable",
+	"java/lang/Error":                                  "java/lang/Throwable",
+	"java/lang/RuntimeException":                       "java/lang/Exception",
+	"java/lang/ArithmeticException":                    "java/lang/RuntimeException",
+	"java/lang/ArrayStoreException":                    "java/lang/RuntimeException",
+	"java/lang/ClassCastException":                     "java/lang/RuntimeException",
+	"java/lang/IllegalArgumentException":               "java/lang/RuntimeException",
+	"java/lang/NumberFormatException":                  "java/lang/IllegalArgumentException",
+	"java/lang/IllegalThreadStateException":            "java/lang/IllegalArgumentException",
+	"java/lang/IllegalStateException":                  "java/lang/RuntimeException",
+	"java/lang/IllegalMonitorStateException":           "java/lang/RuntimeException",
+	"java/lang/IndexOutOfBoundsException":              "java/lang/RuntimeException",
+	"java/lang/ArrayIndexOutOfBoundsException":         "java/lang/IndexOutOfBoundsException",
+	"java/lang/StringIndexOutOfBoundsException":        "java/lang/IndexOutOfBoundsException",
+	"java/lang/NegativeArraySizeException":             "java/lang/RuntimeException",
+	"java/lang/NullPointerException":                   "java/lang/RuntimeException",
+	"java/lang/UnsupportedOperationException":          "java/lang/RuntimeException",
+	"java/util/ConcurrentModificationException":        "java/lang/RuntimeException",
+	"java/util/NoSuchElementException":                 "java/lang/RuntimeException",
+	"java/lang/invoke/WrongMethodTypeException":        "java/lang/RuntimeException",
+	"java/lang/CloneNotSupportedException":             "java/lang/Exception",
+	"java/lang/InterruptedException":                   "java/lang/Exception",
+	"java/lang/ReflectiveOperationException":           "java/lang/Exception",
+	"java/lang/ClassNotFoundException":                 "java/lang/ReflectiveOperationException",
+	"java/lang/IllegalAccessException":                 "java/lang/ReflectiveOperationException",
+	"java/lang/InstantiationException":                 "java/lang/ReflectiveOperationException",
+	"java/lang/NoSuchFieldException":                   "java/lang/ReflectiveOperationException",
+	"java/lang/NoSuchMethodException":                  "java/lang/ReflectiveOperationException",
+	"java/lang/invoke/LambdaConversionException":       "java/lang/Exception",
+	"java/util/regex/PatternSyntaxException":           "java/lang/IllegalArgumentException",
+	"java/util/IllegalFormatException":                 "java/lang/IllegalArgumentException",
+	"java/util/UnknownFormatConversionException":       "java/util/IllegalFormatException",
+	"java/util/MissingFormatArgumentException":         "java/util/IllegalFormatException",
+	"java/util/IllegalFormatConversionException":       "java/util/IllegalFormatException",
+	"java/util/MissingFormatWidthException":            "java/util/IllegalFormatException",
+	"java/util/IllegalFormatFlagsException":            "java/util/IllegalFormatException",
+	"java/util/IllegalFormatPrecisionException":        "java/util/IllegalFormatException",
+	"java/util/FormatFlagsConversionMismatchException": "java/util/IllegalFormatException",
+	"java/util/IllegalFormatCodePointException":        "java/util/IllegalFormatException",
+	"java/io/IOException":                              "java/lang/Exception",
+	"java/lang/AssertionError":                         "java/lang/Error",
+	"java/lang/LinkageError":                           "java/lang/Error",
+	"java/lang/BootstrapMethodError":                   "java/lang/LinkageError",
+	"java/lang/ClassCircularityError":                  "java/lang/LinkageError",
+	"java/lang/ClassFormatError":                       "java/lang/LinkageError",
+	"java/lang/ExceptionInInitializerError":            "java/lang/LinkageError",
+	"java/lang/NoClassDefFoundError":                   "java/lang/LinkageError",
+	"java/lang/UnsatisfiedLinkError":                   "java/lang/LinkageError",
+	"java/lang/VerifyError":                            "java/lang/LinkageError",
+	"java/lang/IncompatibleClassChangeError":           "java/lang/LinkageError",
+	"java/lang/AbstractMethodError":                    "java/lang/IncompatibleClassChangeError",
+	"java/lang/IllegalAccessError":                     "java/lang/IncompatibleClassChangeError",
+	"java/lang/InstantiationError":                     "java/lang/IncompatibleClassChangeError",
+	"java/lang/NoSuchFieldError":                       "java/lang/IncompatibleClassChangeError",
+	"java/lang/NoSuchMethodError":                      "java/lang/IncompatibleClassChangeError",
+	"java/lang/VirtualMachineError":                    "java/lang/Error",
+	"java/lang/InternalError":                          "java/lang/VirtualMachineError",
+	"java/lang/OutOfMemoryError":                       "java/lang/VirtualMachineError",
+	"java/lang/StackOverflowError":                     "java/lang/VirtualMachineError",
+}
+
+func init() {
+	for name, super := range libraryThrowables {
+		libraryClasses[name] = libraryClass{super: super}
+	}
+}
+
+// EmbeddedLibrary is the minimal class library built into the vm, so that
+// programs run without a JDK. It is the default boot class path
+type EmbeddedLibrary struct{}
+
+func (EmbeddedLibrary) ReadClass(name string) ([]byte, error) {
+	spec, ok := libraryClasses[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	b := newClassBuilder(name, spec.super, spec.flags|AccPublic)
+	if spec.flags&AccInterface == 0 {
+		b.flags |= AccSuper
+	}
+	b.interfaces = spec.interfaces
+	for _, field := range spec.fields {
+		fieldName, fieldDescriptor, _ := strings.Cut(field, ":")
+		b.addField(AccProtected, fieldName, fieldDescriptor)
+	}
+	for _, field := range spec.staticFields {
+		fieldName, fieldDescriptor, _ := strings.Cut(field, ":")
+		b.addField(AccPublic|AccStatic|AccFinal, fieldName, fieldDescriptor)
+	}
+	if len(spec.staticFields) > 0 {
+		b.addNativeMethod(AccStatic, "<clinit>", "()V")
+	}
+	return b.Bytes(), nil
+}
+
+func (EmbeddedLibrary) String() string {
+	return "embedded class library"
+}
+
+// hasJDK tells whether the boot class path holds the class library of a JDK
+// rather than the embedded one
+func (jvm *Jvm) hasJDK() bool {
+	for _, source := range jvm.BootClassPath {
+		switch source.(type) {
+		case *JImage, ModuleDirectory:
+			return true
+		}
+	}
+	return false
+}
+
+// libraryObject allocates an instance of a class of the class library
+func (jvm *Jvm) libraryObject(className string) (*Object, error) {
+	class, err := jvm.LoadClass(className)
+	if err != nil {
+		return nil, err
+	}
+	if err := jvm.InitializeClass(class); err != nil {
+		return nil, err
+	}
+	// Accounted for without a collection, the natives creating library
+	// objects may hold references the collector doesn't see
+	object := jvm.NewObject(class)
+	jvm.register(object)
+	return object, nil
+}
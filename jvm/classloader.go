@@ -0,0 +1,145 @@
+package jvm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// LinkageError is one of the java.lang.LinkageError subclasses thrown while
+// a class is loaded, linked or resolved
+type LinkageError struct {
+	// Binary name of the error class, like java.lang.NoClassDefFoundError
+	ErrorClass string
+	Message    string
+}
+
+func (e *LinkageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorClass, e.Message)
+}
+
+func isNoClassDefFound(err error) bool {
+	var linkageError *LinkageError
+	return errors.As(err, &linkageError) && linkageError.ErrorClass == "java.lang.NoClassDefFoundError"
+}
+
+// packageName returns the internal name of the run-time package of a class
+func packageName(className string) string {
+	if i := strings.LastIndexByte(className, '/'); i != -1 {
+		return className[:i]
+	}
+	return ""
+}
+
+// LoadClass returns the class called name, loading it from the boot class
+// path or the class path the first time it is requested
+func (jvm *Jvm) LoadClass(name string) (*JavaClass, error) {
+	if class, ok := jvm.Classes[name]; ok {
+		return class, nil
+	}
+	sources := append([]ClassSource(nil), jvm.BootClassPath...)
+	for _, dir := range jvm.ClassPath {
+		sources = append(sources, ClassDirectory(dir))
+	}
+	for _, source := range sources {
+		content, err := source.ReadClass(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, &LinkageError{ErrorClass: "java.lang.NoClassDefFoundError", Message: fmt.Sprintf("%s: %s", name, err)}
+		}
+		class, err := NewJavaClass(bufio.NewReader(bytes.NewReader(content)))
+		if err != nil {
+			return nil, &LinkageError{ErrorClass: "java.lang.ClassFormatError", Message: fmt.Sprintf("%s: %s", name, err)}
+		}
+		if class.Name() != name {
+			return nil, &LinkageError{ErrorClass: "java.lang.NoClassDefFoundError", Message: fmt.Sprintf("%s (wrong name: %s)", name, class.Name())}
+		}
+		if err := jvm.DefineClass(class); err != nil {
+			return nil, err
+		}
+		return class, nil
+	}
+	return nil, &LinkageError{ErrorClass: "java.lang.NoClassDefFoundError", Message: name}
+}
+
+// DefineClass registers a parsed class, resolving its super types and
+// verifying it
+func (jvm *Jvm) DefineClass(class *JavaClass) error {
+	name := class.Name()
+	if _, ok := jvm.Classes[name]; ok {
+		return &LinkageError{ErrorClass: "java.lang.LinkageError", Message: fmt.Sprintf("duplicate class definition for %s", name)}
+	}
+	// Registered before its super types are loaded so that circular
+	// lookups end
+	jvm.Classes[name] = class
+	if err := jvm.resolveSuperTypes(class); err != nil {
+		delete(jvm.Classes, name)
+		return err
+	}
+	if err := VerifyClass(class, jvm); err != nil {
+		delete(jvm.Classes, name)
+		return err
+	}
+	jvm.initStaticFields(class)
+	return nil
+}
+
+// resolveSuperTypes loads the super class and interfaces of class (JVMS
+// §5.3.5). A super type missing from the boot class path and the class path
+// fails with NoClassDefFoundError, like HotSpot does
+func (jvm *Jvm) resolveSuperTypes(class *JavaClass) error {
+	name := class.Name()
+	if superName := class.SuperName(); superName != "" {
+		super, err := jvm.LoadClass(superName)
+		switch {
+		case err != nil:
+			return err
+		case super.AccessFlags&AccInterface != 0:
+			return &LinkageError{ErrorClass: "java.lang.IncompatibleClassChangeError", Message: fmt.Sprintf("class %s has interface %s as super class", name, superName)}
+		default:
+			for ancestor := super; ancestor != nil; ancestor = jvm.Classes[ancestor.SuperName()] {
+				if ancestor == class {
+					return &LinkageError{ErrorClass: "java.lang.ClassCircularityError", Message: name}
+				}
+			}
+			if err := checkPermittedSubclass(super, class); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, index := range class.Interfaces {
+		interfaceName := GetClassName(class.ConstantPool, index)
+		superInterface, err := jvm.LoadClass(interfaceName)
+		switch {
+		case err != nil:
+			return err
+		case superInterface.AccessFlags&AccInterface == 0:
+			return &LinkageError{ErrorClass: "java.lang.IncompatibleClassChangeError", Message: fmt.Sprintf("class %s can not implement %s, because it is not an interface", name, interfaceName)}
+		default:
+			if err := checkPermittedSubclass(superInterface, class); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkPermittedSubclass makes sure class is allowed to extend or implement
+// super when super is sealed. Every class lives in the unnamed module, so
+// permitted subclasses must also be in the same package
+func checkPermittedSubclass(super, class *JavaClass) error {
+	if !super.IsSealed() {
+		return nil
+	}
+	if !slices.Contains(super.PermittedSubclasses(), class.Name()) || packageName(super.Name()) != packageName(class.Name()) {
+		return &LinkageError{ErrorClass: "java.lang.IncompatibleClassChangeError", Message: fmt.Sprintf("class %s cannot inherit from sealed class %s", class.Name(), super.Name())}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package jvm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ClassSource is a place class files are loaded from
+type ClassSource interface {
+	// ReadClass returns the class file of the class with the given
+	// internal name, or an error satisfying errors.Is(err, os.ErrNotExist)
+	// if the source has none
+	ReadClass(name string) ([]byte, error)
+}
+
+// ClassDirectory is a directory of class files laid out by package, like a
+// class path entry or a --patch-module directory
+type ClassDirectory string
+
+func (dir ClassDirectory) ReadClass(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(dir), filepath.FromSlash(name)+".class"))
+}
+
+func (dir ClassDirectory) String() string {
+	return string(dir)
+}
+
+// ModuleDirectory is a directory with a sub directory per module holding its
+// classes, like the modules directory of an exploded JDK build or a
+// directory of extracted jmod files, whose classes are under classes/
+type ModuleDirectory string
+
+func (dir ModuleDirectory) ReadClass(name string) ([]byte, error) {
+	modules, err := os.ReadDir(string(dir))
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.FromSlash(name) + ".class"
+	for _, module := range modules {
+		if !module.IsDir() {
+			continue
+		}
+		for _, candidate := range []string{
+			filepath.Join(string(dir), module.Name(), path),
+			filepath.Join(string(dir), module.Name(), "classes", path),
+		} {
+			if content, err := os.ReadFile(candidate); !errors.Is(err, os.ErrNotExist) {
+				return content, err
+			}
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (dir ModuleDirectory) String() string {
+	return string(dir)
+}
+
+// UseJDK makes the bootstrap class loader load the class library of the JDK
+// installed at javaHome, from its lib/modules image or, for an exploded
+// build, its modules directory. It replaces the embedded class library, so
+// it must be called before the program runs
+func (jvm *Jvm) UseJDK(javaHome string) error {
+	var library ClassSource
+	image, err := OpenJImage(filepath.Join(javaHome, "lib", "modules"))
+	switch {
+	case err == nil:
+		library = image
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	default:
+		modules := filepath.Join(javaHome, "modules")
+		info, statErr := os.Stat(modules)
+		if statErr != nil || !info.IsDir() {
+			return err
+		}
+		library = ModuleDirectory(modules)
+	}
+	var sources []ClassSource
+	for _, source := range jvm.BootClassPath {
+		if _, ok := source.(EmbeddedLibrary); !ok {
+			sources = append(sources, source)
+		}
+	}
+	jvm.BootClassPath = append(sources, library)
+	return nil
+}
+
+// PatchModule makes the classes of dir override the ones of the boot class
+// path, like --patch-module. Like UseJDK, it must be called before the
+// program runs
+func (jvm *Jvm) PatchModule(dir string) {
+	jvm.BootClassPath = append([]ClassSource{ClassDirectory(dir)}, jvm.BootClassPath...)
+}
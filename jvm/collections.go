@@ -0,0 +1,146 @@
+package jvm
+
+import (
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+var objectType = &descriptor.ObjectType{ClassName: "java/lang/Object"}
+
+// javaEquals compares two references with equals, the way collections do
+func (jvm *Jvm) javaEquals(a, b StackData) (bool, error) {
+	if a.IsNull() || b.IsNull() {
+		return a.IsNull() && b.IsNull(), nil
+	}
+	if sameReference(a, b) {
+		return true, nil
+	}
+	result, err := jvm.InvokeVirtual("java/lang/Object", "equals", "(Ljava/lang/Object;)Z", []StackData{a, b})
+	return err == nil && result.Int() != 0, err
+}
+
+// javaHashCode returns the hashCode of a reference, 0 for null
+func (jvm *Jvm) javaHashCode(value StackData) (int32, error) {
+	if value.IsNull() {
+		return 0, nil
+	}
+	result, err := jvm.InvokeVirtual("java/lang/Object", "hashCode", "()I", []StackData{value})
+	if err != nil {
+		return 0, err
+	}
+	return result.Int(), nil
+}
+
+// collectionElements returns the elements of an Iterable, walking its
+// iterator unless it is a list of the class library
+func (jvm *Jvm) collectionElements(value StackData) ([]StackData, error) {
+	if value.IsNull() {
+		return nil, throwable("java/lang/NullPointerException", "")
+	}
+	if object, ok := value.Data.(*Object); ok && jvm.isInstance(value, "java/util/ArrayList") {
+		return append([]StackData(nil), listContents(object)...), nil
+	}
+	iterator, err := jvm.InvokeVirtual("java/lang/Iterable", "iterator", "()Ljava/util/Iterator;", []StackData{value})
+	if err != nil {
+		return nil, err
+	}
+	var elements []StackData
+	for {
+		hasNext, err := jvm.InvokeVirtual("java/util/Iterator", "hasNext", "()Z", []StackData{iterator})
+		if err != nil || hasNext.Int() == 0 {
+			return elements, err
+		}
+		element, err := jvm.InvokeVirtual("java/util/Iterator", "next", "()Ljava/lang/Object;", []StackData{iterator})
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+}
+
+// collectionString formats elements the way AbstractCollection.toString
+// does, like [1, 2, 3]
+func (jvm *Jvm) collectionString(self StackData, elements []StackData) (StackData, error) {
+	parts := make([]string, len(elements))
+	for i, element := range elements {
+		if sameReference(element, self) {
+			parts[i] = "(this Collection)"
+			continue
+		}
+		s, err := jvm.toJavaString(element, objectType)
+		if err != nil {
+			return StackData{}, err
+		}
+		parts[i] = s.String()
+	}
+	return referenceValue(NewString("[" + strings.Join(parts, ", ") + "]")), nil
+}
+
+// compareElements compares two elements with comparator, or their natural
+// ordering when it is null
+func (jvm *Jvm) compareElements(comparator, a, b StackData) (int32, error) {
+	var result StackData
+	var err error
+	if comparator.IsNull() {
+		if a.IsNull() {
+			return 0, throwable("java/lang/NullPointerException", "")
+		}
+		result, err = jvm.InvokeVirtual("java/lang/Comparable", "compareTo", "(Ljava/lang/Object;)I", []StackData{a, b})
+	} else {
+		result, err = jvm.InvokeVirtual("java/util/Comparator", "compare", "(Ljava/lang/Object;Ljava/lang/Object;)I", []StackData{comparator, a, b})
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.Int(), nil
+}
+
+// applyFunction calls the functional interface method of a lambda or any
+// object implementing it
+func (jvm *Jvm) applyFunction(function StackData, interfaceName, name, methodDescriptor string, args ...StackData) (StackData, error) {
+	if function.IsNull() {
+		return StackData{}, throwable("java/lang/NullPointerException", "")
+	}
+	return jvm.InvokeVirtual(interfaceName, name, methodDescriptor, append([]StackData{function}, args...))
+}
+
+func init() {
+	// The methods of a collection view based on its iterator
+	const className = "java/util/AbstractCollection"
+	RegisterNative(className, "isEmpty", "()Z", func(call *NativeCall) (StackData, error) {
+		size, err := call.Jvm.InvokeVirtual("java/util/Collection", "size", "()I", call.Args[:1])
+		return booleanValue(size.Int() == 0), err
+	})
+	RegisterNative(className, "contains", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		elements, err := call.Jvm.collectionElements(call.Args[0])
+		if err != nil {
+			return StackData{}, err
+		}
+		for _, element := range elements {
+			if equal, err := call.Jvm.javaEquals(call.Args[1], element); err != nil || equal {
+				return booleanValue(equal), err
+			}
+		}
+		return booleanValue(false), nil
+	})
+	RegisterNative(className, "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		elements, err := call.Jvm.collectionElements(call.Args[0])
+		if err != nil {
+			return StackData{}, err
+		}
+		return call.Jvm.collectionString(call.Args[0], elements)
+	})
+	RegisterNative(className, "forEach", "(Ljava/util/function/Consumer;)V", func(call *NativeCall) (StackData, error) {
+		elements, err := call.Jvm.collectionElements(call.Args[0])
+		if err != nil {
+			return StackData{}, err
+		}
+		for _, element := range elements {
+			if _, err := call.Jvm.applyFunction(call.Args[1], "java/util/function/Consumer", "accept", "(Ljava/lang/Object;)V", element); err != nil {
+				return StackData{}, err
+			}
+		}
+		return StackData{}, nil
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/binary"
 	"fmt"
+	"math"
 )
 
 type ConstantPoolTag uint8
@@ -22,7 +23,10 @@ const (
 	ConstantUtf8Tag               ConstantPoolTag = 1
 	ConstantMethodHandleTag       ConstantPoolTag = 15
 	ConstantMethodTypeTag         ConstantPoolTag = 16
+	ConstantDynamicTag            ConstantPoolTag = 17
 	ConstantInvokeDynamicTag      ConstantPoolTag = 18
+	ConstantModuleTag             ConstantPoolTag = 19
+	ConstantPackageTag            ConstantPoolTag = 20
 )
 
 func IsConstantPoolTag(v ConstantPoolTag) bool {
@@ -39,6 +43,8 @@ func IsConstantPoolTag(v ConstantPoolTag) bool {
 		return true
 	case ConstantInterfaceMethodRefTag:
 		return true
+	case ConstantDynamicTag:
+		return true
 	case ConstantInvokeDynamicTag:
 		return true
 	case ConstantLongTag:
@@ -55,6 +61,10 @@ func IsConstantPoolTag(v ConstantPoolTag) bool {
 		return true
 	case ConstantUtf8Tag:
 		return true
+	case ConstantModuleTag:
+		return true
+	case ConstantPackageTag:
+		return true
 	default:
 		return false
 	}
@@ -74,6 +84,8 @@ func (c ConstantPoolTag) String() string {
 		return "ConstantInteger"
 	case ConstantInterfaceMethodRefTag:
 		return "ConstantInterfaceMethodref"
+	case ConstantDynamicTag:
+		return "ConstantDynamic"
 	case ConstantInvokeDynamicTag:
 		return "ConstantInvokeDynamic"
 	case ConstantLongTag:
@@ -90,6 +102,10 @@ func (c ConstantPoolTag) String() string {
 		return "ConstantString"
 	case ConstantUtf8Tag:
 		return "ConstantUtf8"
+	case ConstantModuleTag:
+		return "ConstantModule"
+	case ConstantPackageTag:
+		return "ConstantPackage"
 	default:
 		panic(fmt.Sprintf("unexpected main.ConstantPoolTags: %#v", c))
 	}
@@ -138,6 +154,45 @@ type ConstantNameAndType struct {
 
 type ConstantUtf8 = string
 
+type ReferenceKind uint8
+
+const (
+	RefGetField         ReferenceKind = 1
+	RefGetStatic        ReferenceKind = 2
+	RefPutField         ReferenceKind = 3
+	RefPutStatic        ReferenceKind = 4
+	RefInvokeVirtual    ReferenceKind = 5
+	RefInvokeStatic     ReferenceKind = 6
+	RefInvokeSpecial    ReferenceKind = 7
+	RefNewInvokeSpecial ReferenceKind = 8
+	RefInvokeInterface  ReferenceKind = 9
+)
+
+func (k ReferenceKind) String() string {
+	switch k {
+	case RefGetField:
+		return "REF_getField"
+	case RefGetStatic:
+		return "REF_getStatic"
+	case RefPutField:
+		return "REF_putField"
+	case RefPutStatic:
+		return "REF_putStatic"
+	case RefInvokeVirtual:
+		return "REF_invokeVirtual"
+	case RefInvokeStatic:
+		return "REF_invokeStatic"
+	case RefInvokeSpecial:
+		return "REF_invokeSpecial"
+	case RefNewInvokeSpecial:
+		return "REF_newInvokeSpecial"
+	case RefInvokeInterface:
+		return "REF_invokeInterface"
+	default:
+		return fmt.Sprintf("REF_unknown(%d)", uint8(k))
+	}
+}
+
 type ConstantMethodHandle struct {
 	ReferenceKind  uint8
 	ReferenceIndex uint16
@@ -152,6 +207,21 @@ type ConstantInvokeDynamic struct {
 	NameAndTypeIndex         uint16
 }
 
+// ConstantDynamic is a dynamically computed constant, it shares the layout
+// of ConstantInvokeDynamic but its descriptor is a field descriptor
+type ConstantDynamic struct {
+	BootstrapMethodAttrIndex uint16
+	NameAndTypeIndex         uint16
+}
+
+type ConstantModule struct {
+	NameIndex uint16
+}
+
+type ConstantPackage struct {
+	NameIndex uint16
+}
+
 func ReadConstantPool(javaClassFile *bufio.Reader, sectionsReadBuffer []byte) (*ConstantInfo, error) {
 	if err := ReadSection(javaClassFile, sectionsReadBuffer[:1]); err != nil {
 		return nil, err
@@ -197,7 +267,7 @@ func ReadConstantPool(javaClassFile *bufio.Reader, sectionsReadBuffer []byte) (*
 
 		return &ConstantInfo{
 			Tag:  tag,
-			Data: ConstantDouble((int64(high) << 32) + int64(low)),
+			Data: ConstantDouble(math.Float64frombits((uint64(high) << 32) | uint64(low))),
 		}, nil
 	case ConstantFieldRefTag:
 		if err := ReadSection(javaClassFile, sectionsReadBuffer); err != nil {
@@ -216,7 +286,7 @@ func ReadConstantPool(javaClassFile *bufio.Reader, sectionsReadBuffer []byte) (*
 		}
 		return &ConstantInfo{
 			Tag:  tag,
-			Data: ConstantFloat(binary.BigEndian.Uint32(sectionsReadBuffer)),
+			Data: ConstantFloat(math.Float32frombits(binary.BigEndian.Uint32(sectionsReadBuffer))),
 		}, nil
 	case ConstantIntegerTag:
 		if err := ReadSection(javaClassFile, sectionsReadBuffer); err != nil {
@@ -248,6 +318,17 @@ func ReadConstantPool(javaClassFile *bufio.Reader, sectionsReadBuffer []byte) (*
 				NameAndTypeIndex:         binary.BigEndian.Uint16(sectionsReadBuffer[2:]),
 			},
 		}, nil
+	case ConstantDynamicTag:
+		if err := ReadSection(javaClassFile, sectionsReadBuffer); err != nil {
+			return nil, err
+		}
+		return &ConstantInfo{
+			Tag: tag,
+			Data: ConstantDynamic{
+				BootstrapMethodAttrIndex: binary.BigEndian.Uint16(sectionsReadBuffer),
+				NameAndTypeIndex:         binary.BigEndian.Uint16(sectionsReadBuffer[2:]),
+			},
+		}, nil
 	case ConstantLongTag:
 		if err := ReadSection(javaClassFile, sectionsReadBuffer); err != nil {
 			return nil, err
@@ -320,7 +401,106 @@ func ReadConstantPool(javaClassFile *bufio.Reader, sectionsReadBuffer []byte) (*
 			Tag:  tag,
 			Data: ConstantUtf8(string(ut8Buffer)),
 		}, nil
+	case ConstantModuleTag:
+		if err := ReadSection(javaClassFile, sectionsReadBuffer[:2]); err != nil {
+			return nil, err
+		}
+		return &ConstantInfo{
+			Tag: tag,
+			Data: ConstantModule{
+				NameIndex: binary.BigEndian.Uint16(sectionsReadBuffer),
+			},
+		}, nil
+	case ConstantPackageTag:
+		if err := ReadSection(javaClassFile, sectionsReadBuffer[:2]); err != nil {
+			return nil, err
+		}
+		return &ConstantInfo{
+			Tag: tag,
+			Data: ConstantPackage{
+				NameIndex: binary.BigEndian.Uint16(sectionsReadBuffer),
+			},
+		}, nil
 	default:
 		panic(fmt.Sprintf("unexpected main.ConstantPoolTag: %#v", tag))
 	}
 }
+
+// GetUtf8 returns the ConstantUtf8 at index, or an empty string if the
+// entry is missing or has another tag
+func GetUtf8(constantPool []*ConstantInfo, index uint16) string {
+	if index == 0 || int(index) > len(constantPool) || constantPool[index-1] == nil {
+		return ""
+	}
+	str, _ := constantPool[index-1].Data.(ConstantUtf8)
+	return str
+}
+
+// GetClassName resolves a ConstantClass index into its internal name
+func GetClassName(constantPool []*ConstantInfo, index uint16) string {
+	if index == 0 || int(index) > len(constantPool) || constantPool[index-1] == nil {
+		return ""
+	}
+	class, ok := constantPool[index-1].Data.(ConstantClass)
+	if !ok {
+		return ""
+	}
+	return GetUtf8(constantPool, class.NameIndex)
+}
+
+// GetNameAndType resolves a ConstantNameAndType index into its name and descriptor
+func GetNameAndType(constantPool []*ConstantInfo, index uint16) (string, string) {
+	if index == 0 || int(index) > len(constantPool) || constantPool[index-1] == nil {
+		return "", ""
+	}
+	nameAndType, ok := constantPool[index-1].Data.(ConstantNameAndType)
+	if !ok {
+		return "", ""
+	}
+	return GetUtf8(constantPool, nameAndType.NameIndex), GetUtf8(constantPool, nameAndType.DescriptorIndex)
+}
+
+// GetMemberRef resolves a field, method or interface method reference into
+// the class name, member name and member descriptor
+func GetMemberRef(constantPool []*ConstantInfo, index uint16) (string, string, string) {
+	if index == 0 || int(index) > len(constantPool) || constantPool[index-1] == nil {
+		return "", "", ""
+	}
+	var classIndex, nameAndTypeIndex uint16
+	switch ref := constantPool[index-1].Data.(type) {
+	case ConstantFieldRef:
+		classIndex, nameAndTypeIndex = ref.ClassIndex, ref.NameAndTypeIndex
+	case *ConstantMethodRef:
+		classIndex, nameAndTypeIndex = ref.ClassIndex, ref.NameAndTypeIndex
+	case ConstantInterfaceMethodRef:
+		classIndex, nameAndTypeIndex = ref.ClassIndex, ref.NameAndTypeIndex
+	default:
+		return "", "", ""
+	}
+	name, descriptor := GetNameAndType(constantPool, nameAndTypeIndex)
+	return GetClassName(constantPool, classIndex), name, descriptor
+}
+
+// GetModuleName resolves a ConstantModule index into the module name
+func GetModuleName(constantPool []*ConstantInfo, index uint16) string {
+	if index == 0 || int(index) > len(constantPool) || constantPool[index-1] == nil {
+		return ""
+	}
+	module, ok := constantPool[index-1].Data.(ConstantModule)
+	if !ok {
+		return ""
+	}
+	return GetUtf8(constantPool, module.NameIndex)
+}
+
+// GetPackageName resolves a ConstantPackage index into the internal package name
+func GetPackageName(constantPool []*ConstantInfo, index uint16) string {
+	if index == 0 || int(index) > len(constantPool) || constantPool[index-1] == nil {
+		return ""
+	}
+	pkg, ok := constantPool[index-1].Data.(ConstantPackage)
+	if !ok {
+		return ""
+	}
+	return GetUtf8(constantPool, pkg.NameIndex)
+}
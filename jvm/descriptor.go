@@ -2,66 +2,23 @@ package jvm
 
 import (
 	"fmt"
-	"strings"
-)
-
-func ParseBaseType(c byte) string {
-	switch c {
-	case 'B':
-		return "byte"
-	case 'C':
-		return "char"
-	case 'D':
-		return "double"
-	case 'F':
-		return "float"
-	case 'I':
-		return "int"
-	case 'J':
-		return "long"
-	case 'Z':
-		return "boolean"
-	case 'V':
-		return "void"
-	}
-	return ""
-}
-
-func ParseFieldType(descriptor string, pos *int) string {
-	bt := ParseBaseType(descriptor[*pos])
-	if len(bt) != 0 {
-		return bt
-	}
-	if descriptor[*pos] == '[' {
-		*pos += 1
-		return fmt.Sprintf("%s[]", ParseFieldType(descriptor, pos))
-	} else if descriptor[*pos] == 'L' {
-		semiColPos := strings.IndexByte(descriptor[*pos:], ';')
-		return strings.ReplaceAll(descriptor[*pos+1:semiColPos], "/", ".")
-	}
-	return ""
-}
 
-func ParseDescriptor(descriptor, name string) string {
-	isMethod := strings.HasPrefix(descriptor, "(")
-	if isMethod {
-		returnType := descriptor[len(descriptor)-1]
-		params := descriptor[1 : len(descriptor)-2]
-		paramsTypes := make([]string, 0)
-		if len(params) != 0 {
-			pos := 0
-			for pos < len(params) {
-				t := ParseFieldType(params, &pos)
-				pos += 1
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
 
-				if len(t) == 0 {
-					break
-				}
-				paramsTypes = append(paramsTypes, t)
-			}
+// ParseDescriptor formats a field or method descriptor as a Java declaration
+// of name, like `int sumar(int, int)`
+func ParseDescriptor(desc, name string) string {
+	if len(desc) != 0 && desc[0] == '(' {
+		method, err := descriptor.ParseMethod(desc)
+		if err != nil {
+			return fmt.Sprintf("<%s> %s", err, name)
 		}
-		return fmt.Sprintf("%s %s(%s)", ParseBaseType(returnType), name, strings.Join(paramsTypes, ", "))
+		return method.Format(name)
+	}
+	field, err := descriptor.ParseField(desc)
+	if err != nil {
+		return fmt.Sprintf("<%s> %s", err, name)
 	}
-	pos := 0
-	return fmt.Sprintf("%s %s", ParseFieldType(descriptor, &pos), name)
+	return fmt.Sprintf("%s %s", field, name)
 }
@@ -0,0 +1,260 @@
+// Package descriptor decodes the field and method descriptors of class
+// files (JVMS §4.3) into typed values
+package descriptor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is a field type, or void when used as a method return type
+type Type interface {
+	// Descriptor returns the type back in descriptor form
+	Descriptor() string
+	// String returns the type as written in Java source
+	String() string
+	// Slots is the number of local variables or operand stack entries taken
+	Slots() int
+}
+
+type BaseType byte
+
+const (
+	Byte    BaseType = 'B'
+	Char    BaseType = 'C'
+	Double  BaseType = 'D'
+	Float   BaseType = 'F'
+	Int     BaseType = 'I'
+	Long    BaseType = 'J'
+	Short   BaseType = 'S'
+	Boolean BaseType = 'Z'
+	Void    BaseType = 'V'
+)
+
+func (t BaseType) Descriptor() string {
+	return string(t)
+}
+
+func (t BaseType) String() string {
+	switch t {
+	case Byte:
+		return "byte"
+	case Char:
+		return "char"
+	case Double:
+		return "double"
+	case Float:
+		return "float"
+	case Int:
+		return "int"
+	case Long:
+		return "long"
+	case Short:
+		return "short"
+	case Boolean:
+		return "boolean"
+	case Void:
+		return "void"
+	}
+	return fmt.Sprintf("BaseType(%q)", byte(t))
+}
+
+func (t BaseType) Slots() int {
+	switch t {
+	case Long, Double:
+		return 2
+	case Void:
+		return 0
+	}
+	return 1
+}
+
+type ObjectType struct {
+	// Internal name of the class, like java/lang/String
+	ClassName string
+}
+
+func (t *ObjectType) Descriptor() string {
+	return "L" + t.ClassName + ";"
+}
+
+func (t *ObjectType) String() string {
+	return strings.ReplaceAll(t.ClassName, "/", ".")
+}
+
+func (t *ObjectType) Slots() int {
+	return 1
+}
+
+type ArrayType struct {
+	Component Type
+}
+
+func (t *ArrayType) Descriptor() string {
+	return "[" + t.Component.Descriptor()
+}
+
+func (t *ArrayType) String() string {
+	return t.Component.String() + "[]"
+}
+
+func (t *ArrayType) Slots() int {
+	return 1
+}
+
+// Dimensions returns the number of nested arrays
+func (t *ArrayType) Dimensions() int {
+	if component, ok := t.Component.(*ArrayType); ok {
+		return component.Dimensions() + 1
+	}
+	return 1
+}
+
+// Element returns the innermost non array component
+func (t *ArrayType) Element() Type {
+	if component, ok := t.Component.(*ArrayType); ok {
+		return component.Element()
+	}
+	return t.Component
+}
+
+type MethodType struct {
+	Params []Type
+	Return Type
+}
+
+func (t *MethodType) Descriptor() string {
+	var descriptor strings.Builder
+	descriptor.WriteByte('(')
+	for _, param := range t.Params {
+		descriptor.WriteString(param.Descriptor())
+	}
+	descriptor.WriteByte(')')
+	descriptor.WriteString(t.Return.Descriptor())
+	return descriptor.String()
+}
+
+func (t *MethodType) String() string {
+	return t.Format("")
+}
+
+// Format returns the method declaration in Java syntax, like
+// `java.lang.String name(int, long)`
+func (t *MethodType) Format(name string) string {
+	params := make([]string, len(t.Params))
+	for i, param := range t.Params {
+		params[i] = param.String()
+	}
+	if name == "" {
+		return fmt.Sprintf("%s (%s)", t.Return, strings.Join(params, ", "))
+	}
+	return fmt.Sprintf("%s %s(%s)", t.Return, name, strings.Join(params, ", "))
+}
+
+// ArgSlots is the number of local variables the arguments take, longs and
+// doubles count twice. The receiver of instance methods is not included
+func (t *MethodType) ArgSlots() int {
+	slots := 0
+	for _, param := range t.Params {
+		slots += param.Slots()
+	}
+	return slots
+}
+
+type SyntaxError struct {
+	Descriptor string
+	Pos        int
+	Msg        string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid descriptor %q at %d: %s", e.Descriptor, e.Pos, e.Msg)
+}
+
+// ParseFieldType decodes the field type starting at pos and advances pos
+// past it
+func ParseFieldType(descriptor string, pos *int) (Type, error) {
+	if *pos >= len(descriptor) {
+		return nil, &SyntaxError{descriptor, *pos, "unexpected end"}
+	}
+	switch c := BaseType(descriptor[*pos]); c {
+	case Byte, Char, Double, Float, Int, Long, Short, Boolean:
+		*pos += 1
+		return c, nil
+	case 'L':
+		end := strings.IndexByte(descriptor[*pos:], ';')
+		if end < 0 {
+			return nil, &SyntaxError{descriptor, *pos, "missing ; after class name"}
+		}
+		className := descriptor[*pos+1 : *pos+end]
+		if className == "" || strings.ContainsAny(className, ".[") {
+			return nil, &SyntaxError{descriptor, *pos, "invalid class name"}
+		}
+		*pos += end + 1
+		return &ObjectType{ClassName: className}, nil
+	case '[':
+		start := *pos
+		*pos += 1
+		component, err := ParseFieldType(descriptor, pos)
+		if err != nil {
+			return nil, err
+		}
+		array := &ArrayType{Component: component}
+		if array.Dimensions() > 255 {
+			return nil, &SyntaxError{descriptor, start, "more than 255 array dimensions"}
+		}
+		return array, nil
+	}
+	return nil, &SyntaxError{descriptor, *pos, fmt.Sprintf("unexpected %q", descriptor[*pos])}
+}
+
+// ParseField decodes a whole field descriptor
+func ParseField(descriptor string) (Type, error) {
+	pos := 0
+	t, err := ParseFieldType(descriptor, &pos)
+	if err != nil {
+		return nil, err
+	}
+	if pos != len(descriptor) {
+		return nil, &SyntaxError{descriptor, pos, "trailing characters"}
+	}
+	return t, nil
+}
+
+// ParseMethod decodes a whole method descriptor
+func ParseMethod(descriptor string) (*MethodType, error) {
+	if !strings.HasPrefix(descriptor, "(") {
+		return nil, &SyntaxError{descriptor, 0, "expected ("}
+	}
+	method := &MethodType{Params: make([]Type, 0)}
+	pos := 1
+	for pos < len(descriptor) && descriptor[pos] != ')' {
+		param, err := ParseFieldType(descriptor, &pos)
+		if err != nil {
+			return nil, err
+		}
+		method.Params = append(method.Params, param)
+	}
+	if pos >= len(descriptor) {
+		return nil, &SyntaxError{descriptor, pos, "missing )"}
+	}
+	pos += 1
+
+	if pos < len(descriptor) && BaseType(descriptor[pos]) == Void {
+		method.Return = Void
+		pos += 1
+	} else {
+		ret, err := ParseFieldType(descriptor, &pos)
+		if err != nil {
+			return nil, err
+		}
+		method.Return = ret
+	}
+	if pos != len(descriptor) {
+		return nil, &SyntaxError{descriptor, pos, "trailing characters"}
+	}
+	if method.ArgSlots() > 255 {
+		return nil, &SyntaxError{descriptor, 0, "more than 255 argument slots"}
+	}
+	return method, nil
+}
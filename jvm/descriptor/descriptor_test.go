@@ -0,0 +1,87 @@
+package descriptor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMethod(t *testing.T) {
+	tests := []struct {
+		descriptor string
+		// The method as Java source declares it
+		java  string
+		slots int
+	}{
+		{"()V", "void ()", 0},
+		{"([[ILjava/lang/String;J)Ljava/lang/Object;", "java.lang.Object (int[][], java.lang.String, long)", 4},
+		{"(BCDFIJSZ)[Z", "boolean[] (byte, char, double, float, int, long, short, boolean)", 10},
+		{"([Ljava/util/Map$Entry;)I", "int (java.util.Map$Entry[])", 1},
+	}
+	for _, test := range tests {
+		method, err := ParseMethod(test.descriptor)
+		if err != nil {
+			t.Errorf("ParseMethod(%q): %v", test.descriptor, err)
+			continue
+		}
+		if got := method.Descriptor(); got != test.descriptor {
+			t.Errorf("ParseMethod(%q).Descriptor() = %q", test.descriptor, got)
+		}
+		if got := method.String(); got != test.java {
+			t.Errorf("ParseMethod(%q).String() = %q, want %q", test.descriptor, got, test.java)
+		}
+		if got := method.ArgSlots(); got != test.slots {
+			t.Errorf("ParseMethod(%q).ArgSlots() = %d, want %d", test.descriptor, got, test.slots)
+		}
+	}
+}
+
+func TestParseField(t *testing.T) {
+	array, err := ParseField(strings.Repeat("[", 255) + "Ljava/lang/String;")
+	if err != nil {
+		t.Fatalf("255 dimensions: %v", err)
+	}
+	if dimensions := array.(*ArrayType).Dimensions(); dimensions != 255 {
+		t.Errorf("Dimensions() = %d, want 255", dimensions)
+	}
+	if element := array.(*ArrayType).Element(); element.Descriptor() != "Ljava/lang/String;" {
+		t.Errorf("Element() = %s", element.Descriptor())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		descriptor string
+		method     bool
+		want       string
+	}{
+		{"(Ljava/lang/String", true, `invalid descriptor "(Ljava/lang/String" at 1: missing ; after class name`},
+		{"L;", false, `invalid descriptor "L;" at 0: invalid class name`},
+		{"Ljava.lang.String;", false, `invalid descriptor "Ljava.lang.String;" at 0: invalid class name`},
+		{"(V)V", true, `invalid descriptor "(V)V" at 1: unexpected 'V'`},
+		{"V", false, `invalid descriptor "V" at 0: unexpected 'V'`},
+		{"[V", false, `invalid descriptor "[V" at 1: unexpected 'V'`},
+		{strings.Repeat("[", 256) + "I", false, `invalid descriptor "` + strings.Repeat("[", 256) + `I" at 0: more than 255 array dimensions`},
+		{"II", false, `invalid descriptor "II" at 1: trailing characters`},
+		{"()VV", true, `invalid descriptor "()VV" at 3: trailing characters`},
+		{"(I)Ljava/lang/Object;I", true, `invalid descriptor "(I)Ljava/lang/Object;I" at 21: trailing characters`},
+		{"I)V", true, `invalid descriptor "I)V" at 0: expected (`},
+		{"(I", true, `invalid descriptor "(I" at 2: missing )`},
+		{"()", true, `invalid descriptor "()" at 2: unexpected end`},
+		{"(" + strings.Repeat("J", 128) + ")V", true, `invalid descriptor "(` + strings.Repeat("J", 128) + `)V" at 0: more than 255 argument slots`},
+	}
+	for _, test := range tests {
+		var err error
+		if test.method {
+			_, err = ParseMethod(test.descriptor)
+		} else {
+			_, err = ParseField(test.descriptor)
+		}
+		if err == nil {
+			t.Errorf("%q parsed, want %s", test.descriptor, test.want)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("%q: got %s\nwant %s", test.descriptor, err, test.want)
+		}
+	}
+}
@@ -3,12 +3,16 @@ package jvm
 import (
 	"bufio"
 	"encoding/binary"
+
+	"github.com/Stolkerve/go-jvm/jvm/signature"
 )
 
 type FieldInfo struct {
 	AccessFlags     AccessFlag
 	NameIndex       uint16
+	Name            string
 	DescriptorIndex uint16
+	Descriptor      string
 	AttributesCount uint16
 	Attributes      []*AttributeInfo
 }
@@ -23,6 +27,9 @@ func ReadField(constantPool []*ConstantInfo, javaClassFile *bufio.Reader, sectio
 	field.DescriptorIndex = binary.BigEndian.Uint16(sectionsReadBuffer[4:])
 	field.AttributesCount = binary.BigEndian.Uint16(sectionsReadBuffer[6:])
 
+	field.Name = constantPool[field.NameIndex-1].Data.(ConstantUtf8)
+	field.Descriptor = constantPool[field.DescriptorIndex-1].Data.(ConstantUtf8)
+
 	field.Attributes = make([]*AttributeInfo, field.AttributesCount)
 	for i := range field.AttributesCount {
 		attribute, err := ReadAttribute(constantPool, javaClassFile, make([]byte, 4))
@@ -34,3 +41,22 @@ func ReadField(constantPool []*ConstantInfo, javaClassFile *bufio.Reader, sectio
 
 	return &field, nil
 }
+
+// Signature returns the generic type of the field, nil if it has none
+func (f *FieldInfo) Signature() (signature.ReferenceTypeSignature, error) {
+	attr := FindAttribute(f.Attributes, SignatureAttr)
+	if attr == nil {
+		return nil, nil
+	}
+	return signature.ParseField(attr.Data.(SignatureAttribute).Signature)
+}
+
+// ConstantValue returns the value a static final field is initialized with,
+// nil if it has none
+func (f *FieldInfo) ConstantValue() interface{} {
+	attr := FindAttribute(f.Attributes, ConstantValueAttr)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(ConstantValueAttribute).Value
+}
@@ -0,0 +1,543 @@
+package jvm
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// formatSpecifier matches a format specifier of java.util.Formatter:
+// %[argument_index$][flags][width][.precision]conversion
+var formatSpecifier = regexp.MustCompile(`%(\d+\$)?([-#+ 0,(<]*)?(\d+)?(\.\d+)?([tT])?([a-zA-Z%])`)
+
+// formatFlags are the flags of a format specifier
+type formatFlags struct {
+	leftJustify, alternate, plus, space, zeroPad, group, parentheses bool
+}
+
+// formatSpec is a parsed format specifier
+type formatSpec struct {
+	text       string
+	flags      formatFlags
+	width      int
+	precision  int
+	conversion byte
+	upper      bool
+}
+
+func illegalFormat(className, format string, a ...interface{}) error {
+	return throwable("java/util/"+className, format, a...)
+}
+
+// wrappedValue returns the primitive value and type of a wrapper object,
+// ok is false for other references
+func wrappedValue(value StackData) (t descriptor.BaseType, primitive StackData, ok bool) {
+	object, isObject := value.Data.(*Object)
+	if !isObject {
+		return 0, StackData{}, false
+	}
+	for base, wrapper := range wrapperClasses {
+		if object.Class.Name() == wrapper {
+			return base, object.Fields[wrapper+".value"], true
+		}
+	}
+	return 0, StackData{}, false
+}
+
+// formatString implements String.format
+func (jvm *Jvm) formatString(format string, args []StackData) (string, error) {
+	var out strings.Builder
+	ordinary, last := 0, -1
+	for len(format) > 0 {
+		percent := strings.IndexByte(format, '%')
+		if percent < 0 {
+			out.WriteString(format)
+			break
+		}
+		out.WriteString(format[:percent])
+		format = format[percent:]
+		match := formatSpecifier.FindStringSubmatchIndex(format)
+		if match == nil || match[0] != 0 {
+			conversion := "%"
+			if len(format) > 1 {
+				conversion = format[1:2]
+			}
+			return "", illegalFormat("UnknownFormatConversionException", "Conversion = '%s'", conversion)
+		}
+		specifier := format
+		group := func(i int) string {
+			if match[2*i] < 0 {
+				return ""
+			}
+			return specifier[match[2*i]:match[2*i+1]]
+		}
+		spec := formatSpec{text: group(0), width: -1, precision: -1, conversion: group(6)[0]}
+		format = format[match[1]:]
+		if group(5) != "" {
+			return "", illegalFormat("UnknownFormatConversionException", "Conversion = '%s'", group(5))
+		}
+		relative := false
+		for _, flag := range group(2) {
+			switch flag {
+			case '-':
+				spec.flags.leftJustify = true
+			case '#':
+				spec.flags.alternate = true
+			case '+':
+				spec.flags.plus = true
+			case ' ':
+				spec.flags.space = true
+			case '0':
+				spec.flags.zeroPad = true
+			case ',':
+				spec.flags.group = true
+			case '(':
+				spec.flags.parentheses = true
+			case '<':
+				relative = true
+			}
+		}
+		if group(3) != "" {
+			spec.width, _ = strconv.Atoi(group(3))
+		}
+		if group(4) != "" {
+			spec.precision, _ = strconv.Atoi(group(4)[1:])
+		}
+		if c := spec.conversion; c >= 'A' && c <= 'Z' {
+			spec.upper = true
+			spec.conversion = c + 'a' - 'A'
+		}
+		if (spec.flags.leftJustify || spec.flags.zeroPad) && spec.width < 0 {
+			return "", illegalFormat("MissingFormatWidthException", "%s", spec.text)
+		}
+		if spec.flags.leftJustify && spec.flags.zeroPad || spec.flags.plus && spec.flags.space {
+			return "", illegalFormat("IllegalFormatFlagsException", "Flags = '%s'", group(2))
+		}
+
+		switch spec.conversion {
+		case '%':
+			if spec.precision >= 0 {
+				return "", illegalFormat("IllegalFormatPrecisionException", "%d", spec.precision)
+			}
+			out.WriteString(pad("%", spec, false))
+			continue
+		case 'n':
+			out.WriteString("\n")
+			continue
+		}
+
+		// The argument
+		index := 0
+		switch {
+		case relative:
+			index = last
+		case group(1) != "":
+			index, _ = strconv.Atoi(strings.TrimSuffix(group(1), "$"))
+			index--
+		default:
+			index = ordinary
+			ordinary++
+		}
+		if index < 0 || index >= len(args) {
+			return "", illegalFormat("MissingFormatArgumentException", "Format specifier '%s'", spec.text)
+		}
+		last = index
+		s, err := jvm.formatArgument(spec, args[index])
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(s)
+	}
+	return out.String(), nil
+}
+
+// pad justifies s to the width of spec, with zeros after the sign or
+// prefix when numeric and zero padded
+func pad(s string, spec formatSpec, numeric bool) string {
+	if spec.upper {
+		s = strings.ToUpper(s)
+	}
+	n := len([]rune(s))
+	if spec.width <= n {
+		return s
+	}
+	padding := spec.width - n
+	switch {
+	case spec.flags.leftJustify:
+		return s + strings.Repeat(" ", padding)
+	case spec.flags.zeroPad && numeric:
+		prefix := 0
+		for prefix < len(s) && strings.IndexByte("+- (", s[prefix]) >= 0 {
+			prefix++
+		}
+		if strings.HasPrefix(s[prefix:], "0x") || strings.HasPrefix(s[prefix:], "0X") {
+			prefix += 2
+		}
+		return s[:prefix] + strings.Repeat("0", padding) + s[prefix:]
+	}
+	return strings.Repeat(" ", padding) + s
+}
+
+// groupDigits inserts a comma every three digits of the integer part of a
+// number
+func groupDigits(digits string) string {
+	integer, fraction, hasFraction := strings.Cut(digits, ".")
+	var out strings.Builder
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			out.WriteByte(',')
+		}
+		out.WriteRune(c)
+	}
+	if hasFraction {
+		out.WriteString("." + fraction)
+	}
+	return out.String()
+}
+
+// signed adds the sign of a number to its magnitude according to the flags
+func signed(magnitude string, negative bool, flags formatFlags) string {
+	switch {
+	case negative && flags.parentheses:
+		return "(" + magnitude + ")"
+	case negative:
+		return "-" + magnitude
+	case flags.plus:
+		return "+" + magnitude
+	case flags.space:
+		return " " + magnitude
+	}
+	return magnitude
+}
+
+func (jvm *Jvm) formatArgument(spec formatSpec, arg StackData) (string, error) {
+	mismatch := func() error {
+		if arg.IsNull() {
+			return nil
+		}
+		return illegalFormat("IllegalFormatConversionException", "%c != %s", spec.conversion, strings.ReplaceAll(jvm.referenceClassName(arg), "/", "."))
+	}
+	flagsMismatch := func(flags string) error {
+		return illegalFormat("FormatFlagsConversionMismatchException", "Conversion = %c, Flags = %s", spec.conversion, flags)
+	}
+	t, value, wrapped := wrappedValue(arg)
+	switch spec.conversion {
+	case 'b', 'h', 's':
+		if spec.flags.alternate {
+			return "", flagsMismatch("#")
+		}
+		var s string
+		switch {
+		case arg.IsNull():
+			s = "null"
+			if spec.conversion == 'b' {
+				s = "false"
+			}
+		case spec.conversion == 'b':
+			s = strconv.FormatBool(t != descriptor.Boolean || value.Int() != 0)
+		case spec.conversion == 'h':
+			hash, err := jvm.javaHashCode(arg)
+			if err != nil {
+				return "", err
+			}
+			s = strconv.FormatUint(uint64(uint32(hash)), 16)
+		default:
+			javaString, err := jvm.toJavaString(arg, objectType)
+			if err != nil {
+				return "", err
+			}
+			s = javaString.String()
+		}
+		if spec.precision >= 0 && spec.precision < len([]rune(s)) {
+			s = string([]rune(s)[:spec.precision])
+		}
+		return pad(s, spec, false), nil
+
+	case 'c':
+		if spec.precision >= 0 {
+			return "", illegalFormat("IllegalFormatPrecisionException", "%d", spec.precision)
+		}
+		if arg.IsNull() {
+			return pad("null", spec, false), nil
+		}
+		switch t {
+		case descriptor.Char, descriptor.Byte, descriptor.Short, descriptor.Int:
+			if !wrapped {
+				break
+			}
+			codePoint := value.Int()
+			if t == descriptor.Char {
+				codePoint = int32(uint16(codePoint))
+			}
+			if codePoint < 0 || codePoint > 0x10FFFF {
+				return "", illegalFormat("IllegalFormatCodePointException", "Code point = 0x%x", codePoint)
+			}
+			return pad(string(rune(codePoint)), spec, false), nil
+		}
+		return "", mismatch()
+
+	case 'd', 'o', 'x':
+		if arg.IsNull() {
+			return pad("null", spec, false), nil
+		}
+		if spec.precision >= 0 {
+			return "", illegalFormat("IllegalFormatPrecisionException", "%d", spec.precision)
+		}
+		var v int64
+		var bits int
+		switch {
+		case wrapped && t == descriptor.Long:
+			v, bits = value.Long(), 64
+		case wrapped && t == descriptor.Int:
+			v, bits = int64(value.Int()), 32
+		case wrapped && t == descriptor.Short:
+			v, bits = int64(value.Int()), 16
+		case wrapped && t == descriptor.Byte:
+			v, bits = int64(value.Int()), 8
+		default:
+			return "", mismatch()
+		}
+		if spec.conversion == 'd' {
+			if spec.flags.alternate {
+				return "", flagsMismatch("#")
+			}
+			magnitude := strconv.FormatUint(uint64(v), 10)
+			if v < 0 {
+				magnitude = strconv.FormatUint(uint64(-v), 10)
+			}
+			if spec.flags.group {
+				magnitude = groupDigits(magnitude)
+			}
+			return pad(signed(magnitude, v < 0, spec.flags), spec, true), nil
+		}
+		if spec.flags.plus || spec.flags.space || spec.flags.group || spec.flags.parentheses {
+			return "", flagsMismatch("+ ,(")
+		}
+		// Negative values are shown as unsigned values of the size of the type
+		unsigned := uint64(v)
+		if bits < 64 {
+			unsigned &= 1<<bits - 1
+		}
+		var s string
+		if spec.conversion == 'o' {
+			s = strconv.FormatUint(unsigned, 8)
+			if spec.flags.alternate {
+				s = "0" + s
+			}
+		} else {
+			s = strconv.FormatUint(unsigned, 16)
+			if spec.flags.alternate {
+				s = "0x" + s
+			}
+		}
+		return pad(s, spec, true), nil
+
+	case 'e', 'f', 'g', 'a':
+		if arg.IsNull() {
+			return pad("null", spec, false), nil
+		}
+		var v float64
+		bitSize := 64
+		switch {
+		case wrapped && t == descriptor.Double:
+			v = value.Double()
+		case wrapped && t == descriptor.Float:
+			v, bitSize = float64(value.Float()), 32
+		default:
+			return "", mismatch()
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			s := "NaN"
+			if math.IsInf(v, 0) {
+				s = signed("Infinity", v < 0, spec.flags)
+			}
+			return pad(s, spec, false), nil
+		}
+		negative := math.Signbit(v)
+		magnitude := math.Abs(v)
+		var s string
+		switch spec.conversion {
+		case 'a':
+			s = javaHexFloat(magnitude, bitSize, spec.precision)
+		case 'e':
+			precision := spec.precision
+			if precision < 0 {
+				precision = 6
+			}
+			s = scientificDigits(shortestDigits(magnitude, bitSize), precision)
+		case 'f':
+			precision := spec.precision
+			if precision < 0 {
+				precision = 6
+			}
+			s = fixedDigits(shortestDigits(magnitude, bitSize), precision)
+		case 'g':
+			precision := spec.precision
+			switch {
+			case precision < 0:
+				precision = 6
+			case precision == 0:
+				precision = 1
+			}
+			if spec.flags.alternate {
+				return "", flagsMismatch("#")
+			}
+			// Scientific notation unless the rounded value is in [10^-4, 10^precision)
+			rounded, _ := strconv.ParseFloat(scientificDigits(shortestDigits(magnitude, bitSize), precision-1), 64)
+			if rounded != 0 && (rounded < 1e-4 || rounded >= math.Pow10(precision)) {
+				s = scientificDigits(shortestDigits(magnitude, bitSize), precision-1)
+			} else {
+				exponent := 0
+				if rounded != 0 {
+					exponent = int(math.Floor(math.Log10(rounded)))
+				}
+				s = fixedDigits(shortestDigits(magnitude, bitSize), precision-1-exponent)
+			}
+		}
+		if spec.flags.group && spec.conversion != 'e' && spec.conversion != 'a' {
+			s = groupDigits(s)
+		}
+		return pad(signed(s, negative, spec.flags), spec, true), nil
+	}
+	return "", illegalFormat("UnknownFormatConversionException", "Conversion = '%c'", spec.conversion)
+}
+
+// decimalDigits is a decimal number: digits with the decimal point after
+// the first exponent+1 of them
+type decimalDigits struct {
+	digits   string
+	exponent int
+}
+
+// shortestDigits returns the shortest decimal digits that uniquely
+// identify v, like Double.toString and Float.toString use. Java formats
+// from them and rounds half up
+func shortestDigits(v float64, bitSize int) decimalDigits {
+	s := strconv.FormatFloat(v, 'e', -1, bitSize)
+	if mantissa, _, _ := strings.Cut(s, "e"); len(mantissa) == 1 {
+		// When one digit is enough Java takes the closest of the two digit
+		// decimals which identify v, 4.9E-324 rather than 5.0E-324
+		if two := strconv.FormatFloat(v, 'e', 1, bitSize); two[2] != '0' {
+			if parsed, err := strconv.ParseFloat(two, bitSize); err == nil && parsed == v {
+				s = two
+			}
+		}
+	}
+	mantissa, exponentText, _ := strings.Cut(s, "e")
+	exponent, _ := strconv.Atoi(exponentText)
+	return decimalDigits{digits: strings.Replace(mantissa, ".", "", 1), exponent: exponent}
+}
+
+// round rounds d half up to n significant digits, n may be 0 or negative.
+// A carry makes the result one digit longer
+func (d decimalDigits) round(n int) decimalDigits {
+	if n >= len(d.digits) {
+		return decimalDigits{d.digits + strings.Repeat("0", n-len(d.digits)), d.exponent}
+	}
+	if n < 0 {
+		return decimalDigits{"0", d.exponent}
+	}
+	digits := []byte("0" + d.digits[:n])
+	if d.digits[n] >= '5' {
+		i := len(digits) - 1
+		for digits[i] == '9' {
+			digits[i] = '0'
+			i--
+		}
+		digits[i]++
+	}
+	if digits[0] == '0' {
+		return decimalDigits{string(digits[1:]), d.exponent}
+	}
+	// A carry added a digit
+	return decimalDigits{string(digits), d.exponent + 1}
+}
+
+// fixedDigits formats d with precision digits after the decimal point
+func fixedDigits(d decimalDigits, precision int) string {
+	if d.digits == "0" {
+		d.exponent = 0
+	}
+	rounded := d.round(d.exponent + 1 + precision)
+	digits, exponent := rounded.digits, rounded.exponent
+	if len(digits) == 0 || strings.Trim(digits, "0") == "" {
+		digits, exponent = strings.Repeat("0", precision+1), 0
+	}
+	var integer, fraction string
+	if exponent >= 0 {
+		digits += strings.Repeat("0", max(0, exponent+1+precision-len(digits)))
+		integer, fraction = digits[:exponent+1], digits[exponent+1:]
+	} else {
+		integer = "0"
+		fraction = strings.Repeat("0", -exponent-1) + digits
+	}
+	if len(fraction) > precision {
+		fraction = fraction[:precision]
+	}
+	fraction += strings.Repeat("0", precision-len(fraction))
+	if precision == 0 {
+		return integer
+	}
+	return integer + "." + fraction
+}
+
+// scientificDigits formats d as d.ddde+xx with precision fraction digits
+func scientificDigits(d decimalDigits, precision int) string {
+	if d.digits == "0" {
+		d.exponent = 0
+	}
+	rounded := d.round(precision + 1)
+	mantissa := rounded.digits[:1]
+	if precision > 0 {
+		mantissa += "." + rounded.digits[1:precision+1]
+	}
+	sign := "+"
+	exponent := rounded.exponent
+	if exponent < 0 {
+		sign, exponent = "-", -exponent
+	}
+	return mantissa + "e" + sign + strings.Repeat("0", max(0, 2-len(strconv.Itoa(exponent)))) + strconv.Itoa(exponent)
+}
+
+// javaHexFloat formats v like Double.toHexString, 0x1.8p1, with precision
+// hexadecimal digits when it is not negative
+func javaHexFloat(v float64, bitSize, precision int) string {
+	if v == 0 {
+		return "0x0.0p0"
+	}
+	s := strconv.FormatFloat(v, 'x', precision, bitSize)
+	mantissa, exponent, _ := strings.Cut(s, "p")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	exponentValue, _ := strconv.Atoi(exponent)
+	return mantissa + "p" + strconv.Itoa(exponentValue)
+}
+
+func init() {
+	format := func(call *NativeCall) (StackData, error) {
+		// The format follows the locale, or is the receiver of formatted
+		formatIndex := 0
+		if strings.HasPrefix(call.Descriptor, "(Ljava/util/Locale;") {
+			formatIndex = 1
+		}
+		if call.Args[formatIndex].IsNull() {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		var args []StackData
+		if array, ok := call.Reference(len(call.Args) - 1).(*Array); ok {
+			args = array.Elements
+		}
+		s, err := call.Jvm.formatString(call.GoString(formatIndex), args)
+		if err != nil {
+			return StackData{}, err
+		}
+		return referenceValue(NewString(s)), nil
+	}
+	RegisterNative("java/lang/String", "format", "(Ljava/lang/String;[Ljava/lang/Object;)Ljava/lang/String;", format)
+	RegisterNative("java/lang/String", "format", "(Ljava/util/Locale;Ljava/lang/String;[Ljava/lang/Object;)Ljava/lang/String;", format)
+	RegisterNative("java/lang/String", "formatted", "([Ljava/lang/Object;)Ljava/lang/String;", format)
+}
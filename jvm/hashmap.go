@@ -0,0 +1,600 @@
+package jvm
+
+import (
+	"maps"
+	"strings"
+)
+
+const (
+	mapTable     = "java/util/HashMap.table"
+	mapSize      = "java/util/HashMap.size"
+	mapThreshold = "java/util/HashMap.threshold"
+	nodeHash     = "java/util/HashMap$Node.hash"
+	nodeKey      = "java/util/HashMap$Node.key"
+	nodeValue    = "java/util/HashMap$Node.value"
+	nodeNext     = "java/util/HashMap$Node.next"
+
+	// The capacity of a HashMap created without one and the capacity of the
+	// largest table
+	defaultCapacity = 16
+	maximumCapacity = 1 << 30
+)
+
+// Kinds of HashMap views and iterators
+const (
+	mapKeys = iota
+	mapValues
+	mapEntries
+)
+
+// spreadHash mixes the high bits of a hashCode into the low ones used to
+// select a bin, as HashMap.hash does
+func spreadHash(h int32) int32 {
+	return h ^ int32(uint32(h)>>16)
+}
+
+// tableSizeFor returns the smallest power of two at least capacity
+func tableSizeFor(capacity int32) int32 {
+	n := int32(1)
+	for n < capacity && n < maximumCapacity {
+		n <<= 1
+	}
+	return n
+}
+
+func nodeOf(value StackData) *Object {
+	node, _ := value.Data.(*Object)
+	return node
+}
+
+func mapTableOf(m *Object) *Array {
+	table, _ := m.Fields[mapTable].Data.(*Array)
+	return table
+}
+
+func (jvm *Jvm) mapHash(key StackData) (int32, error) {
+	h, err := jvm.javaHashCode(key)
+	return spreadHash(h), err
+}
+
+// findNode returns the node of key in a HashMap, nil if there is none
+func (jvm *Jvm) findNode(m *Object, key StackData) (*Object, error) {
+	table := mapTableOf(m)
+	if table == nil || len(table.Elements) == 0 {
+		return nil, nil
+	}
+	hash, err := jvm.mapHash(key)
+	if err != nil {
+		return nil, err
+	}
+	for node := nodeOf(table.Elements[int(hash)&(len(table.Elements)-1)]); node != nil; node = nodeOf(node.Fields[nodeNext]) {
+		if node.Fields[nodeHash].Int() != hash {
+			continue
+		}
+		if equal, err := jvm.javaEquals(key, node.Fields[nodeKey]); err != nil || equal {
+			return node, err
+		}
+	}
+	return nil, nil
+}
+
+// resizeMap initializes or doubles the table of a HashMap, splitting every
+// bin into the ones of the same index and of the index plus the old
+// capacity while keeping the order of the nodes
+func resizeMap(m *Object) *Array {
+	oldTable := mapTableOf(m)
+	oldCapacity := int32(0)
+	if oldTable != nil {
+		oldCapacity = int32(len(oldTable.Elements))
+	}
+	oldThreshold := m.Fields[mapThreshold].Int()
+	var newCapacity, newThreshold int32
+	switch {
+	case oldCapacity >= maximumCapacity:
+		m.Fields[mapThreshold] = intValue(1<<31 - 1)
+		return oldTable
+	case oldCapacity > 0:
+		newCapacity = oldCapacity << 1
+		if oldCapacity >= defaultCapacity {
+			newThreshold = oldThreshold << 1
+		} else {
+			newThreshold = newCapacity * 3 / 4
+		}
+	case oldThreshold > 0:
+		// The initial capacity given to the constructor
+		newCapacity, newThreshold = oldThreshold, oldThreshold*3/4
+	default:
+		newCapacity, newThreshold = defaultCapacity, defaultCapacity*3/4
+	}
+	table := NewArray("[Ljava/util/HashMap$Node;", int(newCapacity))
+	if oldTable != nil {
+		for j, bin := range oldTable.Elements {
+			var lo, hi []*Object
+			for node := nodeOf(bin); node != nil; node = nodeOf(node.Fields[nodeNext]) {
+				if node.Fields[nodeHash].Int()&oldCapacity == 0 {
+					lo = append(lo, node)
+				} else {
+					hi = append(hi, node)
+				}
+			}
+			table.Elements[j] = linkNodes(lo)
+			table.Elements[j+int(oldCapacity)] = linkNodes(hi)
+		}
+	}
+	m.Fields[mapTable] = referenceValue(table)
+	m.Fields[mapThreshold] = intValue(newThreshold)
+	return table
+}
+
+// linkNodes chains nodes in order and returns the first one
+func linkNodes(nodes []*Object) StackData {
+	if len(nodes) == 0 {
+		return nullReference
+	}
+	for i, node := range nodes {
+		if i+1 < len(nodes) {
+			node.Fields[nodeNext] = referenceValue(nodes[i+1])
+		} else {
+			node.Fields[nodeNext] = nullReference
+		}
+	}
+	return referenceValue(nodes[0])
+}
+
+// putValue maps key to value in a HashMap and returns the previous value.
+// An existing mapping to a non null value is kept when onlyIfAbsent
+func (jvm *Jvm) putValue(m *Object, key, value StackData, onlyIfAbsent bool) (StackData, error) {
+	hash, err := jvm.mapHash(key)
+	if err != nil {
+		return StackData{}, err
+	}
+	table := mapTableOf(m)
+	if table == nil || len(table.Elements) == 0 {
+		table = resizeMap(m)
+	}
+	index := int(hash) & (len(table.Elements) - 1)
+	var last *Object
+	for node := nodeOf(table.Elements[index]); node != nil; node = nodeOf(node.Fields[nodeNext]) {
+		if node.Fields[nodeHash].Int() == hash {
+			equal, err := jvm.javaEquals(key, node.Fields[nodeKey])
+			if err != nil {
+				return StackData{}, err
+			}
+			if equal {
+				old := node.Fields[nodeValue]
+				if !onlyIfAbsent || old.IsNull() {
+					node.Fields[nodeValue] = value
+				}
+				return old, nil
+			}
+		}
+		last = node
+	}
+	node, err := jvm.libraryObject("java/util/HashMap$Node")
+	if err != nil {
+		return StackData{}, err
+	}
+	node.Fields[nodeHash] = intValue(hash)
+	node.Fields[nodeKey] = key
+	node.Fields[nodeValue] = value
+	if last == nil {
+		table.Elements[index] = referenceValue(node)
+	} else {
+		last.Fields[nodeNext] = referenceValue(node)
+	}
+	size := m.Fields[mapSize].Int() + 1
+	m.Fields[mapSize] = intValue(size)
+	if size > m.Fields[mapThreshold].Int() {
+		resizeMap(m)
+	}
+	return nullReference, nil
+}
+
+// removeNode unlinks the node of key from a HashMap and returns it, nil if
+// there is none
+func (jvm *Jvm) removeNode(m *Object, key StackData) (*Object, error) {
+	target, err := jvm.findNode(m, key)
+	if target == nil || err != nil {
+		return nil, err
+	}
+	table := mapTableOf(m)
+	index := int(target.Fields[nodeHash].Int()) & (len(table.Elements) - 1)
+	if nodeOf(table.Elements[index]) == target {
+		table.Elements[index] = target.Fields[nodeNext]
+	} else {
+		for node := nodeOf(table.Elements[index]); node != nil; node = nodeOf(node.Fields[nodeNext]) {
+			if nodeOf(node.Fields[nodeNext]) == target {
+				node.Fields[nodeNext] = target.Fields[nodeNext]
+				break
+			}
+		}
+	}
+	m.Fields[mapSize] = intValue(m.Fields[mapSize].Int() - 1)
+	return target, nil
+}
+
+// mapNodes returns the nodes of a HashMap in iteration order
+func mapNodes(m *Object) []*Object {
+	var nodes []*Object
+	if table := mapTableOf(m); table != nil {
+		for _, bin := range table.Elements {
+			for node := nodeOf(bin); node != nil; node = nodeOf(node.Fields[nodeNext]) {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	return nodes
+}
+
+// nodeElement returns what an iterator or view of the given kind yields
+// for a node
+func nodeElement(node *Object, kind int32) StackData {
+	switch kind {
+	case mapKeys:
+		return node.Fields[nodeKey]
+	case mapValues:
+		return node.Fields[nodeValue]
+	}
+	return referenceValue(node)
+}
+
+// mapView creates the keySet, values or entrySet view of a HashMap
+func (jvm *Jvm) mapView(className string, m StackData) (StackData, error) {
+	view, err := jvm.libraryObject(className)
+	if err != nil {
+		return StackData{}, err
+	}
+	view.Fields[className+".this$0"] = m
+	return referenceValue(view), nil
+}
+
+// advanceIterator moves a HashIterator to the node after node
+func advanceIterator(iterator *Object, node *Object) {
+	table := mapTableOf(iterator.Fields["java/util/HashMap$HashIterator.this$0"].Data.(*Object))
+	index := iterator.Fields["java/util/HashMap$HashIterator.index"].Int()
+	var next *Object
+	if node != nil {
+		next = nodeOf(node.Fields[nodeNext])
+	}
+	for next == nil && table != nil && int(index) < len(table.Elements) {
+		next = nodeOf(table.Elements[index])
+		index++
+	}
+	iterator.Fields["java/util/HashMap$HashIterator.index"] = intValue(index)
+	if next == nil {
+		iterator.Fields["java/util/HashMap$HashIterator.next"] = nullReference
+	} else {
+		iterator.Fields["java/util/HashMap$HashIterator.next"] = referenceValue(next)
+	}
+}
+
+// entryString formats a map entry as key=value
+func (jvm *Jvm) entryString(self StackData, key, value StackData) (string, error) {
+	var parts [2]string
+	for i, v := range []StackData{key, value} {
+		if sameReference(v, self) {
+			parts[i] = "(this Map)"
+			continue
+		}
+		s, err := jvm.toJavaString(v, objectType)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = s.String()
+	}
+	return parts[0] + "=" + parts[1], nil
+}
+
+func init() {
+	const mapClass = "java/util/HashMap"
+	hashMap := func(call *NativeCall) *Object {
+		return call.Object(0)
+	}
+	construct := func(call *NativeCall) (StackData, error) {
+		switch call.Descriptor {
+		case "(I)V", "(IF)V":
+			capacity := call.Int(1)
+			if capacity < 0 {
+				return StackData{}, throwable("java/lang/IllegalArgumentException", "Illegal initial capacity: %d", capacity)
+			}
+			hashMap(call).Fields[mapThreshold] = intValue(tableSizeFor(capacity))
+		case "(Ljava/util/Map;)V":
+			return call.Jvm.InvokeVirtual(mapClass, "putAll", "(Ljava/util/Map;)V", call.Args)
+		}
+		return StackData{}, nil
+	}
+	for _, methodDescriptor := range []string{"()V", "(I)V", "(IF)V", "(Ljava/util/Map;)V"} {
+		RegisterNative(mapClass, "<init>", methodDescriptor, construct)
+	}
+
+	RegisterNative(mapClass, "size", "()I", func(call *NativeCall) (StackData, error) {
+		return hashMap(call).Fields[mapSize], nil
+	})
+	RegisterNative(mapClass, "isEmpty", "()Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(hashMap(call).Fields[mapSize].Int() == 0), nil
+	})
+	RegisterNative(mapClass, "put", "(Ljava/lang/Object;Ljava/lang/Object;)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		return call.Jvm.putValue(hashMap(call), call.Args[1], call.Args[2], false)
+	})
+	RegisterNative(mapClass, "putIfAbsent", "(Ljava/lang/Object;Ljava/lang/Object;)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		return call.Jvm.putValue(hashMap(call), call.Args[1], call.Args[2], true)
+	})
+	RegisterNative(mapClass, "putAll", "(Ljava/util/Map;)V", func(call *NativeCall) (StackData, error) {
+		entrySet, err := call.Jvm.InvokeVirtual("java/util/Map", "entrySet", "()Ljava/util/Set;", call.Args[1:2])
+		if err != nil {
+			return StackData{}, err
+		}
+		entries, err := call.Jvm.collectionElements(entrySet)
+		if err != nil {
+			return StackData{}, err
+		}
+		for _, entry := range entries {
+			key, err := call.Jvm.InvokeVirtual("java/util/Map$Entry", "getKey", "()Ljava/lang/Object;", []StackData{entry})
+			if err != nil {
+				return StackData{}, err
+			}
+			value, err := call.Jvm.InvokeVirtual("java/util/Map$Entry", "getValue", "()Ljava/lang/Object;", []StackData{entry})
+			if err != nil {
+				return StackData{}, err
+			}
+			if _, err := call.Jvm.putValue(hashMap(call), key, value, false); err != nil {
+				return StackData{}, err
+			}
+		}
+		return StackData{}, nil
+	})
+	get := func(call *NativeCall) (StackData, error) {
+		node, err := call.Jvm.findNode(hashMap(call), call.Args[1])
+		switch {
+		case err != nil:
+			return StackData{}, err
+		case node != nil:
+			return node.Fields[nodeValue], nil
+		case call.Name == "getOrDefault":
+			return call.Args[2], nil
+		}
+		return nullReference, nil
+	}
+	RegisterNative(mapClass, "get", "(Ljava/lang/Object;)Ljava/lang/Object;", get)
+	RegisterNative(mapClass, "getOrDefault", "(Ljava/lang/Object;Ljava/lang/Object;)Ljava/lang/Object;", get)
+	RegisterNative(mapClass, "containsKey", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		node, err := call.Jvm.findNode(hashMap(call), call.Args[1])
+		return booleanValue(node != nil), err
+	})
+	RegisterNative(mapClass, "containsValue", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		for _, node := range mapNodes(hashMap(call)) {
+			if equal, err := call.Jvm.javaEquals(call.Args[1], node.Fields[nodeValue]); err != nil || equal {
+				return booleanValue(equal), err
+			}
+		}
+		return booleanValue(false), nil
+	})
+	RegisterNative(mapClass, "remove", "(Ljava/lang/Object;)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		node, err := call.Jvm.removeNode(hashMap(call), call.Args[1])
+		if node == nil || err != nil {
+			return nullReference, err
+		}
+		return node.Fields[nodeValue], nil
+	})
+	RegisterNative(mapClass, "clear", "()V", func(call *NativeCall) (StackData, error) {
+		if table := mapTableOf(hashMap(call)); table != nil {
+			for i := range table.Elements {
+				table.Elements[i] = nullReference
+			}
+		}
+		hashMap(call).Fields[mapSize] = intValue(0)
+		return StackData{}, nil
+	})
+	RegisterNative(mapClass, "merge", "(Ljava/lang/Object;Ljava/lang/Object;Ljava/util/function/BiFunction;)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		m, key, value := hashMap(call), call.Args[1], call.Args[2]
+		if value.IsNull() || call.Args[3].IsNull() {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		node, err := call.Jvm.findNode(m, key)
+		if err != nil {
+			return StackData{}, err
+		}
+		if node != nil && !node.Fields[nodeValue].IsNull() {
+			value, err = call.Jvm.applyFunction(call.Args[3], "java/util/function/BiFunction", "apply", "(Ljava/lang/Object;Ljava/lang/Object;)Ljava/lang/Object;", node.Fields[nodeValue], value)
+			if err != nil {
+				return StackData{}, err
+			}
+			if value.IsNull() {
+				_, err = call.Jvm.removeNode(m, key)
+				return nullReference, err
+			}
+		}
+		_, err = call.Jvm.putValue(m, key, value, false)
+		return value, err
+	})
+	RegisterNative(mapClass, "computeIfAbsent", "(Ljava/lang/Object;Ljava/util/function/Function;)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		m, key := hashMap(call), call.Args[1]
+		node, err := call.Jvm.findNode(m, key)
+		if err != nil {
+			return StackData{}, err
+		}
+		if node != nil && !node.Fields[nodeValue].IsNull() {
+			return node.Fields[nodeValue], nil
+		}
+		value, err := call.Jvm.applyFunction(call.Args[2], "java/util/function/Function", "apply", "(Ljava/lang/Object;)Ljava/lang/Object;", key)
+		if err != nil || value.IsNull() {
+			return value, err
+		}
+		_, err = call.Jvm.putValue(m, key, value, false)
+		return value, err
+	})
+	RegisterNative(mapClass, "forEach", "(Ljava/util/function/BiConsumer;)V", func(call *NativeCall) (StackData, error) {
+		for _, node := range mapNodes(hashMap(call)) {
+			if _, err := call.Jvm.applyFunction(call.Args[1], "java/util/function/BiConsumer", "accept", "(Ljava/lang/Object;Ljava/lang/Object;)V", node.Fields[nodeKey], node.Fields[nodeValue]); err != nil {
+				return StackData{}, err
+			}
+		}
+		return StackData{}, nil
+	})
+	RegisterNative(mapClass, "keySet", "()Ljava/util/Set;", func(call *NativeCall) (StackData, error) {
+		return call.Jvm.mapView("java/util/HashMap$KeySet", call.Args[0])
+	})
+	RegisterNative(mapClass, "values", "()Ljava/util/Collection;", func(call *NativeCall) (StackData, error) {
+		return call.Jvm.mapView("java/util/HashMap$Values", call.Args[0])
+	})
+	RegisterNative(mapClass, "entrySet", "()Ljava/util/Set;", func(call *NativeCall) (StackData, error) {
+		return call.Jvm.mapView("java/util/HashMap$EntrySet", call.Args[0])
+	})
+	RegisterNative(mapClass, "clone", "()Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		// The copy has its own table and nodes
+		clone := &Object{Class: hashMap(call).Class, Fields: maps.Clone(hashMap(call).Fields)}
+		clone.Fields[mapTable] = nullReference
+		clone.Fields[mapSize] = intValue(0)
+		clone.Fields[mapThreshold] = intValue(0)
+		for _, node := range mapNodes(hashMap(call)) {
+			if _, err := call.Jvm.putValue(clone, node.Fields[nodeKey], node.Fields[nodeValue], false); err != nil {
+				return StackData{}, err
+			}
+		}
+		return referenceValue(clone), nil
+	})
+	RegisterNative(mapClass, "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		var parts []string
+		for _, node := range mapNodes(hashMap(call)) {
+			s, err := call.Jvm.entryString(call.Args[0], node.Fields[nodeKey], node.Fields[nodeValue])
+			if err != nil {
+				return StackData{}, err
+			}
+			parts = append(parts, s)
+		}
+		return referenceValue(NewString("{" + strings.Join(parts, ", ") + "}")), nil
+	})
+	RegisterNative(mapClass, "hashCode", "()I", func(call *NativeCall) (StackData, error) {
+		var hash int32
+		for _, node := range mapNodes(hashMap(call)) {
+			entryHash, err := call.Jvm.InvokeVirtual("java/lang/Object", "hashCode", "()I", []StackData{referenceValue(node)})
+			if err != nil {
+				return StackData{}, err
+			}
+			hash += entryHash.Int()
+		}
+		return intValue(hash), nil
+	})
+	RegisterNative(mapClass, "equals", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		if sameReference(call.Args[0], call.Args[1]) {
+			return booleanValue(true), nil
+		}
+		if !call.Jvm.isInstance(call.Args[1], "java/util/Map") {
+			return booleanValue(false), nil
+		}
+		size, err := call.Jvm.InvokeVirtual("java/util/Map", "size", "()I", call.Args[1:2])
+		if err != nil || size.Int() != hashMap(call).Fields[mapSize].Int() {
+			return booleanValue(false), err
+		}
+		for _, node := range mapNodes(hashMap(call)) {
+			args := []StackData{call.Args[1], node.Fields[nodeKey]}
+			if contains, err := call.Jvm.InvokeVirtual("java/util/Map", "containsKey", "(Ljava/lang/Object;)Z", args); err != nil || contains.Int() == 0 {
+				return booleanValue(false), err
+			}
+			value, err := call.Jvm.InvokeVirtual("java/util/Map", "get", "(Ljava/lang/Object;)Ljava/lang/Object;", args)
+			if err != nil {
+				return StackData{}, err
+			}
+			if equal, err := call.Jvm.javaEquals(node.Fields[nodeValue], value); err != nil || !equal {
+				return booleanValue(false), err
+			}
+		}
+		return booleanValue(true), nil
+	})
+
+	// Entries
+	const nodeClass = "java/util/HashMap$Node"
+	RegisterNative(nodeClass, "getKey", "()Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		return call.Object(0).Fields[nodeKey], nil
+	})
+	RegisterNative(nodeClass, "getValue", "()Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		return call.Object(0).Fields[nodeValue], nil
+	})
+	RegisterNative(nodeClass, "setValue", "(Ljava/lang/Object;)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		old := call.Object(0).Fields[nodeValue]
+		call.Object(0).Fields[nodeValue] = call.Args[1]
+		return old, nil
+	})
+	RegisterNative(nodeClass, "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		s, err := call.Jvm.entryString(StackData{}, call.Object(0).Fields[nodeKey], call.Object(0).Fields[nodeValue])
+		return referenceValue(NewString(s)), err
+	})
+	RegisterNative(nodeClass, "hashCode", "()I", func(call *NativeCall) (StackData, error) {
+		keyHash, err := call.Jvm.javaHashCode(call.Object(0).Fields[nodeKey])
+		if err != nil {
+			return StackData{}, err
+		}
+		valueHash, err := call.Jvm.javaHashCode(call.Object(0).Fields[nodeValue])
+		return intValue(keyHash ^ valueHash), err
+	})
+	RegisterNative(nodeClass, "equals", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		if !call.Jvm.isInstance(call.Args[1], "java/util/Map$Entry") {
+			return booleanValue(false), nil
+		}
+		for _, part := range []struct{ name, field string }{{"getKey", nodeKey}, {"getValue", nodeValue}} {
+			other, err := call.Jvm.InvokeVirtual("java/util/Map$Entry", part.name, "()Ljava/lang/Object;", call.Args[1:2])
+			if err != nil {
+				return StackData{}, err
+			}
+			if equal, err := call.Jvm.javaEquals(call.Object(0).Fields[part.field], other); err != nil || !equal {
+				return booleanValue(false), err
+			}
+		}
+		return booleanValue(true), nil
+	})
+
+	// Views, the methods they don't implement come from AbstractCollection
+	for kind, className := range []string{"java/util/HashMap$KeySet", "java/util/HashMap$Values", "java/util/HashMap$EntrySet"} {
+		owner := func(call *NativeCall) *Object {
+			return call.Object(0).Fields[className+".this$0"].Data.(*Object)
+		}
+		RegisterNative(className, "size", "()I", func(call *NativeCall) (StackData, error) {
+			return owner(call).Fields[mapSize], nil
+		})
+		RegisterNative(className, "iterator", "()Ljava/util/Iterator;", func(call *NativeCall) (StackData, error) {
+			iterator, err := call.Jvm.libraryObject("java/util/HashMap$HashIterator")
+			if err != nil {
+				return StackData{}, err
+			}
+			iterator.Fields["java/util/HashMap$HashIterator.this$0"] = referenceValue(owner(call))
+			iterator.Fields["java/util/HashMap$HashIterator.kind"] = intValue(int32(kind))
+			advanceIterator(iterator, nil)
+			return referenceValue(iterator), nil
+		})
+		if kind == mapKeys {
+			RegisterNative(className, "contains", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+				node, err := call.Jvm.findNode(owner(call), call.Args[1])
+				return booleanValue(node != nil), err
+			})
+			RegisterNative(className, "remove", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+				node, err := call.Jvm.removeNode(owner(call), call.Args[1])
+				return booleanValue(node != nil), err
+			})
+		}
+	}
+
+	const iteratorClass = "java/util/HashMap$HashIterator"
+	RegisterNative(iteratorClass, "hasNext", "()Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(!call.Object(0).Fields[iteratorClass+".next"].IsNull()), nil
+	})
+	RegisterNative(iteratorClass, "next", "()Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		iterator := call.Object(0)
+		node := nodeOf(iterator.Fields[iteratorClass+".next"])
+		if node == nil {
+			return StackData{}, throwable("java/util/NoSuchElementException", "")
+		}
+		iterator.Fields[iteratorClass+".current"] = referenceValue(node)
+		advanceIterator(iterator, node)
+		return nodeElement(node, iterator.Fields[iteratorClass+".kind"].Int()), nil
+	})
+	RegisterNative(iteratorClass, "remove", "()V", func(call *NativeCall) (StackData, error) {
+		iterator := call.Object(0)
+		current := nodeOf(iterator.Fields[iteratorClass+".current"])
+		if current == nil {
+			return StackData{}, throwable("java/lang/IllegalStateException", "")
+		}
+		iterator.Fields[iteratorClass+".current"] = nullReference
+		_, err := call.Jvm.removeNode(iterator.Fields[iteratorClass+".this$0"].Data.(*Object), current.Fields[nodeKey])
+		return StackData{}, err
+	})
+}
@@ -0,0 +1,466 @@
+package jvm
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sizes of the heap when the options don't give them
+const (
+	DefaultMaxHeapSize     = 256 << 20
+	DefaultInitialHeapSize = 8 << 20
+)
+
+// Layout of objects in the heap, the one of HotSpot on 64 bit platforms
+// with compressed class pointers and references
+const (
+	objectHeaderSize = 12
+	arrayHeaderSize  = 16
+	referenceSize    = 4
+	objectAlignment  = 8
+	// Largest length of an array
+	maxArrayLength = math.MaxInt32 - 2
+)
+
+// Heap accounts for the memory the objects of a Jvm take and collects the
+// ones the program can no longer reach with a mark-sweep collector. The Go
+// runtime owns the memory itself, the heap bounds the memory of the program
+// and frees it by dropping the references the vm keeps
+type Heap struct {
+	// Size the heap may grow to, -Xmx
+	MaxSize int64
+	// Size of the heap before its first collection, -Xms
+	InitialSize int64
+	// Where collections are logged like -Xlog:gc does, nil for no log
+	Log io.Writer
+
+	// Bytes taken by the allocated objects and bytes they may take before
+	// the next collection
+	used, capacity int64
+	// The allocated objects, in allocation order
+	objects []headed
+	// Number of collections run
+	collections int
+	started     time.Time
+	// Milliseconds from the start to the last collection, and the ones a
+	// soft reference lives unused
+	clock, softLifetime int64
+}
+
+// Handle keeps a reference alive across collections while Go code holds it
+// outside of the frames, like a global reference of JNI
+type Handle struct {
+	Value StackData
+}
+
+// NewHandle makes value a root of the collections until the handle is
+// deleted
+func (jvm *Jvm) NewHandle(value StackData) *Handle {
+	handle := &Handle{Value: value}
+	jvm.globalHandles[handle] = true
+	return handle
+}
+
+// DeleteHandle lets the collector free the value of handle
+func (jvm *Jvm) DeleteHandle(handle *Handle) {
+	delete(jvm.globalHandles, handle)
+}
+
+// ParseMemorySize parses the size of a memory option like -Xmx: a number
+// of bytes with an optional k, m, g or t suffix
+func ParseMemorySize(arg string) (int64, error) {
+	s, shift := arg, 0
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'k', 'K':
+			shift = 10
+		case 'm', 'M':
+			shift = 20
+		case 'g', 'G':
+			shift = 30
+		case 't', 'T':
+			shift = 40
+		}
+	}
+	if shift != 0 {
+		s = s[:len(s)-1]
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size < 0 || size > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("invalid memory size %q", arg)
+	}
+	return size << shift, nil
+}
+
+func align(size int64) int64 {
+	return (size + objectAlignment - 1) &^ (objectAlignment - 1)
+}
+
+// elementSize returns the bytes an element of an array of the given type
+// takes
+func elementSize(arrayDescriptor string) int64 {
+	switch arrayDescriptor[1] {
+	case 'Z', 'B':
+		return 1
+	case 'C', 'S':
+		return 2
+	case 'J', 'D':
+		return 8
+	case 'I', 'F':
+		return 4
+	}
+	return referenceSize
+}
+
+func arraySize(arrayDescriptor string, length int) int64 {
+	return align(arrayHeaderSize + int64(length)*elementSize(arrayDescriptor))
+}
+
+// objectSize returns the bytes a reference takes in the heap. The fields
+// of objects don't record their type, every one but longs and doubles
+// takes 4 bytes
+func objectSize(reference headed) int64 {
+	switch r := reference.(type) {
+	case *Object:
+		size := int64(objectHeaderSize)
+		for _, value := range r.Fields {
+			if value.Size() == 2 {
+				size += 8
+			} else {
+				size += 4
+			}
+		}
+		return align(size)
+	case *Array:
+		return arraySize(r.Descriptor, len(r.Elements))
+	case *String:
+		// The String and its byte[] value
+		return align(objectHeaderSize+referenceSize+4+2) + align(arrayHeaderSize+int64(len(r.Value)))
+	}
+	return align(objectHeaderSize + referenceSize)
+}
+
+// heapReference returns the object a non null reference refers to
+func heapReference(value StackData) (headed, bool) {
+	if value.Type != StackTypeReference {
+		return nil, false
+	}
+	switch r := value.Data.(type) {
+	case *Object:
+		return r, r != nil
+	case *Array:
+		return r, r != nil
+	case *String:
+		return r, r != nil
+	case *ClassMirror:
+		return r, r != nil
+	case *MethodType:
+		return r, r != nil
+	case *MethodHandle:
+		return r, r != nil
+	case *Lookup:
+		return r, r != nil
+	}
+	return nil, false
+}
+
+// startHeap sizes the heap from its options before the program runs
+func (jvm *Jvm) startHeap() {
+	heap := &jvm.Heap
+	if !heap.started.IsZero() {
+		return
+	}
+	if heap.MaxSize <= 0 {
+		heap.MaxSize = DefaultMaxHeapSize
+	}
+	if heap.InitialSize <= 0 {
+		heap.InitialSize = min(DefaultInitialHeapSize, heap.MaxSize)
+	}
+	heap.InitialSize = min(heap.InitialSize, heap.MaxSize)
+	heap.capacity = heap.InitialSize
+	heap.started = time.Now()
+	jvm.logGC("Using Mark Sweep")
+}
+
+// logGC writes a line of the gc log, decorated with the uptime, the level
+// and the tags like the lines of -Xlog:gc are
+func (jvm *Jvm) logGC(format string, a ...interface{}) {
+	if jvm.Heap.Log == nil {
+		return
+	}
+	// The log shares the standard output with System.out
+	jvm.Flush()
+	uptime := time.Since(jvm.Heap.started).Seconds()
+	fmt.Fprintf(jvm.Heap.Log, "[%.3fs][info][gc] %s\n", uptime, fmt.Sprintf(format, a...))
+}
+
+// reserve makes room for size bytes in the heap, collecting the garbage if
+// they don't fit. It throws OutOfMemoryError when they don't fit even
+// after a collection
+func (jvm *Jvm) reserve(size int64) error {
+	heap := &jvm.Heap
+	jvm.startHeap()
+	if heap.used+size <= heap.capacity {
+		return nil
+	}
+	jvm.collect("Allocation Failure", false)
+	if heap.used+size > heap.MaxSize {
+		// The last resort before running out of memory
+		jvm.collect("Allocation Failure", true)
+	}
+	if err := jvm.runReferenceHandlers(); err != nil {
+		return err
+	}
+	if heap.used+size > heap.MaxSize {
+		return throwable("java/lang/OutOfMemoryError", "Java heap space")
+	}
+	heap.capacity = max(heap.capacity, heap.used+size)
+	return nil
+}
+
+// register accounts for an object the program may use from now on
+func (jvm *Jvm) register(reference headed) {
+	if reference.header().setBits(markAllocated) {
+		return
+	}
+	jvm.Heap.used += objectSize(reference)
+	jvm.Heap.objects = append(jvm.Heap.objects, reference)
+}
+
+// allocate accounts for a new object, see reserve
+func (jvm *Jvm) allocate(reference headed) error {
+	if reference.header().hasBits(markAllocated) {
+		return nil
+	}
+	// Keep the object alive if allocating it needs a collection
+	t := jvm.thread
+	t.handles = append(t.handles, referenceValue(reference))
+	defer func() { t.handles = t.handles[:len(t.handles)-1] }()
+	if err := jvm.reserve(objectSize(reference)); err != nil {
+		return err
+	}
+	jvm.register(reference)
+	return nil
+}
+
+// newArray allocates an array in the heap, see NewArray
+func (jvm *Jvm) newArray(arrayDescriptor string, length int) (*Array, error) {
+	if length > maxArrayLength {
+		return nil, throwable("java/lang/OutOfMemoryError", "Requested array size exceeds VM limit")
+	}
+	if err := jvm.reserve(arraySize(arrayDescriptor, length)); err != nil {
+		return nil, err
+	}
+	array := NewArray(arrayDescriptor, length)
+	jvm.register(array)
+	return array, nil
+}
+
+// newMultiArray allocates the arrays of a multianewarray, the dimensions
+// given by counts
+func (jvm *Jvm) newMultiArray(arrayDescriptor string, counts []StackData) (*Array, error) {
+	// Every array is reserved up front as they are only reachable once the
+	// outermost one is on the stack
+	size, arrays := int64(0), int64(1)
+	for i, count := range counts {
+		length := int64(count.Int())
+		if length > maxArrayLength {
+			return nil, throwable("java/lang/OutOfMemoryError", "Requested array size exceeds VM limit")
+		}
+		size += arrays * arraySize(arrayDescriptor[i:], int(length))
+		if size > jvm.Heap.MaxSize || length > 0 && arrays > jvm.Heap.MaxSize/arrayHeaderSize/length {
+			return nil, throwable("java/lang/OutOfMemoryError", "Java heap space")
+		}
+		arrays *= length
+	}
+	if err := jvm.reserve(size); err != nil {
+		return nil, err
+	}
+	array := newMultiArray(arrayDescriptor, counts)
+	jvm.registerArrays(array)
+	return array, nil
+}
+
+// registerArrays registers an array and the arrays it holds
+func (jvm *Jvm) registerArrays(array *Array) {
+	jvm.register(array)
+	for _, element := range array.Elements {
+		if component, ok := element.Data.(*Array); ok {
+			jvm.registerArrays(component)
+		}
+	}
+}
+
+// GC runs a collection, as System.gc does, then the reference handlers
+func (jvm *Jvm) GC() error {
+	jvm.collect("System.gc()", false)
+	return jvm.runReferenceHandlers()
+}
+
+// collection is the state of a running collection
+type collection struct {
+	// Soft references are cleared whether or not they were used lately, as
+	// they are before throwing OutOfMemoryError
+	clearSoft bool
+	// Objects the vm created without allocating them are accounted for
+	// once reached
+	adopted []headed
+	// References whose referent isn't marked through them, by strength
+	discovered [referencePhantom + 1][]*Object
+}
+
+// collect frees the objects the program can no longer reach: it marks the
+// objects reachable from the roots, clears the references to the others
+// and drops them from the heap
+func (jvm *Jvm) collect(cause string, clearSoft bool) {
+	heap := &jvm.Heap
+	start := time.Now()
+	before := heap.used
+	heap.clock = time.Since(heap.started).Milliseconds()
+
+	c := &collection{clearSoft: clearSoft}
+	jvm.mark(c, jvm.roots())
+	jvm.processReferences(c)
+
+	objects := append(heap.objects, c.adopted...)
+	live := objects[:0]
+	heap.used = 0
+	for _, reference := range objects {
+		h := reference.header()
+		if !h.hasBits(markMarked) {
+			h.clearBits(markAllocated)
+			continue
+		}
+		h.clearBits(markMarked)
+		heap.used += objectSize(reference)
+		live = append(live, reference)
+	}
+	clear(objects[len(live):])
+	heap.objects = live
+
+	// Keep between 40% and 70% of the heap free, as HotSpot does by default
+	heap.capacity = min(max(heap.capacity, heap.used*10/6), heap.MaxSize)
+	if heap.used*10/3 < heap.capacity {
+		heap.capacity = max(heap.used*10/3, heap.InitialSize)
+	}
+	// Soft references live a second per free megabyte since their last
+	// use, the default SoftRefLRUPolicyMSPerMB of HotSpot
+	heap.softLifetime = (heap.MaxSize - heap.used) >> 20 * 1000
+
+	jvm.logGC("GC(%d) Pause Full (%s) %dM->%dM(%dM) %.3fms", heap.collections, cause, before>>20, heap.used>>20, heap.capacity>>20, float64(time.Since(start).Microseconds())/1000)
+	heap.collections++
+}
+
+// roots returns the references the program reaches directly: the ones in
+// frames and handles of the threads, static fields, and the ones the vm
+// keeps
+func (jvm *Jvm) roots() []StackData {
+	var roots []StackData
+	for _, t := range jvm.threads {
+		for _, frame := range t.frames {
+			roots = append(roots, frame.Locals...)
+			roots = append(roots, frame.Stack...)
+		}
+		roots = append(roots, t.handles...)
+		if t.Object != nil {
+			roots = append(roots, referenceValue(t.Object))
+		}
+	}
+	for _, value := range jvm.StaticFields {
+		roots = append(roots, value)
+	}
+	for handle := range jvm.globalHandles {
+		roots = append(roots, handle.Value)
+	}
+	for _, s := range jvm.strings {
+		roots = append(roots, referenceValue(s))
+	}
+	for _, mirror := range jvm.mirrors {
+		roots = append(roots, referenceValue(mirror))
+	}
+	for _, methodType := range jvm.methodTypes {
+		roots = append(roots, referenceValue(methodType))
+	}
+	// What the reference handlers have yet to process
+	for _, reference := range jvm.pendingReferences {
+		roots = append(roots, referenceValue(reference))
+	}
+	for _, object := range jvm.finalizeQueue {
+		roots = append(roots, referenceValue(object))
+	}
+	for _, cleaner := range jvm.cleaners {
+		roots = append(roots, referenceValue(cleaner))
+	}
+	return roots
+}
+
+// mark sets the mark bit of the objects reachable from roots. The referent
+// of a reference is only marked through it if the reference keeps it
+func (jvm *Jvm) mark(c *collection, roots []StackData) {
+	pending := roots
+	for len(pending) > 0 {
+		value := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		reference, ok := heapReference(value)
+		if !ok || reference.header().setBits(markMarked) {
+			continue
+		}
+		if !reference.header().setBits(markAllocated) {
+			c.adopted = append(c.adopted, reference)
+		}
+		switch r := reference.(type) {
+		case *Object:
+			weak := jvm.discover(c, r)
+			for key, field := range r.Fields {
+				if !weak || key != referenceReferent {
+					pending = append(pending, field)
+				}
+			}
+		case *Array:
+			if strings.IndexByte("L[", r.Descriptor[1]) >= 0 {
+				pending = append(pending, r.Elements...)
+			}
+		case *MethodHandle:
+			pending = append(pending, referenceValue(r.Type))
+			pending = append(pending, r.retained...)
+		}
+		if holder, ok := reference.(fieldHolder); ok {
+			for _, field := range holder.store().fields {
+				pending = append(pending, field)
+			}
+		}
+	}
+}
+
+func init() {
+	const runtimeClass = "java/lang/Runtime"
+	RegisterNative(runtimeClass, "<clinit>", "()V", func(call *NativeCall) (StackData, error) {
+		runtime, err := call.Jvm.libraryObject(runtimeClass)
+		if err != nil {
+			return StackData{}, err
+		}
+		call.Jvm.StaticFields[runtimeClass+".currentRuntime"] = referenceValue(runtime)
+		return StackData{}, nil
+	})
+	RegisterNative(runtimeClass, "getRuntime", "()Ljava/lang/Runtime;", func(call *NativeCall) (StackData, error) {
+		return call.Jvm.StaticFields[runtimeClass+".currentRuntime"], nil
+	})
+	RegisterNative(runtimeClass, "gc", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, call.Jvm.GC()
+	})
+	RegisterNative(runtimeClass, "maxMemory", "()J", func(call *NativeCall) (StackData, error) {
+		return longValue(call.Jvm.Heap.MaxSize), nil
+	})
+	RegisterNative(runtimeClass, "totalMemory", "()J", func(call *NativeCall) (StackData, error) {
+		call.Jvm.startHeap()
+		return longValue(call.Jvm.Heap.capacity), nil
+	})
+	RegisterNative(runtimeClass, "freeMemory", "()J", func(call *NativeCall) (StackData, error) {
+		call.Jvm.startHeap()
+		return longValue(max(call.Jvm.Heap.capacity-call.Jvm.Heap.used, 0)), nil
+	})
+}
@@ -0,0 +1,124 @@
+package jvm
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMemorySize(t *testing.T) {
+	tests := []struct {
+		arg  string
+		size int64
+		err  string
+	}{
+		{arg: "4096", size: 4096},
+		{arg: "64k", size: 64 << 10},
+		{arg: "16M", size: 16 << 20},
+		{arg: "2g", size: 2 << 30},
+		{arg: "1T", size: 1 << 40},
+		{arg: "0", size: 0},
+		{arg: "8388607t", size: 8388607 << 40},
+		{arg: "", err: `invalid memory size ""`},
+		{arg: "m", err: `invalid memory size "m"`},
+		{arg: "12xg", err: `invalid memory size "12xg"`},
+		{arg: "-1m", err: `invalid memory size "-1m"`},
+		// Past math.MaxInt64 once shifted
+		{arg: "8388608t", err: `invalid memory size "8388608t"`},
+		{arg: "9223372036854775808", err: `invalid memory size "9223372036854775808"`},
+	}
+	for _, test := range tests {
+		size, err := ParseMemorySize(test.arg)
+		switch {
+		case test.err != "":
+			if err == nil || err.Error() != test.err {
+				t.Errorf("ParseMemorySize(%q) error = %v, want %s", test.arg, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("ParseMemorySize(%q) error = %v", test.arg, err)
+		case size != test.size:
+			t.Errorf("ParseMemorySize(%q) = %d, want %d", test.arg, size, test.size)
+		}
+	}
+}
+
+func TestOutOfMemory(t *testing.T) {
+	tests := []struct {
+		name string
+		// allocate leaves an array bigger than the heap on the stack
+		allocate func(p programBuilder)
+	}{
+		{
+			name: "newarray",
+			allocate: func(p programBuilder) {
+				p.op(OpLdcW, p.class.integer(1<<20))
+				p.op(OpNewarray, uint8(10))
+			},
+		},
+		{
+			name: "multianewarray",
+			allocate: func(p programBuilder) {
+				p.op(OpSipush, int16(1024))
+				p.op(OpSipush, int16(1024))
+				p.op(OpMultianewarray, p.class.class("[[I"), uint8(2))
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := buildProgram(t, func(p programBuilder) {
+				test.allocate(p)
+				p.op(OpPop)
+			})
+			jvm, err := NewJvm(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			jvm.Heap.MaxSize, jvm.Heap.InitialSize = 1<<20, 1<<20
+			var out, errOut bytes.Buffer
+			jvm.Stdout, jvm.Stderr = &out, &errOut
+			RunJvm(jvm)
+			if want := "Exception in thread \"main\" java.lang.OutOfMemoryError: Java heap space\n"; errOut.String() != want {
+				t.Errorf("stderr = %q, want %q", errOut.String(), want)
+			}
+		})
+	}
+}
+
+func TestHandleRoots(t *testing.T) {
+	jvm, err := NewJvm(filepath.Join("..", "Main.class"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocated := func() *Array {
+		array := NewArray("[I", 16)
+		if err := jvm.allocate(array); err != nil {
+			t.Fatal(err)
+		}
+		return array
+	}
+	collect := func() {
+		if err := jvm.GC(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	global, local, garbage := allocated(), allocated(), allocated()
+	handle := jvm.NewHandle(referenceValue(global))
+	jvm.thread.handles = append(jvm.thread.handles, referenceValue(local))
+	collect()
+	for name, array := range map[string]*Array{"global handle": global, "thread handle": local} {
+		if !array.hasBits(markAllocated) {
+			t.Errorf("array of the %s was collected", name)
+		}
+	}
+	if garbage.hasBits(markAllocated) {
+		t.Error("unreachable array was not collected")
+	}
+
+	jvm.DeleteHandle(handle)
+	jvm.thread.handles = jvm.thread.handles[:0]
+	collect()
+	if global.hasBits(markAllocated) || local.hasBits(markAllocated) {
+		t.Error("arrays were not collected once their handles were gone")
+	}
+}
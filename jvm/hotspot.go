@@ -0,0 +1,534 @@
+package jvm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The natives below are the ones of the JDK class library that HotSpot
+// implements, needed to boot it from a jimage. The layout they report for
+// Unsafe is a 64 bit vm with compressed references
+
+const (
+	unsafeAddressSize     = 8
+	unsafePageSize        = 4096
+	unsafeArrayBaseOffset = 16
+	// Offset of the first field, the ones after it are 8 bytes apart
+	unsafeFieldBaseOffset = 12
+)
+
+// unsafeIndexScale returns the size of the elements of an array type
+func unsafeIndexScale(arrayDescriptor string) int64 {
+	switch arrayDescriptor[1] {
+	case 'Z', 'B':
+		return 1
+	case 'C', 'S':
+		return 2
+	case 'J', 'D':
+		return 8
+	}
+	return 4
+}
+
+// fieldOffset returns the offset Unsafe uses for the field with the given
+// key, the same for every object having it
+func (jvm *Jvm) fieldOffset(key string) int64 {
+	if offset, ok := jvm.fieldOffsets[key]; ok {
+		return offset
+	}
+	offset := unsafeFieldBaseOffset + 8*int64(len(jvm.offsetFields))
+	jvm.fieldOffsets[key] = offset
+	jvm.offsetFields = append(jvm.offsetFields, key)
+	return offset
+}
+
+// unsafeSlot returns accessors of the variable of base at offset: an array
+// element, an instance field, or a static field when base is a Class
+func (jvm *Jvm) unsafeSlot(base interface{}, offset int64) (get func() StackData, set func(StackData), err error) {
+	switch base := base.(type) {
+	case *Array:
+		index := (offset - unsafeArrayBaseOffset) / unsafeIndexScale(base.Descriptor)
+		if offset < unsafeArrayBaseOffset || index >= int64(len(base.Elements)) {
+			break
+		}
+		return func() StackData { return base.Elements[index] }, func(v StackData) { base.Elements[index] = v }, nil
+	case *Object, *ClassMirror:
+		i := (offset - unsafeFieldBaseOffset) / 8
+		if offset < unsafeFieldBaseOffset || i >= int64(len(jvm.offsetFields)) {
+			break
+		}
+		key := jvm.offsetFields[i]
+		if object, ok := base.(*Object); ok {
+			return func() StackData { return object.Fields[key] }, func(v StackData) { object.Fields[key] = v }, nil
+		}
+		return func() StackData { return jvm.StaticFields[key] }, func(v StackData) { jvm.StaticFields[key] = v }, nil
+	case nil:
+		return nil, nil, throwable("java/lang/InternalError", "off-heap memory access at %#x is not supported", offset)
+	}
+	return nil, nil, throwable("java/lang/InternalError", "bad Unsafe offset %d", offset)
+}
+
+// primitiveNames maps the names of Class.getPrimitiveClass to descriptors
+var primitiveNames = map[string]string{
+	"boolean": "Z", "byte": "B", "char": "C", "short": "S", "int": "I",
+	"long": "J", "float": "F", "double": "D", "void": "V",
+}
+
+// unsafeTypes are the types of the Unsafe get and put methods, keyed by the
+// name they use
+var unsafeTypes = map[string]string{
+	"Boolean": "Z", "Byte": "B", "Short": "S", "Char": "C", "Int": "I",
+	"Long": "J", "Float": "F", "Double": "D", "Reference": "Ljava/lang/Object;",
+}
+
+// mirrorClassName returns the internal name of the class of a Class
+// argument, empty for primitives and null
+func mirrorClassName(call *NativeCall, i int) string {
+	mirror, _ := call.Reference(i).(*ClassMirror)
+	if mirror == nil || len(mirror.Descriptor) == 1 {
+		return ""
+	}
+	return internalName(call.Args[i])
+}
+
+// stringArray returns a String[] holding values
+func (jvm *Jvm) stringArray(values []string) *Array {
+	array := NewArray("[Ljava/lang/String;", len(values))
+	for i, v := range values {
+		array.Elements[i] = referenceValue(NewString(v))
+	}
+	return array
+}
+
+// platformProperties returns the values of SystemProps.Raw.platformProperties
+// at the indexes the class declares in its _<property>_NDX constants
+func (jvm *Jvm) platformProperties() *Array {
+	const raw = "jdk/internal/util/SystemProps$Raw"
+	workingDirectory, _ := os.Getwd()
+	home, _ := os.UserHomeDir()
+	properties := map[string]string{
+		"file_encoding":       "UTF-8",
+		"native_encoding":     "UTF-8",
+		"sun_jnu_encoding":    "UTF-8",
+		"stdout_encoding":     "UTF-8",
+		"stderr_encoding":     "UTF-8",
+		"file_separator":      string(filepath.Separator),
+		"path_separator":      string(filepath.ListSeparator),
+		"line_separator":      "\n",
+		"java_io_tmpdir":      os.TempDir(),
+		"os_name":             map[string]string{"linux": "Linux", "darwin": "Mac OS X", "windows": "Windows"}[runtime.GOOS],
+		"os_arch":             map[string]string{"amd64": "amd64", "arm64": "aarch64", "386": "x86"}[runtime.GOARCH],
+		"os_version":          "",
+		"user_dir":            workingDirectory,
+		"user_home":           home,
+		"user_name":           os.Getenv("USER"),
+		"sun_arch_data_model": "64",
+		"sun_cpu_endian":      "little",
+	}
+	length := jvm.StaticFields[raw+".FIXED_LENGTH"]
+	if length.Type != StackTypeInt {
+		return jvm.stringArray(nil)
+	}
+	array := NewArray("[Ljava/lang/String;", int(length.Int()))
+	for name, value := range properties {
+		index, ok := jvm.StaticFields[raw+"._"+name+"_NDX"]
+		if ok && value != "" && int(index.Int()) < len(array.Elements) {
+			array.Elements[index.Int()] = referenceValue(NewString(value))
+		}
+	}
+	return array
+}
+
+// fileDescriptorWriter returns where a FileOutputStream writes, the
+// standard streams only
+func (jvm *Jvm) fileDescriptorWriter(stream *Object) (io.Writer, error) {
+	if stream != nil {
+		if fd, ok := stream.Fields["java/io/FileOutputStream.fd"].Data.(*Object); ok {
+			switch fd.Fields["java/io/FileDescriptor.fd"].Int() {
+			case 1:
+				return jvm.Stdout, nil
+			case 2:
+				return jvm.Stderr, nil
+			}
+		}
+	}
+	return nil, throwable("java/io/IOException", "only the standard streams can be written")
+}
+
+// BootSystem initializes the class library of a JDK on the boot class path
+// the way HotSpot does before running main: the initial thread group and
+// thread are created, then System.initPhase1, 2 and 3 run
+func (jvm *Jvm) BootSystem() error {
+	for _, name := range []string{"java/lang/String", "java/lang/System", "java/lang/Class", "jdk/internal/misc/UnsafeConstants"} {
+		class, err := jvm.LoadClass(name)
+		if err != nil {
+			return err
+		}
+		if err := jvm.InitializeClass(class); err != nil {
+			return err
+		}
+	}
+	// Injected by the vm once the class is initialized
+	constants := "jdk/internal/misc/UnsafeConstants."
+	jvm.StaticFields[constants+"ADDRESS_SIZE0"] = intValue(unsafeAddressSize)
+	jvm.StaticFields[constants+"PAGE_SIZE"] = intValue(unsafePageSize)
+	jvm.StaticFields[constants+"BIG_ENDIAN"] = booleanValue(binary.NativeEndian.Uint16([]byte{0, 1}) == 1)
+	jvm.StaticFields[constants+"UNALIGNED_ACCESS"] = booleanValue(true)
+
+	newInstance := func(className, ctorDescriptor string, args ...StackData) (*Object, error) {
+		class, err := jvm.LoadClass(className)
+		if err != nil {
+			return nil, err
+		}
+		if err := jvm.InitializeClass(class); err != nil {
+			return nil, err
+		}
+		object := jvm.NewObject(class)
+		_, err = jvm.InvokeSpecial(className, "<init>", ctorDescriptor, append([]StackData{referenceValue(object)}, args...))
+		return object, err
+	}
+	systemGroup, err := newInstance("java/lang/ThreadGroup", "()V")
+	if err != nil {
+		return err
+	}
+	mainGroup, err := newInstance("java/lang/ThreadGroup", "(Ljava/lang/ThreadGroup;Ljava/lang/String;)V", referenceValue(systemGroup), referenceValue(jvm.internString("main")))
+	if err != nil {
+		return err
+	}
+	// The thread is current while it is constructed, so that it sees
+	// itself as an attached thread
+	threadClass, err := jvm.LoadClass("java/lang/Thread")
+	if err != nil {
+		return err
+	}
+	if err := jvm.InitializeClass(threadClass); err != nil {
+		return err
+	}
+	jvm.thread.Object = jvm.NewObject(threadClass)
+	if _, err := jvm.InvokeSpecial("java/lang/Thread", "<init>", "(Ljava/lang/ThreadGroup;Ljava/lang/String;)V",
+		[]StackData{referenceValue(jvm.thread.Object), referenceValue(mainGroup), referenceValue(jvm.internString("main"))}); err != nil {
+		return err
+	}
+
+	if _, err := jvm.InvokeStatic("java/lang/System", "initPhase1", "()V", nil); err != nil {
+		return err
+	}
+	status, err := jvm.InvokeStatic("java/lang/System", "initPhase2", "(ZZ)I", []StackData{booleanValue(true), booleanValue(true)})
+	if err != nil {
+		return err
+	}
+	if status.Int() != 0 {
+		return fmt.Errorf("java.lang.System.initPhase2 failed with status %d", status.Int())
+	}
+	_, err = jvm.InvokeStatic("java/lang/System", "initPhase3", "()V", nil)
+	return err
+}
+
+func init() {
+	noop := func(call *NativeCall) (StackData, error) {
+		return StackData{}, nil
+	}
+	constant := func(value StackData) Native {
+		return func(call *NativeCall) (StackData, error) {
+			return value, nil
+		}
+	}
+	for _, class := range []string{
+		"java/lang/System", "java/lang/Class", "java/lang/Thread", "java/lang/Object",
+		"jdk/internal/misc/Unsafe", "jdk/internal/misc/ScopedMemoryAccess",
+	} {
+		RegisterNative(class, "registerNatives", "()V", noop)
+	}
+	for _, class := range []string{"java/io/FileDescriptor", "java/io/FileInputStream", "java/io/FileOutputStream", "java/io/UnixFileSystem", "java/io/WinNTFileSystem"} {
+		RegisterNative(class, "initIDs", "()V", noop)
+	}
+
+	// jdk.internal.misc.Unsafe
+	const unsafe = "jdk/internal/misc/Unsafe"
+	RegisterNative(unsafe, "arrayBaseOffset0", "(Ljava/lang/Class;)I", constant(intValue(unsafeArrayBaseOffset)))
+	RegisterNative(unsafe, "arrayIndexScale0", "(Ljava/lang/Class;)I", func(call *NativeCall) (StackData, error) {
+		mirror, _ := call.Reference(1).(*ClassMirror)
+		if mirror == nil || mirror.Descriptor[0] != '[' {
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "not an array class")
+		}
+		return intValue(int32(unsafeIndexScale(mirror.Descriptor))), nil
+	})
+	RegisterNative(unsafe, "addressSize0", "()I", constant(intValue(unsafeAddressSize)))
+	RegisterNative(unsafe, "pageSize", "()I", constant(intValue(unsafePageSize)))
+	RegisterNative(unsafe, "objectFieldOffset1", "(Ljava/lang/Class;Ljava/lang/String;)J", func(call *NativeCall) (StackData, error) {
+		className, name := mirrorClassName(call, 1), call.GoString(2)
+		class, err := call.Jvm.LoadClass(className)
+		if err != nil {
+			return StackData{}, err
+		}
+		for _, f := range class.Fields {
+			if f.Name == name && f.AccessFlags&AccStatic == 0 {
+				return longValue(call.Jvm.fieldOffset(className + "." + name)), nil
+			}
+		}
+		return StackData{}, throwable("java/lang/InternalError", "%s", name)
+	})
+	for _, name := range []string{"fullFence", "loadFence", "storeFence"} {
+		RegisterNative(unsafe, name, "()V", noop)
+	}
+	for typeName, typeDescriptor := range unsafeTypes {
+		get := func(call *NativeCall) (StackData, error) {
+			get, _, err := call.Jvm.unsafeSlot(call.Reference(1), call.Long(2))
+			if err != nil {
+				return StackData{}, err
+			}
+			return get(), nil
+		}
+		put := func(call *NativeCall) (StackData, error) {
+			_, set, err := call.Jvm.unsafeSlot(call.Reference(1), call.Long(2))
+			if err != nil {
+				return StackData{}, err
+			}
+			set(call.Args[3])
+			return StackData{}, nil
+		}
+		for _, suffix := range []string{"", "Volatile"} {
+			RegisterNative(unsafe, "get"+typeName+suffix, "(Ljava/lang/Object;J)"+typeDescriptor, get)
+			RegisterNative(unsafe, "put"+typeName+suffix, "(Ljava/lang/Object;J"+typeDescriptor+")V", put)
+		}
+		if typeName != "Int" && typeName != "Long" && typeName != "Reference" {
+			continue
+		}
+		compareAndExchange := func(call *NativeCall) (StackData, error) {
+			get, set, err := call.Jvm.unsafeSlot(call.Reference(1), call.Long(2))
+			if err != nil {
+				return StackData{}, err
+			}
+			witness := get()
+			if sameReference(witness, call.Args[3]) {
+				set(call.Args[4])
+			}
+			return witness, nil
+		}
+		RegisterNative(unsafe, "compareAndExchange"+typeName, "(Ljava/lang/Object;J"+typeDescriptor+typeDescriptor+")"+typeDescriptor, compareAndExchange)
+		RegisterNative(unsafe, "compareAndSet"+typeName, "(Ljava/lang/Object;J"+typeDescriptor+typeDescriptor+")Z", func(call *NativeCall) (StackData, error) {
+			witness, err := compareAndExchange(call)
+			return booleanValue(err == nil && sameReference(witness, call.Args[3])), err
+		})
+	}
+	RegisterNative(unsafe, "shouldBeInitialized0", "(Ljava/lang/Class;)Z", func(call *NativeCall) (StackData, error) {
+		mirror, _ := call.Reference(1).(*ClassMirror)
+		return booleanValue(mirror != nil && mirror.Class != nil && !call.Jvm.isInitialized(mirror.Class)), nil
+	})
+	RegisterNative(unsafe, "ensureClassInitialized0", "(Ljava/lang/Class;)V", func(call *NativeCall) (StackData, error) {
+		if mirror, _ := call.Reference(1).(*ClassMirror); mirror != nil && mirror.Class != nil {
+			return StackData{}, call.Jvm.InitializeClass(mirror.Class)
+		}
+		return StackData{}, nil
+	})
+	RegisterNative(unsafe, "allocateInstance", "(Ljava/lang/Class;)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		mirror, _ := call.Reference(1).(*ClassMirror)
+		if mirror == nil {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		if mirror.Class == nil || mirror.Class.AccessFlags&(AccInterface|AccAbstract) != 0 {
+			return StackData{}, throwable("java/lang/InstantiationException", "%s", mirror.Name())
+		}
+		if err := call.Jvm.InitializeClass(mirror.Class); err != nil {
+			return StackData{}, err
+		}
+		return referenceValue(call.Jvm.NewObject(mirror.Class)), nil
+	})
+
+	// Class data sharing is never enabled
+	const cds = "jdk/internal/misc/CDS"
+	RegisterNative(cds, "isDumpingClassList0", "()Z", constant(booleanValue(false)))
+	RegisterNative(cds, "isDumpingArchive0", "()Z", constant(booleanValue(false)))
+	RegisterNative(cds, "isSharingEnabled0", "()Z", constant(booleanValue(false)))
+	RegisterNative(cds, "getCDSConfigStatus", "()I", constant(intValue(0)))
+	RegisterNative(cds, "getRandomSeedForDumping", "()J", constant(longValue(0)))
+	RegisterNative(cds, "initializeFromArchive", "(Ljava/lang/Class;)V", noop)
+	RegisterNative(cds, "defineArchivedModules", "(Ljava/lang/ClassLoader;Ljava/lang/ClassLoader;)V", noop)
+	RegisterNative(cds, "logLambdaFormInvoker", "(Ljava/lang/String;)V", noop)
+	RegisterNative(cds, "dumpClassList", "(Ljava/lang/String;)V", noop)
+	RegisterNative(cds, "dumpDynamicArchive", "(Ljava/lang/String;)V", noop)
+
+	// jdk.internal.misc.VM and the system properties
+	RegisterNative("jdk/internal/misc/VM", "initialize", "()V", noop)
+	RegisterNative("jdk/internal/misc/VM", "latestUserDefinedLoader0", "()Ljava/lang/ClassLoader;", constant(nullReference))
+	RegisterNative("jdk/internal/misc/VM", "getNanoTimeAdjustment", "(J)J", func(call *NativeCall) (StackData, error) {
+		now := time.Now()
+		return longValue((now.Unix()-call.Long(0))*int64(time.Second) + int64(now.Nanosecond())), nil
+	})
+	RegisterNative("jdk/internal/misc/VM", "getRuntimeArguments", "()[Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.stringArray(nil)), nil
+	})
+	RegisterNative("jdk/internal/util/SystemProps$Raw", "platformProperties", "()[Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.platformProperties()), nil
+	})
+	RegisterNative("jdk/internal/util/SystemProps$Raw", "vmProperties", "()[Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		javaHome := ""
+		for _, source := range call.Jvm.BootClassPath {
+			if image, ok := source.(*JImage); ok {
+				javaHome = filepath.Dir(filepath.Dir(image.Path))
+			}
+		}
+		properties := []string{
+			"java.home", javaHome,
+			"java.vm.name", "go-jvm",
+			"java.vm.vendor", "go-jvm",
+			"java.vm.info", "interpreted mode",
+			"java.class.path", strings.Join(call.Jvm.ClassPath, string(filepath.ListSeparator)),
+			"sun.nio.MaxDirectMemorySize", "-1",
+			"sun.nio.PageAlignDirectMemory", "false",
+		}
+		// Read by Integer.IntegerCache
+		if call.Jvm.AutoBoxCacheMax > 127 {
+			properties = append(properties, "java.lang.Integer.IntegerCache.high", strconv.Itoa(int(call.Jvm.AutoBoxCacheMax)))
+		}
+		return referenceValue(call.Jvm.stringArray(properties)), nil
+	})
+	RegisterNative("java/lang/StringUTF16", "isBigEndian", "()Z", constant(booleanValue(false)))
+
+	// The standard streams are final, the vm sets them
+	for stream, setter := range map[string]string{"in": "setIn0", "out": "setOut0", "err": "setErr0"} {
+		key := "java/lang/System." + stream
+		RegisterNative("java/lang/System", setter, "", func(call *NativeCall) (StackData, error) {
+			call.Jvm.StaticFields[key] = call.Args[0]
+			return StackData{}, nil
+		})
+	}
+
+	// java.lang.Runtime
+	RegisterNative("java/lang/Runtime", "availableProcessors", "()I", func(call *NativeCall) (StackData, error) {
+		return intValue(int32(runtime.NumCPU())), nil
+	})
+
+	// Floating point bits
+	RegisterNative("java/lang/Float", "floatToRawIntBits", "(F)I", func(call *NativeCall) (StackData, error) {
+		return intValue(int32(math.Float32bits(call.Float(0)))), nil
+	})
+	RegisterNative("java/lang/Float", "intBitsToFloat", "(I)F", func(call *NativeCall) (StackData, error) {
+		return floatValue(math.Float32frombits(uint32(call.Int(0)))), nil
+	})
+	RegisterNative("java/lang/Double", "doubleToRawLongBits", "(D)J", func(call *NativeCall) (StackData, error) {
+		return longValue(int64(math.Float64bits(call.Double(0)))), nil
+	})
+	RegisterNative("java/lang/Double", "longBitsToDouble", "(J)D", func(call *NativeCall) (StackData, error) {
+		return doubleValue(math.Float64frombits(uint64(call.Long(0)))), nil
+	})
+
+	// java.lang.Class and java.lang.Object
+	RegisterNative("java/lang/Class", "getPrimitiveClass", "(Ljava/lang/String;)Ljava/lang/Class;", func(call *NativeCall) (StackData, error) {
+		primitive, ok := primitiveNames[call.GoString(0)]
+		if !ok {
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "%s", call.GoString(0))
+		}
+		return referenceValue(call.Jvm.Mirror(primitive)), nil
+	})
+	RegisterNative("java/lang/Class", "desiredAssertionStatus0", "(Ljava/lang/Class;)Z", constant(booleanValue(false)))
+	mirrorTest := func(test func(call *NativeCall, mirror *ClassMirror) bool) Native {
+		return func(call *NativeCall) (StackData, error) {
+			return booleanValue(test(call, call.Reference(0).(*ClassMirror))), nil
+		}
+	}
+	RegisterNative("java/lang/Class", "isArray", "()Z", mirrorTest(func(call *NativeCall, mirror *ClassMirror) bool {
+		return mirror.Descriptor[0] == '['
+	}))
+	RegisterNative("java/lang/Class", "isPrimitive", "()Z", mirrorTest(func(call *NativeCall, mirror *ClassMirror) bool {
+		return len(mirror.Descriptor) == 1
+	}))
+	RegisterNative("java/lang/Class", "isInterface", "()Z", mirrorTest(func(call *NativeCall, mirror *ClassMirror) bool {
+		return mirror.Class != nil && mirror.Class.AccessFlags&AccInterface != 0
+	}))
+	RegisterNative("java/lang/Class", "isHidden", "()Z", mirrorTest(func(call *NativeCall, mirror *ClassMirror) bool {
+		return false
+	}))
+	RegisterNative("java/lang/Class", "isInstance", "(Ljava/lang/Object;)Z", mirrorTest(func(call *NativeCall, mirror *ClassMirror) bool {
+		return len(mirror.Descriptor) > 1 && !call.Args[1].IsNull() && call.Jvm.isInstance(call.Args[1], internalName(call.Args[0]))
+	}))
+	RegisterNative("java/lang/Class", "isAssignableFrom", "(Ljava/lang/Class;)Z", func(call *NativeCall) (StackData, error) {
+		if call.Args[1].IsNull() {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		to, from := call.Reference(0).(*ClassMirror), call.Reference(1).(*ClassMirror)
+		if len(to.Descriptor) == 1 || len(from.Descriptor) == 1 {
+			return booleanValue(to.Descriptor == from.Descriptor), nil
+		}
+		return booleanValue(call.Jvm.isAssignable(internalName(call.Args[1]), internalName(call.Args[0]))), nil
+	})
+	RegisterNative("java/lang/Class", "cast", "(Ljava/lang/Object;)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		mirror := call.Reference(0).(*ClassMirror)
+		if !call.Args[1].IsNull() && (len(mirror.Descriptor) == 1 || !call.Jvm.isInstance(call.Args[1], internalName(call.Args[0]))) {
+			return StackData{}, throwable("java/lang/ClassCastException", "Cannot cast %s to %s",
+				strings.ReplaceAll(call.Jvm.referenceClassName(call.Args[1]), "/", "."), mirror.Name())
+		}
+		return call.Args[1], nil
+	})
+	RegisterNative("java/lang/Class", "initClassName", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.internString(call.Reference(0).(*ClassMirror).Name())), nil
+	})
+	RegisterNative("java/lang/Class", "getModifiers", "()I", func(call *NativeCall) (StackData, error) {
+		mirror := call.Reference(0).(*ClassMirror)
+		if mirror.Class == nil {
+			return intValue(int32(AccPublic | AccFinal | AccAbstract)), nil
+		}
+		return intValue(int32(mirror.Class.AccessFlags &^ AccSuper)), nil
+	})
+	RegisterNative("java/lang/Class", "getSuperclass", "()Ljava/lang/Class;", func(call *NativeCall) (StackData, error) {
+		mirror := call.Reference(0).(*ClassMirror)
+		switch {
+		case mirror.Descriptor[0] == '[':
+			return referenceValue(call.Jvm.Mirror("Ljava/lang/Object;")), nil
+		case mirror.Class == nil || mirror.Class.SuperName() == "" || mirror.Class.AccessFlags&AccInterface != 0:
+			return nullReference, nil
+		}
+		return referenceValue(call.Jvm.Mirror("L" + mirror.Class.SuperName() + ";")), nil
+	})
+
+	// Threads, see thread.go
+	RegisterNative("java/lang/Thread", "setPriority0", "(I)V", noop)
+
+	// Stack walking
+	RegisterNative("jdk/internal/reflect/Reflection", "getCallerClass", "()Ljava/lang/Class;", func(call *NativeCall) (StackData, error) {
+		// The top frame is the caller sensitive method calling this native
+		frames := call.Jvm.thread.frames
+		if len(frames) < 2 {
+			return nullReference, nil
+		}
+		return referenceValue(call.Jvm.Mirror("L" + frames[len(frames)-2].Class.Name() + ";")), nil
+	})
+	RegisterNative("java/lang/Throwable", "fillInStackTrace", "(I)Ljava/lang/Throwable;", func(call *NativeCall) (StackData, error) {
+		return call.Args[0], nil
+	})
+	RegisterNative("java/security/AccessController", "getStackAccessControlContext", "()Ljava/security/AccessControlContext;", constant(nullReference))
+	RegisterNative("java/security/AccessController", "getInheritedAccessControlContext", "()Ljava/security/AccessControlContext;", constant(nullReference))
+
+	// Signals and the standard streams
+	RegisterNative("jdk/internal/misc/Signal", "findSignal0", "(Ljava/lang/String;)I", constant(intValue(-1)))
+	RegisterNative("jdk/internal/misc/Signal", "handle0", "(IJ)J", constant(longValue(0)))
+	RegisterNative("java/io/FileDescriptor", "getHandle", "(I)J", constant(longValue(-1)))
+	RegisterNative("java/io/FileDescriptor", "getAppend", "(I)Z", constant(booleanValue(false)))
+	RegisterNative("java/io/FileOutputStream", "writeBytes", "([BIIZ)V", func(call *NativeCall) (StackData, error) {
+		writer, err := call.Jvm.fileDescriptorWriter(call.Object(0))
+		if err != nil {
+			return StackData{}, err
+		}
+		elements := call.Reference(1).(*Array).Elements
+		offset, length := int(call.Int(2)), int(call.Int(3))
+		if offset < 0 || length < 0 || offset+length > len(elements) {
+			return StackData{}, throwable("java/lang/IndexOutOfBoundsException", "")
+		}
+		content := make([]byte, length)
+		for i := range content {
+			content[i] = byte(elements[offset+i].Int())
+		}
+		if _, err := writer.Write(content); err != nil {
+			return StackData{}, throwable("java/io/IOException", "%s", err)
+		}
+		return StackData{}, nil
+	})
+}
@@ -0,0 +1,1079 @@
+package jvm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// Frame is the activation record of a method run by the interpreter
+type Frame struct {
+	Class  *JavaClass
+	Method *MethodInfo
+	Code   *CodeAttribute
+	// Longs and doubles take two local variables, the second one is unused
+	Locals []StackData
+	// Every value takes a single stack entry
+	Stack []StackData
+	// Offset of the instruction being run
+	Pc int
+	// Objects whose monitor the method entered and has not exited, the
+	// one of a synchronized method first
+	Monitors []headed
+}
+
+func (f *Frame) push(v StackData) {
+	f.Stack = append(f.Stack, v)
+}
+
+func (f *Frame) pop() StackData {
+	v := f.Stack[len(f.Stack)-1]
+	f.Stack = f.Stack[:len(f.Stack)-1]
+	return v
+}
+
+// popN pops the n values on top of the stack, keeping their order
+func (f *Frame) popN(n int) []StackData {
+	values := append([]StackData(nil), f.Stack[len(f.Stack)-n:]...)
+	f.Stack = f.Stack[:len(f.Stack)-n]
+	return values
+}
+
+func (f *Frame) u1(offset int) int {
+	return int(f.Code.Code[offset])
+}
+
+func (f *Frame) u2(offset int) uint16 {
+	return binary.BigEndian.Uint16(f.Code.Code[offset:])
+}
+
+func (f *Frame) s2(offset int) int {
+	return int(int16(f.u2(offset)))
+}
+
+func (f *Frame) s4(offset int) int {
+	return int(int32(binary.BigEndian.Uint32(f.Code.Code[offset:])))
+}
+
+func intValue(v int32) StackData {
+	return StackData{Type: StackTypeInt, Data: v}
+}
+
+func longValue(v int64) StackData {
+	return StackData{Type: StackTypeLong, Data: v}
+}
+
+func floatValue(v float32) StackData {
+	return StackData{Type: StackTypeFloat, Data: v}
+}
+
+func doubleValue(v float64) StackData {
+	return StackData{Type: StackTypeDouble, Data: v}
+}
+
+func referenceValue(reference interface{}) StackData {
+	return StackData{Type: StackTypeReference, Data: reference}
+}
+
+func booleanValue(v bool) StackData {
+	if v {
+		return intValue(1)
+	}
+	return intValue(0)
+}
+
+func (s StackData) Int() int32 {
+	return s.Data.(int32)
+}
+
+func (s StackData) Long() int64 {
+	return s.Data.(int64)
+}
+
+func (s StackData) Float() float32 {
+	return s.Data.(float32)
+}
+
+func (s StackData) Double() float64 {
+	return s.Data.(float64)
+}
+
+// IsNull reports whether the value is the null reference
+func (s StackData) IsNull() bool {
+	return s.Type == StackTypeReference && s.Data == nil
+}
+
+// Size is the number of local variables the value takes
+func (s StackData) Size() int {
+	if s.Type == StackTypeLong || s.Type == StackTypeDouble {
+		return 2
+	}
+	return 1
+}
+
+// JavaThrowable is a Java exception propagating through the interpreter
+type JavaThrowable struct {
+	// Thrown object, nil for the exceptions raised by the vm itself until
+	// they unwind to a method that may catch them
+	Object    *Object
+	ClassName string
+	Message   string
+}
+
+func (t *JavaThrowable) Error() string {
+	name := strings.ReplaceAll(t.ClassName, "/", ".")
+	if message, ok := t.Object.messageField(); ok && t.Message == "" {
+		return fmt.Sprintf("%s: %s", name, message)
+	}
+	if t.Message == "" {
+		return name
+	}
+	return fmt.Sprintf("%s: %s", name, t.Message)
+}
+
+func throwable(className string, format string, a ...interface{}) error {
+	return &JavaThrowable{ClassName: className, Message: fmt.Sprintf(format, a...)}
+}
+
+// Invoke runs method with the given arguments, the receiver first for
+// instance methods. The result is meaningless for void methods. A
+// synchronized method holds the monitor of its receiver or class while it
+// runs
+func (jvm *Jvm) Invoke(class *JavaClass, method *MethodInfo, args []StackData) (StackData, error) {
+	if AccessFlag(method.AccessFlags)&AccSynchronized == 0 {
+		return jvm.invoke(class, method, args)
+	}
+	lock := jvm.methodLock(class, method, args)
+	jvm.monitorEnter(lock)
+	result, err := jvm.invoke(class, method, args)
+	if exitErr := jvm.monitorExit(lock); exitErr != nil && err == nil {
+		return StackData{}, exitErr
+	}
+	return result, err
+}
+
+func (jvm *Jvm) invoke(class *JavaClass, method *MethodInfo, args []StackData) (StackData, error) {
+	flags := AccessFlag(method.AccessFlags)
+	if native := jvm.findNative(class.Name(), method.Name, method.Descriptor); native != nil && (flags&AccNative != 0 || method.Code() == nil || jvm.replacesCode(class.Name(), method.Name, method.Descriptor)) {
+		return jvm.callNativeMethod(native, &NativeCall{Jvm: jvm, Class: class.Name(), Name: method.Name, Descriptor: method.Descriptor, Args: args})
+	}
+	if flags&AccAbstract != 0 {
+		return StackData{}, throwable("java/lang/AbstractMethodError", "%s.%s%s", class.Name(), method.Name, method.Descriptor)
+	}
+	code := method.Code()
+	if flags&AccNative != 0 || code == nil {
+		return StackData{}, throwable("java/lang/UnsatisfiedLinkError", "%s.%s%s", class.Name(), method.Name, method.Descriptor)
+	}
+
+	frame := &Frame{
+		Class:  class,
+		Method: method,
+		Code:   code,
+		Locals: make([]StackData, code.MaxLocals),
+		Stack:  make([]StackData, 0, code.MaxStack),
+	}
+	if flags&AccSynchronized != 0 {
+		frame.Monitors = []headed{jvm.methodLock(class, method, args)}
+	}
+	slot := 0
+	for _, arg := range args {
+		frame.Locals[slot] = arg
+		slot += arg.Size()
+	}
+	t := jvm.thread
+	t.frames = append(t.frames, frame)
+	defer func() { t.frames = t.frames[:len(t.frames)-1] }()
+	return jvm.run(frame)
+}
+
+// run executes the frame until it returns, exceptions thrown by its
+// instructions jump to the matching handler
+func (jvm *Jvm) run(frame *Frame) (StackData, error) {
+	for {
+		result, err := jvm.execute(frame)
+		if err == nil {
+			return result, nil
+		}
+		thrown, ok := catchable(err)
+		if !ok {
+			return StackData{}, err
+		}
+		if thrown.Object == nil {
+			// Raised by the vm, the instance is created when a handler may
+			// catch it
+			if thrown.Object = jvm.throwableObject(thrown.ClassName, thrown.Message); thrown.Object == nil {
+				return StackData{}, err
+			}
+		}
+		handlerPc, found := jvm.findHandler(frame, thrown.Object)
+		if !found {
+			return StackData{}, err
+		}
+		frame.Stack = frame.Stack[:0]
+		frame.push(referenceValue(thrown.Object))
+		frame.Pc = handlerPc
+	}
+}
+
+// catchable returns the exception a handler may catch for err. The linkage
+// errors of the class loader become exceptions raised by the vm, err itself
+// unwinds further when no handler catches them
+func catchable(err error) (*JavaThrowable, bool) {
+	switch err := err.(type) {
+	case *JavaThrowable:
+		return err, true
+	case *LinkageError:
+		return &JavaThrowable{ClassName: strings.ReplaceAll(err.ErrorClass, ".", "/"), Message: err.Message}, true
+	}
+	return nil, false
+}
+
+func (jvm *Jvm) findHandler(frame *Frame, thrown *Object) (int, bool) {
+	for _, handler := range frame.Code.ExceptionsTable {
+		if frame.Pc < int(handler.StartPc) || frame.Pc >= int(handler.EndPc) {
+			continue
+		}
+		if handler.CatchType == 0 || jvm.isAssignable(thrown.Class.Name(), GetClassName(frame.Class.ConstantPool, handler.CatchType)) {
+			return int(handler.HandlerPc), true
+		}
+	}
+	return 0, false
+}
+
+// isSubclass reports whether class is name or extends or implements it,
+// walking the loaded super types
+func (jvm *Jvm) isSubclass(class *JavaClass, name string) bool {
+	if class.Name() == name || class.SuperName() == name {
+		return true
+	}
+	for _, index := range class.Interfaces {
+		interfaceName := GetClassName(class.ConstantPool, index)
+		if interfaceName == name {
+			return true
+		}
+		if superInterface, ok := jvm.Classes[interfaceName]; ok && jvm.isSubclass(superInterface, name) {
+			return true
+		}
+	}
+	if super, ok := jvm.Classes[class.SuperName()]; ok {
+		return jvm.isSubclass(super, name)
+	}
+	return false
+}
+
+func javaF2I(v float64) int32 {
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case v >= math.MaxInt32:
+		return math.MaxInt32
+	case v <= math.MinInt32:
+		return math.MinInt32
+	}
+	return int32(v)
+}
+
+func javaF2L(v float64) int64 {
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case v >= math.MaxInt64:
+		return math.MaxInt64
+	case v <= math.MinInt64:
+		return math.MinInt64
+	}
+	return int64(v)
+}
+
+// compareFloats implements fcmp and dcmp, nanResult is pushed when either
+// value is NaN
+func compareFloats(a, b float64, nanResult int32) StackData {
+	switch {
+	case math.IsNaN(a) || math.IsNaN(b):
+		return intValue(nanResult)
+	case a > b:
+		return intValue(1)
+	case a < b:
+		return intValue(-1)
+	}
+	return intValue(0)
+}
+
+// dupValues duplicates the values covering the top dup slots of the stack,
+// inserting the copy below the values covering the next skip slots
+func (f *Frame) dupValues(dup, skip int) {
+	count := 0
+	for slots := 0; slots < dup; count++ {
+		slots += f.Stack[len(f.Stack)-1-count].Size()
+	}
+	skipped := 0
+	for slots := 0; slots < skip; skipped++ {
+		slots += f.Stack[len(f.Stack)-1-count-skipped].Size()
+	}
+	top := f.popN(count)
+	below := f.popN(skipped)
+	f.Stack = append(f.Stack, top...)
+	f.Stack = append(f.Stack, below...)
+	f.Stack = append(f.Stack, top...)
+}
+
+// branch returns the next pc of a conditional branch at pc
+func (f *Frame) branch(pc int, taken bool) int {
+	if taken {
+		return pc + f.s2(pc+1)
+	}
+	return pc + 3
+}
+
+func sameReference(a, b StackData) bool {
+	return a.Data == b.Data
+}
+
+func (jvm *Jvm) arrayAccess(frame *Frame) (*Array, int, error) {
+	index := frame.pop().Int()
+	arrayRef := frame.pop()
+	if arrayRef.IsNull() {
+		return nil, 0, throwable("java/lang/NullPointerException", "Cannot load from array because it is null")
+	}
+	array := arrayRef.Data.(*Array)
+	if index < 0 || int(index) >= len(array.Elements) {
+		return nil, 0, throwable("java/lang/ArrayIndexOutOfBoundsException", "Index %d out of bounds for length %d", index, len(array.Elements))
+	}
+	return array, int(index), nil
+}
+
+// execute runs the instructions of the frame until it returns or an
+// exception is thrown, frame.Pc is left on the faulting instruction
+func (jvm *Jvm) execute(frame *Frame) (StackData, error) {
+	code := frame.Code.Code
+	for {
+		jvm.safepoint()
+		pc := frame.Pc
+		op := Opcode(code[pc])
+		length, err := InstructionLength(code, pc)
+		if err != nil {
+			return StackData{}, err
+		}
+		next := pc + length
+
+		switch op {
+		case OpNop:
+		case OpAconstNull:
+			frame.push(nullReference)
+		case OpIconstM1, OpIconst0, OpIconst1, OpIconst2, OpIconst3, OpIconst4, OpIconst5:
+			frame.push(intValue(int32(op) - int32(OpIconst0)))
+		case OpLconst0, OpLconst1:
+			frame.push(longValue(int64(op - OpLconst0)))
+		case OpFconst0, OpFconst1, OpFconst2:
+			frame.push(floatValue(float32(op - OpFconst0)))
+		case OpDconst0, OpDconst1:
+			frame.push(doubleValue(float64(op - OpDconst0)))
+		case OpBipush:
+			frame.push(intValue(int32(int8(code[pc+1]))))
+		case OpSipush:
+			frame.push(intValue(int32(frame.s2(pc + 1))))
+		case OpLdc, OpLdcW, OpLdc2W:
+			index := uint16(frame.u1(pc + 1))
+			if op != OpLdc {
+				index = frame.u2(pc + 1)
+			}
+			value, err := jvm.loadConstant(frame.Class, index)
+			if err != nil {
+				return StackData{}, err
+			}
+			frame.push(value)
+
+		case OpIload, OpLload, OpFload, OpDload, OpAload:
+			frame.push(frame.Locals[frame.u1(pc+1)])
+		case OpIload0, OpIload1, OpIload2, OpIload3:
+			frame.push(frame.Locals[op-OpIload0])
+		case OpLload0, OpLload1, OpLload2, OpLload3:
+			frame.push(frame.Locals[op-OpLload0])
+		case OpFload0, OpFload1, OpFload2, OpFload3:
+			frame.push(frame.Locals[op-OpFload0])
+		case OpDload0, OpDload1, OpDload2, OpDload3:
+			frame.push(frame.Locals[op-OpDload0])
+		case OpAload0, OpAload1, OpAload2, OpAload3:
+			frame.push(frame.Locals[op-OpAload0])
+		case OpIaload, OpLaload, OpFaload, OpDaload, OpAaload, OpBaload, OpCaload, OpSaload:
+			array, index, err := jvm.arrayAccess(frame)
+			if err != nil {
+				return StackData{}, err
+			}
+			frame.push(array.Elements[index])
+
+		case OpIstore, OpLstore, OpFstore, OpDstore, OpAstore:
+			frame.Locals[frame.u1(pc+1)] = frame.pop()
+		case OpIstore0, OpIstore1, OpIstore2, OpIstore3:
+			frame.Locals[op-OpIstore0] = frame.pop()
+		case OpLstore0, OpLstore1, OpLstore2, OpLstore3:
+			frame.Locals[op-OpLstore0] = frame.pop()
+		case OpFstore0, OpFstore1, OpFstore2, OpFstore3:
+			frame.Locals[op-OpFstore0] = frame.pop()
+		case OpDstore0, OpDstore1, OpDstore2, OpDstore3:
+			frame.Locals[op-OpDstore0] = frame.pop()
+		case OpAstore0, OpAstore1, OpAstore2, OpAstore3:
+			frame.Locals[op-OpAstore0] = frame.pop()
+		case OpIastore, OpLastore, OpFastore, OpDastore, OpAastore, OpBastore, OpCastore, OpSastore:
+			value := frame.pop()
+			array, index, err := jvm.arrayAccess(frame)
+			if err != nil {
+				return StackData{}, err
+			}
+			switch op {
+			case OpBastore:
+				if array.Descriptor == "[Z" {
+					value = intValue(value.Int() & 1)
+				} else {
+					value = intValue(int32(int8(value.Int())))
+				}
+			case OpCastore:
+				value = intValue(int32(uint16(value.Int())))
+			case OpSastore:
+				value = intValue(int32(int16(value.Int())))
+			}
+			if op == OpAastore && !value.IsNull() && !jvm.isAssignable(jvm.referenceClassName(value), componentName(array.Descriptor)) {
+				return StackData{}, throwable("java/lang/ArrayStoreException", "%s", strings.ReplaceAll(jvm.referenceClassName(value), "/", "."))
+			}
+			array.Elements[index] = value
+
+		case OpPop:
+			frame.pop()
+		case OpPop2:
+			if frame.pop().Size() == 1 {
+				frame.pop()
+			}
+		case OpDup:
+			frame.dupValues(1, 0)
+		case OpDupX1:
+			frame.dupValues(1, 1)
+		case OpDupX2:
+			frame.dupValues(1, 2)
+		case OpDup2:
+			frame.dupValues(2, 0)
+		case OpDup2X1:
+			frame.dupValues(2, 1)
+		case OpDup2X2:
+			frame.dupValues(2, 2)
+		case OpSwap:
+			values := frame.popN(2)
+			frame.push(values[1])
+			frame.push(values[0])
+
+		case OpIadd, OpIsub, OpImul, OpIdiv, OpIrem, OpIshl, OpIshr, OpIushr, OpIand, OpIor, OpIxor:
+			b := frame.pop().Int()
+			a := frame.pop().Int()
+			var result int32
+			switch op {
+			case OpIadd:
+				result = a + b
+			case OpIsub:
+				result = a - b
+			case OpImul:
+				result = a * b
+			case OpIdiv, OpIrem:
+				if b == 0 {
+					return StackData{}, throwable("java/lang/ArithmeticException", "/ by zero")
+				}
+				if op == OpIdiv {
+					result = a / b
+				} else {
+					result = a % b
+				}
+			case OpIshl:
+				result = a << (b & 0x1f)
+			case OpIshr:
+				result = a >> (b & 0x1f)
+			case OpIushr:
+				result = int32(uint32(a) >> (b & 0x1f))
+			case OpIand:
+				result = a & b
+			case OpIor:
+				result = a | b
+			case OpIxor:
+				result = a ^ b
+			}
+			frame.push(intValue(result))
+		case OpLshl, OpLshr, OpLushr:
+			shift := frame.pop().Int() & 0x3f
+			a := frame.pop().Long()
+			switch op {
+			case OpLshl:
+				frame.push(longValue(a << shift))
+			case OpLshr:
+				frame.push(longValue(a >> shift))
+			default:
+				frame.push(longValue(int64(uint64(a) >> shift)))
+			}
+		case OpLadd, OpLsub, OpLmul, OpLdiv, OpLrem, OpLand, OpLor, OpLxor:
+			b := frame.pop().Long()
+			a := frame.pop().Long()
+			var result int64
+			switch op {
+			case OpLadd:
+				result = a + b
+			case OpLsub:
+				result = a - b
+			case OpLmul:
+				result = a * b
+			case OpLdiv, OpLrem:
+				if b == 0 {
+					return StackData{}, throwable("java/lang/ArithmeticException", "/ by zero")
+				}
+				if op == OpLdiv {
+					result = a / b
+				} else {
+					result = a % b
+				}
+			case OpLand:
+				result = a & b
+			case OpLor:
+				result = a | b
+			case OpLxor:
+				result = a ^ b
+			}
+			frame.push(longValue(result))
+		case OpFadd, OpFsub, OpFmul, OpFdiv, OpFrem:
+			b := frame.pop().Float()
+			a := frame.pop().Float()
+			var result float32
+			switch op {
+			case OpFadd:
+				result = a + b
+			case OpFsub:
+				result = a - b
+			case OpFmul:
+				result = a * b
+			case OpFdiv:
+				result = a / b
+			case OpFrem:
+				result = float32(math.Mod(float64(a), float64(b)))
+			}
+			frame.push(floatValue(result))
+		case OpDadd, OpDsub, OpDmul, OpDdiv, OpDrem:
+			b := frame.pop().Double()
+			a := frame.pop().Double()
+			var result float64
+			switch op {
+			case OpDadd:
+				result = a + b
+			case OpDsub:
+				result = a - b
+			case OpDmul:
+				result = a * b
+			case OpDdiv:
+				result = a / b
+			case OpDrem:
+				result = math.Mod(a, b)
+			}
+			frame.push(doubleValue(result))
+		case OpIneg:
+			frame.push(intValue(-frame.pop().Int()))
+		case OpLneg:
+			frame.push(longValue(-frame.pop().Long()))
+		case OpFneg:
+			frame.push(floatValue(-frame.pop().Float()))
+		case OpDneg:
+			frame.push(doubleValue(-frame.pop().Double()))
+		case OpIinc:
+			index := frame.u1(pc + 1)
+			frame.Locals[index] = intValue(frame.Locals[index].Int() + int32(int8(code[pc+2])))
+
+		case OpI2l:
+			frame.push(longValue(int64(frame.pop().Int())))
+		case OpI2f:
+			frame.push(floatValue(float32(frame.pop().Int())))
+		case OpI2d:
+			frame.push(doubleValue(float64(frame.pop().Int())))
+		case OpL2i:
+			frame.push(intValue(int32(frame.pop().Long())))
+		case OpL2f:
+			frame.push(floatValue(float32(frame.pop().Long())))
+		case OpL2d:
+			frame.push(doubleValue(float64(frame.pop().Long())))
+		case OpF2i:
+			frame.push(intValue(javaF2I(float64(frame.pop().Float()))))
+		case OpF2l:
+			frame.push(longValue(javaF2L(float64(frame.pop().Float()))))
+		case OpF2d:
+			frame.push(doubleValue(float64(frame.pop().Float())))
+		case OpD2i:
+			frame.push(intValue(javaF2I(frame.pop().Double())))
+		case OpD2l:
+			frame.push(longValue(javaF2L(frame.pop().Double())))
+		case OpD2f:
+			frame.push(floatValue(float32(frame.pop().Double())))
+		case OpI2b:
+			frame.push(intValue(int32(int8(frame.pop().Int()))))
+		case OpI2c:
+			frame.push(intValue(int32(uint16(frame.pop().Int()))))
+		case OpI2s:
+			frame.push(intValue(int32(int16(frame.pop().Int()))))
+
+		case OpLcmp:
+			b := frame.pop().Long()
+			a := frame.pop().Long()
+			switch {
+			case a > b:
+				frame.push(intValue(1))
+			case a < b:
+				frame.push(intValue(-1))
+			default:
+				frame.push(intValue(0))
+			}
+		case OpFcmpl, OpFcmpg:
+			b := frame.pop().Float()
+			a := frame.pop().Float()
+			nanResult := int32(-1)
+			if op == OpFcmpg {
+				nanResult = 1
+			}
+			frame.push(compareFloats(float64(a), float64(b), nanResult))
+		case OpDcmpl, OpDcmpg:
+			b := frame.pop().Double()
+			a := frame.pop().Double()
+			nanResult := int32(-1)
+			if op == OpDcmpg {
+				nanResult = 1
+			}
+			frame.push(compareFloats(a, b, nanResult))
+
+		case OpIfeq, OpIfne, OpIflt, OpIfge, OpIfgt, OpIfle:
+			v := frame.pop().Int()
+			taken := [...]bool{v == 0, v != 0, v < 0, v >= 0, v > 0, v <= 0}[op-OpIfeq]
+			next = frame.branch(pc, taken)
+		case OpIfIcmpeq, OpIfIcmpne, OpIfIcmplt, OpIfIcmpge, OpIfIcmpgt, OpIfIcmple:
+			b := frame.pop().Int()
+			a := frame.pop().Int()
+			taken := [...]bool{a == b, a != b, a < b, a >= b, a > b, a <= b}[op-OpIfIcmpeq]
+			next = frame.branch(pc, taken)
+		case OpIfAcmpeq, OpIfAcmpne:
+			b := frame.pop()
+			a := frame.pop()
+			next = frame.branch(pc, sameReference(a, b) == (op == OpIfAcmpeq))
+		case OpIfnull, OpIfnonnull:
+			next = frame.branch(pc, frame.pop().IsNull() == (op == OpIfnull))
+		case OpGoto:
+			next = pc + frame.s2(pc+1)
+		case OpGotoW:
+			next = pc + frame.s4(pc+1)
+		case OpJsr, OpJsrW:
+			frame.push(StackData{Type: StackTypeReturnAddress, Data: next})
+			if op == OpJsr {
+				next = pc + frame.s2(pc+1)
+			} else {
+				next = pc + frame.s4(pc+1)
+			}
+		case OpRet:
+			next = frame.Locals[frame.u1(pc+1)].Data.(int)
+		case OpTableswitch:
+			base := pc + 1 + (3 - pc%4)
+			index := int(frame.pop().Int())
+			low := frame.s4(base + 4)
+			high := frame.s4(base + 8)
+			if index < low || index > high {
+				next = pc + frame.s4(base)
+			} else {
+				next = pc + frame.s4(base+12+(index-low)*4)
+			}
+		case OpLookupswitch:
+			base := pc + 1 + (3 - pc%4)
+			key := int(frame.pop().Int())
+			next = pc + frame.s4(base)
+			for i := 0; i < frame.s4(base+4); i++ {
+				if frame.s4(base+8+i*8) == key {
+					next = pc + frame.s4(base+12+i*8)
+					break
+				}
+			}
+
+		case OpIreturn, OpLreturn, OpFreturn, OpDreturn, OpAreturn:
+			return frame.pop(), nil
+		case OpReturn:
+			return StackData{}, nil
+
+		case OpGetstatic, OpPutstatic, OpGetfield, OpPutfield:
+			if err := jvm.fieldInstruction(frame, op); err != nil {
+				return StackData{}, err
+			}
+		case OpInvokevirtual, OpInvokespecial, OpInvokestatic, OpInvokeinterface:
+			if err := jvm.invokeInstruction(frame, op); err != nil {
+				return StackData{}, err
+			}
+		case OpInvokedynamic:
+			if err := jvm.invokeDynamic(frame); err != nil {
+				return StackData{}, err
+			}
+
+		case OpNew:
+			class, err := jvm.LoadClass(GetClassName(frame.Class.ConstantPool, frame.u2(pc+1)))
+			if err != nil {
+				return StackData{}, err
+			}
+			if class.AccessFlags&(AccInterface|AccAbstract) != 0 {
+				return StackData{}, throwable("java/lang/InstantiationError", "%s", class.Name())
+			}
+			if err := jvm.InitializeClass(class); err != nil {
+				return StackData{}, err
+			}
+			// Strings of the JDK's class library are the vm's strings too
+			var object headed = &String{}
+			if class.Name() != "java/lang/String" {
+				object = jvm.NewObject(class)
+			}
+			if err := jvm.allocate(object); err != nil {
+				return StackData{}, err
+			}
+			if jvm.hasFinalizer(class) {
+				jvm.finalizable = append(jvm.finalizable, object.(*Object))
+			}
+			frame.push(referenceValue(object))
+		case OpNewarray:
+			count := frame.pop().Int()
+			if count < 0 {
+				return StackData{}, throwable("java/lang/NegativeArraySizeException", "%d", count)
+			}
+			array, err := jvm.newArray(newarrayTypes[frame.u1(pc+1)], int(count))
+			if err != nil {
+				return StackData{}, err
+			}
+			frame.push(referenceValue(array))
+		case OpAnewarray:
+			count := frame.pop().Int()
+			if count < 0 {
+				return StackData{}, throwable("java/lang/NegativeArraySizeException", "%d", count)
+			}
+			component := GetClassName(frame.Class.ConstantPool, frame.u2(pc+1))
+			array, err := jvm.newArray(vReference(component).ArrayOf().Name, int(count))
+			if err != nil {
+				return StackData{}, err
+			}
+			frame.push(referenceValue(array))
+		case OpMultianewarray:
+			dimensions := frame.u1(pc + 3)
+			counts := frame.popN(dimensions)
+			for _, count := range counts {
+				if count.Int() < 0 {
+					return StackData{}, throwable("java/lang/NegativeArraySizeException", "%d", count.Int())
+				}
+			}
+			array, err := jvm.newMultiArray(GetClassName(frame.Class.ConstantPool, frame.u2(pc+1)), counts)
+			if err != nil {
+				return StackData{}, err
+			}
+			frame.push(referenceValue(array))
+		case OpArraylength:
+			arrayRef := frame.pop()
+			if arrayRef.IsNull() {
+				return StackData{}, throwable("java/lang/NullPointerException", "Cannot read the array length because it is null")
+			}
+			frame.push(intValue(int32(len(arrayRef.Data.(*Array).Elements))))
+		case OpAthrow:
+			thrown := frame.pop()
+			if thrown.IsNull() {
+				return StackData{}, throwable("java/lang/NullPointerException", "Cannot throw exception because it is null")
+			}
+			object := thrown.Data.(*Object)
+			return StackData{}, &JavaThrowable{Object: object, ClassName: object.Class.Name()}
+		case OpCheckcast:
+			className := GetClassName(frame.Class.ConstantPool, frame.u2(pc+1))
+			value := frame.Stack[len(frame.Stack)-1]
+			if !value.IsNull() && !jvm.isInstance(value, className) {
+				return StackData{}, throwable("java/lang/ClassCastException", "%s", jvm.classCastMessage(jvm.referenceClassName(value), className))
+			}
+		case OpInstanceof:
+			className := GetClassName(frame.Class.ConstantPool, frame.u2(pc+1))
+			value := frame.pop()
+			frame.push(booleanValue(!value.IsNull() && jvm.isInstance(value, className)))
+		case OpMonitorenter:
+			value := frame.pop()
+			if value.IsNull() {
+				return StackData{}, throwable("java/lang/NullPointerException", "Cannot enter synchronized block because the object is null")
+			}
+			jvm.monitorEnter(value.Data.(headed))
+			frame.Monitors = append(frame.Monitors, value.Data.(headed))
+		case OpMonitorexit:
+			value := frame.pop()
+			if value.IsNull() {
+				return StackData{}, throwable("java/lang/NullPointerException", "Cannot exit synchronized block because the object is null")
+			}
+			if err := jvm.monitorExit(value.Data.(headed)); err != nil {
+				return StackData{}, err
+			}
+			if i := slices.Index(frame.Monitors, value.Data.(headed)); i >= 0 {
+				frame.Monitors = slices.Delete(frame.Monitors, i, i+1)
+			}
+		case OpWide:
+			index := int(frame.u2(pc + 2))
+			switch Opcode(code[pc+1]) {
+			case OpIload, OpLload, OpFload, OpDload, OpAload:
+				frame.push(frame.Locals[index])
+			case OpIstore, OpLstore, OpFstore, OpDstore, OpAstore:
+				frame.Locals[index] = frame.pop()
+			case OpIinc:
+				frame.Locals[index] = intValue(frame.Locals[index].Int() + int32(frame.s2(pc+4)))
+			case OpRet:
+				next = frame.Locals[index].Data.(int)
+			}
+		default:
+			return StackData{}, fmt.Errorf("opcode %s not supported", op)
+		}
+		frame.Pc = next
+	}
+}
+
+func newMultiArray(arrayDescriptor string, counts []StackData) *Array {
+	array := NewArray(arrayDescriptor, int(counts[0].Int()))
+	if len(counts) > 1 {
+		for i := range array.Elements {
+			array.Elements[i] = referenceValue(newMultiArray(arrayDescriptor[1:], counts[1:]))
+		}
+	}
+	return array
+}
+
+// referenceClassName returns the internal name of the class of a non null
+// reference
+func (jvm *Jvm) referenceClassName(value StackData) string {
+	switch reference := value.Data.(type) {
+	case *Object:
+		return reference.Class.Name()
+	case *Array:
+		return reference.Descriptor
+	case *String:
+		return "java/lang/String"
+	case *ClassMirror:
+		return "java/lang/Class"
+	case *MethodType:
+		return "java/lang/invoke/MethodType"
+	case *MethodHandle:
+		return "java/lang/invoke/MethodHandle"
+	case *Lookup:
+		return "java/lang/invoke/MethodHandles$Lookup"
+	}
+	return "java/lang/Object"
+}
+
+// isInstance implements the type test of checkcast and instanceof for a non
+// null reference
+func (jvm *Jvm) isInstance(value StackData, className string) bool {
+	return jvm.isAssignable(jvm.referenceClassName(value), className)
+}
+
+// isAssignable implements the rules of checkcast (JVMS §6.5) telling whether
+// a value of type from is one of type to, which are internal names of
+// classes or descriptors of arrays. Arrays are covariant in their reference
+// components, an array of primitives is only one of the same primitives
+func (jvm *Jvm) isAssignable(from, to string) bool {
+	if from == to || to == "java/lang/Object" {
+		return true
+	}
+	if from[0] == '[' {
+		switch {
+		case to == "java/lang/Cloneable" || to == "java/io/Serializable":
+			return true
+		case to[0] != '[' || !isReferenceDescriptor(from[1:]) || !isReferenceDescriptor(to[1:]):
+			return false
+		}
+		return jvm.isAssignable(componentName(from), componentName(to))
+	}
+	if to[0] == '[' {
+		return false
+	}
+	class, err := jvm.LoadClass(from)
+	return err == nil && jvm.isSubclass(class, to)
+}
+
+// isReferenceDescriptor tells whether a field descriptor is the one of a
+// class or an array
+func isReferenceDescriptor(fieldDescriptor string) bool {
+	return fieldDescriptor[0] == 'L' || fieldDescriptor[0] == '['
+}
+
+// componentName returns the component type of an array descriptor as
+// isAssignable takes it: the internal name of a class or a descriptor
+func componentName(arrayDescriptor string) string {
+	component := arrayDescriptor[1:]
+	if component[0] == 'L' {
+		return component[1 : len(component)-1]
+	}
+	return component
+}
+
+// classCastMessage returns the message of the ClassCastException of a cast
+// from one type to another, naming their modules like HotSpot
+func (jvm *Jvm) classCastMessage(from, to string) string {
+	fromName, toName := strings.ReplaceAll(from, "/", "."), strings.ReplaceAll(to, "/", ".")
+	fromModule, toModule := jvm.moduleDescription(from), jvm.moduleDescription(to)
+	if fromModule == toModule {
+		return fmt.Sprintf("class %s cannot be cast to class %s (%s and %s are in %s)", fromName, toName, fromName, toName, fromModule)
+	}
+	return fmt.Sprintf("class %s cannot be cast to class %s (%s is in %s; %s is in %s)", fromName, toName, fromName, fromModule, toName, toModule)
+}
+
+// moduleDescription returns where a type is for messages: the module of the
+// class library for the classes of the boot class path and the primitives,
+// else the unnamed module of the application class loader
+func (jvm *Jvm) moduleDescription(name string) string {
+	element := strings.TrimLeft(name, "[")
+	if len(element) < len(name) {
+		if element[0] != 'L' {
+			return "module java.base of loader 'bootstrap'"
+		}
+		element = element[1 : len(element)-1]
+	}
+	for _, source := range jvm.BootClassPath {
+		if _, err := source.ReadClass(element); err == nil {
+			return "module java.base of loader 'bootstrap'"
+		}
+	}
+	return "unnamed module of loader 'app'"
+}
+
+// loadConstant pushes a loadable constant of the constant pool of class
+func (jvm *Jvm) loadConstant(class *JavaClass, index uint16) (StackData, error) {
+	constant := class.ConstantPool[index-1]
+	switch constant.Tag {
+	case ConstantIntegerTag:
+		return intValue(constant.Data.(ConstantInteger)), nil
+	case ConstantFloatTag:
+		return floatValue(constant.Data.(ConstantFloat)), nil
+	case ConstantLongTag:
+		return longValue(constant.Data.(ConstantLong)), nil
+	case ConstantDoubleTag:
+		return doubleValue(constant.Data.(ConstantDouble)), nil
+	case ConstantStringTag:
+		return referenceValue(jvm.internString(GetUtf8(class.ConstantPool, constant.Data.(ConstantString).StringIndex))), nil
+	case ConstantClassTag:
+		className := GetClassName(class.ConstantPool, index)
+		if className[0] != '[' {
+			className = "L" + className + ";"
+		}
+		return referenceValue(jvm.Mirror(className)), nil
+	case ConstantMethodTypeTag:
+		methodType, err := jvm.MethodTypeOf(GetUtf8(class.ConstantPool, constant.Data.(ConstantMethodType).DescriptorIndex))
+		if err != nil {
+			return StackData{}, err
+		}
+		return referenceValue(methodType), nil
+	case ConstantMethodHandleTag:
+		ref, _ := GetMethodHandle(class.ConstantPool, index)
+		handle, err := jvm.NewMethodHandle(class, ref)
+		if err != nil {
+			return StackData{}, err
+		}
+		return referenceValue(handle), nil
+	}
+	return StackData{}, fmt.Errorf("ldc of %s constants is not supported", constant.Tag)
+}
+
+func (jvm *Jvm) fieldInstruction(frame *Frame, op Opcode) error {
+	className, name, fieldDescriptor := GetMemberRef(frame.Class.ConstantPool, frame.u2(frame.Pc+1))
+	class, err := jvm.LoadClass(className)
+	if err != nil {
+		return err
+	}
+	owner, field := jvm.resolveField(class, name, fieldDescriptor)
+	if field == nil {
+		return throwable("java/lang/NoSuchFieldError", "%s", name)
+	}
+	if err := jvm.CheckMemberAccess(frame.Class, owner, name, field.AccessFlags); err != nil {
+		return err
+	}
+	isStatic := op == OpGetstatic || op == OpPutstatic
+	if isStatic != (field.AccessFlags&AccStatic != 0) {
+		return &LinkageError{ErrorClass: "java.lang.IncompatibleClassChangeError", Message: fmt.Sprintf("Expected %s field %s.%s", map[bool]string{true: "static", false: "non-static"}[isStatic], owner.Name(), name)}
+	}
+	key := owner.Name() + "." + name
+	if field.AccessFlags&AccVolatile != 0 && (op == OpGetstatic || op == OpGetfield) {
+		jvm.volatileRead()
+	}
+
+	switch op {
+	case OpGetstatic:
+		if err := jvm.InitializeClass(owner); err != nil {
+			return err
+		}
+		frame.push(jvm.StaticFields[key])
+	case OpPutstatic:
+		if err := jvm.InitializeClass(owner); err != nil {
+			return err
+		}
+		jvm.StaticFields[key] = frame.pop()
+	case OpGetfield:
+		objectRef := frame.pop()
+		if objectRef.IsNull() {
+			return throwable("java/lang/NullPointerException", "Cannot read field \"%s\" because value is null", name)
+		}
+		switch r := objectRef.Data.(type) {
+		case *Object:
+			frame.push(r.Fields[key])
+		case *String:
+			frame.push(r.field(name))
+		case fieldHolder:
+			frame.push(r.store().field(key, fieldDescriptor))
+		default:
+			return jvm.fieldReceiverError(objectRef, key)
+		}
+	case OpPutfield:
+		value := frame.pop()
+		objectRef := frame.pop()
+		if objectRef.IsNull() {
+			return throwable("java/lang/NullPointerException", "Cannot assign field \"%s\" because value is null", name)
+		}
+		switch r := objectRef.Data.(type) {
+		case *Object:
+			r.Fields[key] = value
+		case *String:
+			r.setField(name, value)
+		case fieldHolder:
+			r.store().setField(key, value)
+		default:
+			return jvm.fieldReceiverError(objectRef, key)
+		}
+	}
+	return nil
+}
+
+// fieldReceiverError is thrown by getfield and putfield on a reference
+// without instance fields, an array the verifier let through
+func (jvm *Jvm) fieldReceiverError(objectRef StackData, key string) error {
+	return &LinkageError{ErrorClass: "java.lang.IncompatibleClassChangeError", Message: fmt.Sprintf("%s has no field %s", strings.ReplaceAll(jvm.referenceClassName(objectRef), "/", "."), key)}
+}
+
+func (jvm *Jvm) invokeInstruction(frame *Frame, op Opcode) error {
+	className, name, methodDescriptor := GetMemberRef(frame.Class.ConstantPool, frame.u2(frame.Pc+1))
+	methodType, err := descriptor.ParseMethod(methodDescriptor)
+	if err != nil {
+		return err
+	}
+	argsCount := len(methodType.Params)
+	if op != OpInvokestatic {
+		argsCount++
+	}
+	args := frame.popN(argsCount)
+
+	var result StackData
+	switch {
+	case op == OpInvokestatic && className == "java/lang/invoke/MethodHandles" && name == "lookup":
+		// Caller sensitive, the lookup class is the calling class
+		result = referenceValue(&Lookup{Class: frame.Class})
+	case op == OpInvokestatic:
+		result, err = jvm.InvokeStatic(className, name, methodDescriptor, args)
+	case op == OpInvokespecial:
+		result, err = jvm.InvokeSpecial(className, name, methodDescriptor, args)
+	default:
+		result, err = jvm.InvokeVirtual(className, name, methodDescriptor, args)
+	}
+	if err != nil {
+		return err
+	}
+	if methodType.Return != descriptor.Void {
+		frame.push(result)
+	}
+	return nil
+}
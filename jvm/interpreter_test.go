@@ -0,0 +1,133 @@
+package jvm
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIsAssignable(t *testing.T) {
+	jvm, err := NewJvm(filepath.Join("..", "Main.class"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"java/lang/Integer", "java/lang/Integer", true},
+		{"java/lang/Integer", "java/lang/Number", true},
+		{"java/lang/Integer", "java/lang/Object", true},
+		{"java/lang/Number", "java/lang/Integer", false},
+		// Interfaces of the class and of its super classes
+		{"java/lang/Integer", "java/lang/Comparable", true},
+		{"java/lang/Integer", "java/io/Serializable", true},
+		{"java/lang/Integer", "java/lang/CharSequence", false},
+		{"java/lang/Integer", "[Ljava/lang/Integer;", false},
+		// Arrays are Cloneable and Serializable, and covariant
+		{"[I", "java/lang/Object", true},
+		{"[I", "java/lang/Cloneable", true},
+		{"[I", "java/io/Serializable", true},
+		{"[I", "java/lang/Comparable", false},
+		{"[Ljava/lang/Integer;", "[Ljava/lang/Number;", true},
+		{"[Ljava/lang/Integer;", "[Ljava/lang/Object;", true},
+		{"[Ljava/lang/Number;", "[Ljava/lang/Integer;", false},
+		{"[Ljava/lang/String;", "[Ljava/lang/Integer;", false},
+		// Arrays of interfaces
+		{"[Ljava/lang/String;", "[Ljava/lang/CharSequence;", true},
+		{"[Ljava/lang/CharSequence;", "[Ljava/lang/String;", false},
+		{"[Ljava/lang/CharSequence;", "[Ljava/lang/Object;", true},
+		{"[[I", "[Ljava/lang/Cloneable;", true},
+		{"[[Ljava/lang/String;", "[[Ljava/io/Serializable;", true},
+		{"[[Ljava/lang/String;", "[Ljava/io/Serializable;", true},
+		// Primitive arrays are only assignable to the same type
+		{"[I", "[I", true},
+		{"[I", "[J", false},
+		{"[B", "[Z", false},
+		{"[I", "[Ljava/lang/Object;", false},
+		{"[Ljava/lang/Object;", "[I", false},
+		{"[[I", "[[J", false},
+		{"[[I", "[Ljava/lang/Object;", true},
+	}
+	for _, test := range tests {
+		if got := jvm.isAssignable(test.from, test.to); got != test.want {
+			t.Errorf("isAssignable(%s, %s) = %t, want %t", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestTypeChecks(t *testing.T) {
+	tests := []struct {
+		name string
+		// check throws the exception
+		check  func(p programBuilder)
+		stdout string
+	}{
+		{
+			name: "String stored into an Integer[] typed Object[]",
+			check: func(p programBuilder) {
+				p.op(OpIconst1)
+				p.op(OpAnewarray, p.class.class("java/lang/Integer"))
+				p.op(OpCheckcast, p.class.class("[Ljava/lang/Object;"))
+				p.op(OpIconst0)
+				p.ldc("s")
+				p.op(OpAastore)
+			},
+			stdout: "java.lang.ArrayStoreException: java.lang.String\n",
+		},
+		{
+			name: "cast to an interface",
+			check: func(p programBuilder) {
+				p.newObject("java/lang/Object")
+				p.op(OpCheckcast, p.class.class("java/lang/Runnable"))
+			},
+			stdout: "java.lang.ClassCastException: class java.lang.Object cannot be cast to class java.lang.Runnable (java.lang.Object and java.lang.Runnable are in module java.base of loader 'bootstrap')\n",
+		},
+		{
+			name: "cast to an array",
+			check: func(p programBuilder) {
+				p.op(OpIconst1)
+				p.op(OpAnewarray, p.class.class("java/lang/Object"))
+				p.op(OpCheckcast, p.class.class("[Ljava/lang/String;"))
+			},
+			stdout: "java.lang.ClassCastException: class [Ljava.lang.Object; cannot be cast to class [Ljava.lang.String; ([Ljava.lang.Object; and [Ljava.lang.String; are in module java.base of loader 'bootstrap')\n",
+		},
+		{
+			name: "cast of a primitive array",
+			check: func(p programBuilder) {
+				p.op(OpIconst1)
+				p.op(OpNewarray, uint8(10))
+				p.op(OpCheckcast, p.class.class("[Ljava/lang/Object;"))
+			},
+			stdout: "java.lang.ClassCastException: class [I cannot be cast to class [Ljava.lang.Object; ([I and [Ljava.lang.Object; are in module java.base of loader 'bootstrap')\n",
+		},
+		{
+			name: "cast to a class of the application",
+			check: func(p programBuilder) {
+				p.ldc("s")
+				p.op(OpCheckcast, p.class.class("Main"))
+			},
+			stdout: "java.lang.ClassCastException: class java.lang.String cannot be cast to class Main (java.lang.String is in module java.base of loader 'bootstrap'; Main is in unnamed module of loader 'app')\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := buildProgram(t, func(p programBuilder) {
+				start := p.pc()
+				test.check(p)
+				end := p.pc()
+				p.op(OpReturn)
+				// catch (RuntimeException e) { System.out.println(e); }
+				p.catch(start, end, p.pc(), "java/lang/RuntimeException")
+				p.op(OpAstore1)
+				p.println("(Ljava/lang/Object;)V", func() { p.op(OpAload1) })
+			})
+			stdout, stderr := runProgram(t, path)
+			if want := "Running main function code\n" + test.stdout; stdout != want {
+				t.Errorf("stdout = %q, want %q", stdout, want)
+			}
+			if stderr != "" {
+				t.Errorf("stderr = %q", stderr)
+			}
+		})
+	}
+}
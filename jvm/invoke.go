@@ -0,0 +1,286 @@
+package jvm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// findMethod resolves a method in class and its super classes, then looks
+// for a default method in the super interfaces. It returns the class
+// declaring the method
+func (jvm *Jvm) findMethod(class *JavaClass, name, methodDescriptor string) (*JavaClass, *MethodInfo) {
+	for c := class; c != nil; c = jvm.Classes[c.SuperName()] {
+		for _, m := range c.Methods {
+			if m.Name == name && m.Descriptor == methodDescriptor {
+				return c, m
+			}
+		}
+	}
+	for c := class; c != nil; c = jvm.Classes[c.SuperName()] {
+		for _, index := range c.Interfaces {
+			superInterface, ok := jvm.Classes[GetClassName(c.ConstantPool, index)]
+			if !ok {
+				continue
+			}
+			if owner, m := jvm.findMethod(superInterface, name, methodDescriptor); m != nil && AccessFlag(m.AccessFlags)&AccAbstract == 0 {
+				return owner, m
+			}
+		}
+	}
+	return nil, nil
+}
+
+// classInitState is how far the initialization of a class went
+type classInitState int
+
+const (
+	classInitializing classInitState = iota
+	classInitialized
+	// Its static initializer threw, the class cannot be used
+	classErroneous
+)
+
+// classInit is the initialization state of a class and the thread running
+// its static initializer
+type classInit struct {
+	state  classInitState
+	thread *Thread
+}
+
+// isInitialized tells whether the static initializer of class ran
+func (jvm *Jvm) isInitialized(class *JavaClass) bool {
+	init := jvm.initialized[class]
+	return init != nil && init.state == classInitialized
+}
+
+// InitializeClass runs the static initializer of class, and of its super
+// classes, the first time it is used (JVMS §5.5). A thread using the class
+// while another one initializes it waits for it to finish
+func (jvm *Jvm) InitializeClass(class *JavaClass) error {
+	init := jvm.initialized[class]
+	if init != nil && init.state == classInitializing && init.thread != jvm.thread {
+		jvm.park(ThreadRunnable, time.Time{}, false, func() bool { return init.state != classInitializing })
+	}
+	if init != nil {
+		if init.state == classErroneous {
+			return throwable("java/lang/NoClassDefFoundError", "Could not initialize class %s", strings.ReplaceAll(class.Name(), "/", "."))
+		}
+		// Initialized, or being initialized by the running thread
+		return nil
+	}
+	init = &classInit{state: classInitializing, thread: jvm.thread}
+	jvm.initialized[class] = init
+	err := jvm.runClassInitializers(class)
+	init.state, init.thread = classInitialized, nil
+	if err != nil {
+		init.state = classErroneous
+	}
+	jvm.wakeAll()
+	return err
+}
+
+// runClassInitializers initializes the super class of class, then runs
+// the static initializer of class
+func (jvm *Jvm) runClassInitializers(class *JavaClass) error {
+	if super, ok := jvm.Classes[class.SuperName()]; ok && class.AccessFlags&AccInterface == 0 {
+		if err := jvm.InitializeClass(super); err != nil {
+			return err
+		}
+	}
+	for _, m := range class.Methods {
+		if m.Name == "<clinit>" && m.Descriptor == "()V" {
+			if _, err := jvm.Invoke(class, m, nil); err != nil {
+				return jvm.initializerError(err)
+			}
+		}
+	}
+	return nil
+}
+
+// initializerError returns what a failed static initializer throws (JVMS
+// §5.5 step 11). Errors are thrown as they are, the other exceptions become
+// the cause of an ExceptionInInitializerError
+func (jvm *Jvm) initializerError(err error) error {
+	thrown, ok := err.(*JavaThrowable)
+	if !ok {
+		return err
+	}
+	if thrown.Object == nil {
+		if thrown.Object = jvm.throwableObject(thrown.ClassName, thrown.Message); thrown.Object == nil {
+			return err
+		}
+	}
+	if jvm.isSubclass(thrown.Object.Class, "java/lang/Error") {
+		return err
+	}
+	object := jvm.throwableObject("java/lang/ExceptionInInitializerError", "")
+	if object == nil {
+		return err
+	}
+	object.Fields[throwableCause] = referenceValue(thrown.Object)
+	return &JavaThrowable{Object: object, ClassName: "java/lang/ExceptionInInitializerError"}
+}
+
+// InvokeStatic runs the static method className.name
+func (jvm *Jvm) InvokeStatic(className, name, methodDescriptor string, args []StackData) (StackData, error) {
+	class, err := jvm.LoadClass(className)
+	if err != nil {
+		if result, ok, nativeErr := jvm.callNative([]string{className}, name, methodDescriptor, args); ok {
+			return result, nativeErr
+		}
+		return StackData{}, err
+	}
+	owner, method := jvm.findMethod(class, name, methodDescriptor)
+	if method == nil {
+		// A method of the embedded class library, which initializes the
+		// class like the ones with code
+		if err := jvm.InitializeClass(class); err != nil {
+			return StackData{}, err
+		}
+		if result, ok, nativeErr := jvm.callNative([]string{className}, name, methodDescriptor, args); ok {
+			return result, nativeErr
+		}
+		return StackData{}, throwable("java/lang/NoSuchMethodError", "'%s'", ParseDescriptor(methodDescriptor, className+"."+name))
+	}
+	if AccessFlag(method.AccessFlags)&AccStatic == 0 {
+		return StackData{}, &LinkageError{ErrorClass: "java.lang.IncompatibleClassChangeError", Message: fmt.Sprintf("Expected static method '%s'", ParseDescriptor(methodDescriptor, className+"."+name))}
+	}
+	if err := jvm.InitializeClass(owner); err != nil {
+		return StackData{}, err
+	}
+	return jvm.Invoke(owner, method, args)
+}
+
+// InvokeSpecial runs an instance method without dynamic dispatch, used for
+// constructors, private methods and super calls
+func (jvm *Jvm) InvokeSpecial(className, name, methodDescriptor string, args []StackData) (StackData, error) {
+	if args[0].IsNull() {
+		return StackData{}, throwable("java/lang/NullPointerException", "Cannot invoke \"%s.%s()\" because value is null", strings.ReplaceAll(className, "/", "."), name)
+	}
+	class, err := jvm.LoadClass(className)
+	if err != nil {
+		if result, ok, nativeErr := jvm.callNative([]string{className}, name, methodDescriptor, args); ok {
+			return result, nativeErr
+		}
+		return StackData{}, err
+	}
+	owner, method := jvm.findMethod(class, name, methodDescriptor)
+	if method == nil {
+		// Inherited from a class of the class library
+		if result, ok, nativeErr := jvm.callNative(append(jvm.classChain(className), "java/lang/Object"), name, methodDescriptor, args); ok {
+			return result, nativeErr
+		}
+		return StackData{}, throwable("java/lang/NoSuchMethodError", "'%s'", ParseDescriptor(methodDescriptor, className+"."+name))
+	}
+	return jvm.Invoke(owner, method, args)
+}
+
+// InvokeVirtual runs an instance method selected by the class of the
+// receiver, args[0]
+func (jvm *Jvm) InvokeVirtual(className, name, methodDescriptor string, args []StackData) (StackData, error) {
+	receiver := args[0]
+	if receiver.IsNull() {
+		return StackData{}, throwable("java/lang/NullPointerException", "Cannot invoke \"%s.%s()\" because value is null", strings.ReplaceAll(className, "/", "."), name)
+	}
+	class := jvm.Classes[jvm.referenceClassName(receiver)]
+	if _, ok := receiver.Data.(*Array); ok {
+		class = jvm.Classes["java/lang/Object"]
+	}
+	// The vm's own types, like strings, run the code of their class when
+	// the class library is loaded
+	if class != nil {
+		if owner, method := jvm.findMethod(class, name, methodDescriptor); method != nil {
+			return jvm.Invoke(owner, method, args)
+		}
+	}
+	// Implemented by a class of the class library the receiver extends
+	classNames := append(jvm.classChain(jvm.referenceClassName(receiver)), className, "java/lang/Object")
+	if result, ok, err := jvm.callNative(classNames, name, methodDescriptor, args); ok {
+		return result, err
+	}
+	return StackData{}, throwable("java/lang/AbstractMethodError", "Receiver class %s does not define or inherit an implementation of the resolved method '%s'",
+		strings.ReplaceAll(jvm.referenceClassName(receiver), "/", "."), ParseDescriptor(methodDescriptor, name))
+}
+
+// formatFloat formats a float or double the way Double.toString and
+// Float.toString do: plainly from 10^-3 up to 10^7 and in computerized
+// scientific notation outside, both from the shortest digits
+func formatFloat(v float64, bitSize int) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	case v == 0 && math.Signbit(v):
+		return "-0.0"
+	case v == 0:
+		return "0.0"
+	}
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	if v >= 1e-3 && v < 1e7 {
+		s := strconv.FormatFloat(v, 'f', -1, bitSize)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return sign + s
+	}
+	d := shortestDigits(v, bitSize)
+	fraction := d.digits[1:]
+	if fraction == "" {
+		fraction = "0"
+	}
+	return sign + d.digits[:1] + "." + fraction + "E" + strconv.Itoa(d.exponent)
+}
+
+// javaString converts a value of type t to a string the way string
+// concatenation and print do
+func (jvm *Jvm) javaString(value StackData, t descriptor.Type) (string, error) {
+	switch t {
+	case descriptor.Boolean:
+		return strconv.FormatBool(value.Int() != 0), nil
+	case descriptor.Char:
+		// From the UTF-16 char, a lone surrogate is no rune
+		return newStringFromChars([]uint16{uint16(value.Int())}).String(), nil
+	case descriptor.Byte, descriptor.Short, descriptor.Int:
+		return strconv.Itoa(int(value.Int())), nil
+	case descriptor.Long:
+		return strconv.FormatInt(value.Long(), 10), nil
+	case descriptor.Float:
+		return formatFloat(float64(value.Float()), 32), nil
+	case descriptor.Double:
+		return formatFloat(value.Double(), 64), nil
+	}
+
+	switch reference := value.Data.(type) {
+	case nil:
+		return "null", nil
+	case *String:
+		return reference.String(), nil
+	case *Array:
+		if reference.Descriptor == "[C" && t.Descriptor() == "[C" {
+			s, err := jvm.toJavaString(value, t)
+			if err != nil {
+				return "", err
+			}
+			return s.String(), nil
+		}
+	}
+	result, err := jvm.InvokeVirtual("java/lang/Object", "toString", "()Ljava/lang/String;", []StackData{value})
+	if err != nil {
+		return "", err
+	}
+	if result.IsNull() {
+		return "null", nil
+	}
+	return result.Data.(*String).String(), nil
+}
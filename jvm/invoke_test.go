@@ -0,0 +1,163 @@
+package jvm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInitializeClassErroneous(t *testing.T) {
+	jvm, err := NewJvm(buildProgram(t, func(p programBuilder) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// static { int x = 1 / 0; }
+	boom := newClassBuilder("Boom", "java/lang/Object", AccSuper)
+	clinit := boom.addMethod(AccStatic, "<clinit>", "()V")
+	clinit.maxStack = 2
+	clinit.op(OpIconst1)
+	clinit.op(OpIconst0)
+	clinit.op(OpIdiv)
+	clinit.op(OpPop)
+	clinit.op(OpReturn)
+	class, err := boom.Define(jvm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"java.lang.ExceptionInInitializerError",
+		"java.lang.NoClassDefFoundError: Could not initialize class Boom",
+		"java.lang.NoClassDefFoundError: Could not initialize class Boom",
+	}
+	var first error
+	for i, want := range want {
+		err := jvm.InitializeClass(class)
+		if err == nil {
+			t.Fatalf("use %d initialized the class, want %s", i+1, want)
+		}
+		if err.Error() != want {
+			t.Errorf("use %d: got %s, want %s", i+1, err, want)
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	if jvm.isInitialized(class) {
+		t.Error("erroneous class is initialized")
+	}
+	cause := first.(*JavaThrowable).Object.Fields[throwableCause]
+	if cause.IsNull() {
+		t.Fatal("ExceptionInInitializerError has no cause")
+	}
+	if s, _ := jvm.throwableString(cause); s != "java.lang.ArithmeticException: / by zero" {
+		t.Errorf("cause = %s, want java.lang.ArithmeticException: / by zero", s)
+	}
+}
+
+func TestInitializeClassThrowingError(t *testing.T) {
+	jvm, err := NewJvm(buildProgram(t, func(p programBuilder) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// static { throw new AssertionError(); }
+	failing := newClassBuilder("Failing", "java/lang/Object", AccSuper)
+	clinit := failing.addMethod(AccStatic, "<clinit>", "()V")
+	clinit.maxStack = 2
+	clinit.op(OpNew, failing.class("java/lang/AssertionError"))
+	clinit.op(OpDup)
+	clinit.op(OpInvokespecial, failing.methodRef("java/lang/AssertionError", "<init>", "()V", false))
+	clinit.op(OpAthrow)
+	class, err := failing.Define(jvm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors are not wrapped in an ExceptionInInitializerError
+	if err := jvm.InitializeClass(class); err == nil || err.Error() != "java.lang.AssertionError" {
+		t.Errorf("got %v, want java.lang.AssertionError", err)
+	}
+}
+
+func TestInitializeClassFromTwoThreads(t *testing.T) {
+	// static int value; static { Thread.sleep(100); value = 42; }
+	slow := newClassBuilder("Slow", "java/lang/Object", AccSuper)
+	slow.addField(AccStatic, "value", "I")
+	clinit := slow.addMethod(AccStatic, "<clinit>", "()V")
+	clinit.maxStack = 2
+	clinit.op(OpBipush, int8(100))
+	clinit.op(OpI2l)
+	clinit.op(OpInvokestatic, slow.methodRef("java/lang/Thread", "sleep", "(J)V", false))
+	clinit.op(OpBipush, int8(42))
+	clinit.op(OpPutstatic, slow.fieldRef("Slow", "value", "I"))
+	clinit.op(OpReturn)
+
+	// A Runnable printing Slow.value
+	reader := newClassBuilder("Reader", "java/lang/Object", AccSuper)
+	reader.interfaces = []string{"java/lang/Runnable"}
+	init := reader.addMethod(AccPublic, "<init>", "()V")
+	init.maxStack, init.maxLocals = 1, 1
+	init.op(OpAload0)
+	init.op(OpInvokespecial, reader.methodRef("java/lang/Object", "<init>", "()V", false))
+	init.op(OpReturn)
+	run := reader.addMethod(AccPublic, "run", "()V")
+	run.maxStack, run.maxLocals = 2, 1
+	run.op(OpGetstatic, reader.fieldRef("java/lang/System", "out", "Ljava/io/PrintStream;"))
+	run.op(OpGetstatic, reader.fieldRef("Slow", "value", "I"))
+	run.op(OpInvokevirtual, reader.methodRef("java/io/PrintStream", "println", "(I)V", false))
+	run.op(OpReturn)
+
+	// The main thread starts initializing Slow, the other thread uses it
+	// while the main thread sleeps in its static initializer
+	path := buildProgram(t, func(p programBuilder) {
+		p.op(OpNew, p.class.class("java/lang/Thread"))
+		p.op(OpDup)
+		p.newObject("Reader")
+		p.op(OpInvokespecial, p.class.methodRef("java/lang/Thread", "<init>", "(Ljava/lang/Runnable;)V", false))
+		p.invoke(false, "java/lang/Thread", "start", "()V")
+		p.println("(I)V", func() {
+			p.op(OpGetstatic, p.class.fieldRef("Slow", "value", "I"))
+		})
+	}, slow, reader)
+	stdout, stderr := runProgram(t, path)
+	if want := "Running main function code\n42\n42\n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+	if stderr != "" {
+		t.Errorf("stderr = %q", stderr)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		v       float64
+		bitSize int
+		want    string
+	}{
+		{1e7, 64, "1.0E7"},
+		{9999999, 64, "9999999.0"},
+		{1e-3, 64, "0.001"},
+		{1e-4, 64, "1.0E-4"},
+		{100, 64, "100.0"},
+		{-1.5, 64, "-1.5"},
+		{1.0 / 3, 64, "0.3333333333333333"},
+		{0.1, 64, "0.1"},
+		{float64(float32(0.1)), 32, "0.1"},
+		{float64(float32(1e10)), 32, "1.0E10"},
+		{1.23456789e-5, 64, "1.23456789E-5"},
+		{math.MaxFloat64, 64, "1.7976931348623157E308"},
+		{math.MaxFloat32, 32, "3.4028235E38"},
+		// Subnormals
+		{math.SmallestNonzeroFloat64, 64, "4.9E-324"},
+		{math.SmallestNonzeroFloat32, 32, "1.4E-45"},
+		{math.NaN(), 64, "NaN"},
+		{math.Inf(1), 32, "Infinity"},
+		{math.Inf(-1), 64, "-Infinity"},
+		{0, 64, "0.0"},
+		{math.Copysign(0, -1), 64, "-0.0"},
+	}
+	for _, test := range tests {
+		if got := formatFloat(test.v, test.bitSize); got != test.want {
+			t.Errorf("formatFloat(%g, %d) = %s, want %s", test.v, test.bitSize, got, test.want)
+		}
+	}
+}
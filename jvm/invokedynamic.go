@@ -0,0 +1,230 @@
+package jvm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// MethodHandleRef is a resolved ConstantMethodHandle
+type MethodHandleRef struct {
+	Kind       ReferenceKind
+	Class      string
+	Name       string
+	Descriptor string
+}
+
+func (h MethodHandleRef) String() string {
+	return fmt.Sprintf("%s %s.%s:%s", h.Kind, h.Class, h.Name, h.Descriptor)
+}
+
+// MethodTypeRef is the descriptor of a resolved ConstantMethodType
+type MethodTypeRef string
+
+// ClassRef is the internal name of a resolved ConstantClass
+type ClassRef string
+
+// GetMethodHandle resolves a ConstantMethodHandle index
+func GetMethodHandle(constantPool []*ConstantInfo, index uint16) (MethodHandleRef, bool) {
+	if index == 0 || int(index) > len(constantPool) || constantPool[index-1] == nil {
+		return MethodHandleRef{}, false
+	}
+	handle, ok := constantPool[index-1].Data.(ConstantMethodHandle)
+	if !ok {
+		return MethodHandleRef{}, false
+	}
+	ref := MethodHandleRef{Kind: ReferenceKind(handle.ReferenceKind)}
+	ref.Class, ref.Name, ref.Descriptor = GetMemberRef(constantPool, handle.ReferenceIndex)
+	return ref, true
+}
+
+// CallSite is an invokedynamic instruction linked to its target
+type CallSite struct {
+	Bootstrap  MethodHandleRef
+	Name       string
+	Descriptor string
+	Target     func(args []StackData) (StackData, error)
+	// Error of a failed link, thrown again by every later execution of
+	// the instruction
+	LinkError error
+}
+
+type callSiteKey struct {
+	class *JavaClass
+	pc    int
+	// Methods of the same class have separate code
+	method *MethodInfo
+}
+
+func bootstrapMethodError(format string, a ...interface{}) error {
+	return &LinkageError{ErrorClass: "java.lang.BootstrapMethodError", Message: fmt.Sprintf(format, a...)}
+}
+
+// bootstrapArguments resolves the static arguments of a bootstrap method
+// into strings, numbers, ClassRef, MethodTypeRef and MethodHandleRef values
+func bootstrapArguments(class *JavaClass, bootstrapMethod BootstrapMethod) ([]interface{}, error) {
+	args := make([]interface{}, len(bootstrapMethod.BootstrapArguments))
+	for i, index := range bootstrapMethod.BootstrapArguments {
+		constant := class.ConstantPool[index-1]
+		switch constant.Tag {
+		case ConstantStringTag:
+			args[i] = GetUtf8(class.ConstantPool, constant.Data.(ConstantString).StringIndex)
+		case ConstantIntegerTag, ConstantFloatTag, ConstantLongTag, ConstantDoubleTag:
+			args[i] = constant.Data
+		case ConstantClassTag:
+			args[i] = ClassRef(GetClassName(class.ConstantPool, index))
+		case ConstantMethodTypeTag:
+			args[i] = MethodTypeRef(GetUtf8(class.ConstantPool, constant.Data.(ConstantMethodType).DescriptorIndex))
+		case ConstantMethodHandleTag:
+			args[i], _ = GetMethodHandle(class.ConstantPool, index)
+		default:
+			return nil, bootstrapMethodError("unsupported bootstrap argument %s", constant.Tag)
+		}
+	}
+	return args, nil
+}
+
+// linkCallSite runs the bootstrap method of the invokedynamic instruction at
+// frame.Pc. The common bootstrap methods of the class library have fast
+// paths which don't need java.lang.invoke
+func (jvm *Jvm) linkCallSite(frame *Frame) (*CallSite, error) {
+	dynamic := frame.Class.ConstantPool[frame.u2(frame.Pc+1)-1].Data.(ConstantInvokeDynamic)
+	bootstrapMethods := frame.Class.BootstrapMethods()
+	if int(dynamic.BootstrapMethodAttrIndex) >= len(bootstrapMethods) {
+		return nil, bootstrapMethodError("bootstrap method %d not found in %s", dynamic.BootstrapMethodAttrIndex, frame.Class.Name())
+	}
+	bootstrapMethod := bootstrapMethods[dynamic.BootstrapMethodAttrIndex]
+	bootstrap, ok := GetMethodHandle(frame.Class.ConstantPool, bootstrapMethod.BootstrapMethodRef)
+	if !ok {
+		return nil, bootstrapMethodError("invalid bootstrap method handle #%d", bootstrapMethod.BootstrapMethodRef)
+	}
+	staticArgs, err := bootstrapArguments(frame.Class, bootstrapMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	callSite := &CallSite{Bootstrap: bootstrap}
+	callSite.Name, callSite.Descriptor = GetNameAndType(frame.Class.ConstantPool, dynamic.NameAndTypeIndex)
+	methodType, err := descriptor.ParseMethod(callSite.Descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	switch bootstrap.Class + "." + bootstrap.Name {
+	case "java/lang/invoke/StringConcatFactory.makeConcatWithConstants":
+		recipe, ok := staticArgs[0].(string)
+		if !ok {
+			return nil, bootstrapMethodError("makeConcatWithConstants expects a recipe string")
+		}
+		callSite.Target, err = jvm.stringConcat(methodType, recipe, staticArgs[1:])
+	case "java/lang/invoke/StringConcatFactory.makeConcat":
+		callSite.Target, err = jvm.stringConcat(methodType, strings.Repeat("\u0001", len(methodType.Params)), nil)
+	case "java/lang/invoke/LambdaMetafactory.metafactory", "java/lang/invoke/LambdaMetafactory.altMetafactory":
+		callSite.Target, err = jvm.lambdaFactory(frame.Class, callSite.Name, methodType, staticArgs, bootstrap.Name == "altMetafactory")
+	default:
+		return nil, bootstrapMethodError("unsupported bootstrap method %s", bootstrap)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return callSite, nil
+}
+
+// invokeDynamic runs the invokedynamic instruction at frame.Pc, linking it
+// the first time. A call site which failed to link throws the same error
+// again, JVMS §6.5
+func (jvm *Jvm) invokeDynamic(frame *Frame) error {
+	key := callSiteKey{class: frame.Class, method: frame.Method, pc: frame.Pc}
+	callSite, ok := jvm.CallSites[key]
+	if !ok {
+		var err error
+		if callSite, err = jvm.linkCallSite(frame); err != nil {
+			// Kept as a throwable so that the same instance is thrown
+			// each time
+			if thrown, ok := catchable(err); ok {
+				err = thrown
+			}
+			callSite = &CallSite{LinkError: err}
+		}
+		jvm.CallSites[key] = callSite
+	}
+	if callSite.LinkError != nil {
+		return callSite.LinkError
+	}
+
+	methodType, err := descriptor.ParseMethod(callSite.Descriptor)
+	if err != nil {
+		return err
+	}
+	result, err := callSite.Target(frame.popN(len(methodType.Params)))
+	if err != nil {
+		return err
+	}
+	if methodType.Return != descriptor.Void {
+		frame.push(result)
+	}
+	return nil
+}
+
+// stringConcat links a StringConcatFactory call site. In the recipe \1
+// stands for the next argument and \2 for the next constant
+func (jvm *Jvm) stringConcat(methodType *descriptor.MethodType, recipe string, constants []interface{}) (func([]StackData) (StackData, error), error) {
+	argCount := strings.Count(recipe, "\u0001")
+	if argCount != len(methodType.Params) {
+		return nil, bootstrapMethodError("mismatched number of concat arguments: recipe wants %d, but signature provides %d", argCount, len(methodType.Params))
+	}
+	if strings.Count(recipe, "\u0002") > len(constants) {
+		return nil, bootstrapMethodError("mismatched number of concat constants")
+	}
+
+	return func(args []StackData) (StackData, error) {
+		var chars []uint16
+		arg, constant := 0, 0
+		for _, c := range decodeModifiedUTF8(recipe) {
+			switch c {
+			case '\u0001':
+				s, err := jvm.toJavaString(args[arg], methodType.Params[arg])
+				if err != nil {
+					return StackData{}, err
+				}
+				chars = append(chars, s.Chars()...)
+				arg++
+			case '\u0002':
+				chars = append(chars, decodeModifiedUTF8(fmt.Sprint(constants[constant]))...)
+				constant++
+			default:
+				chars = append(chars, c)
+			}
+		}
+		return referenceValue(newStringFromChars(chars)), nil
+	}, nil
+}
+
+// InvokeMethodHandle runs the member a method handle refers to
+func (jvm *Jvm) InvokeMethodHandle(handle MethodHandleRef, args []StackData) (StackData, error) {
+	switch handle.Kind {
+	case RefInvokeStatic:
+		return jvm.InvokeStatic(handle.Class, handle.Name, handle.Descriptor, args)
+	case RefInvokeVirtual, RefInvokeInterface:
+		return jvm.InvokeVirtual(handle.Class, handle.Name, handle.Descriptor, args)
+	case RefInvokeSpecial:
+		return jvm.InvokeSpecial(handle.Class, handle.Name, handle.Descriptor, args)
+	case RefNewInvokeSpecial:
+		class, err := jvm.LoadClass(handle.Class)
+		if err != nil {
+			return StackData{}, err
+		}
+		if err := jvm.InitializeClass(class); err != nil {
+			return StackData{}, err
+		}
+		object := referenceValue(jvm.NewObject(class))
+		if _, err := jvm.InvokeSpecial(handle.Class, handle.Name, handle.Descriptor, append([]StackData{object}, args...)); err != nil {
+			return StackData{}, err
+		}
+		return object, nil
+	case RefGetField, RefGetStatic, RefPutField, RefPutStatic:
+		return jvm.accessField(handle, args)
+	}
+	return StackData{}, fmt.Errorf("method handles of kind %s are not supported", handle.Kind)
+}
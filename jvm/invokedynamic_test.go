@@ -0,0 +1,44 @@
+package jvm
+
+import "testing"
+
+func TestInvokeDynamicLinkFailure(t *testing.T) {
+	jvm, err := NewJvm(buildProgram(t, func(p programBuilder) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// static void link() { invokedynamic run()V } bootstrapped by a method
+	// the vm can't link
+	dynamic := newClassBuilder("Dynamic", "java/lang/Object", AccSuper)
+	bootstrap := dynamic.constant(ConstantMethodHandleTag, "bootstrap", uint8(RefInvokeStatic),
+		dynamic.methodRef("Dynamic", "bootstrap", "()Ljava/lang/invoke/CallSite;", false))
+	callSite := dynamic.constant(ConstantInvokeDynamicTag, "run", uint16(0), dynamic.nameAndType("run", "()V"))
+	link := dynamic.addMethod(AccStatic, "link", "()V")
+	link.op(OpInvokedynamic, callSite, uint16(0))
+	link.op(OpReturn)
+	class, err := dynamic.Define(jvm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	class.Attributes = append(class.Attributes, &AttributeInfo{
+		AttributeType: BootstrapMethodsAttr,
+		Data:          BootstrapMethodsAttribute{{BootstrapMethodRef: bootstrap}},
+	})
+
+	want := "java.lang.BootstrapMethodError: unsupported bootstrap method REF_invokeStatic Dynamic.bootstrap:()Ljava/lang/invoke/CallSite;"
+	var first error
+	for i := range 2 {
+		_, err := jvm.InvokeStatic("Dynamic", "link", "()V", nil)
+		if err == nil {
+			t.Fatalf("call %d linked the call site", i+1)
+		}
+		if err.Error() != want {
+			t.Errorf("call %d: got %s, want %s", i+1, err, want)
+		}
+		if first == nil {
+			first = err
+		} else if err != first {
+			t.Error("the second call threw another error")
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package jvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The jimage file, lib/modules in a JDK, holds the classes and resources of
+// every module of the run-time image. It starts with an index:
+//
+//	header     magic, version, flags, resource count, table length,
+//	           locations size and strings size, all u4
+//	redirect   s4[table length], perfect hash of the resource names
+//	offsets    u4[table length], location of each resource
+//	locations  attribute streams describing the resources
+//	strings    NUL terminated modified UTF-8 strings
+//
+// followed by the content of the resources. Numbers are in the byte order
+// of the platform that created the image, told by the magic.
+
+const (
+	jimageMagic          = 0xCAFEDADA
+	jimageMajorVersion   = 1
+	jimageHeaderSize     = 7 * 4
+	jimageHashMultiplier = 0x01000193
+)
+
+// Kinds of the attributes of a location
+const (
+	jimageAttributeEnd = iota
+	jimageAttributeModule
+	jimageAttributeParent
+	jimageAttributeBase
+	jimageAttributeExtension
+	jimageAttributeOffset
+	jimageAttributeCompressed
+	jimageAttributeUncompressed
+	jimageAttributeCount
+)
+
+// JImage is an opened jimage file
+type JImage struct {
+	Path string
+	// The whole file, jimages are read once at startup
+	data      []byte
+	order     binary.ByteOrder
+	redirect  []int32
+	offsets   []uint32
+	locations []byte
+	strings   []byte
+	indexSize uint32
+	// Module of each package, filled on demand from the /packages
+	// directory of the image
+	packageModules map[string]string
+}
+
+// OpenJImage reads the jimage file at path
+func OpenJImage(path string) (*JImage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < jimageHeaderSize {
+		return nil, fmt.Errorf("%s: truncated jimage header", path)
+	}
+	image := &JImage{Path: path, data: data, packageModules: map[string]string{}}
+	switch {
+	case binary.LittleEndian.Uint32(data) == jimageMagic:
+		image.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(data) == jimageMagic:
+		image.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%s: not a jimage file", path)
+	}
+	header := make([]uint32, 7)
+	for i := range header {
+		header[i] = image.order.Uint32(data[4*i:])
+	}
+	if major := header[1] >> 16; major != jimageMajorVersion {
+		return nil, fmt.Errorf("%s: unsupported jimage version %d.%d", path, major, header[1]&0xFFFF)
+	}
+	tableLength, locationsSize, stringsSize := header[4], header[5], header[6]
+	image.indexSize = jimageHeaderSize + 8*tableLength + locationsSize + stringsSize
+	if uint64(image.indexSize) > uint64(len(data)) {
+		return nil, fmt.Errorf("%s: truncated jimage index", path)
+	}
+	offset := uint32(jimageHeaderSize)
+	image.redirect = make([]int32, tableLength)
+	for i := range image.redirect {
+		image.redirect[i] = int32(image.order.Uint32(data[offset:]))
+		offset += 4
+	}
+	image.offsets = make([]uint32, tableLength)
+	for i := range image.offsets {
+		image.offsets[i] = image.order.Uint32(data[offset:])
+		offset += 4
+	}
+	image.locations = data[offset : offset+locationsSize]
+	image.strings = data[offset+locationsSize : offset+locationsSize+stringsSize]
+	return image, nil
+}
+
+// jimageHash is the FNV-1a style hash the image writer uses for its perfect
+// hash table, seed is the default multiplier or a redirect value
+func jimageHash(name string, seed int32) int32 {
+	h := seed
+	for i := 0; i < len(name); i++ {
+		h = (h * jimageHashMultiplier) ^ int32(name[i])
+	}
+	return h & 0x7FFFFFFF
+}
+
+// string returns the NUL terminated string at offset of the strings table
+func (image *JImage) string(offset uint64) string {
+	if offset >= uint64(len(image.strings)) {
+		return ""
+	}
+	s := image.strings[offset:]
+	if end := bytes.IndexByte(s, 0); end >= 0 {
+		s = s[:end]
+	}
+	return string(s)
+}
+
+// location decodes the attribute stream at offset of the locations table.
+// Each attribute is a byte holding the kind in its high 5 bits and the
+// length minus one in the low 3, followed by a big endian value
+func (image *JImage) location(offset uint32) [jimageAttributeCount]uint64 {
+	var attributes [jimageAttributeCount]uint64
+	stream := image.locations
+	for i := int(offset); i < len(stream); {
+		kind, length := int(stream[i]>>3), int(stream[i]&7)+1
+		if kind == jimageAttributeEnd || kind >= jimageAttributeCount || i+1+length > len(stream) {
+			break
+		}
+		var value uint64
+		for _, b := range stream[i+1 : i+1+length] {
+			value = value<<8 | uint64(b)
+		}
+		attributes[kind] = value
+		i += 1 + length
+	}
+	return attributes
+}
+
+// locationName rebuilds the full name of a location, like
+// /java.base/java/lang/Object.class
+func (image *JImage) locationName(attributes [jimageAttributeCount]uint64) string {
+	var name strings.Builder
+	if module := image.string(attributes[jimageAttributeModule]); module != "" {
+		name.WriteString("/" + module + "/")
+	}
+	if parent := image.string(attributes[jimageAttributeParent]); parent != "" {
+		name.WriteString(parent + "/")
+	}
+	name.WriteString(image.string(attributes[jimageAttributeBase]))
+	if extension := image.string(attributes[jimageAttributeExtension]); extension != "" {
+		name.WriteString("." + extension)
+	}
+	return name.String()
+}
+
+// Resource returns the content of the resource with the given full name,
+// ok is false if the image has none
+func (image *JImage) Resource(name string) (content []byte, ok bool, err error) {
+	length := int32(len(image.redirect))
+	if length == 0 {
+		return nil, false, nil
+	}
+	index := jimageHash(name, jimageHashMultiplier) % length
+	switch value := image.redirect[index]; {
+	case value < 0:
+		index = -1 - value
+	case value > 0:
+		index = jimageHash(name, value) % length
+	default:
+		return nil, false, nil
+	}
+	if index < 0 || index >= length {
+		return nil, false, nil
+	}
+	// The hash is perfect for the names in the image only, other names land
+	// on some resource
+	attributes := image.location(image.offsets[index])
+	if image.locationName(attributes) != name {
+		return nil, false, nil
+	}
+	if attributes[jimageAttributeCompressed] != 0 {
+		return nil, false, fmt.Errorf("%s: %s is compressed, images made with jlink --compress are not supported", image.Path, name)
+	}
+	start := uint64(image.indexSize) + attributes[jimageAttributeOffset]
+	end := start + attributes[jimageAttributeUncompressed]
+	if end > uint64(len(image.data)) {
+		return nil, false, fmt.Errorf("%s: %s is out of the file", image.Path, name)
+	}
+	return image.data[start:end], true, nil
+}
+
+// packageModule returns the module holding the package with the given
+// dotted name. The image records it in /packages/<package>, an array of u4
+// pairs: whether the module has no class of the package, and the offset of
+// the module name
+func (image *JImage) packageModule(pkg string) (string, error) {
+	if module, ok := image.packageModules[pkg]; ok {
+		return module, nil
+	}
+	content, ok, err := image.Resource("/packages/" + pkg)
+	if err != nil || !ok {
+		return "", err
+	}
+	module := ""
+	for i := 0; i+8 <= len(content); i += 8 {
+		isEmpty, nameOffset := image.order.Uint32(content[i:]), image.order.Uint32(content[i+4:])
+		if isEmpty == 0 || module == "" {
+			module = image.string(uint64(nameOffset))
+		}
+		if isEmpty == 0 {
+			break
+		}
+	}
+	image.packageModules[pkg] = module
+	return module, nil
+}
+
+// ReadClass returns the class file of the class with the given internal
+// name, looked up in the module of its package
+func (image *JImage) ReadClass(name string) ([]byte, error) {
+	pkg := strings.ReplaceAll(packageName(name), "/", ".")
+	module, err := image.packageModule(pkg)
+	if err != nil {
+		return nil, err
+	}
+	if module == "" {
+		return nil, os.ErrNotExist
+	}
+	content, ok, err := image.Resource("/" + module + "/" + name + ".class")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return content, nil
+}
+
+func (image *JImage) String() string {
+	return image.Path
+}
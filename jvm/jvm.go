@@ -3,15 +3,26 @@ package jvm
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type StackType int
 
 const (
 	StackTypeInt = StackType(iota)
-	StackTypeConstant
-	StackTypeStaticClass
+	StackTypeLong
+	StackTypeFloat
+	StackTypeDouble
+	// Data is nil for null, a *String, *Object, *Array, *ClassMirror,
+	// *MethodType, *MethodHandle or *Lookup
+	StackTypeReference
+	// Offset pushed by jsr
+	StackTypeReturnAddress
 )
 
 type StackData struct {
@@ -20,7 +31,85 @@ type StackData struct {
 }
 
 type Jvm struct {
+	// The main class
 	Class *JavaClass
+	// Sources of the class library, searched before the class path. The
+	// embedded library by default
+	BootClassPath []ClassSource
+	// Directories searched for class files
+	ClassPath []string
+	// Loaded classes keyed by internal name
+	Classes map[string]*JavaClass
+	// Static fields of the loaded classes, keyed by class and field name
+	StaticFields map[string]StackData
+	// Linked invokedynamic instructions
+	CallSites map[callSiteKey]*CallSite
+	// Standard streams of the program. System.out and System.err buffer
+	// what they write to Stdout and Stderr, see Flush
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Highest value Integer.valueOf shares a box for, the lowest is -128.
+	// Raised to 127 when lower, and lowered to Integer.MAX_VALUE - 129 when
+	// higher
+	AutoBoxCacheMax int32
+
+	// Initialization state of the classes whose initialization started
+	initialized map[*JavaClass]*classInit
+	// Class instances keyed by field descriptor
+	mirrors map[string]*ClassMirror
+	// MethodType instances keyed by method descriptor, equal types are the
+	// same object
+	methodTypes map[string]*MethodType
+	// Number of classes synthesized for lambdas, used to name them
+	lambdaCount int
+	// Interned strings keyed by coder and value
+	strings map[string]*String
+	// Methods implemented in Go, keyed by class, name and descriptor, and
+	// the keys of the ones added to this Jvm only
+	natives   map[string]Native
+	overrides map[string]bool
+	// Offsets Unsafe gives to fields, keyed by class and field name, and the
+	// fields in offset order
+	fieldOffsets map[string]int64
+	offsetFields []string
+	// Held by the running thread, see Thread. The goroutine creating the
+	// Jvm runs the main thread
+	lock sync.Mutex
+	// Threads waiting for the lock, and instructions run since the running
+	// thread last let them run
+	contenders atomic.Int32
+	ticks      int
+	thread     *Thread
+	// Threads which have started and not ended, the main thread first
+	threads []*Thread
+	// Last identifier given to a java.lang.Thread and number of the next
+	// thread named after it
+	threadIDs    int64
+	threadNumber int
+	// Running threads which are not daemons, the vm exits once they end
+	nonDaemons sync.WaitGroup
+	// Monitors of the objects threads contend for or wait on
+	monitors map[headed]*Monitor
+	// Memory of the objects, see Heap
+	Heap Heap
+	// Handles of Go code
+	globalHandles map[*Handle]bool
+	// Strength of the references classes create and whether their
+	// instances need finalizing
+	referenceKinds map[*JavaClass]referenceKind
+	finalizers     map[*JavaClass]bool
+	// Objects to finalize once unreachable and the unreachable ones to
+	// finalize
+	finalizable, finalizeQueue []*Object
+	// References cleared by collections which the reference handler has
+	// yet to enqueue, and the cleaners whose queues it processes
+	pendingReferences, cleaners []*Object
+	handlingReferences          bool
+	// State of the generator of identity hash codes
+	hashState [4]uint32
+	// Buffers of the standard output streams keyed by file descriptor
+	outputs map[int32]*bufio.Writer
 }
 
 func NewJvm(filename string) (*Jvm, error) {
@@ -35,224 +124,137 @@ func NewJvm(filename string) (*Jvm, error) {
 		return nil, err
 	}
 
-	return &Jvm{
-		Class: class,
-	}, nil
-}
-
-func RunJvm(jvm *Jvm) {
-	// fmt.Println(jvm.Class)
-	var mainMethod *MethodInfo
-
-	for _, m := range jvm.Class.Methods {
-		if m.Name == "main" {
-			mainMethod = m
-		}
+	// The class path is the directory holding the package of the main class
+	classPath := filepath.Dir(filename)
+	if pkg := packageName(class.Name()); pkg != "" {
+		classPath = strings.TrimSuffix(filepath.ToSlash(classPath), "/"+pkg)
 	}
 
-	mainCodeAttr := mainMethod.Attributes[0].Data.(CodeAttribute)
+	jvm := &Jvm{
+		Class:         class,
+		BootClassPath: []ClassSource{EmbeddedLibrary{}},
+		ClassPath:     []string{classPath},
+		Classes:       map[string]*JavaClass{},
+		StaticFields:  map[string]StackData{},
+		CallSites:     map[callSiteKey]*CallSite{},
+		Stdin:         os.Stdin,
+		Stdout:        os.Stdout,
+		Stderr:        os.Stderr,
+		initialized:   map[*JavaClass]*classInit{},
+		mirrors:       map[string]*ClassMirror{},
+		methodTypes:   map[string]*MethodType{},
+		strings:       map[string]*String{},
+		natives:       map[string]Native{},
+		overrides:     map[string]bool{},
+		fieldOffsets:  map[string]int64{},
+		Heap:          Heap{MaxSize: DefaultMaxHeapSize, InitialSize: DefaultInitialHeapSize},
+		globalHandles: map[*Handle]bool{},
+		monitors:      map[headed]*Monitor{},
 
-	fmt.Println("Running", mainMethod.Name, "function code")
-	RunCodeAttr(jvm, &mainCodeAttr)
-}
-
-func RunCodeAttr(jvm *Jvm, codeAttr *CodeAttribute) {
-	pc := 0
-	code := codeAttr.Code
+		referenceKinds: map[*JavaClass]referenceKind{},
+		finalizers:     map[*JavaClass]bool{},
 
-	// fmt.Printf("%X\n", code)
-	locals := make([]StackData, codeAttr.MaxLocals)
-	stack := make([]StackData, 0, codeAttr.MaxStack)
-	for pc < len(code) {
-		switch code[pc] {
-		case 0x10: // Push byte
-			pc += 1
-			stack = append(stack, StackData{
-				Type: StackTypeInt,
-				Data: int32(code[pc]),
-			})
-		case 0x3C: // istore_1 Store int into local variable
-			v := stack[len(stack)-1]
-			if v.Type != StackTypeInt {
-				fmt.Fprintf(os.Stderr, "At instruction 0x%X expected stack value of type int\n", code[pc])
-				break
-			}
-			locals[1] = v
-			stack = stack[:len(stack)-1]
-		case 0x3D: // istore_2 Store int into local variable
-			v := stack[len(stack)-1]
-			if v.Type != StackTypeInt {
-				fmt.Fprintf(os.Stderr, "At instruction 0x%X expected stack value of type int\n", code[pc])
-				break
-			}
-			locals[2] = v
-			stack = stack[:len(stack)-1]
-		case 0x03: // iconst_0
-			stack = append(stack, StackData{
-				Type: StackTypeInt,
-				Data: int32(0),
-			})
-		case 0x04: // iconst_1
-			stack = append(stack, StackData{
-				Type: StackTypeInt,
-				Data: int32(1),
-			})
-		case 0x05: // iconst_2
-			stack = append(stack, StackData{
-				Type: StackTypeInt,
-				Data: int32(2),
-			})
-		case 0x06: // iconst_3
-			stack = append(stack, StackData{
-				Type: StackTypeInt,
-				Data: int32(3),
-			})
-		case 0x60: // iadd
-			v1 := stack[len(stack)-1]
-			v2 := stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-
-			if v1.Type != StackTypeInt && v2.Type != StackTypeInt {
-				fmt.Fprintf(os.Stderr, "At instruction 0x%X expected stack value of type int\n", code[pc])
-			}
-
-			stack = append(stack, StackData{
-				Type: StackTypeInt,
-				Data: int32(v1.Data.(int32) + v2.Data.(int32)),
-			})
-		case 0x68: // imul
-			v1 := stack[len(stack)-1]
-			v2 := stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-
-			if v1.Type != StackTypeInt && v2.Type != StackTypeInt {
-				fmt.Fprintf(os.Stderr, "At instruction 0x%X expected stack value of type int\n", code[pc])
-			}
+		AutoBoxCacheMax: 127,
+	}
+	main := newThread(nil, "main", false)
+	main.id = 1
+	jvm.threads = []*Thread{main}
+	jvm.threadIDs = 1
+	jvm.acquire(main)
+	for key, native := range natives {
+		jvm.natives[key] = native
+	}
+	// The main class is linked by RunJvm, once UseJDK and PatchModule
+	// settled the boot class path its super types load from
+	return jvm, nil
+}
 
-			stack = append(stack, StackData{
-				Type: StackTypeInt,
-				Data: int32(v1.Data.(int32) * v2.Data.(int32)),
-			})
-		case 0xB2: // Get static field from class
-			pc += 1
-			indexByte1 := uint16(code[pc])
-			pc += 1
-			indexByte2 := uint16(code[pc])
-			index := (indexByte1 << 8) | indexByte2
-			fieldRef := jvm.Class.ConstantPool[index-1].Data.(ConstantFieldRef)
-			class := jvm.Class.ConstantPool[fieldRef.ClassIndex-1].Data.(ConstantClass)
-			className := jvm.Class.ConstantPool[class.NameIndex-1].Data.(ConstantUtf8)
-			method := jvm.Class.ConstantPool[fieldRef.NameAndTypeIndex-1].Data.(ConstantNameAndType)
-			methodName := jvm.Class.ConstantPool[method.NameIndex-1].Data.(ConstantUtf8)
-			if className == "java/lang/System" && methodName == "out" {
-				stack = append(stack, StackData{
-					Type: StackTypeStaticClass,
-					Data: "JavaPrintStream",
-				})
-			} else {
-				fmt.Fprintf(os.Stderr, "Unsupported static class %s method %s\n", className, methodName)
-				break
-			}
-		case 0x12: // Push item from run-time constant pool
-			pc += 1
-			index := uint16(code[pc])
-			stack = append(stack, StackData{
-				Type: StackTypeConstant,
-				Data: index,
-			})
-		case 0x1B: // iload_1 load an int value from local variable 1
-			int := locals[1]
-			if int.Type != StackTypeInt {
-				fmt.Fprintf(os.Stderr, "Expected value type int\n")
-				break
-			}
-			stack = append(stack, StackData{
-				Type: StackTypeInt,
-				Data: int.Data,
-			})
-		case 0x1c: // iload_2 load an int value from local variable 2
-			int := locals[2]
-			if int.Type != StackTypeInt {
-				fmt.Fprintf(os.Stderr, "Expected value type int\n")
-				break
-			}
-			stack = append(stack, StackData{
-				Type: StackTypeInt,
-				Data: int.Data,
-			})
-		case 0x1d: // iload_3 load an int value from local variable 2
-			int := locals[3]
-			if int.Type != StackTypeInt {
-				fmt.Fprintf(os.Stderr, "Expected value type int\n")
-				break
+// initStaticFields gives the static fields their default value, or the one
+// of their ConstantValue attribute
+func (jvm *Jvm) initStaticFields(class *JavaClass) {
+	for _, f := range class.Fields {
+		if f.AccessFlags&AccStatic == 0 {
+			continue
+		}
+		value := zeroValue(f.Descriptor)
+		if attr := FindAttribute(f.Attributes, ConstantValueAttr); attr != nil {
+			constantValue := attr.Data.(ConstantValueAttribute)
+			switch v := constantValue.Value.(type) {
+			case ConstantInteger:
+				value = StackData{Type: StackTypeInt, Data: v}
+			case ConstantLong:
+				value = StackData{Type: StackTypeLong, Data: v}
+			case ConstantFloat:
+				value = StackData{Type: StackTypeFloat, Data: v}
+			case ConstantDouble:
+				value = StackData{Type: StackTypeDouble, Data: v}
+			case ConstantUtf8:
+				value = referenceValue(jvm.internString(v))
 			}
-			stack = append(stack, StackData{
-				Type: StackTypeInt,
-				Data: int.Data,
-			})
-		case 0x84: //iinc  	increment local variable #index by signed byte const
-			pc += 1
-			index := int(code[pc])
-			pc += 1
-			v := int32(code[pc])
+		}
+		jvm.StaticFields[class.Name()+"."+f.Name] = value
+	}
+}
 
-			if locals[index].Type != StackTypeInt {
-				fmt.Fprintf(os.Stderr, "Expected value type int\n")
-				break
+// resolveField looks for a field in class and its super classes, returning
+// the class declaring it
+func (jvm *Jvm) resolveField(class *JavaClass, name, fieldDescriptor string) (*JavaClass, *FieldInfo) {
+	for ; class != nil; class = jvm.Classes[class.SuperName()] {
+		for _, f := range class.Fields {
+			if f.Name == name && f.Descriptor == fieldDescriptor {
+				return class, f
 			}
-			locals[index].Data = locals[index].Data.(int32) + v
-		case 0xB6: // Invoke instance method; dispatch based on class
-			pc += 1
-			indexByte1 := uint16(code[pc])
-			pc += 1
-			indexByte2 := uint16(code[pc])
-			index := (indexByte1 << 8) | indexByte2
-
-			methodRef := jvm.Class.ConstantPool[index-1].Data.(*ConstantMethodRef)
+		}
+	}
+	return nil, nil
+}
 
-			class := jvm.Class.ConstantPool[methodRef.ClassIndex-1].Data.(ConstantClass)
-			className := jvm.Class.ConstantPool[class.NameIndex-1].Data.(ConstantUtf8)
-			method := jvm.Class.ConstantPool[methodRef.NameAndTypeIndex-1].Data.(ConstantNameAndType)
-			methodName := jvm.Class.ConstantPool[method.NameIndex-1].Data.(ConstantUtf8)
+func (jvm *Jvm) LookupClass(name string) (string, bool, bool) {
+	class, err := jvm.LoadClass(name)
+	if err != nil {
+		return "", false, false
+	}
+	return class.SuperName(), class.AccessFlags&AccInterface != 0, true
+}
 
-			if className == "java/io/PrintStream" && methodName == "println" {
-				if len(stack) < 2 {
-					fmt.Fprintf(os.Stderr, "expected two arguments in class %s on method %s, found %d\n", className, methodName, len(stack))
-					break
-				}
-				value := stack[len(stack)-1]
-				class := stack[len(stack)-2]
-				stack = stack[:len(stack)-2]
+func RunJvm(jvm *Jvm) {
+	// fmt.Println(jvm.Class)
+	if _, ok := jvm.Classes[jvm.Class.Name()]; !ok {
+		if err := jvm.DefineClass(jvm.Class); err != nil {
+			fmt.Fprintln(jvm.Stderr, err)
+			return
+		}
+	}
+	var mainMethod *MethodInfo
 
-				if class.Type == StackTypeStaticClass {
-					if class.Data.(string) != "JavaPrintStream" {
-						fmt.Fprintf(os.Stderr, "expected %s class, found %s\n", "JavaPrintStream", class.Data.(string))
-						break
-					}
-				}
-				switch value.Type {
-				case StackTypeConstant:
-					constant := jvm.Class.ConstantPool[value.Data.(uint16)-1]
-					switch constant.Tag {
-					case ConstantStringTag:
-						str := jvm.Class.ConstantPool[constant.Data.(ConstantString).StringIndex-1].Data.(ConstantUtf8)
-						fmt.Println(str)
-					}
-				default:
-				case StackTypeInt:
-					fmt.Println(value.Data.(int32))
-				}
-			} else {
-				fmt.Fprintf(os.Stderr, "Unsupported class %s method %s\n", className, methodName)
-				break
-			}
+	for _, m := range jvm.Class.Methods {
+		if m.Name == "main" && m.Descriptor == "([Ljava/lang/String;)V" && AccessFlag(m.AccessFlags)&AccStatic != 0 {
+			mainMethod = m
+		}
+	}
+	if mainMethod == nil {
+		fmt.Fprintf(jvm.Stderr, "Main method not found in class %s\n", jvm.Class.Name())
+		return
+	}
 
-		case 0xB1:
-			break
-		default:
-			fmt.Fprintf(os.Stderr, "opcode 0x%02X not supported\n", code[pc])
+	fmt.Fprintln(jvm.Stdout, "Running", mainMethod.Name, "function code")
+	jvm.startHeap()
+	if jvm.hasJDK() {
+		if err := jvm.BootSystem(); err != nil {
+			fmt.Fprintf(jvm.Stderr, "Error occurred during initialization of VM\n%s\n", err)
+			return
 		}
-		pc += 1
-		// fmt.Println(stack)
 	}
+	err := jvm.InitializeClass(jvm.Class)
+	if err == nil {
+		args := referenceValue(NewArray("[Ljava/lang/String;", 0))
+		_, err = jvm.Invoke(jvm.Class, mainMethod, []StackData{args})
+	}
+	if err != nil {
+		jvm.uncaughtException(jvm.thread, err)
+	}
+	// What the threads print comes before the exit
+	jvm.Flush()
+	jvm.awaitThreads()
+	jvm.Flush()
 }
@@ -0,0 +1,325 @@
+package jvm
+
+import (
+	"fmt"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// Flags of LambdaMetafactory.altMetafactory
+const (
+	lambdaFlagSerializable = 1 << iota
+	lambdaFlagMarkers
+	lambdaFlagBridges
+)
+
+// lambdaProxy describes the class synthesized for a LambdaMetafactory call
+// site, implementing the functional interface by forwarding to the
+// implementation method
+type lambdaProxy struct {
+	caller *JavaClass
+	// Name of the interface method
+	name string
+	// Captured arguments to the interface returned
+	factoryType *descriptor.MethodType
+	// Erased type of the interface method, and the one it is called with
+	samType          *descriptor.MethodType
+	instantiatedType *descriptor.MethodType
+	impl             MethodHandleRef
+	markers          []string
+	// Other types of the interface method, implemented by bridge methods
+	bridges      []*descriptor.MethodType
+	serializable bool
+}
+
+// newLambdaProxy decodes the static arguments of metafactory, or the longer
+// ones of altMetafactory
+func newLambdaProxy(caller *JavaClass, name string, factoryType *descriptor.MethodType, staticArgs []interface{}, alt bool) (*lambdaProxy, error) {
+	if len(staticArgs) < 3 {
+		return nil, bootstrapMethodError("LambdaMetafactory expects 3 static arguments, got %d", len(staticArgs))
+	}
+	samType, ok1 := staticArgs[0].(MethodTypeRef)
+	impl, ok2 := staticArgs[1].(MethodHandleRef)
+	instantiatedType, ok3 := staticArgs[2].(MethodTypeRef)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, bootstrapMethodError("invalid LambdaMetafactory arguments")
+	}
+	if _, ok := factoryType.Return.(*descriptor.ObjectType); !ok {
+		return nil, bootstrapMethodError("LambdaMetafactory call site must return an interface")
+	}
+	proxy := &lambdaProxy{caller: caller, name: name, factoryType: factoryType, impl: impl}
+	var err error
+	if proxy.samType, err = descriptor.ParseMethod(string(samType)); err != nil {
+		return nil, bootstrapMethodError("%s", err)
+	}
+	if proxy.instantiatedType, err = descriptor.ParseMethod(string(instantiatedType)); err != nil {
+		return nil, bootstrapMethodError("%s", err)
+	}
+	if !alt {
+		return proxy, nil
+	}
+
+	// flags, [marker count, markers...], [bridge count, bridges...]
+	rest := staticArgs[3:]
+	next := func() (interface{}, bool) {
+		if len(rest) == 0 {
+			return nil, false
+		}
+		arg := rest[0]
+		rest = rest[1:]
+		return arg, true
+	}
+	count := func() (int, error) {
+		arg, _ := next()
+		n, ok := arg.(ConstantInteger)
+		if !ok || int(n) > len(rest) {
+			return 0, bootstrapMethodError("invalid altMetafactory arguments")
+		}
+		return int(n), nil
+	}
+	arg, _ := next()
+	flags, ok := arg.(ConstantInteger)
+	if !ok {
+		return nil, bootstrapMethodError("altMetafactory expects flags")
+	}
+	proxy.serializable = flags&lambdaFlagSerializable != 0
+	if flags&lambdaFlagMarkers != 0 {
+		n, err := count()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			marker, _ := next()
+			class, ok := marker.(ClassRef)
+			if !ok {
+				return nil, bootstrapMethodError("marker interface must be a class")
+			}
+			proxy.markers = append(proxy.markers, string(class))
+		}
+	}
+	if flags&lambdaFlagBridges != 0 {
+		n, err := count()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			bridge, _ := next()
+			bridgeType, ok := bridge.(MethodTypeRef)
+			if !ok {
+				return nil, bootstrapMethodError("bridge must be a method type")
+			}
+			parsed, err := descriptor.ParseMethod(string(bridgeType))
+			if err != nil {
+				return nil, bootstrapMethodError("%s", err)
+			}
+			if parsed.Descriptor() != proxy.samType.Descriptor() {
+				proxy.bridges = append(proxy.bridges, parsed)
+			}
+		}
+	}
+	return proxy, nil
+}
+
+// implSignature returns the parameters of the implementation method,
+// including the receiver, and its result
+func (p *lambdaProxy) implSignature() ([]descriptor.Type, descriptor.Type, error) {
+	implType, err := handleType(p.impl)
+	if err != nil {
+		return nil, nil, bootstrapMethodError("%s", err)
+	}
+	return implType.Params, implType.Return, nil
+}
+
+func (jvm *Jvm) isInterface(className string) bool {
+	class, err := jvm.LoadClass(className)
+	return err == nil && class.AccessFlags&AccInterface != 0
+}
+
+// spinClass generates and defines the class of the lambda. Like the classes
+// of the JDK, it stores the captured arguments in fields arg$1, arg$2...
+func (jvm *Jvm) spinClass(p *lambdaProxy) (*JavaClass, error) {
+	jvm.lambdaCount++
+	className := fmt.Sprintf("%s$$Lambda$%d", p.caller.Name(), jvm.lambdaCount)
+	functionalInterface := p.factoryType.Return.(*descriptor.ObjectType).ClassName
+	b := newClassBuilder(className, "java/lang/Object", AccFinal|AccSuper|AccSynthetic)
+	b.interfaces = append([]string{functionalInterface}, p.markers...)
+	if p.serializable && !jvm.implementsInterface(b.interfaces, "java/io/Serializable") {
+		b.interfaces = append(b.interfaces, "java/io/Serializable")
+	}
+
+	captured := p.factoryType.Params
+	for i, t := range captured {
+		b.addField(AccPrivate|AccFinal, fmt.Sprintf("arg$%d", i+1), t.Descriptor())
+	}
+	constructor := b.addMethod(AccPrivate, "<init>", (&descriptor.MethodType{Params: captured, Return: descriptor.Void}).Descriptor())
+	constructor.op(OpAload0)
+	constructor.op(OpInvokespecial, b.methodRef("java/lang/Object", "<init>", "()V", false))
+	slot := 1
+	for i, t := range captured {
+		constructor.op(OpAload0)
+		constructor.load(t, slot)
+		constructor.op(OpPutfield, b.fieldRef(className, fmt.Sprintf("arg$%d", i+1), t.Descriptor()))
+		slot += t.Slots()
+	}
+	constructor.op(OpReturn)
+	constructor.maxStack, constructor.maxLocals = 3, uint16(slot)
+
+	for _, methodType := range append([]*descriptor.MethodType{p.samType}, p.bridges...) {
+		if err := jvm.forward(p, b, methodType); err != nil {
+			return nil, err
+		}
+	}
+	if p.serializable {
+		p.writeReplace(b, functionalInterface)
+	}
+	return b.Define(jvm)
+}
+
+// implementsInterface reports whether one of the interfaces is or extends
+// name
+func (jvm *Jvm) implementsInterface(interfaces []string, name string) bool {
+	for _, i := range interfaces {
+		if i == name {
+			return true
+		}
+		if class, err := jvm.LoadClass(i); err == nil && jvm.isSubclass(class, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// forward adds the interface method with the given type, loading the
+// captured arguments and its own ones converted to the types of the
+// implementation method, then converting back its result
+func (jvm *Jvm) forward(p *lambdaProxy, b *classBuilder, methodType *descriptor.MethodType) error {
+	implParams, implReturn, err := p.implSignature()
+	if err != nil {
+		return err
+	}
+	captured := p.factoryType.Params
+	if len(captured)+len(methodType.Params) != len(implParams) {
+		return bootstrapMethodError("Incorrect number of parameters for %s method %s; %d captured parameters, %d functional interface method parameters, %d implementation parameters",
+			p.impl.Kind, p.impl, len(captured), len(methodType.Params), len(implParams))
+	}
+	if methodType.Return != descriptor.Void && implReturn == descriptor.Void {
+		return bootstrapMethodError("Type mismatch for lambda return: void is not convertible to %s", methodType.Return)
+	}
+
+	code := b.addMethod(AccPublic, p.name, methodType.Descriptor())
+	argSlots := 0
+	for _, t := range implParams {
+		argSlots += t.Slots()
+	}
+	code.maxStack = uint16(2 + argSlots + 2)
+
+	if p.impl.Kind == RefNewInvokeSpecial {
+		code.op(OpNew, b.class(p.impl.Class))
+		code.op(OpDup)
+	}
+	for i, t := range captured {
+		code.op(OpAload0)
+		code.op(OpGetfield, b.fieldRef(b.name, fmt.Sprintf("arg$%d", i+1), t.Descriptor()))
+		code.convert(t, implParams[i])
+	}
+	slot := 1
+	for i, t := range methodType.Params {
+		code.load(t, slot)
+		code.convert(t, implParams[len(captured)+i])
+		slot += t.Slots()
+	}
+	code.maxLocals = uint16(slot)
+
+	isInterface := p.impl.Kind == RefInvokeInterface || jvm.isInterface(p.impl.Class)
+	ref := b.methodRef(p.impl.Class, p.impl.Name, p.impl.Descriptor, isInterface)
+	switch p.impl.Kind {
+	case RefInvokeStatic:
+		code.op(OpInvokestatic, ref)
+	case RefNewInvokeSpecial:
+		code.op(OpInvokespecial, ref)
+	case RefInvokeVirtual, RefInvokeSpecial, RefInvokeInterface:
+		// Private methods of the caller are invoked virtually, the proxy
+		// can't name them with invokespecial
+		if isInterface {
+			code.op(OpInvokeinterface, ref, uint8(argSlots), uint8(0))
+		} else {
+			code.op(OpInvokevirtual, ref)
+		}
+	default:
+		return bootstrapMethodError("Unsupported MethodHandle kind: %s", p.impl)
+	}
+
+	switch {
+	case methodType.Return != descriptor.Void:
+		code.convert(implReturn, methodType.Return)
+	case implReturn.Slots() == 2:
+		code.op(OpPop2)
+	case implReturn.Slots() == 1:
+		code.op(OpPop)
+	}
+	code.ret(methodType.Return)
+	return nil
+}
+
+// writeReplace adds the method serialization calls to replace a
+// serializable lambda by its SerializedLambda
+func (p *lambdaProxy) writeReplace(b *classBuilder, functionalInterface string) {
+	code := b.addMethod(AccPrivate|AccFinal, "writeReplace", "()Ljava/lang/Object;")
+	code.maxStack, code.maxLocals = 20, 1
+	serializedLambda := "java/lang/invoke/SerializedLambda"
+	code.op(OpNew, b.class(serializedLambda))
+	code.op(OpDup)
+	code.op(OpLdcW, b.class(p.caller.Name()))
+	for _, s := range []string{functionalInterface, p.name, p.samType.Descriptor()} {
+		code.op(OpLdcW, b.string(s))
+	}
+	code.op(OpLdcW, b.integer(int32(p.impl.Kind)))
+	for _, s := range []string{p.impl.Class, p.impl.Name, p.impl.Descriptor, p.instantiatedType.Descriptor()} {
+		code.op(OpLdcW, b.string(s))
+	}
+
+	object := &descriptor.ObjectType{ClassName: "java/lang/Object"}
+	code.op(OpLdcW, b.integer(int32(len(p.factoryType.Params))))
+	code.op(OpAnewarray, b.class(object.ClassName))
+	for i, t := range p.factoryType.Params {
+		code.op(OpDup)
+		code.op(OpLdcW, b.integer(int32(i)))
+		code.op(OpAload0)
+		code.op(OpGetfield, b.fieldRef(b.name, fmt.Sprintf("arg$%d", i+1), t.Descriptor()))
+		code.convert(t, object)
+		code.op(OpAastore)
+	}
+	code.op(OpInvokespecial, b.methodRef(serializedLambda, "<init>",
+		"(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/String;Ljava/lang/String;ILjava/lang/String;Ljava/lang/String;Ljava/lang/String;Ljava/lang/String;[Ljava/lang/Object;)V", false))
+	code.op(OpAreturn)
+}
+
+// lambdaFactory links a LambdaMetafactory call site. Every evaluation
+// creates an instance of the synthesized class, except for lambdas which
+// capture nothing and share a single instance
+func (jvm *Jvm) lambdaFactory(caller *JavaClass, name string, methodType *descriptor.MethodType, staticArgs []interface{}, alt bool) (func([]StackData) (StackData, error), error) {
+	proxy, err := newLambdaProxy(caller, name, methodType, staticArgs, alt)
+	if err != nil {
+		return nil, err
+	}
+	class, err := jvm.spinClass(proxy)
+	if err != nil {
+		return nil, err
+	}
+	constructor := (&descriptor.MethodType{Params: methodType.Params, Return: descriptor.Void}).Descriptor()
+
+	var shared *Object
+	return func(args []StackData) (StackData, error) {
+		if shared != nil {
+			return referenceValue(shared), nil
+		}
+		object := jvm.NewObject(class)
+		if _, err := jvm.InvokeSpecial(class.Name(), "<init>", constructor, append([]StackData{referenceValue(object)}, args...)); err != nil {
+			return StackData{}, err
+		}
+		if len(args) == 0 {
+			shared = object
+		}
+		return referenceValue(object), nil
+	}, nil
+}
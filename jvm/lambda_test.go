@@ -0,0 +1,272 @@
+package jvm
+
+import (
+	"testing"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// defineLambdaCaller defines Op, a functional interface with a default
+// method, and Lambdas, the class whose methods the lambdas implement
+func defineLambdaCaller(t *testing.T) (*Jvm, *JavaClass) {
+	t.Helper()
+	jvm, err := NewJvm(buildProgram(t, func(p programBuilder) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// interface Op { int apply(int x); default int twice(int x) { return apply(apply(x)); } }
+	op := newClassBuilder("Op", "java/lang/Object", AccPublic|AccInterface|AccAbstract)
+	op.methods = append(op.methods, builderMember{flags: AccPublic | AccAbstract, name: "apply", descriptor: "(I)I"})
+	twice := op.addMethod(AccPublic, "twice", "(I)I")
+	twice.maxStack, twice.maxLocals = 3, 2
+	twice.op(OpAload0)
+	twice.op(OpAload0)
+	twice.op(OpIload1)
+	twice.op(OpInvokeinterface, op.methodRef("Op", "apply", "(I)I", true), uint8(2), uint8(0))
+	twice.op(OpInvokeinterface, op.methodRef("Op", "apply", "(I)I", true), uint8(2), uint8(0))
+	twice.op(OpIreturn)
+	if _, err := op.Define(jvm); err != nil {
+		t.Fatal(err)
+	}
+
+	lambdas := newClassBuilder("Lambdas", "java/lang/Object", AccPublic|AccSuper)
+	init := lambdas.addMethod(AccPublic, "<init>", "()V")
+	init.maxStack, init.maxLocals = 1, 1
+	init.op(OpAload0)
+	init.op(OpInvokespecial, lambdas.methodRef("java/lang/Object", "<init>", "()V", false))
+	init.op(OpReturn)
+	// static int plus(int a, int b) { return a + b; }
+	plus := lambdas.addMethod(AccPrivate|AccStatic|AccSynthetic, "plus", "(II)I")
+	plus.maxStack, plus.maxLocals = 2, 2
+	plus.op(OpIload0)
+	plus.op(OpIload1)
+	plus.op(OpIadd)
+	plus.op(OpIreturn)
+	// static String hello() { return "hello"; }
+	hello := lambdas.addMethod(AccPrivate|AccStatic|AccSynthetic, "hello", "()Ljava/lang/String;")
+	hello.maxStack = 1
+	hello.op(OpLdcW, lambdas.string("hello"))
+	hello.op(OpAreturn)
+	// private String secret() { return "secret"; }
+	secret := lambdas.addMethod(AccPrivate, "secret", "()Ljava/lang/String;")
+	secret.maxStack, secret.maxLocals = 1, 1
+	secret.op(OpLdcW, lambdas.string("secret"))
+	secret.op(OpAreturn)
+	caller, err := lambdas.Define(jvm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jvm, caller
+}
+
+// newLambda evaluates a LambdaMetafactory call site of caller
+func newLambda(t *testing.T, jvm *Jvm, caller *JavaClass, name, factoryDescriptor string, staticArgs []interface{}, alt bool, args ...StackData) StackData {
+	t.Helper()
+	factoryType, err := descriptor.ParseMethod(factoryDescriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory, err := jvm.lambdaFactory(caller, name, factoryType, staticArgs, alt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lambda, err := factory(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lambda
+}
+
+func TestLambdaProxies(t *testing.T) {
+	jvm, caller := defineLambdaCaller(t)
+	const (
+		function     = "java/util/function/Function"
+		supplier     = "java/util/function/Supplier"
+		objectMethod = "(Ljava/lang/Object;)Ljava/lang/Object;"
+	)
+	plus := MethodHandleRef{RefInvokeStatic, "Lambdas", "plus", "(II)I"}
+	// x -> 40 + x, capturing 40
+	adder := newLambda(t, jvm, caller, "apply", "(I)LOp;", []interface{}{MethodTypeRef("(I)I"), plus, MethodTypeRef("(I)I")}, false, intValue(40))
+	box := func(i int32) StackData {
+		boxed, err := jvm.box(intValue(i), descriptor.Int)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return boxed
+	}
+	lambdas := referenceValue(jvm.NewObject(caller))
+
+	tests := []struct {
+		name string
+		// call runs the lambda
+		call func() (StackData, error)
+		want interface{}
+	}{
+		{
+			name: "capturing lambda",
+			call: func() (StackData, error) {
+				return jvm.InvokeVirtual("Op", "apply", "(I)I", []StackData{adder, intValue(2)})
+			},
+			want: int32(42),
+		},
+		{
+			name: "default method of the interface",
+			call: func() (StackData, error) {
+				return jvm.InvokeVirtual("Op", "twice", "(I)I", []StackData{adder, intValue(1)})
+			},
+			want: int32(81),
+		},
+		{
+			name: "unbound virtual method reference",
+			call: func() (StackData, error) {
+				// String::length as Function<String, Integer>
+				length := newLambda(t, jvm, caller, "apply", "()L"+function+";", []interface{}{
+					MethodTypeRef(objectMethod),
+					MethodHandleRef{RefInvokeVirtual, "java/lang/String", "length", "()I"},
+					MethodTypeRef("(Ljava/lang/String;)Ljava/lang/Integer;"),
+				}, false)
+				result, err := jvm.InvokeVirtual(function, "apply", objectMethod, []StackData{length, referenceValue(NewString("abcd"))})
+				if err != nil {
+					return StackData{}, err
+				}
+				return jvm.unbox(result, descriptor.Int)
+			},
+			want: int32(4),
+		},
+		{
+			name: "bound virtual method reference",
+			call: func() (StackData, error) {
+				// "abc"::concat as Function<String, String>
+				concat := newLambda(t, jvm, caller, "apply", "(Ljava/lang/String;)L"+function+";", []interface{}{
+					MethodTypeRef(objectMethod),
+					MethodHandleRef{RefInvokeVirtual, "java/lang/String", "concat", "(Ljava/lang/String;)Ljava/lang/String;"},
+					MethodTypeRef("(Ljava/lang/String;)Ljava/lang/String;"),
+				}, false, referenceValue(NewString("abc")))
+				return jvm.InvokeVirtual(function, "apply", objectMethod, []StackData{concat, referenceValue(NewString("def"))})
+			},
+			want: "abcdef",
+		},
+		{
+			name: "interface method reference",
+			call: func() (StackData, error) {
+				// adder::apply as Function<Integer, Integer>
+				apply := newLambda(t, jvm, caller, "apply", "(LOp;)L"+function+";", []interface{}{
+					MethodTypeRef(objectMethod),
+					MethodHandleRef{RefInvokeInterface, "Op", "apply", "(I)I"},
+					MethodTypeRef("(Ljava/lang/Integer;)Ljava/lang/Integer;"),
+				}, false, adder)
+				result, err := jvm.InvokeVirtual(function, "apply", objectMethod, []StackData{apply, box(2)})
+				if err != nil {
+					return StackData{}, err
+				}
+				return jvm.unbox(result, descriptor.Int)
+			},
+			want: int32(42),
+		},
+		{
+			name: "private method reference",
+			call: func() (StackData, error) {
+				// this::secret as Supplier<String>
+				secret := newLambda(t, jvm, caller, "get", "(LLambdas;)L"+supplier+";", []interface{}{
+					MethodTypeRef("()Ljava/lang/Object;"),
+					MethodHandleRef{RefInvokeSpecial, "Lambdas", "secret", "()Ljava/lang/String;"},
+					MethodTypeRef("()Ljava/lang/String;"),
+				}, false, lambdas)
+				return jvm.InvokeVirtual(supplier, "get", "()Ljava/lang/Object;", []StackData{secret})
+			},
+			want: "secret",
+		},
+		{
+			name: "constructor reference",
+			call: func() (StackData, error) {
+				// ArrayList::new as Supplier<ArrayList>
+				newList := newLambda(t, jvm, caller, "get", "()L"+supplier+";", []interface{}{
+					MethodTypeRef("()Ljava/lang/Object;"),
+					MethodHandleRef{RefNewInvokeSpecial, "java/util/ArrayList", "<init>", "()V"},
+					MethodTypeRef("()Ljava/util/ArrayList;"),
+				}, false)
+				list, err := jvm.InvokeVirtual(supplier, "get", "()Ljava/lang/Object;", []StackData{newList})
+				if err != nil {
+					return StackData{}, err
+				}
+				return booleanValue(jvm.isInstance(list, "java/util/ArrayList")), nil
+			},
+			want: int32(1),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := test.call()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkResult(t, result, test.want)
+		})
+	}
+}
+
+func TestLambdaSharedInstance(t *testing.T) {
+	jvm, caller := defineLambdaCaller(t)
+	factoryType, err := descriptor.ParseMethod("()Ljava/util/function/Supplier;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := MethodHandleRef{RefInvokeStatic, "Lambdas", "hello", "()Ljava/lang/String;"}
+	factory, err := jvm.lambdaFactory(caller, "get", factoryType, []interface{}{MethodTypeRef("()Ljava/lang/Object;"), hello, MethodTypeRef("()Ljava/lang/String;")}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := factory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := factory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameReference(first, second) {
+		t.Error("a lambda capturing nothing created two instances")
+	}
+}
+
+func TestLambdaAltMetafactory(t *testing.T) {
+	jvm, caller := defineLambdaCaller(t)
+	hello := MethodHandleRef{RefInvokeStatic, "Lambdas", "hello", "()Ljava/lang/String;"}
+	// A Supplier<String> also implementing Cloneable, with a bridge
+	// returning String
+	lambda := newLambda(t, jvm, caller, "get", "()Ljava/util/function/Supplier;", []interface{}{
+		MethodTypeRef("()Ljava/lang/Object;"), hello, MethodTypeRef("()Ljava/lang/String;"),
+		ConstantInteger(lambdaFlagMarkers | lambdaFlagBridges),
+		ConstantInteger(1), ClassRef("java/lang/Cloneable"),
+		ConstantInteger(1), MethodTypeRef("()Ljava/lang/String;"),
+	}, true)
+	if !jvm.isInstance(lambda, "java/lang/Cloneable") {
+		t.Error("lambda doesn't implement its marker interface")
+	}
+	for _, methodDescriptor := range []string{"()Ljava/lang/Object;", "()Ljava/lang/String;"} {
+		result, err := jvm.InvokeVirtual("java/util/function/Supplier", "get", methodDescriptor, []StackData{lambda})
+		if err != nil {
+			t.Fatalf("get%s: %v", methodDescriptor, err)
+		}
+		checkResult(t, result, "hello")
+	}
+
+	// Bad static arguments are BootstrapMethodErrors
+	factoryType, err := descriptor.ParseMethod("()Ljava/util/function/Supplier;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jvm.lambdaFactory(caller, "get", factoryType, []interface{}{
+		MethodTypeRef("()Ljava/lang/Object;"), hello, MethodTypeRef("()Ljava/lang/String;"),
+		ConstantInteger(lambdaFlagBridges), ConstantInteger(2), MethodTypeRef("()Ljava/lang/String;"),
+	}, true)
+	if want := "java.lang.BootstrapMethodError: invalid altMetafactory arguments"; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %s", err, want)
+	}
+	_, err = jvm.lambdaFactory(caller, "get", factoryType, []interface{}{
+		MethodTypeRef("()Ljava/lang/Object;"), MethodHandleRef{RefInvokeStatic, "Lambdas", "plus", "(II)I"}, MethodTypeRef("()Ljava/lang/Integer;"),
+	}, false)
+	if want := "java.lang.BootstrapMethodError: Incorrect number of parameters for REF_invokeStatic method REF_invokeStatic Lambdas.plus:(II)I; 0 captured parameters, 0 functional interface method parameters, 2 implementation parameters"; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %s", err, want)
+	}
+}
@@ -3,6 +3,8 @@ package jvm
 import (
 	"bufio"
 	"encoding/binary"
+
+	"github.com/Stolkerve/go-jvm/jvm/signature"
 )
 
 type MethodInfo struct {
@@ -10,6 +12,7 @@ type MethodInfo struct {
 	NameIndex       uint16
 	Name            string
 	DescriptorIndex uint16
+	Descriptor      string
 	AttributesCount uint16
 	Attributes      []*AttributeInfo
 }
@@ -25,6 +28,7 @@ func ReadMethod(constantPool []*ConstantInfo, javaClassFile *bufio.Reader, secti
 	method.AttributesCount = binary.BigEndian.Uint16(sectionsReadBuffer[6:])
 
 	method.Name = constantPool[method.NameIndex-1].Data.(ConstantUtf8)
+	method.Descriptor = constantPool[method.DescriptorIndex-1].Data.(ConstantUtf8)
 
 	method.Attributes = make([]*AttributeInfo, method.AttributesCount)
 	for i := range method.AttributesCount {
@@ -37,3 +41,43 @@ func ReadMethod(constantPool []*ConstantInfo, javaClassFile *bufio.Reader, secti
 
 	return &method, nil
 }
+
+// Code returns the Code attribute of the method, nil for abstract and native methods
+func (m *MethodInfo) Code() *CodeAttribute {
+	for _, attr := range m.Attributes {
+		if attr.AttributeType == CodeAttr {
+			code := attr.Data.(CodeAttribute)
+			return &code
+		}
+	}
+	return nil
+}
+
+// Signature returns the generic signature of the method, nil if it has none
+func (m *MethodInfo) Signature() (*signature.MethodSignature, error) {
+	attr := FindAttribute(m.Attributes, SignatureAttr)
+	if attr == nil {
+		return nil, nil
+	}
+	return signature.ParseMethod(attr.Data.(SignatureAttribute).Signature)
+}
+
+// Exceptions returns the internal names of the checked exceptions the method
+// declares in its throws clause
+func (m *MethodInfo) Exceptions() []string {
+	attr := FindAttribute(m.Attributes, ExceptionsAttr)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(ExceptionsAttribute).Exceptions
+}
+
+// Parameters returns the names and flags of the formal parameters, nil if
+// the method was compiled without them
+func (m *MethodInfo) Parameters() MethodParametersAttribute {
+	attr := FindAttribute(m.Attributes, MethodParametersAttr)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(MethodParametersAttribute)
+}
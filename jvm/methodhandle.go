@@ -0,0 +1,698 @@
+package jvm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// MethodType is a java.lang.invoke.MethodType. Instances are unique per
+// descriptor so they can be compared by reference
+type MethodType struct {
+	Header
+	*descriptor.MethodType
+	fieldStore
+}
+
+// String formats the type the way MethodType.toString does, like
+// (String,int)void
+func (t *MethodType) String() string {
+	params := make([]string, len(t.Params))
+	for i, param := range t.Params {
+		params[i] = simpleName(param)
+	}
+	return fmt.Sprintf("(%s)%s", strings.Join(params, ","), simpleName(t.Return))
+}
+
+func simpleName(t descriptor.Type) string {
+	switch t := t.(type) {
+	case *descriptor.ObjectType:
+		return t.ClassName[strings.LastIndexAny(t.ClassName, "/$")+1:]
+	case *descriptor.ArrayType:
+		return simpleName(t.Component) + "[]"
+	}
+	return t.String()
+}
+
+// MethodTypeOf returns the MethodType of a method descriptor
+func (jvm *Jvm) MethodTypeOf(methodDescriptor string) (*MethodType, error) {
+	if methodType, ok := jvm.methodTypes[methodDescriptor]; ok {
+		return methodType, nil
+	}
+	parsed, err := descriptor.ParseMethod(methodDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	methodType := &MethodType{MethodType: parsed}
+	jvm.methodTypes[methodDescriptor] = methodType
+	return methodType, nil
+}
+
+func (jvm *Jvm) newMethodType(params []descriptor.Type, returnType descriptor.Type) *MethodType {
+	methodType, _ := jvm.MethodTypeOf((&descriptor.MethodType{Params: params, Return: returnType}).Descriptor())
+	return methodType
+}
+
+// MethodHandle is a java.lang.invoke.MethodHandle, either a direct handle to
+// a member or one adapted by a combinator
+type MethodHandle struct {
+	Header
+	Type *MethodType
+	// Member of a direct handle, nil for the adapted ones
+	Member *MethodHandleRef
+	target func(args []StackData) (StackData, error)
+	// The handles and values an adapted handle calls target with, which the
+	// garbage collector can't find in the closure
+	retained []StackData
+	fieldStore
+}
+
+func (h *MethodHandle) String() string {
+	return "MethodHandle" + h.Type.String()
+}
+
+// Lookup is a java.lang.invoke.MethodHandles.Lookup, the members its lookup
+// class can access are the ones it finds
+type Lookup struct {
+	Header
+	Class *JavaClass
+	fieldStore
+}
+
+func (l *Lookup) String() string {
+	return strings.ReplaceAll(l.Class.Name(), "/", ".")
+}
+
+// handleType returns the type of the direct method handle of a member, the
+// receiver of instance members is the first parameter
+func handleType(ref MethodHandleRef) (*descriptor.MethodType, error) {
+	owner := &descriptor.ObjectType{ClassName: ref.Class}
+	switch ref.Kind {
+	case RefGetField, RefGetStatic, RefPutField, RefPutStatic:
+		fieldType, err := descriptor.ParseField(ref.Descriptor)
+		if err != nil {
+			return nil, err
+		}
+		switch ref.Kind {
+		case RefGetField:
+			return &descriptor.MethodType{Params: []descriptor.Type{owner}, Return: fieldType}, nil
+		case RefGetStatic:
+			return &descriptor.MethodType{Return: fieldType}, nil
+		case RefPutField:
+			return &descriptor.MethodType{Params: []descriptor.Type{owner, fieldType}, Return: descriptor.Void}, nil
+		}
+		return &descriptor.MethodType{Params: []descriptor.Type{fieldType}, Return: descriptor.Void}, nil
+	}
+
+	methodType, err := descriptor.ParseMethod(ref.Descriptor)
+	if err != nil {
+		return nil, err
+	}
+	switch ref.Kind {
+	case RefInvokeStatic:
+		return methodType, nil
+	case RefNewInvokeSpecial:
+		return &descriptor.MethodType{Params: methodType.Params, Return: owner}, nil
+	}
+	return &descriptor.MethodType{Params: append([]descriptor.Type{owner}, methodType.Params...), Return: methodType.Return}, nil
+}
+
+// NewMethodHandle resolves the member of a direct method handle, checking
+// that caller can access it. Members of classes that can't be loaded are
+// assumed to be provided by the class library
+func (jvm *Jvm) NewMethodHandle(caller *JavaClass, ref MethodHandleRef) (*MethodHandle, error) {
+	parsedType, err := handleType(ref)
+	if err != nil {
+		return nil, err
+	}
+	class, err := jvm.LoadClass(ref.Class)
+	switch {
+	case err == nil:
+		if err := jvm.checkHandleMember(caller, class, ref); err != nil {
+			return nil, err
+		}
+	case !isNoClassDefFound(err):
+		return nil, err
+	}
+	methodType, err := jvm.MethodTypeOf(parsedType.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	return &MethodHandle{
+		Type:   methodType,
+		Member: &ref,
+		target: func(args []StackData) (StackData, error) {
+			return jvm.InvokeMethodHandle(ref, args)
+		},
+	}, nil
+}
+
+// checkHandleMember checks that the member of a method handle exists, has
+// the kind the handle expects and is accessible from caller
+func (jvm *Jvm) checkHandleMember(caller, class *JavaClass, ref MethodHandleRef) error {
+	var owner *JavaClass
+	var flags AccessFlag
+	wantStatic := ref.Kind == RefGetStatic || ref.Kind == RefPutStatic || ref.Kind == RefInvokeStatic
+
+	switch ref.Kind {
+	case RefGetField, RefGetStatic, RefPutField, RefPutStatic:
+		var field *FieldInfo
+		if owner, field = jvm.resolveField(class, ref.Name, ref.Descriptor); field == nil {
+			return throwable("java/lang/NoSuchFieldError", "%s", ref.Name)
+		}
+		flags = field.AccessFlags
+	default:
+		if (ref.Name == "<init>") != (ref.Kind == RefNewInvokeSpecial) {
+			return &LinkageError{ErrorClass: "java.lang.IncompatibleClassChangeError", Message: fmt.Sprintf("%s can't refer to %s.%s", ref.Kind, ref.Class, ref.Name)}
+		}
+		var method *MethodInfo
+		if owner, method = jvm.findMethod(class, ref.Name, ref.Descriptor); method == nil {
+			if (ref.Kind == RefInvokeVirtual || ref.Kind == RefInvokeInterface) && jvm.mayInheritNative(class, ref) {
+				return nil
+			}
+			return throwable("java/lang/NoSuchMethodError", "'%s'", ParseDescriptor(ref.Descriptor, ref.Class+"."+ref.Name))
+		}
+		flags = AccessFlag(method.AccessFlags)
+	}
+
+	if wantStatic != (flags&AccStatic != 0) {
+		return &LinkageError{ErrorClass: "java.lang.IncompatibleClassChangeError", Message: fmt.Sprintf("Expected %s member %s.%s", map[bool]string{true: "static", false: "non-static"}[wantStatic], owner.Name(), ref.Name)}
+	}
+	if caller == nil {
+		return nil
+	}
+	if err := jvm.CheckClassAccess(caller, class); err != nil {
+		return err
+	}
+	return jvm.CheckMemberAccess(caller, owner, ref.Name, flags)
+}
+
+// mayInheritNative tells whether the instances of class may have a virtual
+// method the class file doesn't declare: one of the natives of its super
+// classes, or any method of an interface of the embedded class library,
+// whose interfaces declare no methods
+func (jvm *Jvm) mayInheritNative(class *JavaClass, ref MethodHandleRef) bool {
+	if class.AccessFlags&AccInterface != 0 {
+		return true
+	}
+	for _, className := range jvm.classChain(class.Name()) {
+		if jvm.findNative(className, ref.Name, ref.Descriptor) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// accessField runs a method handle to a field getter or setter
+func (jvm *Jvm) accessField(handle MethodHandleRef, args []StackData) (StackData, error) {
+	class, err := jvm.LoadClass(handle.Class)
+	if err != nil {
+		return StackData{}, err
+	}
+	owner, field := jvm.resolveField(class, handle.Name, handle.Descriptor)
+	if field == nil {
+		return StackData{}, throwable("java/lang/NoSuchFieldError", "%s", handle.Name)
+	}
+	key := owner.Name() + "." + handle.Name
+
+	switch handle.Kind {
+	case RefGetStatic, RefPutStatic:
+		if err := jvm.InitializeClass(owner); err != nil {
+			return StackData{}, err
+		}
+		if handle.Kind == RefGetStatic {
+			return jvm.StaticFields[key], nil
+		}
+		jvm.StaticFields[key] = args[0]
+		return StackData{}, nil
+	}
+	if args[0].IsNull() {
+		return StackData{}, throwable("java/lang/NullPointerException", "Cannot access field \"%s\" because value is null", handle.Name)
+	}
+	get := handle.Kind == RefGetField
+	switch r := args[0].Data.(type) {
+	case *Object:
+		if get {
+			return r.Fields[key], nil
+		}
+		r.Fields[key] = args[1]
+	case *String:
+		if get {
+			return r.field(handle.Name), nil
+		}
+		r.setField(handle.Name, args[1])
+	case fieldHolder:
+		if get {
+			return r.store().field(key, handle.Descriptor), nil
+		}
+		r.store().setField(key, args[1])
+	default:
+		return StackData{}, jvm.fieldReceiverError(args[0], key)
+	}
+	return StackData{}, nil
+}
+
+func wrongMethodType(format string, a ...interface{}) error {
+	return throwable("java/lang/invoke/WrongMethodTypeException", format, a...)
+}
+
+// InvokeHandle runs a method handle called from a site with the given
+// descriptor. invokeExact needs the exact type of the handle, invoke adapts
+// the arguments and result like asType
+func (jvm *Jvm) InvokeHandle(handle *MethodHandle, callDescriptor string, exact bool, args []StackData) (StackData, error) {
+	if callDescriptor != handle.Type.Descriptor() {
+		callType, err := jvm.MethodTypeOf(callDescriptor)
+		if err != nil {
+			return StackData{}, err
+		}
+		if exact {
+			return StackData{}, wrongMethodType("handle's method type %s but found %s", handle.Type, callType)
+		}
+		if handle, err = jvm.asType(handle, callType); err != nil {
+			return StackData{}, err
+		}
+	}
+	return handle.target(args)
+}
+
+// asType adapts handle to newType, converting each argument to the type of
+// the handle and the result back
+func (jvm *Jvm) asType(handle *MethodHandle, newType *MethodType) (*MethodHandle, error) {
+	if newType == handle.Type {
+		return handle, nil
+	}
+	oldType := handle.Type
+	if len(newType.Params) != len(oldType.Params) {
+		return nil, wrongMethodType("cannot convert %s to %s", handle, newType)
+	}
+	for i, param := range newType.Params {
+		if !canConvert(param, oldType.Params[i]) {
+			return nil, wrongMethodType("cannot convert %s to %s", handle, newType)
+		}
+	}
+	if newType.Return != descriptor.Void && oldType.Return != descriptor.Void && !canConvert(oldType.Return, newType.Return) {
+		return nil, wrongMethodType("cannot convert %s to %s", handle, newType)
+	}
+
+	return &MethodHandle{
+		Type:     newType,
+		retained: []StackData{referenceValue(handle)},
+		target: func(args []StackData) (StackData, error) {
+			converted := make([]StackData, len(args))
+			for i, arg := range args {
+				var err error
+				if converted[i], err = jvm.convertValue(arg, newType.Params[i], oldType.Params[i]); err != nil {
+					return StackData{}, err
+				}
+			}
+			result, err := handle.target(converted)
+			switch {
+			case err != nil:
+				return StackData{}, err
+			case newType.Return == descriptor.Void:
+				return StackData{}, nil
+			case oldType.Return == descriptor.Void:
+				return zeroValue(newType.Return.Descriptor()), nil
+			}
+			return jvm.convertValue(result, oldType.Return, newType.Return)
+		},
+	}, nil
+}
+
+// wrapperClasses are the boxes of the primitive types
+var wrapperClasses = map[descriptor.BaseType]string{
+	descriptor.Boolean: "java/lang/Boolean",
+	descriptor.Byte:    "java/lang/Byte",
+	descriptor.Char:    "java/lang/Character",
+	descriptor.Short:   "java/lang/Short",
+	descriptor.Int:     "java/lang/Integer",
+	descriptor.Long:    "java/lang/Long",
+	descriptor.Float:   "java/lang/Float",
+	descriptor.Double:  "java/lang/Double",
+}
+
+// isWidening reports whether from converts to to by a widening primitive
+// conversion (JLS §5.1.2)
+func isWidening(from, to descriptor.BaseType) bool {
+	order := "BSIJFD"
+	switch {
+	case from == to:
+		return true
+	case from == descriptor.Boolean || to == descriptor.Boolean || to == descriptor.Char || to == descriptor.Byte:
+		return false
+	case from == descriptor.Char:
+		return to != descriptor.Short
+	}
+	return strings.IndexByte(order, byte(from)) < strings.IndexByte(order, byte(to))
+}
+
+// canConvert reports whether asType accepts a conversion from one type to
+// another. Conversions involving references may still fail at run time
+func canConvert(from, to descriptor.Type) bool {
+	fromBase, fromPrimitive := from.(descriptor.BaseType)
+	toBase, toPrimitive := to.(descriptor.BaseType)
+	switch {
+	case fromPrimitive && toPrimitive:
+		return isWidening(fromBase, toBase)
+	case fromPrimitive:
+		object, ok := to.(*descriptor.ObjectType)
+		if !ok {
+			return false
+		}
+		switch object.ClassName {
+		case wrapperClasses[fromBase], "java/lang/Object", "java/io/Serializable", "java/lang/Comparable":
+			return true
+		case "java/lang/Number":
+			return fromBase != descriptor.Boolean && fromBase != descriptor.Char
+		}
+		return false
+	}
+	return true
+}
+
+// widen applies a widening primitive conversion to value
+func widen(value StackData, to descriptor.BaseType) StackData {
+	switch to {
+	case descriptor.Long:
+		if value.Type == StackTypeInt {
+			return longValue(int64(value.Int()))
+		}
+	case descriptor.Float:
+		switch value.Type {
+		case StackTypeInt:
+			return floatValue(float32(value.Int()))
+		case StackTypeLong:
+			return floatValue(float32(value.Long()))
+		}
+	case descriptor.Double:
+		switch value.Type {
+		case StackTypeInt:
+			return doubleValue(float64(value.Int()))
+		case StackTypeLong:
+			return doubleValue(float64(value.Long()))
+		case StackTypeFloat:
+			return doubleValue(float64(value.Float()))
+		}
+	}
+	return value
+}
+
+// box converts a primitive value to an instance of its wrapper class
+func (jvm *Jvm) box(value StackData, t descriptor.BaseType) (StackData, error) {
+	wrapper := wrapperClasses[t]
+	return jvm.InvokeStatic(wrapper, "valueOf", fmt.Sprintf("(%c)L%s;", t, wrapper), []StackData{value})
+}
+
+// unbox extracts the primitive value of a wrapper object and widens it to t
+func (jvm *Jvm) unbox(value StackData, t descriptor.BaseType) (StackData, error) {
+	if value.IsNull() {
+		return StackData{}, throwable("java/lang/NullPointerException", "Cannot unbox null value")
+	}
+	if object, ok := value.Data.(*Object); ok {
+		for base, wrapper := range wrapperClasses {
+			if object.Class.Name() == wrapper && isWidening(base, t) {
+				return widen(object.Fields[wrapper+".value"], t), nil
+			}
+		}
+	}
+	return StackData{}, throwable("java/lang/ClassCastException", "%s", jvm.classCastMessage(jvm.referenceClassName(value), wrapperClasses[t]))
+}
+
+// convertValue converts an argument or result of a method handle between
+// the types of an asType adaptation
+func (jvm *Jvm) convertValue(value StackData, from, to descriptor.Type) (StackData, error) {
+	fromBase, fromPrimitive := from.(descriptor.BaseType)
+	toBase, toPrimitive := to.(descriptor.BaseType)
+	switch {
+	case fromPrimitive && toPrimitive:
+		return widen(value, toBase), nil
+	case fromPrimitive:
+		return jvm.box(value, fromBase)
+	case toPrimitive:
+		return jvm.unbox(value, toBase)
+	}
+	className := to.Descriptor()
+	if object, ok := to.(*descriptor.ObjectType); ok {
+		className = object.ClassName
+	}
+	if !value.IsNull() && !jvm.isInstance(value, className) {
+		return StackData{}, throwable("java/lang/ClassCastException", "Cannot cast %s to %s",
+			strings.ReplaceAll(jvm.referenceClassName(value), "/", "."), to)
+	}
+	return value, nil
+}
+
+// insertArguments binds values to the parameters of handle starting at pos,
+// boxed values are unboxed for primitive parameters
+func (jvm *Jvm) insertArguments(handle *MethodHandle, pos int, values []StackData) (*MethodHandle, error) {
+	params := handle.Type.Params
+	if pos < 0 || pos+len(values) > len(params) {
+		return nil, throwable("java/lang/IllegalArgumentException", "too many values to insert")
+	}
+	bound := make([]StackData, len(values))
+	for i, value := range values {
+		var err error
+		if bound[i], err = jvm.convertValue(value, &descriptor.ObjectType{ClassName: "java/lang/Object"}, params[pos+i]); err != nil {
+			return nil, err
+		}
+	}
+	remaining := append(append([]descriptor.Type(nil), params[:pos]...), params[pos+len(values):]...)
+	return &MethodHandle{
+		Type:     jvm.newMethodType(remaining, handle.Type.Return),
+		retained: append([]StackData{referenceValue(handle)}, bound...),
+		target: func(args []StackData) (StackData, error) {
+			all := append(append(append([]StackData(nil), args[:pos]...), bound...), args[pos:]...)
+			return handle.target(all)
+		},
+	}, nil
+}
+
+// dropArguments adds parameters of the given types at pos which are ignored
+func (jvm *Jvm) dropArguments(handle *MethodHandle, pos int, types []descriptor.Type) (*MethodHandle, error) {
+	params := handle.Type.Params
+	if pos < 0 || pos > len(params) {
+		return nil, throwable("java/lang/IllegalArgumentException", "bad argument count %d", pos)
+	}
+	newParams := append(append(append([]descriptor.Type(nil), params[:pos]...), types...), params[pos:]...)
+	return &MethodHandle{
+		Type:     jvm.newMethodType(newParams, handle.Type.Return),
+		retained: []StackData{referenceValue(handle)},
+		target: func(args []StackData) (StackData, error) {
+			kept := append(append([]StackData(nil), args[:pos]...), args[pos+len(types):]...)
+			return handle.target(kept)
+		},
+	}, nil
+}
+
+// filterReturnValue passes the result of target through filter
+func (jvm *Jvm) filterReturnValue(target, filter *MethodHandle) (*MethodHandle, error) {
+	filterParams := filter.Type.Params
+	matches := len(filterParams) == 1 && filterParams[0].Descriptor() == target.Type.Return.Descriptor()
+	if target.Type.Return == descriptor.Void {
+		matches = len(filterParams) == 0
+	}
+	if !matches {
+		return nil, throwable("java/lang/IllegalArgumentException", "target and filter types do not match: %s, %s", target.Type, filter.Type)
+	}
+	return &MethodHandle{
+		Type:     jvm.newMethodType(target.Type.Params, filter.Type.Return),
+		retained: []StackData{referenceValue(target), referenceValue(filter)},
+		target: func(args []StackData) (StackData, error) {
+			result, err := target.target(args)
+			if err != nil {
+				return StackData{}, err
+			}
+			if target.Type.Return == descriptor.Void {
+				return filter.target(nil)
+			}
+			return filter.target([]StackData{result})
+		},
+	}, nil
+}
+
+// findMember implements the find methods of Lookup, translating resolution
+// errors into the exceptions reflective lookups throw
+func (jvm *Jvm) findMember(lookup *Lookup, ref MethodHandleRef) (StackData, error) {
+	handle, err := jvm.NewMethodHandle(lookup.Class, ref)
+	if err == nil {
+		return referenceValue(handle), nil
+	}
+	if thrown, ok := err.(*JavaThrowable); ok && thrown.Object == nil {
+		switch thrown.ClassName {
+		case "java/lang/NoSuchMethodError":
+			return StackData{}, throwable("java/lang/NoSuchMethodException", "no such method: %s.%s%s", ref.Class, ref.Name, ref.Descriptor)
+		case "java/lang/NoSuchFieldError":
+			return StackData{}, throwable("java/lang/NoSuchFieldException", "no such field: %s.%s/%s", ref.Class, ref.Name, ref.Descriptor)
+		}
+	}
+	if linkageError, ok := err.(*LinkageError); ok && linkageError.ErrorClass != "java.lang.NoClassDefFoundError" {
+		return StackData{}, throwable("java/lang/IllegalAccessException", "%s", linkageError.Message)
+	}
+	return StackData{}, err
+}
+
+// classArray returns the types of the mirrors in a Class[]
+func classArray(value StackData) []descriptor.Type {
+	if value.IsNull() {
+		return nil
+	}
+	elements := value.Data.(*Array).Elements
+	types := make([]descriptor.Type, len(elements))
+	for i, element := range elements {
+		types[i] = element.Data.(*ClassMirror).Type()
+	}
+	return types
+}
+
+func mirrorType(value StackData) descriptor.Type {
+	return value.Data.(*ClassMirror).Type()
+}
+
+func internalName(value StackData) string {
+	t := mirrorType(value)
+	if object, ok := t.(*descriptor.ObjectType); ok {
+		return object.ClassName
+	}
+	return t.Descriptor()
+}
+
+func init() {
+	const (
+		methodTypeClass   = "java/lang/invoke/MethodType"
+		methodHandleClass = "java/lang/invoke/MethodHandle"
+		methodHandles     = "java/lang/invoke/MethodHandles"
+		lookupClass       = "java/lang/invoke/MethodHandles$Lookup"
+	)
+	// reference returns a result of a combinator
+	reference := func(v interface{}, err error) (StackData, error) {
+		if err != nil {
+			return StackData{}, err
+		}
+		return referenceValue(v), nil
+	}
+	toString := func(call *NativeCall) (StackData, error) {
+		return referenceValue(NewString(call.Reference(0).(fmt.Stringer).String())), nil
+	}
+
+	RegisterNative(methodTypeClass, "methodType", "(Ljava/lang/Class;)Ljava/lang/invoke/MethodType;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.newMethodType(nil, mirrorType(call.Args[0]))), nil
+	})
+	RegisterNative(methodTypeClass, "methodType", "(Ljava/lang/Class;Ljava/lang/Class;)Ljava/lang/invoke/MethodType;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.newMethodType([]descriptor.Type{mirrorType(call.Args[1])}, mirrorType(call.Args[0]))), nil
+	})
+	RegisterNative(methodTypeClass, "methodType", "(Ljava/lang/Class;[Ljava/lang/Class;)Ljava/lang/invoke/MethodType;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.newMethodType(classArray(call.Args[1]), mirrorType(call.Args[0]))), nil
+	})
+	RegisterNative(methodTypeClass, "methodType", "(Ljava/lang/Class;Ljava/lang/Class;[Ljava/lang/Class;)Ljava/lang/invoke/MethodType;", func(call *NativeCall) (StackData, error) {
+		params := append([]descriptor.Type{mirrorType(call.Args[1])}, classArray(call.Args[2])...)
+		return referenceValue(call.Jvm.newMethodType(params, mirrorType(call.Args[0]))), nil
+	})
+	RegisterNative(methodTypeClass, "fromMethodDescriptorString", "(Ljava/lang/String;Ljava/lang/ClassLoader;)Ljava/lang/invoke/MethodType;", func(call *NativeCall) (StackData, error) {
+		methodType, err := call.Jvm.MethodTypeOf(call.GoString(0))
+		if err != nil {
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "%s", err)
+		}
+		return referenceValue(methodType), nil
+	})
+	RegisterNative(methodTypeClass, "parameterCount", "()I", func(call *NativeCall) (StackData, error) {
+		return intValue(int32(len(call.Reference(0).(*MethodType).Params))), nil
+	})
+	RegisterNative(methodTypeClass, "parameterType", "(I)Ljava/lang/Class;", func(call *NativeCall) (StackData, error) {
+		params, index := call.Reference(0).(*MethodType).Params, int(call.Int(1))
+		if index < 0 || index >= len(params) {
+			return StackData{}, throwable("java/lang/IndexOutOfBoundsException", "%d", index)
+		}
+		return referenceValue(call.Jvm.Mirror(params[index].Descriptor())), nil
+	})
+	RegisterNative(methodTypeClass, "returnType", "()Ljava/lang/Class;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.Mirror(call.Reference(0).(*MethodType).Return.Descriptor())), nil
+	})
+	RegisterNative(methodTypeClass, "toMethodDescriptorString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(NewString(call.Reference(0).(*MethodType).Descriptor())), nil
+	})
+	RegisterNative(methodTypeClass, "toString", "()Ljava/lang/String;", toString)
+
+	RegisterNative(methodHandles, "insertArguments", "(Ljava/lang/invoke/MethodHandle;I[Ljava/lang/Object;)Ljava/lang/invoke/MethodHandle;", func(call *NativeCall) (StackData, error) {
+		return reference(call.Jvm.insertArguments(call.Reference(0).(*MethodHandle), int(call.Int(1)), call.Reference(2).(*Array).Elements))
+	})
+	RegisterNative(methodHandles, "dropArguments", "(Ljava/lang/invoke/MethodHandle;I[Ljava/lang/Class;)Ljava/lang/invoke/MethodHandle;", func(call *NativeCall) (StackData, error) {
+		return reference(call.Jvm.dropArguments(call.Reference(0).(*MethodHandle), int(call.Int(1)), classArray(call.Args[2])))
+	})
+	RegisterNative(methodHandles, "filterReturnValue", "(Ljava/lang/invoke/MethodHandle;Ljava/lang/invoke/MethodHandle;)Ljava/lang/invoke/MethodHandle;", func(call *NativeCall) (StackData, error) {
+		return reference(call.Jvm.filterReturnValue(call.Reference(0).(*MethodHandle), call.Reference(1).(*MethodHandle)))
+	})
+
+	// Signature polymorphic, the descriptor is the one of the call site
+	invoke := func(call *NativeCall) (StackData, error) {
+		return call.Jvm.InvokeHandle(call.Reference(0).(*MethodHandle), call.Descriptor, call.Name == "invokeExact", call.Args[1:])
+	}
+	RegisterNative(methodHandleClass, "invokeExact", "", invoke)
+	RegisterNative(methodHandleClass, "invoke", "", invoke)
+	RegisterNative(methodHandleClass, "invokeWithArguments", "([Ljava/lang/Object;)Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		values := call.Reference(1).(*Array).Elements
+		object := &descriptor.ObjectType{ClassName: "java/lang/Object"}
+		params := make([]descriptor.Type, len(values))
+		for i := range params {
+			params[i] = object
+		}
+		return call.Jvm.InvokeHandle(call.Reference(0).(*MethodHandle), (&descriptor.MethodType{Params: params, Return: object}).Descriptor(), false, values)
+	})
+	RegisterNative(methodHandleClass, "type", "()Ljava/lang/invoke/MethodType;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Reference(0).(*MethodHandle).Type), nil
+	})
+	RegisterNative(methodHandleClass, "asType", "(Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;", func(call *NativeCall) (StackData, error) {
+		return reference(call.Jvm.asType(call.Reference(0).(*MethodHandle), call.Reference(1).(*MethodType)))
+	})
+	RegisterNative(methodHandleClass, "bindTo", "(Ljava/lang/Object;)Ljava/lang/invoke/MethodHandle;", func(call *NativeCall) (StackData, error) {
+		handle := call.Reference(0).(*MethodHandle)
+		leadingPrimitive := false
+		if len(handle.Type.Params) > 0 {
+			_, leadingPrimitive = handle.Type.Params[0].(descriptor.BaseType)
+		}
+		if len(handle.Type.Params) == 0 || leadingPrimitive {
+			value, err := call.Jvm.toJavaString(call.Args[1], &descriptor.ObjectType{ClassName: "java/lang/Object"})
+			if err != nil {
+				return StackData{}, err
+			}
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "no leading reference parameter: %s", value)
+		}
+		return reference(call.Jvm.insertArguments(handle, 0, call.Args[1:2]))
+	})
+	RegisterNative(methodHandleClass, "toString", "()Ljava/lang/String;", toString)
+
+	RegisterNative(lookupClass, "lookupClass", "()Ljava/lang/Class;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.Mirror("L" + call.Reference(0).(*Lookup).Class.Name() + ";")), nil
+	})
+	RegisterNative(lookupClass, "toString", "()Ljava/lang/String;", toString)
+	// find registers a find method of Lookup, ref builds the member
+	// reference from the arguments
+	find := func(name, methodDescriptor string, ref func(call *NativeCall, class string) MethodHandleRef) {
+		RegisterNative(lookupClass, name, methodDescriptor, func(call *NativeCall) (StackData, error) {
+			return call.Jvm.findMember(call.Reference(0).(*Lookup), ref(call, internalName(call.Args[1])))
+		})
+	}
+	find("findStatic", "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;", func(call *NativeCall, class string) MethodHandleRef {
+		return MethodHandleRef{RefInvokeStatic, class, call.GoString(2), call.Reference(3).(*MethodType).Descriptor()}
+	})
+	find("findVirtual", "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;", func(call *NativeCall, class string) MethodHandleRef {
+		ref := MethodHandleRef{RefInvokeVirtual, class, call.GoString(2), call.Reference(3).(*MethodType).Descriptor()}
+		if mirror := call.Reference(1).(*ClassMirror); mirror.Class != nil && mirror.Class.AccessFlags&AccInterface != 0 {
+			ref.Kind = RefInvokeInterface
+		}
+		return ref
+	})
+	find("findSpecial", "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/invoke/MethodType;Ljava/lang/Class;)Ljava/lang/invoke/MethodHandle;", func(call *NativeCall, class string) MethodHandleRef {
+		return MethodHandleRef{RefInvokeSpecial, class, call.GoString(2), call.Reference(3).(*MethodType).Descriptor()}
+	})
+	find("findConstructor", "(Ljava/lang/Class;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;", func(call *NativeCall, class string) MethodHandleRef {
+		return MethodHandleRef{RefNewInvokeSpecial, class, "<init>", call.Reference(2).(*MethodType).Descriptor()}
+	})
+	fieldKinds := map[string]ReferenceKind{"findGetter": RefGetField, "findSetter": RefPutField, "findStaticGetter": RefGetStatic, "findStaticSetter": RefPutStatic}
+	for name, kind := range fieldKinds {
+		kind := kind
+		find(name, "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/Class;)Ljava/lang/invoke/MethodHandle;", func(call *NativeCall, class string) MethodHandleRef {
+			return MethodHandleRef{kind, class, call.GoString(2), call.Reference(3).(*ClassMirror).Descriptor}
+		})
+	}
+}
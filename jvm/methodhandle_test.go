@@ -0,0 +1,384 @@
+package jvm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// defineHandleTargets defines Target, whose members the handles refer to,
+// and Other, a class without access to its private members
+func defineHandleTargets(t *testing.T) (*Jvm, *JavaClass, *JavaClass) {
+	t.Helper()
+	jvm, err := NewJvm(buildProgram(t, func(p programBuilder) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := newClassBuilder("Target", "java/lang/Object", AccPublic|AccSuper)
+	target.interfaces = []string{"java/lang/Runnable"}
+	target.addField(AccPublic, "count", "I")
+	target.addField(AccPublic|AccStatic, "label", "Ljava/lang/String;")
+	init := target.addMethod(AccPublic, "<init>", "()V")
+	init.maxStack, init.maxLocals = 1, 1
+	init.op(OpAload0)
+	init.op(OpInvokespecial, target.methodRef("java/lang/Object", "<init>", "()V", false))
+	init.op(OpReturn)
+	// static int twice(int i) { return i * 2; }
+	twice := target.addMethod(AccPublic|AccStatic, "twice", "(I)I")
+	twice.maxStack, twice.maxLocals = 2, 1
+	twice.op(OpIload0)
+	twice.op(OpIconst2)
+	twice.op(OpImul)
+	twice.op(OpIreturn)
+	// int add(int i) { return count + i; }
+	add := target.addMethod(AccPublic, "add", "(I)I")
+	add.maxStack, add.maxLocals = 2, 2
+	add.op(OpAload0)
+	add.op(OpGetfield, target.fieldRef("Target", "count", "I"))
+	add.op(OpIload1)
+	add.op(OpIadd)
+	add.op(OpIreturn)
+	// void run() { count++; }
+	run := target.addMethod(AccPublic, "run", "()V")
+	run.maxStack, run.maxLocals = 3, 1
+	run.op(OpAload0)
+	run.op(OpDup)
+	run.op(OpGetfield, target.fieldRef("Target", "count", "I"))
+	run.op(OpIconst1)
+	run.op(OpIadd)
+	run.op(OpPutfield, target.fieldRef("Target", "count", "I"))
+	run.op(OpReturn)
+	hidden := target.addMethod(AccPrivate|AccStatic, "hidden", "()V")
+	hidden.op(OpReturn)
+	targetClass, err := target.Define(jvm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherClass, err := newClassBuilder("Other", "java/lang/Object", AccPublic|AccSuper).Define(jvm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jvm, targetClass, otherClass
+}
+
+// checkResult compares the result of a handle with want: an int32, a Go
+// string for a String, nil for no result
+func checkResult(t *testing.T, result StackData, want interface{}) {
+	t.Helper()
+	switch want := want.(type) {
+	case int32:
+		if result.Int() != want {
+			t.Errorf("result = %d, want %d", result.Int(), want)
+		}
+	case int64:
+		if result.Long() != want {
+			t.Errorf("result = %d, want %d", result.Long(), want)
+		}
+	case string:
+		if s, ok := result.Data.(*String); !ok || s.String() != want {
+			t.Errorf("result = %v, want %q", result.Data, want)
+		}
+	}
+}
+
+func TestDirectMethodHandles(t *testing.T) {
+	jvm, target, _ := defineHandleTargets(t)
+	object := referenceValue(jvm.NewObject(target))
+	// Run in order, the ones after the setters see what they set
+	tests := []struct {
+		ref        MethodHandleRef
+		handleType string
+		args       []StackData
+		want       interface{}
+	}{
+		{MethodHandleRef{RefPutField, "Target", "count", "I"}, "(Target,int)void", []StackData{object, intValue(5)}, nil},
+		{MethodHandleRef{RefGetField, "Target", "count", "I"}, "(Target)int", []StackData{object}, int32(5)},
+		{MethodHandleRef{RefPutStatic, "Target", "label", "Ljava/lang/String;"}, "(String)void", []StackData{referenceValue(NewString("set"))}, nil},
+		{MethodHandleRef{RefGetStatic, "Target", "label", "Ljava/lang/String;"}, "()String", nil, "set"},
+		{MethodHandleRef{RefInvokeStatic, "Target", "twice", "(I)I"}, "(int)int", []StackData{intValue(21)}, int32(42)},
+		{MethodHandleRef{RefInvokeVirtual, "Target", "add", "(I)I"}, "(Target,int)int", []StackData{object, intValue(1)}, int32(6)},
+		{MethodHandleRef{RefInvokeInterface, "java/lang/Runnable", "run", "()V"}, "(Runnable)void", []StackData{object}, nil},
+		{MethodHandleRef{RefInvokeSpecial, "Target", "add", "(I)I"}, "(Target,int)int", []StackData{object, intValue(2)}, int32(8)},
+	}
+	for _, test := range tests {
+		t.Run(test.ref.String(), func(t *testing.T) {
+			handle, err := jvm.NewMethodHandle(target, test.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := handle.Type.String(); got != test.handleType {
+				t.Errorf("type = %s, want %s", got, test.handleType)
+			}
+			result, err := jvm.InvokeHandle(handle, handle.Type.Descriptor(), true, test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkResult(t, result, test.want)
+		})
+	}
+
+	constructor, err := jvm.NewMethodHandle(target, MethodHandleRef{RefNewInvokeSpecial, "Target", "<init>", "()V"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := constructor.Type.String(); got != "()Target" {
+		t.Errorf("constructor type = %s, want ()Target", got)
+	}
+	created, err := jvm.InvokeHandle(constructor, "()LTarget;", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object, ok := created.Data.(*Object); !ok || object.Class != target {
+		t.Errorf("constructor created %v, want a Target", created.Data)
+	}
+}
+
+func TestInvokeHandleTypes(t *testing.T) {
+	jvm, target, _ := defineHandleTargets(t)
+	twice, err := jvm.NewMethodHandle(target, MethodHandleRef{RefInvokeStatic, "Target", "twice", "(I)I"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxed, err := jvm.box(intValue(21), descriptor.Int)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name           string
+		callDescriptor string
+		exact          bool
+		args           []StackData
+		want           interface{}
+		err            string
+	}{
+		{
+			name:           "invokeExact of another type",
+			callDescriptor: "(Ljava/lang/Integer;)I",
+			exact:          true,
+			args:           []StackData{boxed},
+			err:            "java.lang.invoke.WrongMethodTypeException: handle's method type (int)int but found (Integer)int",
+		},
+		{
+			name:           "invoke widening",
+			callDescriptor: "(S)J",
+			args:           []StackData{intValue(21)},
+			want:           int64(42),
+		},
+		{
+			name:           "invoke unboxing",
+			callDescriptor: "(Ljava/lang/Integer;)I",
+			args:           []StackData{boxed},
+			want:           int32(42),
+		},
+		{
+			name:           "invoke narrowing",
+			callDescriptor: "(J)I",
+			args:           []StackData{longValue(21)},
+			err:            "java.lang.invoke.WrongMethodTypeException: cannot convert MethodHandle(int)int to (long)int",
+		},
+		{
+			name:           "invoke with another arity",
+			callDescriptor: "(II)I",
+			args:           []StackData{intValue(1), intValue(2)},
+			err:            "java.lang.invoke.WrongMethodTypeException: cannot convert MethodHandle(int)int to (int,int)int",
+		},
+		{
+			name:           "invoke unboxing another class",
+			callDescriptor: "(Ljava/lang/Object;)I",
+			args:           []StackData{referenceValue(NewString("21"))},
+			err:            "java.lang.ClassCastException: class java.lang.String cannot be cast to class java.lang.Integer (java.lang.String and java.lang.Integer are in module java.base of loader 'bootstrap')",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := jvm.InvokeHandle(twice, test.callDescriptor, test.exact, test.args)
+			switch {
+			case test.err != "":
+				if err == nil || err.Error() != test.err {
+					t.Errorf("error = %v, want %s", err, test.err)
+				}
+			case err != nil:
+				t.Error(err)
+			default:
+				checkResult(t, result, test.want)
+			}
+		})
+	}
+
+	// The result of invoke is boxed back for a reference return type
+	result, err := jvm.InvokeHandle(twice, "(Ljava/lang/Integer;)Ljava/lang/Object;", false, []StackData{boxed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object, ok := result.Data.(*Object); !ok || object.Fields["java/lang/Integer.value"].Int() != 42 {
+		t.Errorf("boxed result = %v, want Integer 42", result.Data)
+	}
+}
+
+func TestAsTypeAndBindTo(t *testing.T) {
+	jvm, target, _ := defineHandleTargets(t)
+	object := jvm.NewObject(target)
+	object.Fields["Target.count"] = intValue(40)
+	add, err := jvm.NewMethodHandle(target, MethodHandleRef{RefInvokeVirtual, "Target", "add", "(I)I"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const methodHandle = "java/lang/invoke/MethodHandle"
+	bound, err := jvm.InvokeVirtual(methodHandle, "bindTo", "(Ljava/lang/Object;)Ljava/lang/invoke/MethodHandle;", []StackData{referenceValue(add), referenceValue(object)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	boundHandle := bound.Data.(*MethodHandle)
+	if got := boundHandle.Type.String(); got != "(int)int" {
+		t.Errorf("bound type = %s, want (int)int", got)
+	}
+	result, err := jvm.InvokeVirtual(methodHandle, "invokeExact", "(I)I", []StackData{bound, intValue(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResult(t, result, int32(42))
+
+	// Binding a receiver of another class fails when the handle is made
+	if _, err := jvm.InvokeVirtual(methodHandle, "bindTo", "(Ljava/lang/Object;)Ljava/lang/invoke/MethodHandle;", []StackData{referenceValue(add), referenceValue(NewString("s"))}); err == nil {
+		t.Error("bindTo accepted a String for a Target receiver")
+	}
+	// bindTo needs a leading reference parameter
+	if _, err := jvm.InvokeVirtual(methodHandle, "bindTo", "(Ljava/lang/Object;)Ljava/lang/invoke/MethodHandle;", []StackData{bound, referenceValue(object)}); err == nil || !strings.HasPrefix(err.Error(), "java.lang.IllegalArgumentException: no leading reference parameter: Target@") {
+		t.Errorf("bindTo of (int)int error = %v", err)
+	}
+
+	objectType, err := jvm.MethodTypeOf("(Ljava/lang/Object;I)Ljava/lang/Object;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapted, err := jvm.asType(add, objectType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adapted.Type != objectType {
+		t.Errorf("asType type = %s, want %s", adapted.Type, objectType)
+	}
+	if same, err := jvm.asType(add, add.Type); err != nil || same != add {
+		t.Errorf("asType to the same type = %v, %v, want the handle itself", same, err)
+	}
+	result, err = jvm.InvokeHandle(adapted, objectType.Descriptor(), true, []StackData{referenceValue(NewString("s")), intValue(1)})
+	if err == nil || err.Error() != "java.lang.ClassCastException: Cannot cast java.lang.String to Target" {
+		t.Errorf("adapted handle on a String = %v, %v", result, err)
+	}
+}
+
+func TestLookupFind(t *testing.T) {
+	jvm, target, other := defineHandleTargets(t)
+	const lookupClass = "java/lang/invoke/MethodHandles$Lookup"
+	intToInt, err := jvm.MethodTypeOf("(I)I")
+	if err != nil {
+		t.Fatal(err)
+	}
+	voidType, err := jvm.MethodTypeOf("()V")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetMirror := referenceValue(jvm.Mirror("LTarget;"))
+	tests := []struct {
+		name, method, methodDescriptor string
+		lookup                         *JavaClass
+		args                           []StackData
+		handleType                     string
+		kind                           ReferenceKind
+		err                            string
+	}{
+		{
+			name: "findStatic", method: "findStatic",
+			methodDescriptor: "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;",
+			lookup:           other,
+			args:             []StackData{targetMirror, referenceValue(NewString("twice")), referenceValue(intToInt)},
+			handleType:       "(int)int", kind: RefInvokeStatic,
+		},
+		{
+			name: "findVirtual of an interface", method: "findVirtual",
+			methodDescriptor: "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;",
+			lookup:           other,
+			args:             []StackData{referenceValue(jvm.Mirror("Ljava/lang/Runnable;")), referenceValue(NewString("run")), referenceValue(voidType)},
+			handleType:       "(Runnable)void", kind: RefInvokeInterface,
+		},
+		{
+			name: "findConstructor", method: "findConstructor",
+			methodDescriptor: "(Ljava/lang/Class;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;",
+			lookup:           other,
+			args:             []StackData{targetMirror, referenceValue(voidType)},
+			handleType:       "()Target", kind: RefNewInvokeSpecial,
+		},
+		{
+			name: "findGetter", method: "findGetter",
+			methodDescriptor: "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/Class;)Ljava/lang/invoke/MethodHandle;",
+			lookup:           other,
+			args:             []StackData{targetMirror, referenceValue(NewString("count")), referenceValue(jvm.Mirror("I"))},
+			handleType:       "(Target)int", kind: RefGetField,
+		},
+		{
+			name: "findStaticSetter", method: "findStaticSetter",
+			methodDescriptor: "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/Class;)Ljava/lang/invoke/MethodHandle;",
+			lookup:           other,
+			args:             []StackData{targetMirror, referenceValue(NewString("label")), referenceValue(jvm.Mirror("Ljava/lang/String;"))},
+			handleType:       "(String)void", kind: RefPutStatic,
+		},
+		{
+			name: "missing method", method: "findVirtual",
+			methodDescriptor: "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;",
+			lookup:           other,
+			args:             []StackData{targetMirror, referenceValue(NewString("missing")), referenceValue(intToInt)},
+			err:              "java.lang.NoSuchMethodException: no such method: Target.missing(I)I",
+		},
+		{
+			name: "missing field", method: "findGetter",
+			methodDescriptor: "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/Class;)Ljava/lang/invoke/MethodHandle;",
+			lookup:           other,
+			args:             []StackData{targetMirror, referenceValue(NewString("missing")), referenceValue(jvm.Mirror("I"))},
+			err:              "java.lang.NoSuchFieldException: no such field: Target.missing/I",
+		},
+		{
+			name: "private method of another class", method: "findStatic",
+			methodDescriptor: "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;",
+			lookup:           other,
+			args:             []StackData{targetMirror, referenceValue(NewString("hidden")), referenceValue(voidType)},
+			err:              "java.lang.IllegalAccessException: class Other tried to access private member Target.hidden",
+		},
+		{
+			name: "private method of the lookup class", method: "findStatic",
+			methodDescriptor: "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;",
+			lookup:           target,
+			args:             []StackData{targetMirror, referenceValue(NewString("hidden")), referenceValue(voidType)},
+			handleType:       "()void", kind: RefInvokeStatic,
+		},
+		{
+			name: "instance method found as static", method: "findStatic",
+			methodDescriptor: "(Ljava/lang/Class;Ljava/lang/String;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/MethodHandle;",
+			lookup:           other,
+			args:             []StackData{targetMirror, referenceValue(NewString("add")), referenceValue(intToInt)},
+			err:              "java.lang.IllegalAccessException: Expected static member Target.add",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]StackData{referenceValue(&Lookup{Class: test.lookup})}, test.args...)
+			result, err := jvm.InvokeVirtual(lookupClass, test.method, test.methodDescriptor, args)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			handle := result.Data.(*MethodHandle)
+			if got := handle.Type.String(); got != test.handleType {
+				t.Errorf("type = %s, want %s", got, test.handleType)
+			}
+			if handle.Member == nil || handle.Member.Kind != test.kind {
+				t.Errorf("member = %v, want a %s", handle.Member, test.kind)
+			}
+		})
+	}
+}
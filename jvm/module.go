@@ -0,0 +1,255 @@
+package jvm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Module declarations (JVMS §4.7.25), only found in module-info classes
+
+type ModuleFlag uint16
+
+const (
+	ModuleOpen        ModuleFlag = 0x0020
+	ModuleTransitive  ModuleFlag = 0x0020
+	ModuleStaticPhase ModuleFlag = 0x0040
+	ModuleSynthetic   ModuleFlag = 0x1000
+	ModuleMandated    ModuleFlag = 0x8000
+)
+
+type ModuleRequires struct {
+	RequiresIndex uint16
+	Requires      string
+	Flags         ModuleFlag
+	// Zero, with an empty Version, if no version was recorded
+	VersionIndex uint16
+	Version      string
+}
+
+// ModulePackageAccess is an exports or opens entry, To is empty when the
+// package is exported or opened to every module
+type ModulePackageAccess struct {
+	PackageIndex uint16
+	Package      string
+	Flags        ModuleFlag
+	ToIndexes    []uint16
+	To           []string
+}
+
+type ModuleProvides struct {
+	ProvidesIndex uint16
+	Service       string
+	WithIndexes   []uint16
+	With          []string
+}
+
+type ModuleAttribute struct {
+	ModuleNameIndex uint16
+	Name            string
+	Flags           ModuleFlag
+	VersionIndex    uint16
+	Version         string
+	Requires        []ModuleRequires
+	Exports         []ModulePackageAccess
+	Opens           []ModulePackageAccess
+	UsesIndexes     []uint16
+	Uses            []string
+	Provides        []ModuleProvides
+}
+
+type ModulePackagesAttribute struct {
+	PackageIndexes []uint16
+	Packages       []string
+}
+
+type ModuleMainClassAttribute struct {
+	MainClassIndex uint16
+	MainClass      string
+}
+
+// readIndexes reads a u2 count followed by that many constant pool indexes,
+// resolving each one with resolve
+func readIndexes(constantPool []*ConstantInfo, r *attributeReader, resolve func([]*ConstantInfo, uint16) string) ([]uint16, []string, error) {
+	count, err := r.u2()
+	if err != nil {
+		return nil, nil, err
+	}
+	indexes := make([]uint16, count)
+	names := make([]string, count)
+	for i := range count {
+		if indexes[i], err = r.u2(); err != nil {
+			return nil, nil, err
+		}
+		names[i] = resolve(constantPool, indexes[i])
+	}
+	return indexes, names, nil
+}
+
+func readModulePackageAccess(constantPool []*ConstantInfo, r *attributeReader) ([]ModulePackageAccess, error) {
+	count, err := r.u2()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ModulePackageAccess, count)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.PackageIndex, err = r.u2(); err != nil {
+			return nil, err
+		}
+		entry.Package = GetPackageName(constantPool, entry.PackageIndex)
+		flags, err := r.u2()
+		if err != nil {
+			return nil, err
+		}
+		entry.Flags = ModuleFlag(flags)
+		if entry.ToIndexes, entry.To, err = readIndexes(constantPool, r, GetModuleName); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func ReadModule(constantPool []*ConstantInfo, info []byte) (ModuleAttribute, error) {
+	r := &attributeReader{info: info}
+	module := ModuleAttribute{}
+	var err error
+	if module.ModuleNameIndex, err = r.u2(); err != nil {
+		return module, err
+	}
+	module.Name = GetModuleName(constantPool, module.ModuleNameIndex)
+	flags, err := r.u2()
+	if err != nil {
+		return module, err
+	}
+	module.Flags = ModuleFlag(flags)
+	if module.VersionIndex, err = r.u2(); err != nil {
+		return module, err
+	}
+	module.Version = GetUtf8(constantPool, module.VersionIndex)
+
+	requiresCount, err := r.u2()
+	if err != nil {
+		return module, err
+	}
+	module.Requires = make([]ModuleRequires, requiresCount)
+	for i := range module.Requires {
+		requires := &module.Requires[i]
+		if requires.RequiresIndex, err = r.u2(); err != nil {
+			return module, err
+		}
+		requires.Requires = GetModuleName(constantPool, requires.RequiresIndex)
+		flags, err := r.u2()
+		if err != nil {
+			return module, err
+		}
+		requires.Flags = ModuleFlag(flags)
+		if requires.VersionIndex, err = r.u2(); err != nil {
+			return module, err
+		}
+		requires.Version = GetUtf8(constantPool, requires.VersionIndex)
+	}
+
+	if module.Exports, err = readModulePackageAccess(constantPool, r); err != nil {
+		return module, err
+	}
+	if module.Opens, err = readModulePackageAccess(constantPool, r); err != nil {
+		return module, err
+	}
+	if module.UsesIndexes, module.Uses, err = readIndexes(constantPool, r, GetClassName); err != nil {
+		return module, err
+	}
+
+	providesCount, err := r.u2()
+	if err != nil {
+		return module, err
+	}
+	module.Provides = make([]ModuleProvides, providesCount)
+	for i := range module.Provides {
+		provides := &module.Provides[i]
+		if provides.ProvidesIndex, err = r.u2(); err != nil {
+			return module, err
+		}
+		provides.Service = GetClassName(constantPool, provides.ProvidesIndex)
+		if provides.WithIndexes, provides.With, err = readIndexes(constantPool, r, GetClassName); err != nil {
+			return module, err
+		}
+	}
+	return module, nil
+}
+
+func (m ModuleAttribute) String() string {
+	var output strings.Builder
+	if m.Flags&ModuleOpen != 0 {
+		output.WriteString("open ")
+	}
+	fmt.Fprintf(&output, "module %s", m.Name)
+	if m.Version != "" {
+		fmt.Fprintf(&output, "@%s", m.Version)
+	}
+	output.WriteString(" {")
+	for _, requires := range m.Requires {
+		output.WriteString("\n\t\trequires ")
+		if requires.Flags&ModuleTransitive != 0 {
+			output.WriteString("transitive ")
+		}
+		if requires.Flags&ModuleStaticPhase != 0 {
+			output.WriteString("static ")
+		}
+		output.WriteString(requires.Requires)
+	}
+	for _, exports := range m.Exports {
+		fmt.Fprintf(&output, "\n\t\texports %s", exports.Package)
+		if len(exports.To) != 0 {
+			fmt.Fprintf(&output, " to %s", strings.Join(exports.To, ", "))
+		}
+	}
+	for _, opens := range m.Opens {
+		fmt.Fprintf(&output, "\n\t\topens %s", opens.Package)
+		if len(opens.To) != 0 {
+			fmt.Fprintf(&output, " to %s", strings.Join(opens.To, ", "))
+		}
+	}
+	for _, uses := range m.Uses {
+		fmt.Fprintf(&output, "\n\t\tuses %s", uses)
+	}
+	for _, provides := range m.Provides {
+		fmt.Fprintf(&output, "\n\t\tprovides %s with %s", provides.Service, strings.Join(provides.With, ", "))
+	}
+	output.WriteString("\n\t}")
+	return output.String()
+}
+
+// IsModule reports whether the class is a module-info class
+func (c *JavaClass) IsModule() bool {
+	return c.AccessFlags&AccModule != 0
+}
+
+// Module returns the module declared by a module-info class, nil for any
+// other class
+func (c *JavaClass) Module() *ModuleAttribute {
+	attr := FindAttribute(c.Attributes, ModuleAttr)
+	if attr == nil {
+		return nil
+	}
+	module := attr.Data.(ModuleAttribute)
+	return &module
+}
+
+// ModulePackages returns every package of the module, including the ones
+// not exported nor opened
+func (c *JavaClass) ModulePackages() []string {
+	attr := FindAttribute(c.Attributes, ModulePackagesAttr)
+	if attr == nil {
+		return nil
+	}
+	return attr.Data.(ModulePackagesAttribute).Packages
+}
+
+// ModuleMainClass returns the main class of the module, empty if it has none
+func (c *JavaClass) ModuleMainClass() string {
+	attr := FindAttribute(c.Attributes, ModuleMainClassAttr)
+	if attr == nil {
+		return ""
+	}
+	return attr.Data.(ModuleMainClassAttribute).MainClass
+}
@@ -0,0 +1,305 @@
+package jvm
+
+import (
+	"slices"
+	"time"
+)
+
+// Lock states of the mark word, under markLockMask
+const (
+	markUnlocked = 0
+	// Locked by a thread no other one contends with, the owner has the
+	// object in its lock stack
+	markLightLocked = 1
+	// Locked through the Monitor the vm keeps for the object
+	markInflated = 2
+)
+
+// Monitor is the lock of an object which threads contend for or wait on.
+// An object gets one when it is first needed and loses it once no thread
+// uses it, an uncontended lock only takes the bits of the mark word
+type Monitor struct {
+	owner *Thread
+	// Times the owner entered the monitor
+	recursions int
+	// Threads blocked entering the monitor, the notified ones included, and
+	// the ones waiting to be notified
+	entering, waiting []*Thread
+}
+
+// monitorEnter locks the monitor of reference for the running thread,
+// blocking while another thread owns it
+func (jvm *Jvm) monitorEnter(reference headed) {
+	t := jvm.thread
+	h := reference.header()
+	for {
+		mark := h.mark.Load()
+		switch mark & markLockMask {
+		case markUnlocked:
+			if !h.mark.CompareAndSwap(mark, mark|markLightLocked) {
+				continue
+			}
+			t.lockStack = append(t.lockStack, reference)
+			return
+		case markLightLocked:
+			if slices.Contains(t.lockStack, reference) {
+				t.lockStack = append(t.lockStack, reference)
+				return
+			}
+		}
+		break
+	}
+	m := jvm.inflate(reference)
+	if m.owner == t {
+		m.recursions++
+		return
+	}
+	if m.owner != nil {
+		m.entering = append(m.entering, t)
+		jvm.awaitOwnership(m, reference)
+	}
+	m.owner, m.recursions = t, 1
+}
+
+// awaitOwnership blocks the running thread, which is entering m, until
+// no thread owns m
+func (jvm *Jvm) awaitOwnership(m *Monitor, reference headed) {
+	t := jvm.thread
+	t.blockedOn = reference
+	jvm.park(ThreadBlocked, time.Time{}, false, func() bool { return m.owner == nil })
+	t.blockedOn = nil
+	m.entering = slices.DeleteFunc(m.entering, func(other *Thread) bool { return other == t })
+}
+
+// monitorExit unlocks the monitor of reference once the running thread has
+// exited it as many times as it entered it
+func (jvm *Jvm) monitorExit(reference headed) error {
+	t := jvm.thread
+	h := reference.header()
+	switch h.mark.Load() & markLockMask {
+	case markLightLocked:
+		// The innermost lock is the last one
+		i := len(t.lockStack) - 1
+		for i >= 0 && t.lockStack[i] != reference {
+			i--
+		}
+		if i < 0 {
+			break
+		}
+		t.lockStack = slices.Delete(t.lockStack, i, i+1)
+		if !slices.Contains(t.lockStack, reference) {
+			h.clearBits(markLockMask)
+		}
+		return nil
+	case markInflated:
+		m := jvm.monitors[reference]
+		if m.owner != t {
+			break
+		}
+		if m.recursions--; m.recursions == 0 {
+			jvm.releaseMonitor(m, reference)
+		}
+		return nil
+	}
+	return throwable("java/lang/IllegalMonitorStateException", "")
+}
+
+// releaseMonitor lets another thread own m, or drops it when no thread
+// uses it
+func (jvm *Jvm) releaseMonitor(m *Monitor, reference headed) {
+	m.owner, m.recursions = nil, 0
+	if len(m.entering) == 0 && len(m.waiting) == 0 {
+		delete(jvm.monitors, reference)
+		reference.header().clearBits(markLockMask)
+		return
+	}
+	for _, t := range m.entering {
+		t.wakeUp()
+	}
+}
+
+// inflate returns the Monitor of reference, creating it with the owner and
+// recursions of a lightweight lock
+func (jvm *Jvm) inflate(reference headed) *Monitor {
+	if m, ok := jvm.monitors[reference]; ok {
+		return m
+	}
+	m := &Monitor{}
+	h := reference.header()
+	if h.hasBits(markLightLocked) {
+		for _, t := range jvm.threads {
+			if n := len(t.lockStack); slices.Contains(t.lockStack, reference) {
+				t.lockStack = slices.DeleteFunc(t.lockStack, func(other headed) bool { return other == reference })
+				m.owner, m.recursions = t, n-len(t.lockStack)
+				break
+			}
+		}
+	}
+	for {
+		mark := h.mark.Load()
+		if h.mark.CompareAndSwap(mark, mark&^markLockMask|markInflated) {
+			break
+		}
+	}
+	jvm.monitors[reference] = m
+	return m
+}
+
+// ownedMonitor returns the Monitor of a reference the running thread
+// locked, for Object.wait and notify
+func (jvm *Jvm) ownedMonitor(reference headed) (*Monitor, error) {
+	t := jvm.thread
+	switch reference.header().mark.Load() & markLockMask {
+	case markLightLocked:
+		if !slices.Contains(t.lockStack, reference) {
+			return nil, throwable("java/lang/IllegalMonitorStateException", "current thread is not owner")
+		}
+	case markUnlocked:
+		return nil, throwable("java/lang/IllegalMonitorStateException", "current thread is not owner")
+	}
+	m := jvm.inflate(reference)
+	if m.owner != t {
+		return nil, throwable("java/lang/IllegalMonitorStateException", "current thread is not owner")
+	}
+	return m, nil
+}
+
+// holdsLock tells whether the running thread owns the monitor of reference
+func (jvm *Jvm) holdsLock(reference headed) bool {
+	switch reference.header().mark.Load() & markLockMask {
+	case markLightLocked:
+		return slices.Contains(jvm.thread.lockStack, reference)
+	case markInflated:
+		return jvm.monitors[reference].owner == jvm.thread
+	}
+	return false
+}
+
+// wait releases the monitor of reference until another thread notifies it
+// or the deadline, unless it is zero, passes, then enters it again
+func (jvm *Jvm) wait(reference headed, deadline time.Time) error {
+	m, err := jvm.ownedMonitor(reference)
+	if err != nil {
+		return err
+	}
+	t := jvm.thread
+	if jvm.clearInterrupt(t) {
+		return throwable("java/lang/InterruptedException", "")
+	}
+	recursions := m.recursions
+	m.waiting = append(m.waiting, t)
+	jvm.releaseMonitor(m, reference)
+
+	state := ThreadWaiting
+	if !deadline.IsZero() {
+		state = ThreadTimedWaiting
+	}
+	t.blockedOn = reference
+	notified := func() bool { return !slices.Contains(m.waiting, t) }
+	interrupted := jvm.park(state, deadline, true, notified)
+	if !notified() {
+		m.waiting = slices.DeleteFunc(m.waiting, func(other *Thread) bool { return other == t })
+		m.entering = append(m.entering, t)
+	}
+	if m.owner != nil {
+		jvm.awaitOwnership(m, reference)
+	} else {
+		t.blockedOn = nil
+		m.entering = slices.DeleteFunc(m.entering, func(other *Thread) bool { return other == t })
+	}
+	m.owner, m.recursions = t, recursions
+	if interrupted {
+		return throwable("java/lang/InterruptedException", "")
+	}
+	return nil
+}
+
+// notify moves the first thread waiting on the monitor of reference, or
+// all of them, to the threads entering it
+func (jvm *Jvm) notify(reference headed, all bool) error {
+	if !jvm.holdsLock(reference) {
+		return throwable("java/lang/IllegalMonitorStateException", "current thread is not owner")
+	}
+	jvm.notifyWaiting(reference, all)
+	return nil
+}
+
+// notifyWaiting notifies the threads waiting on the monitor of reference
+// whoever owns it
+func (jvm *Jvm) notifyWaiting(reference headed, all bool) {
+	m, ok := jvm.monitors[reference]
+	if !ok || len(m.waiting) == 0 {
+		return
+	}
+	n := 1
+	if all {
+		n = len(m.waiting)
+	}
+	for _, t := range m.waiting[:n] {
+		t.wakeUp()
+	}
+	m.entering = append(m.entering, m.waiting[:n]...)
+	m.waiting = slices.Delete(m.waiting, 0, n)
+}
+
+// releaseMonitors unlocks the monitors an ending thread still owns and
+// notifies the threads waiting on its java.lang.Thread, the ones joining it
+func (jvm *Jvm) releaseMonitors(t *Thread) {
+	for _, reference := range t.lockStack {
+		reference.header().clearBits(markLockMask)
+	}
+	t.lockStack = nil
+	for reference, m := range jvm.monitors {
+		if m.owner == t {
+			jvm.releaseMonitor(m, reference)
+		}
+	}
+	if t.Object != nil {
+		jvm.notifyWaiting(t.Object, true)
+	}
+}
+
+// methodLock returns the reference a synchronized method locks: the
+// receiver, or the class of a static method
+func (jvm *Jvm) methodLock(class *JavaClass, method *MethodInfo, args []StackData) headed {
+	if AccessFlag(method.AccessFlags)&AccStatic != 0 {
+		return jvm.Mirror("L" + class.Name() + ";")
+	}
+	return args[0].Data.(headed)
+}
+
+func init() {
+	wait := func(call *NativeCall) (StackData, error) {
+		var millis int64
+		var nanos int32
+		if len(call.Args) > 1 {
+			millis = call.Long(1)
+		}
+		if len(call.Args) > 2 {
+			nanos = call.Int(2)
+		}
+		switch {
+		case millis < 0:
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "timeout value is negative")
+		case nanos < 0 || nanos > 999999:
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "nanosecond timeout value out of range")
+		}
+		return StackData{}, call.Jvm.wait(call.Reference(0).(headed), deadline(millis, nanos))
+	}
+	RegisterNative("java/lang/Object", "wait", "()V", wait)
+	RegisterNative("java/lang/Object", "wait", "(J)V", wait)
+	RegisterNative("java/lang/Object", "wait", "(JI)V", wait)
+	RegisterNative("java/lang/Object", "wait0", "(J)V", wait)
+	RegisterNative("java/lang/Object", "notify", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, call.Jvm.notify(call.Reference(0).(headed), false)
+	})
+	RegisterNative("java/lang/Object", "notifyAll", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, call.Jvm.notify(call.Reference(0).(headed), true)
+	})
+	RegisterNative("java/lang/Thread", "holdsLock", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		if call.Args[0].IsNull() {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		return booleanValue(call.Jvm.holdsLock(call.Reference(0).(headed))), nil
+	})
+}
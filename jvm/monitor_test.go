@@ -0,0 +1,164 @@
+package jvm
+
+import "testing"
+
+// holdsLock prints Thread.holdsLock of the object in local 1
+func holdsLock(p programBuilder) {
+	p.println("(Z)V", func() {
+		p.op(OpAload1)
+		p.invoke(true, "java/lang/Thread", "holdsLock", "(Ljava/lang/Object;)Z")
+	})
+}
+
+// printThrown prints what call throws. Without an exception it prints null
+func printThrown(p programBuilder, catchType string, call func()) {
+	start := p.pc()
+	call()
+	p.op(OpAconstNull)
+	p.catch(start, p.pc(), p.pc(), catchType)
+	p.op(OpAstore2)
+	p.println("(Ljava/lang/Object;)V", func() { p.op(OpAload2) })
+}
+
+func TestMonitors(t *testing.T) {
+	// static Thread waiter, the thread the Interrupter interrupts
+	shared := sharedClass()
+	shared.addField(AccStatic, "waiter", "Ljava/lang/Thread;")
+	interrupter := runnable("Interrupter", 1, 1, func(c *codeBuilder) {
+		c.op(OpGetstatic, c.class.fieldRef("Shared", "waiter", "Ljava/lang/Thread;"))
+		c.op(OpInvokevirtual, c.class.methodRef("java/lang/Thread", "interrupt", "()V", false))
+	})
+
+	tests := []struct {
+		name   string
+		body   func(p programBuilder)
+		stdout string
+	}{
+		{
+			name: "reentrant lock",
+			body: func(p programBuilder) {
+				p.newObject("java/lang/Object")
+				p.op(OpAstore1)
+				p.op(OpAload1)
+				p.op(OpMonitorenter)
+				p.op(OpAload1)
+				p.op(OpMonitorenter)
+				holdsLock(p)
+				p.op(OpAload1)
+				p.op(OpMonitorexit)
+				holdsLock(p)
+				p.op(OpAload1)
+				p.op(OpMonitorexit)
+				holdsLock(p)
+			},
+			stdout: "true\ntrue\nfalse\n",
+		},
+		{
+			// wait(10) times out and gives back both entries of the
+			// monitor it inflated
+			name: "wait timeout",
+			body: func(p programBuilder) {
+				currentTime := func() { p.invoke(true, "java/lang/System", "currentTimeMillis", "()J") }
+				p.newObject("java/lang/Object")
+				p.op(OpAstore1)
+				p.op(OpAload1)
+				p.op(OpMonitorenter)
+				p.op(OpAload1)
+				p.op(OpMonitorenter)
+				currentTime()
+				p.op(OpLstore2)
+				p.op(OpAload1)
+				p.op(OpBipush, int8(10))
+				p.op(OpI2l)
+				p.invoke(false, "java/lang/Object", "wait", "(J)V")
+				// Long.compare(System.currentTimeMillis() - start, 9)
+				p.println("(I)V", func() {
+					currentTime()
+					p.op(OpLload2)
+					p.op(OpLsub)
+					p.op(OpBipush, int8(9))
+					p.op(OpI2l)
+					p.op(OpLcmp)
+				})
+				p.op(OpAload1)
+				p.op(OpMonitorexit)
+				holdsLock(p)
+				p.op(OpAload1)
+				p.op(OpMonitorexit)
+				holdsLock(p)
+			},
+			stdout: "1\ntrue\nfalse\n",
+		},
+		{
+			name: "wait and notify without the monitor",
+			body: func(p programBuilder) {
+				p.newObject("java/lang/Object")
+				p.op(OpAstore1)
+				for _, name := range []string{"wait", "notify", "notifyAll"} {
+					printThrown(p, "java/lang/IllegalMonitorStateException", func() {
+						p.op(OpAload1)
+						p.invoke(false, "java/lang/Object", name, "()V")
+					})
+				}
+				// Nor after exiting it
+				p.op(OpAload1)
+				p.op(OpMonitorenter)
+				p.op(OpAload1)
+				p.op(OpMonitorexit)
+				printThrown(p, "java/lang/IllegalMonitorStateException", func() {
+					p.op(OpAload1)
+					p.invoke(false, "java/lang/Object", "notify", "()V")
+				})
+				printThrown(p, "java/lang/IllegalMonitorStateException", func() {
+					p.op(OpAload1)
+					p.op(OpMonitorexit)
+				})
+			},
+			stdout: "java.lang.IllegalMonitorStateException: current thread is not owner\n" +
+				"java.lang.IllegalMonitorStateException: current thread is not owner\n" +
+				"java.lang.IllegalMonitorStateException: current thread is not owner\n" +
+				"java.lang.IllegalMonitorStateException: current thread is not owner\n" +
+				"java.lang.IllegalMonitorStateException\n",
+		},
+		{
+			// The interrupted wait enters the monitor again before it
+			// throws, and clears the interrupt
+			name: "interrupt during wait",
+			body: func(p programBuilder) {
+				p.invoke(true, "java/lang/Thread", "currentThread", "()Ljava/lang/Thread;")
+				p.op(OpPutstatic, p.class.fieldRef("Shared", "waiter", "Ljava/lang/Thread;"))
+				p.newObject("java/lang/Object")
+				p.op(OpAstore1)
+				p.op(OpAload1)
+				p.op(OpMonitorenter)
+				p.op(OpNew, p.class.class("java/lang/Thread"))
+				p.op(OpDup)
+				p.newObject("Interrupter")
+				p.op(OpInvokespecial, p.class.methodRef("java/lang/Thread", "<init>", "(Ljava/lang/Runnable;)V", false))
+				p.invoke(false, "java/lang/Thread", "start", "()V")
+				printThrown(p, "java/lang/InterruptedException", func() {
+					p.op(OpAload1)
+					p.invoke(false, "java/lang/Object", "wait", "()V")
+				})
+				holdsLock(p)
+				p.println("(Z)V", func() {
+					p.invoke(true, "java/lang/Thread", "interrupted", "()Z")
+				})
+				p.op(OpAload1)
+				p.op(OpMonitorexit)
+			},
+			stdout: "java.lang.InterruptedException\ntrue\nfalse\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, stderr := runProgram(t, buildProgram(t, test.body, shared, interrupter))
+			if want := "Running main function code\n" + test.stdout; stdout != want {
+				t.Errorf("stdout = %q, want %q", stdout, want)
+			}
+			if stderr != "" {
+				t.Errorf("stderr = %q", stderr)
+			}
+		})
+	}
+}
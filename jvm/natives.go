@@ -0,0 +1,139 @@
+package jvm
+
+// Native is the Go implementation of a Java method. Java exceptions are
+// thrown by returning a *JavaThrowable
+type Native func(call *NativeCall) (StackData, error)
+
+// NativeCall is a call of a native method
+type NativeCall struct {
+	Jvm *Jvm
+	// Method called. Descriptor is the one of the call site for signature
+	// polymorphic methods
+	Class, Name, Descriptor string
+	// Arguments, the receiver first for instance methods
+	Args []StackData
+}
+
+func (c *NativeCall) Int(i int) int32 {
+	return c.Args[i].Int()
+}
+
+func (c *NativeCall) Long(i int) int64 {
+	return c.Args[i].Long()
+}
+
+func (c *NativeCall) Float(i int) float32 {
+	return c.Args[i].Float()
+}
+
+func (c *NativeCall) Double(i int) float64 {
+	return c.Args[i].Double()
+}
+
+func (c *NativeCall) Boolean(i int) bool {
+	return c.Args[i].Int() != 0
+}
+
+// Reference returns the reference argument i, nil for null
+func (c *NativeCall) Reference(i int) interface{} {
+	return c.Args[i].Data
+}
+
+// String returns the String argument i, nil for null
+func (c *NativeCall) String(i int) *String {
+	s, _ := c.Args[i].Data.(*String)
+	return s
+}
+
+// GoString returns the String argument i converted to UTF-8
+func (c *NativeCall) GoString(i int) string {
+	if s := c.String(i); s != nil {
+		return s.String()
+	}
+	return "null"
+}
+
+// Object returns the argument i if it is an instance of a loaded class
+func (c *NativeCall) Object(i int) *Object {
+	object, _ := c.Args[i].Data.(*Object)
+	return object
+}
+
+// natives are the methods the vm implements, registered by the files
+// implementing them. Every Jvm starts with a copy
+var natives = map[string]Native{}
+
+func nativeKey(className, name, methodDescriptor string) string {
+	return className + "." + name + methodDescriptor
+}
+
+// RegisterNative adds a native method to the Jvms created afterwards. An
+// empty descriptor matches every descriptor of the method, as signature
+// polymorphic methods need
+func RegisterNative(className, name, methodDescriptor string, native Native) {
+	natives[nativeKey(className, name, methodDescriptor)] = native
+}
+
+// RegisterNative adds a native method to jvm. It implements the method
+// whether or not it is declared native, so it can also replace the code of
+// a class file
+func (jvm *Jvm) RegisterNative(className, name, methodDescriptor string, native Native) {
+	key := nativeKey(className, name, methodDescriptor)
+	jvm.natives[key] = native
+	jvm.overrides[key] = true
+}
+
+// replacesCode tells whether the native of a method with code runs instead
+// of it. The natives of the embedded class library don't replace the code
+// of the class library of a JDK, the ones added to the Jvm always do
+func (jvm *Jvm) replacesCode(className, name, methodDescriptor string) bool {
+	return !jvm.hasJDK() || jvm.overrides[nativeKey(className, name, methodDescriptor)] || jvm.overrides[nativeKey(className, name, "")]
+}
+
+func (jvm *Jvm) findNative(className, name, methodDescriptor string) Native {
+	if native, ok := jvm.natives[nativeKey(className, name, methodDescriptor)]; ok {
+		return native
+	}
+	return jvm.natives[nativeKey(className, name, "")]
+}
+
+// callNativeMethod runs a native. Its arguments stay alive while it runs
+// and the object it returns is allocated in the heap
+func (jvm *Jvm) callNativeMethod(native Native, call *NativeCall) (StackData, error) {
+	t := jvm.thread
+	depth := len(t.handles)
+	t.handles = append(t.handles, call.Args...)
+	defer func() { t.handles = t.handles[:depth] }()
+	result, err := native(call)
+	if err != nil {
+		return StackData{}, err
+	}
+	if reference, ok := heapReference(result); ok {
+		if err := jvm.allocate(reference); err != nil {
+			return StackData{}, err
+		}
+	}
+	return result, nil
+}
+
+// callNative runs the native method name of the first class of classNames
+// registering one, ok is false if none does
+func (jvm *Jvm) callNative(classNames []string, name, methodDescriptor string, args []StackData) (result StackData, ok bool, err error) {
+	for _, className := range classNames {
+		if native := jvm.findNative(className, name, methodDescriptor); native != nil {
+			result, err = jvm.callNativeMethod(native, &NativeCall{Jvm: jvm, Class: className, Name: name, Descriptor: methodDescriptor, Args: args})
+			return result, true, err
+		}
+	}
+	return StackData{}, false, nil
+}
+
+// classChain returns name followed by the names of its super classes, as
+// far as they are loaded
+func (jvm *Jvm) classChain(name string) []string {
+	names := []string{name}
+	for class := jvm.Classes[name]; class != nil && class.SuperName() != ""; class = jvm.Classes[class.SuperName()] {
+		names = append(names, class.SuperName())
+	}
+	return names
+}
@@ -0,0 +1,106 @@
+package jvm
+
+import (
+	"fmt"
+	"testing"
+)
+
+// defineNatives defines Natives, with the native mix, call which passes it
+// a long, an int, a double and a long, and answer, whose code returns 1
+func defineNatives(t *testing.T) (*Jvm, *JavaClass) {
+	t.Helper()
+	jvm, err := NewJvm(buildProgram(t, func(p programBuilder) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	natives := newClassBuilder("Natives", "java/lang/Object", AccPublic|AccSuper)
+	natives.addNativeMethod(AccPublic|AccStatic, "mix", "(JIDJ)Ljava/lang/String;")
+	call := natives.addMethod(AccPublic|AccStatic, "call", "()Ljava/lang/String;")
+	call.maxStack = 7
+	call.op(OpLconst1)
+	call.op(OpIconst2)
+	call.op(OpDconst1)
+	call.op(OpLconst0)
+	call.op(OpInvokestatic, natives.methodRef("Natives", "mix", "(JIDJ)Ljava/lang/String;", false))
+	call.op(OpAreturn)
+	answer := natives.addMethod(AccPublic|AccStatic, "answer", "()I")
+	answer.maxStack = 1
+	answer.op(OpIconst1)
+	answer.op(OpIreturn)
+	class, err := natives.Define(jvm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jvm, class
+}
+
+func invokeStatic(t *testing.T, jvm *Jvm, class *JavaClass, name, methodDescriptor string) (StackData, error) {
+	t.Helper()
+	owner, method := jvm.findMethod(class, name, methodDescriptor)
+	if method == nil {
+		t.Fatalf("no method %s%s", name, methodDescriptor)
+	}
+	return jvm.Invoke(owner, method, nil)
+}
+
+func TestNativeArguments(t *testing.T) {
+	jvm, class := defineNatives(t)
+	jvm.RegisterNative("Natives", "mix", "(JIDJ)Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		if len(call.Args) != 4 {
+			return StackData{}, fmt.Errorf("%d arguments, want one per parameter", len(call.Args))
+		}
+		for i, want := range []StackType{StackTypeLong, StackTypeInt, StackTypeDouble, StackTypeLong} {
+			if call.Args[i].Type != want {
+				return StackData{}, fmt.Errorf("argument %d has type %v, want %v", i, call.Args[i].Type, want)
+			}
+		}
+		s := fmt.Sprintf("%s.%s%s %d %d %g %d", call.Class, call.Name, call.Descriptor, call.Long(0), call.Int(1), call.Double(2), call.Long(3))
+		return referenceValue(NewString(s)), nil
+	})
+	result, err := invokeStatic(t, jvm, class, "call", "()Ljava/lang/String;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResult(t, result, "Natives.mix(JIDJ)Ljava/lang/String; 1 2 1 0")
+}
+
+func TestMissingNative(t *testing.T) {
+	jvm, class := defineNatives(t)
+	tests := []struct {
+		name, descriptor string
+		args             []StackData
+	}{
+		{"mix", "(JIDJ)Ljava/lang/String;", []StackData{longValue(1), intValue(2), doubleValue(1), longValue(0)}},
+		// From bytecode
+		{"call", "()Ljava/lang/String;", nil},
+	}
+	for _, test := range tests {
+		owner, method := jvm.findMethod(class, test.name, test.descriptor)
+		_, err := jvm.Invoke(owner, method, test.args)
+		if want := "java.lang.UnsatisfiedLinkError: Natives.mix(JIDJ)Ljava/lang/String;"; err == nil || err.Error() != want {
+			t.Errorf("%s: error = %v, want %s", test.name, err, want)
+		}
+	}
+}
+
+func TestNativeOverrides(t *testing.T) {
+	jvm, class := defineNatives(t)
+	other, otherClass := defineNatives(t)
+	jvm.RegisterNative("Natives", "answer", "()I", func(call *NativeCall) (StackData, error) {
+		return intValue(42), nil
+	})
+	result, err := invokeStatic(t, jvm, class, "answer", "()I")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResult(t, result, int32(42))
+	// The native is added to one Jvm only
+	result, err = invokeStatic(t, other, otherClass, "answer", "()I")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResult(t, result, int32(1))
+	if _, err := invokeStatic(t, other, otherClass, "call", "()Ljava/lang/String;"); err == nil {
+		t.Error("the native of another Jvm was called")
+	}
+}
@@ -0,0 +1,334 @@
+package jvm
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// Header starts every object and array, and every value of the vm's own
+// reference types like strings. Its mark word holds the identity hash code
+// and the lock state
+type Header struct {
+	mark atomic.Uint64
+}
+
+// Layout of the mark word. It is the one of HotSpot on 64 bit platforms, a
+// 31 bit identity hash above the lock bits, except that 0 is the unlocked
+// state so a zero header needs no initialization. The garbage collector
+// keeps its bits where HotSpot keeps the age of objects
+const (
+	markLockMask  = 0x3
+	markHashShift = 8
+	markHashMask  = 0x7FFFFFFF
+	// The object is accounted for in the heap
+	markAllocated = 1 << 2
+	// The collection running reached the object
+	markMarked = 1 << 3
+)
+
+func (h *Header) header() *Header {
+	return h
+}
+
+// hasBits tells whether every one of bits is set in the mark word
+func (h *Header) hasBits(bits uint64) bool {
+	return h.mark.Load()&bits == bits
+}
+
+// setBits sets bits in the mark word and tells whether they were all set
+// before, keeping the bits other threads change meanwhile
+func (h *Header) setBits(bits uint64) bool {
+	for {
+		mark := h.mark.Load()
+		if mark&bits == bits || h.mark.CompareAndSwap(mark, mark|bits) {
+			return mark&bits == bits
+		}
+	}
+}
+
+// clearBits clears bits in the mark word
+func (h *Header) clearBits(bits uint64) {
+	for {
+		mark := h.mark.Load()
+		if mark&bits == 0 || h.mark.CompareAndSwap(mark, mark&^bits) {
+			return
+		}
+	}
+}
+
+// headed is implemented by the reference types with a Header
+type headed interface {
+	header() *Header
+}
+
+// fieldStore holds the instance fields the class library declares on the
+// vm's own reference types, like the ones java.lang.Class caches its name
+// and reflection data in. The map is made by the first write
+type fieldStore struct {
+	fields map[string]StackData
+}
+
+// field reads a field keyed by declaring class and field name, unset fields
+// hold the zero value of their descriptor
+func (s *fieldStore) field(key, fieldDescriptor string) StackData {
+	if value, ok := s.fields[key]; ok {
+		return value
+	}
+	return zeroValue(fieldDescriptor)
+}
+
+// setField writes a field keyed by declaring class and field name
+func (s *fieldStore) setField(key string, value StackData) {
+	if s.fields == nil {
+		s.fields = map[string]StackData{}
+	}
+	s.fields[key] = value
+}
+
+func (s *fieldStore) store() *fieldStore {
+	return s
+}
+
+// fieldHolder is implemented by the reference types with a fieldStore
+type fieldHolder interface {
+	store() *fieldStore
+}
+
+// Object is an instance of a class loaded by the vm
+type Object struct {
+	Header
+	// The class pointer
+	Class *JavaClass
+	// Instance fields keyed by declaring class and field name
+	Fields map[string]StackData
+}
+
+// Array is a Java array, Descriptor is the array type like [I or
+// [Ljava/lang/String; and the class pointer of the array. Its length is
+// the one of Elements
+type Array struct {
+	Header
+	Descriptor string
+	Elements   []StackData
+}
+
+// Length returns the length of the array
+func (a *Array) Length() int32 {
+	return int32(len(a.Elements))
+}
+
+// ComponentDescriptor returns the descriptor of the elements of the array
+func (a *Array) ComponentDescriptor() string {
+	return a.Descriptor[1:]
+}
+
+// zeroValue returns the default value of a field or array element of the
+// given descriptor
+func zeroValue(fieldDescriptor string) StackData {
+	switch fieldDescriptor[0] {
+	case 'J':
+		return StackData{Type: StackTypeLong, Data: int64(0)}
+	case 'F':
+		return StackData{Type: StackTypeFloat, Data: float32(0)}
+	case 'D':
+		return StackData{Type: StackTypeDouble, Data: float64(0)}
+	case 'L', '[':
+		return nullReference
+	default:
+		return StackData{Type: StackTypeInt, Data: int32(0)}
+	}
+}
+
+var nullReference = StackData{Type: StackTypeReference, Data: nil}
+
+// NewObject allocates an instance of class with every instance field,
+// including the inherited ones, set to its default value
+func (jvm *Jvm) NewObject(class *JavaClass) *Object {
+	object := &Object{Class: class, Fields: map[string]StackData{}}
+	for c := class; c != nil; c = jvm.Classes[c.SuperName()] {
+		for _, f := range c.Fields {
+			if f.AccessFlags&AccStatic == 0 {
+				object.Fields[c.Name()+"."+f.Name] = zeroValue(f.Descriptor)
+			}
+		}
+	}
+	return object
+}
+
+// NewArray allocates an array of the given type with every element set to
+// its default value
+func NewArray(arrayDescriptor string, length int) *Array {
+	array := &Array{Descriptor: arrayDescriptor, Elements: make([]StackData, length)}
+	zero := zeroValue(arrayDescriptor[1:])
+	for i := range array.Elements {
+		array.Elements[i] = zero
+	}
+	return array
+}
+
+// identityHash returns the identity hash code of a reference. It is
+// generated when first asked for and kept in the header, so it never
+// changes, whatever the garbage collector does
+func (jvm *Jvm) identityHash(reference interface{}) int32 {
+	h, ok := reference.(headed)
+	if !ok {
+		return 0
+	}
+	for {
+		mark := h.header().mark.Load()
+		if hash := mark >> markHashShift & markHashMask; hash != 0 {
+			return int32(hash)
+		}
+		hash := jvm.nextHash()
+		// A racing thread may have set the hash or the lock bits
+		if h.header().mark.CompareAndSwap(mark, mark|hash<<markHashShift) {
+			return int32(hash)
+		}
+	}
+}
+
+// nextHash returns a new identity hash code from the Marsaglia xor-shift
+// generator HotSpot uses, never 0
+func (jvm *Jvm) nextHash() uint64 {
+	state := &jvm.hashState
+	if *state == [4]uint32{} {
+		*state = [4]uint32{rand.Uint32(), 842502087, 0x8767, 273326509}
+	}
+	t := state[0]
+	t ^= t << 11
+	state[0], state[1], state[2] = state[1], state[2], state[3]
+	v := state[3]
+	v = v ^ v>>19 ^ (t ^ t>>8)
+	state[3] = v
+	if hash := uint64(v) & markHashMask; hash != 0 {
+		return hash
+	}
+	return 0xBAD
+}
+
+// identityString formats a reference the way Object.toString does with
+// the given hash code
+func identityString(reference interface{}, hash int32) string {
+	var className string
+	switch r := reference.(type) {
+	case *Object:
+		className = r.Class.Name()
+	case *Array:
+		className = r.Descriptor
+	default:
+		className = fmt.Sprintf("%T", r)
+	}
+	return strings.ReplaceAll(className, "/", ".") + "@" + strconv.FormatUint(uint64(uint32(hash)), 16)
+}
+
+// ClassMirror is the java.lang.Class instance of a type
+type ClassMirror struct {
+	Header
+	// Field descriptor of the type, like I, [J or Ljava/lang/String;
+	Descriptor string
+	// Loaded class of an object type, nil for primitives, arrays and types
+	// whose class failed to load
+	Class *JavaClass
+	fieldStore
+}
+
+// Type returns the type the mirror stands for
+func (c *ClassMirror) Type() descriptor.Type {
+	t, _ := descriptor.ParseField(c.Descriptor)
+	return t
+}
+
+// Name returns the name the way Class.getName does, like int, [I or
+// java.lang.String
+func (c *ClassMirror) Name() string {
+	switch t := c.Type().(type) {
+	case *descriptor.ObjectType:
+		return t.String()
+	case *descriptor.ArrayType:
+		return strings.ReplaceAll(c.Descriptor, "/", ".")
+	}
+	return c.Type().String()
+}
+
+func (c *ClassMirror) String() string {
+	switch {
+	case len(c.Descriptor) == 1:
+		return c.Name()
+	case c.Class != nil && c.Class.AccessFlags&AccInterface != 0:
+		return "interface " + c.Name()
+	}
+	return "class " + c.Name()
+}
+
+// Mirror returns the unique Class instance of the type with the given field
+// descriptor
+func (jvm *Jvm) Mirror(fieldDescriptor string) *ClassMirror {
+	if mirror, ok := jvm.mirrors[fieldDescriptor]; ok {
+		return mirror
+	}
+	mirror := &ClassMirror{Descriptor: fieldDescriptor}
+	if fieldDescriptor[0] == 'L' {
+		mirror.Class, _ = jvm.LoadClass(fieldDescriptor[1 : len(fieldDescriptor)-1])
+	}
+	jvm.mirrors[fieldDescriptor] = mirror
+	return mirror
+}
+
+func init() {
+	RegisterNative("java/lang/Object", "<init>", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, nil
+	})
+	RegisterNative("java/lang/Object", "hashCode", "()I", func(call *NativeCall) (StackData, error) {
+		return intValue(call.Jvm.identityHash(call.Reference(0))), nil
+	})
+	RegisterNative("java/lang/Object", "equals", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(sameReference(call.Args[0], call.Args[1])), nil
+	})
+	RegisterNative("java/lang/Object", "getClass", "()Ljava/lang/Class;", func(call *NativeCall) (StackData, error) {
+		name := call.Jvm.referenceClassName(call.Args[0])
+		if name[0] != '[' {
+			name = "L" + name + ";"
+		}
+		return referenceValue(call.Jvm.Mirror(name)), nil
+	})
+	RegisterNative("java/lang/Object", "clone", "()Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		// A shallow copy with a new header
+		switch original := call.Reference(0).(type) {
+		case *Array:
+			return referenceValue(&Array{Descriptor: original.Descriptor, Elements: slices.Clone(original.Elements)}), nil
+		case *Object:
+			if call.Jvm.isSubclass(original.Class, "java/lang/Cloneable") {
+				return referenceValue(&Object{Class: original.Class, Fields: maps.Clone(original.Fields)}), nil
+			}
+		}
+		return StackData{}, throwable("java/lang/CloneNotSupportedException", "%s", strings.ReplaceAll(call.Jvm.referenceClassName(call.Args[0]), "/", "."))
+	})
+	RegisterNative("java/lang/Object", "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		// The vm's own types format themselves
+		if s, ok := call.Reference(0).(fmt.Stringer); ok {
+			return referenceValue(NewString(s.String())), nil
+		}
+		hash, err := call.Jvm.InvokeVirtual("java/lang/Object", "hashCode", "()I", call.Args[:1])
+		if err != nil {
+			return StackData{}, err
+		}
+		return referenceValue(NewString(identityString(call.Reference(0), hash.Int()))), nil
+	})
+	RegisterNative("java/lang/Class", "getName", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.internString(call.Reference(0).(*ClassMirror).Name())), nil
+	})
+	RegisterNative("java/lang/Class", "getSimpleName", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		name := call.Reference(0).(*ClassMirror).Name()
+		if t, ok := call.Reference(0).(*ClassMirror).Type().(*descriptor.ArrayType); ok {
+			name = t.String()
+		}
+		return referenceValue(NewString(name[strings.LastIndexAny(name, ".$")+1:])), nil
+	})
+}
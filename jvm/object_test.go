@@ -0,0 +1,109 @@
+package jvm
+
+import "testing"
+
+func TestIdentityHash(t *testing.T) {
+	jvm, err := NewJvm(buildProgram(t, func(p programBuilder) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	array := NewArray("[I", 4)
+	if err := jvm.allocate(array); err != nil {
+		t.Fatal(err)
+	}
+	handle := jvm.NewHandle(referenceValue(array))
+	defer jvm.DeleteHandle(handle)
+	hashCode := func() int32 {
+		t.Helper()
+		hash, err := jvm.InvokeVirtual("java/lang/Object", "hashCode", "()I", []StackData{referenceValue(array)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash.Int()
+	}
+	hash := hashCode()
+	if hash == 0 {
+		t.Error("identity hash is 0")
+	}
+	// The collector and the lock bits share the header with the hash
+	for i := 0; i < 3; i++ {
+		if err := jvm.GC(); err != nil {
+			t.Fatal(err)
+		}
+		if got := hashCode(); got != hash {
+			t.Fatalf("hash after collection %d = %d, want %d", i+1, got, hash)
+		}
+	}
+	jvm.monitorEnter(array)
+	if got := hashCode(); got != hash {
+		t.Errorf("hash while locked = %d, want %d", got, hash)
+	}
+	if err := jvm.monitorExit(array); err != nil {
+		t.Fatal(err)
+	}
+	if got := hashCode(); got != hash {
+		t.Errorf("hash after unlocking = %d, want %d", got, hash)
+	}
+}
+
+func TestClone(t *testing.T) {
+	jvm, err := NewJvm(buildProgram(t, func(p programBuilder) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := newClassBuilder("Point", "java/lang/Object", AccPublic|AccSuper)
+	point.interfaces = []string{"java/lang/Cloneable"}
+	point.addField(AccPublic, "x", "I")
+	pointClass, err := point.Define(jvm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := newClassBuilder("Plain", "java/lang/Object", AccPublic|AccSuper)
+	plainClass, err := plain.Define(jvm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := func(reference interface{}) (interface{}, error) {
+		result, err := jvm.InvokeVirtual("java/lang/Object", "clone", "()Ljava/lang/Object;", []StackData{referenceValue(reference)})
+		return result.Data, err
+	}
+
+	element := jvm.NewObject(pointClass)
+	array := NewArray("[Ljava/lang/Object;", 2)
+	array.Elements[0] = referenceValue(element)
+	copied, err := clone(array)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arrayCopy, ok := copied.(*Array)
+	if !ok || arrayCopy == array || arrayCopy.Descriptor != array.Descriptor || len(arrayCopy.Elements) != 2 {
+		t.Fatalf("clone of the array = %v", copied)
+	}
+	// Shallow: the elements are the same objects, the arrays are distinct
+	if arrayCopy.Elements[0].Data != element || arrayCopy.Elements[1].Data != nil {
+		t.Errorf("cloned elements = %v, want the original ones", arrayCopy.Elements)
+	}
+	arrayCopy.Elements[1] = referenceValue(element)
+	if array.Elements[1].Data != nil {
+		t.Error("storing in the clone changed the original array")
+	}
+
+	element.Fields["Point.x"] = intValue(3)
+	copied, err = clone(element)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objectCopy, ok := copied.(*Object)
+	if !ok || objectCopy == element || objectCopy.Class != pointClass || objectCopy.Fields["Point.x"].Int() != 3 {
+		t.Fatalf("clone of the Cloneable object = %v", copied)
+	}
+	objectCopy.Fields["Point.x"] = intValue(4)
+	if element.Fields["Point.x"].Int() != 3 {
+		t.Error("setting a field of the clone changed the original object")
+	}
+
+	_, err = clone(jvm.NewObject(plainClass))
+	if want := "java.lang.CloneNotSupportedException: Plain"; err == nil || err.Error() != want {
+		t.Errorf("clone of a class not Cloneable: error = %v, want %s", err, want)
+	}
+}
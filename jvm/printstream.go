@@ -0,0 +1,274 @@
+package jvm
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+const (
+	printStreamFd        = "java/io/PrintStream.fd"
+	printStreamOut       = "java/io/PrintStream.out"
+	printStreamAutoFlush = "java/io/PrintStream.autoFlush"
+	printStreamTrouble   = "java/io/PrintStream.trouble"
+
+	// Size of the buffers of the standard streams
+	standardBufferSize = 8192
+)
+
+// standardOutput returns the buffer of file descriptor 1 or 2, created in
+// front of Stdout or Stderr when first written
+func (jvm *Jvm) standardOutput(fd int32) *bufio.Writer {
+	if jvm.outputs == nil {
+		jvm.outputs = map[int32]*bufio.Writer{}
+	}
+	output, ok := jvm.outputs[fd]
+	if !ok {
+		if fd == 2 {
+			output = bufio.NewWriterSize(jvm.Stderr, standardBufferSize)
+		} else {
+			output = bufio.NewWriterSize(jvm.Stdout, standardBufferSize)
+		}
+		jvm.outputs[fd] = output
+	}
+	return output
+}
+
+// Flush writes what the standard streams of the program hold in their
+// buffers to Stdout and Stderr
+func (jvm *Jvm) Flush() error {
+	var errs []error
+	for _, fd := range []int32{1, 2} {
+		if output, ok := jvm.outputs[fd]; ok {
+			errs = append(errs, output.Flush())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeStream writes s to a PrintStream: to the OutputStream it wraps or
+// to the standard stream of its file descriptor. An I/O error sets the
+// trouble flag checkError reports instead of being thrown. flush forces
+// an autoflush stream to flush, it otherwise flushes on newlines
+func (jvm *Jvm) writeStream(stream *Object, s string, flush bool) error {
+	out := stream.Fields[printStreamOut]
+	autoFlush := stream.Fields[printStreamAutoFlush].Int() != 0 && (flush || strings.Contains(s, "\n"))
+	if out.IsNull() {
+		output := jvm.standardOutput(stream.Fields[printStreamFd].Int())
+		_, err := output.WriteString(s)
+		if err == nil && autoFlush {
+			err = output.Flush()
+		}
+		if err != nil {
+			stream.Fields[printStreamTrouble] = booleanValue(true)
+		}
+		return nil
+	}
+	var err error
+	if s != "" {
+		bytes := byteArray([]byte(s))
+		_, err = jvm.InvokeVirtual("java/io/OutputStream", "write", "([BII)V", []StackData{out, referenceValue(bytes), intValue(0), intValue(int32(len(bytes.Elements)))})
+	}
+	if err == nil && autoFlush {
+		_, err = jvm.InvokeVirtual("java/io/OutputStream", "flush", "()V", []StackData{out})
+	}
+	var thrown *JavaThrowable
+	if errors.As(err, &thrown) && jvm.isIOException(thrown) {
+		stream.Fields[printStreamTrouble] = booleanValue(true)
+		return nil
+	}
+	return err
+}
+
+// isIOException tells whether a thrown exception is an IOException, which
+// a PrintStream swallows
+func (jvm *Jvm) isIOException(thrown *JavaThrowable) bool {
+	if thrown.Object != nil {
+		return jvm.isSubclass(thrown.Object.Class, "java/io/IOException")
+	}
+	return thrown.ClassName == "java/io/IOException"
+}
+
+// byteArray returns a byte[] holding b
+func byteArray(b []byte) *Array {
+	array := NewArray("[B", len(b))
+	for i, v := range b {
+		array.Elements[i] = intValue(int32(int8(v)))
+	}
+	return array
+}
+
+// systemStream returns System.out or System.err
+func (jvm *Jvm) systemStream(name string) (*Object, error) {
+	system, err := jvm.LoadClass("java/lang/System")
+	if err != nil {
+		return nil, err
+	}
+	if err := jvm.InitializeClass(system); err != nil {
+		return nil, err
+	}
+	stream, _ := jvm.StaticFields["java/lang/System."+name].Data.(*Object)
+	if stream == nil {
+		return nil, throwable("java/lang/NullPointerException", "Cannot invoke \"java.io.PrintStream.println()\" because \"java.lang.System.%s\" is null", name)
+	}
+	return stream, nil
+}
+
+// printValue writes the argument of a print or println call to the stream
+func printValue(call *NativeCall) (StackData, error) {
+	var output string
+	if len(call.Args) == 2 {
+		methodType, err := descriptor.ParseMethod(call.Descriptor)
+		if err != nil {
+			return StackData{}, err
+		}
+		if methodType.Params[0].Descriptor() == "[C" && call.Args[1].IsNull() {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		if output, err = call.Jvm.javaString(call.Args[1], methodType.Params[0]); err != nil {
+			return StackData{}, err
+		}
+	}
+	if call.Name == "println" {
+		output += "\n"
+	}
+	return StackData{}, call.Jvm.writeStream(call.Object(0), output, false)
+}
+
+// formatValues writes the output of a printf or format call to the stream
+// and returns the stream
+func formatValues(call *NativeCall) (StackData, error) {
+	formatIndex := 1
+	if strings.HasPrefix(call.Descriptor, "(Ljava/util/Locale;") {
+		formatIndex = 2
+	}
+	if call.Args[formatIndex].IsNull() {
+		return StackData{}, throwable("java/lang/NullPointerException", "")
+	}
+	var args []StackData
+	if array, ok := call.Reference(formatIndex + 1).(*Array); ok {
+		args = array.Elements
+	}
+	s, err := call.Jvm.formatString(call.GoString(formatIndex), args)
+	if err != nil {
+		return StackData{}, err
+	}
+	return call.Args[0], call.Jvm.writeStream(call.Object(0), s, false)
+}
+
+func init() {
+	const streamClass = "java/io/PrintStream"
+	construct := func(call *NativeCall) (StackData, error) {
+		if call.Args[1].IsNull() {
+			return StackData{}, throwable("java/lang/NullPointerException", "Null output stream")
+		}
+		stream := call.Object(0)
+		stream.Fields[printStreamOut] = call.Args[1]
+		if len(call.Args) == 3 {
+			stream.Fields[printStreamAutoFlush] = call.Args[2]
+		}
+		return StackData{}, nil
+	}
+	RegisterNative(streamClass, "<init>", "(Ljava/io/OutputStream;)V", construct)
+	RegisterNative(streamClass, "<init>", "(Ljava/io/OutputStream;Z)V", construct)
+
+	for _, param := range []string{"", "Z", "C", "I", "J", "F", "D", "[C", "Ljava/lang/String;", "Ljava/lang/Object;"} {
+		if param != "" {
+			RegisterNative(streamClass, "print", "("+param+")V", printValue)
+		}
+		RegisterNative(streamClass, "println", "("+param+")V", printValue)
+	}
+	for _, name := range []string{"printf", "format"} {
+		RegisterNative(streamClass, name, "(Ljava/lang/String;[Ljava/lang/Object;)Ljava/io/PrintStream;", formatValues)
+		RegisterNative(streamClass, name, "(Ljava/util/Locale;Ljava/lang/String;[Ljava/lang/Object;)Ljava/io/PrintStream;", formatValues)
+	}
+	appendValue := func(call *NativeCall) (StackData, error) {
+		var s *String
+		var err error
+		if call.Descriptor == "(C)Ljava/io/PrintStream;" {
+			s, err = call.Jvm.toJavaString(call.Args[1], descriptor.Char)
+		} else {
+			s, err = call.Jvm.toJavaString(call.Args[1], objectType)
+		}
+		if err != nil {
+			return StackData{}, err
+		}
+		return call.Args[0], call.Jvm.writeStream(call.Object(0), s.String(), false)
+	}
+	RegisterNative(streamClass, "append", "(C)Ljava/io/PrintStream;", appendValue)
+	RegisterNative(streamClass, "append", "(Ljava/lang/CharSequence;)Ljava/io/PrintStream;", appendValue)
+	RegisterNative(streamClass, "write", "(I)V", func(call *NativeCall) (StackData, error) {
+		b := byte(call.Int(1))
+		return StackData{}, call.Jvm.writeStream(call.Object(0), string([]byte{b}), b == '\n')
+	})
+	write := func(call *NativeCall) (StackData, error) {
+		array, ok := call.Reference(1).(*Array)
+		if !ok {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		offset, length := 0, len(array.Elements)
+		if len(call.Args) == 4 {
+			offset, length = int(call.Int(2)), int(call.Int(3))
+		}
+		if offset < 0 || length < 0 || offset+length > len(array.Elements) {
+			return StackData{}, throwable("java/lang/IndexOutOfBoundsException", "Range [%d, %d + %d) out of bounds for length %d", offset, offset, length, len(array.Elements))
+		}
+		b := make([]byte, length)
+		for i := range b {
+			b[i] = byte(array.Elements[offset+i].Int())
+		}
+		return StackData{}, call.Jvm.writeStream(call.Object(0), string(b), true)
+	}
+	RegisterNative(streamClass, "write", "([B)V", write)
+	RegisterNative(streamClass, "write", "([BII)V", write)
+	RegisterNative(streamClass, "flush", "()V", func(call *NativeCall) (StackData, error) {
+		stream := call.Object(0)
+		if stream.Fields[printStreamOut].IsNull() {
+			if err := call.Jvm.standardOutput(stream.Fields[printStreamFd].Int()).Flush(); err != nil {
+				stream.Fields[printStreamTrouble] = booleanValue(true)
+			}
+			return StackData{}, nil
+		}
+		_, err := call.Jvm.InvokeVirtual("java/io/OutputStream", "flush", "()V", []StackData{stream.Fields[printStreamOut]})
+		return StackData{}, err
+	})
+	RegisterNative(streamClass, "close", "()V", func(call *NativeCall) (StackData, error) {
+		return call.Jvm.InvokeVirtual(streamClass, "flush", "()V", call.Args[:1])
+	})
+	RegisterNative(streamClass, "checkError", "()Z", func(call *NativeCall) (StackData, error) {
+		if _, err := call.Jvm.InvokeVirtual(streamClass, "flush", "()V", call.Args[:1]); err != nil {
+			return StackData{}, err
+		}
+		return call.Object(0).Fields[printStreamTrouble], nil
+	})
+
+	// The bytes of an OutputStream go to write(int) unless a subclass writes
+	// arrays itself
+	const outputClass = "java/io/OutputStream"
+	writeBytes := func(call *NativeCall) (StackData, error) {
+		array, ok := call.Reference(1).(*Array)
+		if !ok {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		offset, length := 0, len(array.Elements)
+		if len(call.Args) == 4 {
+			offset, length = int(call.Int(2)), int(call.Int(3))
+		}
+		if offset < 0 || length < 0 || offset+length > len(array.Elements) {
+			return StackData{}, throwable("java/lang/IndexOutOfBoundsException", "Range [%d, %d + %d) out of bounds for length %d", offset, offset, length, len(array.Elements))
+		}
+		for _, b := range array.Elements[offset : offset+length] {
+			if _, err := call.Jvm.InvokeVirtual(outputClass, "write", "(I)V", []StackData{call.Args[0], b}); err != nil {
+				return StackData{}, err
+			}
+		}
+		return StackData{}, nil
+	}
+	RegisterNative(outputClass, "write", "([B)V", writeBytes)
+	RegisterNative(outputClass, "write", "([BII)V", writeBytes)
+	RegisterNative(outputClass, "flush", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, nil
+	})
+}
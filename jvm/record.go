@@ -0,0 +1,115 @@
+package jvm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+
+	"github.com/Stolkerve/go-jvm/jvm/signature"
+)
+
+// Record classes (JVMS §4.7.30)
+
+type RecordComponent struct {
+	NameIndex       uint16
+	Name            string
+	DescriptorIndex uint16
+	Descriptor      string
+	// Signature, annotations and type annotations of the component
+	Attributes []*AttributeInfo
+}
+
+type RecordAttribute []RecordComponent
+
+// readNestedAttributes reads a u2 count followed by that many attributes
+func readNestedAttributes(constantPool []*ConstantInfo, r *attributeReader) ([]*AttributeInfo, error) {
+	count, err := r.u2()
+	if err != nil {
+		return nil, err
+	}
+	attributes := make([]*AttributeInfo, count)
+	for i := range attributes {
+		start := r.offset
+		if _, err := r.u2(); err != nil {
+			return nil, err
+		}
+		length, err := r.u4()
+		if err != nil {
+			return nil, err
+		}
+		if r.offset+int(length) > len(r.info) {
+			return nil, fmt.Errorf("truncated attribute")
+		}
+		r.offset += int(length)
+		attrBuff := bufio.NewReader(bytes.NewBuffer(r.info[start:r.offset]))
+		if attributes[i], err = ReadAttribute(constantPool, attrBuff, make([]byte, 4)); err != nil {
+			return nil, err
+		}
+	}
+	return attributes, nil
+}
+
+func ReadRecord(constantPool []*ConstantInfo, info []byte) (RecordAttribute, error) {
+	r := &attributeReader{info: info}
+	count, err := r.u2()
+	if err != nil {
+		return nil, err
+	}
+	record := make(RecordAttribute, count)
+	for i := range record {
+		component := &record[i]
+		if component.NameIndex, component.Name, err = r.utf8(constantPool); err != nil {
+			return nil, err
+		}
+		if component.DescriptorIndex, component.Descriptor, err = r.utf8(constantPool); err != nil {
+			return nil, err
+		}
+		if component.Attributes, err = readNestedAttributes(constantPool, r); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// Signature returns the generic type of the component, nil if it has none
+func (rc *RecordComponent) Signature() (signature.ReferenceTypeSignature, error) {
+	attr := FindAttribute(rc.Attributes, SignatureAttr)
+	if attr == nil {
+		return nil, nil
+	}
+	return signature.ParseField(attr.Data.(SignatureAttribute).Signature)
+}
+
+func (rc *RecordComponent) Annotations() []Annotation {
+	return annotationsOf(rc.Attributes, RuntimeVisibleAnnotationsAttr)
+}
+
+func (rc *RecordComponent) TypeAnnotations() []TypeAnnotation {
+	return typeAnnotationsOf(rc.Attributes, RuntimeVisibleTypeAnnotationsAttr)
+}
+
+// Accessor returns the public accessor method of the component declared by
+// class, nil if it can't be found
+func (rc *RecordComponent) Accessor(class *JavaClass) *MethodInfo {
+	for _, m := range class.Methods {
+		if m.Name == rc.Name && m.Descriptor == "()"+rc.Descriptor && AccessFlag(m.AccessFlags)&AccStatic == 0 {
+			return m
+		}
+	}
+	return nil
+}
+
+// IsRecord reports whether the class is a record class, it must extend
+// java/lang/Record and carry a Record attribute
+func (c *JavaClass) IsRecord() bool {
+	return c.SuperName() == "java/lang/Record" && FindAttribute(c.Attributes, RecordAttr) != nil
+}
+
+// RecordComponents returns the components of a record class in declaration
+// order, nil for any other class
+func (c *JavaClass) RecordComponents() RecordAttribute {
+	if !c.IsRecord() {
+		return nil
+	}
+	return FindAttribute(c.Attributes, RecordAttr).Data.(RecordAttribute)
+}
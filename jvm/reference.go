@@ -0,0 +1,415 @@
+package jvm
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	referenceReferent = "java/lang/ref/Reference.referent"
+	referenceQueue    = "java/lang/ref/Reference.queue"
+	referenceNext     = "java/lang/ref/Reference.next"
+	softTimestamp     = "java/lang/ref/SoftReference.timestamp"
+	queueHead         = "java/lang/ref/ReferenceQueue.head"
+	queueLength       = "java/lang/ref/ReferenceQueue.queueLength"
+	// The queue of the references in a queue
+	queueEnqueued    = "java/lang/ref/ReferenceQueue.ENQUEUED"
+	cleanerQueue     = "java/lang/ref/Cleaner.queue"
+	cleanerList      = "java/lang/ref/Cleaner.list"
+	cleanableAction  = "jdk/internal/ref/PhantomCleanable.action"
+	cleanableCleaner = "jdk/internal/ref/PhantomCleanable.cleaner"
+	cleanablePrev    = "jdk/internal/ref/PhantomCleanable.prev"
+	cleanableNext    = "jdk/internal/ref/PhantomCleanable.next"
+)
+
+// referenceKind is the strength of the instances of a class extending
+// java.lang.ref.Reference
+type referenceKind int
+
+const (
+	referenceNone referenceKind = iota
+	referenceSoft
+	referenceWeak
+	referencePhantom
+)
+
+// referenceKindOf returns the strength of the references class creates,
+// referenceNone for classes which don't extend Reference
+func (jvm *Jvm) referenceKindOf(class *JavaClass) referenceKind {
+	kind, ok := jvm.referenceKinds[class]
+	if !ok {
+		switch {
+		case jvm.isSubclass(class, "java/lang/ref/SoftReference"):
+			kind = referenceSoft
+		case jvm.isSubclass(class, "java/lang/ref/WeakReference"):
+			kind = referenceWeak
+		case jvm.isSubclass(class, "java/lang/ref/PhantomReference"):
+			kind = referencePhantom
+		}
+		jvm.referenceKinds[class] = kind
+	}
+	return kind
+}
+
+// discover records a reference met while marking and tells whether its
+// referent is left to processReferences. A soft reference used lately
+// keeps its referent unless the collection clears them all
+func (jvm *Jvm) discover(c *collection, object *Object) bool {
+	kind := jvm.referenceKindOf(object.Class)
+	if kind == referenceNone {
+		return false
+	}
+	if _, ok := heapReference(object.Fields[referenceReferent]); !ok {
+		return false
+	}
+	if kind == referenceSoft && !c.clearSoft {
+		if timestamp, ok := object.Fields[softTimestamp].Data.(int64); ok && jvm.Heap.clock-timestamp <= jvm.Heap.softLifetime {
+			return false
+		}
+	}
+	c.discovered[kind] = append(c.discovered[kind], object)
+	return true
+}
+
+// processReferences clears the references whose referent marking didn't
+// reach, strongest first. The objects with a finalizer found unreachable
+// are marked again until it runs, between weak and phantom references as
+// finalization comes after the first ones and before the others
+func (jvm *Jvm) processReferences(c *collection) {
+	jvm.clearReferences(c, referenceSoft, 0)
+	jvm.clearReferences(c, referenceWeak, 0)
+
+	var resurrected []StackData
+	kept := jvm.finalizable[:0]
+	for _, object := range jvm.finalizable {
+		if object.header().hasBits(markMarked) {
+			kept = append(kept, object)
+			continue
+		}
+		jvm.finalizeQueue = append(jvm.finalizeQueue, object)
+		resurrected = append(resurrected, referenceValue(object))
+	}
+	clear(jvm.finalizable[len(kept):])
+	jvm.finalizable = kept
+	soft, weak := len(c.discovered[referenceSoft]), len(c.discovered[referenceWeak])
+	jvm.mark(c, resurrected)
+	// The references only finalizable objects reach
+	jvm.clearReferences(c, referenceSoft, soft)
+	jvm.clearReferences(c, referenceWeak, weak)
+
+	jvm.clearReferences(c, referencePhantom, 0)
+}
+
+// clearReferences clears the references of a kind discovered from the
+// index from on whose referent isn't marked, and hands the ones with a
+// queue to the reference handler
+func (jvm *Jvm) clearReferences(c *collection, kind referenceKind, from int) {
+	for _, reference := range c.discovered[kind][from:] {
+		referent, ok := heapReference(reference.Fields[referenceReferent])
+		if !ok || referent.header().hasBits(markMarked) {
+			continue
+		}
+		reference.Fields[referenceReferent] = nullReference
+		if !reference.Fields[referenceQueue].IsNull() {
+			jvm.pendingReferences = append(jvm.pendingReferences, reference)
+		}
+	}
+}
+
+// hasFinalizer tells whether the instances of class must be finalized
+// before they are freed, which is when it overrides Object.finalize with
+// a method doing something
+func (jvm *Jvm) hasFinalizer(class *JavaClass) bool {
+	has, ok := jvm.finalizers[class]
+	if ok {
+		return has
+	}
+	for c := class; c != nil && c.Name() != "java/lang/Object"; c = jvm.Classes[c.SuperName()] {
+		if _, method := jvm.findMethod(c, "finalize", "()V"); method != nil && AccessFlag(method.AccessFlags)&AccStatic == 0 {
+			code := method.Code()
+			has = code == nil || len(code.Code) != 1 || Opcode(code.Code[0]) != OpReturn
+			break
+		}
+	}
+	jvm.finalizers[class] = has
+	return has
+}
+
+// runReferenceHandlers does the work the reference handler, finalizer and
+// cleaner threads of the JDK do after a collection: it enqueues the
+// references it cleared, finalizes the objects it found unreachable and
+// runs the actions of the cleanables of cleaners. The exceptions thrown by
+// finalizers and actions are ignored
+func (jvm *Jvm) runReferenceHandlers() error {
+	if jvm.handlingReferences {
+		return nil
+	}
+	jvm.handlingReferences = true
+	defer func() { jvm.handlingReferences = false }()
+
+	ignore := func(err error) error {
+		var thrown *JavaThrowable
+		if errors.As(err, &thrown) {
+			return nil
+		}
+		return err
+	}
+	for len(jvm.pendingReferences) > 0 {
+		reference := jvm.pendingReferences[0]
+		jvm.pendingReferences = jvm.pendingReferences[1:]
+		queue := reference.Fields[referenceQueue]
+		if queue.IsNull() {
+			continue
+		}
+		if _, err := jvm.InvokeVirtual("java/lang/ref/ReferenceQueue", "enqueue", "(Ljava/lang/ref/Reference;)Z", []StackData{queue, referenceValue(reference)}); ignore(err) != nil {
+			return err
+		}
+	}
+	for len(jvm.finalizeQueue) > 0 {
+		object := jvm.finalizeQueue[0]
+		jvm.finalizeQueue = jvm.finalizeQueue[1:]
+		if _, err := jvm.InvokeVirtual("java/lang/Object", "finalize", "()V", []StackData{referenceValue(object)}); ignore(err) != nil {
+			return err
+		}
+	}
+	for _, cleaner := range jvm.cleaners {
+		for {
+			cleanable := pollQueue(cleaner.Fields[cleanerQueue].Data.(*Object))
+			if cleanable == nil {
+				break
+			}
+			if _, err := jvm.InvokeVirtual("java/lang/ref/Cleaner$Cleanable", "clean", "()V", []StackData{referenceValue(cleanable)}); ignore(err) != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enqueue adds a reference to its queue, false if it has none or is
+// already enqueued
+func (jvm *Jvm) enqueue(queue, reference *Object) bool {
+	if reference.Fields[referenceQueue].Data != queue {
+		return false
+	}
+	// The queue is a stack as the one of the JDK is, the last reference
+	// links to itself
+	next := queue.Fields[queueHead]
+	if next.IsNull() {
+		next = referenceValue(reference)
+	}
+	reference.Fields[referenceNext] = next
+	reference.Fields[referenceQueue] = jvm.StaticFields[queueEnqueued]
+	queue.Fields[queueHead] = referenceValue(reference)
+	queue.Fields[queueLength] = longValue(queue.Fields[queueLength].Long() + 1)
+	jvm.wakeAll()
+	return true
+}
+
+// pollQueue removes the reference at the head of a queue, nil if the
+// queue is empty
+func pollQueue(queue *Object) *Object {
+	reference, _ := queue.Fields[queueHead].Data.(*Object)
+	if reference == nil {
+		return nil
+	}
+	next := reference.Fields[referenceNext]
+	if next.Data == reference {
+		next = nullReference
+	}
+	queue.Fields[queueHead] = next
+	queue.Fields[queueLength] = longValue(queue.Fields[queueLength].Long() - 1)
+	reference.Fields[referenceQueue] = nullReference
+	reference.Fields[referenceNext] = referenceValue(reference)
+	return reference
+}
+
+// removeQueue removes the reference at the head of a queue, waiting for one
+// to be enqueued up to timeout, forever if it is 0
+func (jvm *Jvm) removeQueue(queue *Object, timeout time.Duration) (*Object, error) {
+	if err := jvm.runReferenceHandlers(); err != nil {
+		return nil, err
+	}
+	var reference *Object
+	polled := func() bool {
+		reference = pollQueue(queue)
+		return reference != nil
+	}
+	state, until := ThreadWaiting, time.Time{}
+	if timeout > 0 {
+		state, until = ThreadTimedWaiting, time.Now().Add(timeout)
+	}
+	if jvm.park(state, until, true, polled) {
+		return nil, throwable("java/lang/InterruptedException", "")
+	}
+	return reference, nil
+}
+
+// unlinkCleanable removes a cleanable from the list of its cleaner and
+// tells whether it was in it
+func unlinkCleanable(cleanable *Object) bool {
+	cleaner, _ := cleanable.Fields[cleanableCleaner].Data.(*Object)
+	if cleaner == nil {
+		return false
+	}
+	prev, next := cleanable.Fields[cleanablePrev], cleanable.Fields[cleanableNext]
+	if prev.IsNull() {
+		cleaner.Fields[cleanerList] = next
+	} else {
+		prev.Data.(*Object).Fields[cleanableNext] = next
+	}
+	if !next.IsNull() {
+		next.Data.(*Object).Fields[cleanablePrev] = prev
+	}
+	cleanable.Fields[cleanableCleaner] = nullReference
+	cleanable.Fields[cleanablePrev] = nullReference
+	cleanable.Fields[cleanableNext] = nullReference
+	return true
+}
+
+func init() {
+	const referenceClass = "java/lang/ref/Reference"
+	construct := func(call *NativeCall) (StackData, error) {
+		reference := call.Object(0)
+		reference.Fields[referenceReferent] = call.Args[1]
+		if len(call.Args) == 3 {
+			reference.Fields[referenceQueue] = call.Args[2]
+		}
+		if _, ok := reference.Fields[softTimestamp]; ok {
+			reference.Fields[softTimestamp] = longValue(call.Jvm.Heap.clock)
+		}
+		return StackData{}, nil
+	}
+	RegisterNative(referenceClass, "<init>", "(Ljava/lang/Object;)V", construct)
+	RegisterNative(referenceClass, "<init>", "(Ljava/lang/Object;Ljava/lang/ref/ReferenceQueue;)V", construct)
+	RegisterNative(referenceClass, "get", "()Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		reference := call.Object(0)
+		// Using a soft reference keeps it longer
+		if _, ok := reference.Fields[softTimestamp]; ok {
+			reference.Fields[softTimestamp] = longValue(call.Jvm.Heap.clock)
+		}
+		return reference.Fields[referenceReferent], nil
+	})
+	RegisterNative("java/lang/ref/PhantomReference", "get", "()Ljava/lang/Object;", func(call *NativeCall) (StackData, error) {
+		return nullReference, nil
+	})
+	RegisterNative(referenceClass, "refersTo", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(sameReference(call.Object(0).Fields[referenceReferent], call.Args[1])), nil
+	})
+	RegisterNative(referenceClass, "clear", "()V", func(call *NativeCall) (StackData, error) {
+		call.Object(0).Fields[referenceReferent] = nullReference
+		return StackData{}, nil
+	})
+	RegisterNative(referenceClass, "enqueue", "()Z", func(call *NativeCall) (StackData, error) {
+		reference := call.Object(0)
+		reference.Fields[referenceReferent] = nullReference
+		queue, _ := reference.Fields[referenceQueue].Data.(*Object)
+		if queue == nil {
+			return booleanValue(false), nil
+		}
+		return call.Jvm.InvokeVirtual("java/lang/ref/ReferenceQueue", "enqueue", "(Ljava/lang/ref/Reference;)Z", []StackData{referenceValue(queue), call.Args[0]})
+	})
+	RegisterNative(referenceClass, "isEnqueued", "()Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(sameReference(call.Object(0).Fields[referenceQueue], call.Jvm.StaticFields[queueEnqueued])), nil
+	})
+
+	const queueClass = "java/lang/ref/ReferenceQueue"
+	RegisterNative(queueClass, "<clinit>", "()V", func(call *NativeCall) (StackData, error) {
+		enqueued, err := call.Jvm.libraryObject(queueClass)
+		if err != nil {
+			return StackData{}, err
+		}
+		call.Jvm.StaticFields[queueEnqueued] = referenceValue(enqueued)
+		return StackData{}, nil
+	})
+	RegisterNative(queueClass, "<init>", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, nil
+	})
+	RegisterNative(queueClass, "enqueue", "(Ljava/lang/ref/Reference;)Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(call.Jvm.enqueue(call.Object(0), call.Object(1))), nil
+	})
+	RegisterNative(queueClass, "poll", "()Ljava/lang/ref/Reference;", func(call *NativeCall) (StackData, error) {
+		if reference := pollQueue(call.Object(0)); reference != nil {
+			return referenceValue(reference), nil
+		}
+		return nullReference, nil
+	})
+	remove := func(call *NativeCall) (StackData, error) {
+		var timeout time.Duration
+		if len(call.Args) == 2 {
+			if call.Long(1) < 0 {
+				return StackData{}, throwable("java/lang/IllegalArgumentException", "Negative timeout value")
+			}
+			timeout = time.Duration(call.Long(1)) * time.Millisecond
+		}
+		reference, err := call.Jvm.removeQueue(call.Object(0), timeout)
+		if reference == nil || err != nil {
+			return nullReference, err
+		}
+		return referenceValue(reference), nil
+	}
+	RegisterNative(queueClass, "remove", "()Ljava/lang/ref/Reference;", remove)
+	RegisterNative(queueClass, "remove", "(J)Ljava/lang/ref/Reference;", remove)
+
+	const cleanerClass = "java/lang/ref/Cleaner"
+	RegisterNative(cleanerClass, "create", "()Ljava/lang/ref/Cleaner;", func(call *NativeCall) (StackData, error) {
+		cleaner, err := call.Jvm.libraryObject(cleanerClass)
+		if err != nil {
+			return StackData{}, err
+		}
+		queue, err := call.Jvm.libraryObject(queueClass)
+		if err != nil {
+			return StackData{}, err
+		}
+		cleaner.Fields[cleanerQueue] = referenceValue(queue)
+		call.Jvm.cleaners = append(call.Jvm.cleaners, cleaner)
+		return referenceValue(cleaner), nil
+	})
+	RegisterNative(cleanerClass, "register", "(Ljava/lang/Object;Ljava/lang/Runnable;)Ljava/lang/ref/Cleaner$Cleanable;", func(call *NativeCall) (StackData, error) {
+		switch {
+		case call.Args[1].IsNull():
+			return StackData{}, throwable("java/lang/NullPointerException", "obj")
+		case call.Args[2].IsNull():
+			return StackData{}, throwable("java/lang/NullPointerException", "action")
+		}
+		cleaner := call.Object(0)
+		cleanable, err := call.Jvm.libraryObject("jdk/internal/ref/PhantomCleanable")
+		if err != nil {
+			return StackData{}, err
+		}
+		cleanable.Fields[referenceReferent] = call.Args[1]
+		cleanable.Fields[referenceQueue] = cleaner.Fields[cleanerQueue]
+		cleanable.Fields[cleanableAction] = call.Args[2]
+		cleanable.Fields[cleanableCleaner] = call.Args[0]
+		// The list of the cleaner keeps the cleanable alive until it is
+		// cleaned
+		head := cleaner.Fields[cleanerList]
+		cleanable.Fields[cleanableNext] = head
+		if !head.IsNull() {
+			head.Data.(*Object).Fields[cleanablePrev] = referenceValue(cleanable)
+		}
+		cleaner.Fields[cleanerList] = referenceValue(cleanable)
+		return referenceValue(cleanable), nil
+	})
+
+	const cleanableClass = "jdk/internal/ref/PhantomCleanable"
+	RegisterNative(cleanableClass, "clean", "()V", func(call *NativeCall) (StackData, error) {
+		cleanable := call.Object(0)
+		if !unlinkCleanable(cleanable) {
+			return StackData{}, nil
+		}
+		cleanable.Fields[referenceReferent] = nullReference
+		_, err := call.Jvm.InvokeVirtual("java/lang/Runnable", "run", "()V", []StackData{cleanable.Fields[cleanableAction]})
+		return StackData{}, err
+	})
+	RegisterNative(cleanableClass, "clear", "()V", func(call *NativeCall) (StackData, error) {
+		unlinkCleanable(call.Object(0))
+		call.Object(0).Fields[referenceReferent] = nullReference
+		return StackData{}, nil
+	})
+
+	// Objects don't need finalizing unless a subclass says otherwise
+	RegisterNative("java/lang/Object", "finalize", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, nil
+	})
+}
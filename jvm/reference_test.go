@@ -0,0 +1,155 @@
+package jvm
+
+import "testing"
+
+// printing writes code printing s with System.out.println
+func printing(s string) func(c *codeBuilder) {
+	return func(c *codeBuilder) {
+		c.op(OpGetstatic, c.class.fieldRef("java/lang/System", "out", "Ljava/io/PrintStream;"))
+		c.op(OpLdcW, c.class.string(s))
+		c.op(OpInvokevirtual, c.class.methodRef("java/io/PrintStream", "println", "(Ljava/lang/String;)V", false))
+	}
+}
+
+func TestReferences(t *testing.T) {
+	// Finalizable prints "finalized" when finalized
+	finalizable := newClassBuilder("Finalizable", "java/lang/Object", AccPublic|AccSuper)
+	init := finalizable.addMethod(AccPublic, "<init>", "()V")
+	init.maxStack, init.maxLocals = 1, 1
+	init.op(OpAload0)
+	init.op(OpInvokespecial, finalizable.methodRef("java/lang/Object", "<init>", "()V", false))
+	init.op(OpReturn)
+	finalize := finalizable.addMethod(AccProtected, "finalize", "()V")
+	finalize.maxStack, finalize.maxLocals = 2, 1
+	printing("finalized")(finalize)
+	finalize.op(OpReturn)
+	action := runnable("Action", 2, 1, printing("cleaned"))
+
+	const (
+		reference = "java/lang/ref/Reference"
+		queue     = "java/lang/ref/ReferenceQueue"
+	)
+	gc := func(p programBuilder) { p.invoke(true, "java/lang/System", "gc", "()V") }
+	// cleared prints whether the reference in local 1 was cleared
+	cleared := func(p programBuilder) {
+		p.println("(Z)V", func() {
+			p.op(OpAload1)
+			p.op(OpAconstNull)
+			p.invoke(false, reference, "refersTo", "(Ljava/lang/Object;)Z")
+		})
+	}
+	// newReference stores in local 1 a reference of class to a new object,
+	// registered with the queue in local 2 if queued is set
+	newReference := func(p programBuilder, class, referent string, queued bool) {
+		p.op(OpNew, p.class.class(class))
+		p.op(OpDup)
+		p.newObject(referent)
+		methodDescriptor := "(Ljava/lang/Object;)V"
+		if queued {
+			p.op(OpAload2)
+			methodDescriptor = "(Ljava/lang/Object;Ljava/lang/ref/ReferenceQueue;)V"
+		}
+		p.op(OpInvokespecial, p.class.methodRef(class, "<init>", methodDescriptor, false))
+		p.op(OpAstore1)
+	}
+	tests := []struct {
+		name   string
+		body   func(p programBuilder)
+		stdout string
+	}{
+		{
+			name: "weak reference cleared by System.gc",
+			body: func(p programBuilder) {
+				newReference(p, "java/lang/ref/WeakReference", "java/lang/Object", false)
+				cleared(p)
+				gc(p)
+				cleared(p)
+			},
+			stdout: "false\ntrue\n",
+		},
+		{
+			name: "weak reference to a reachable object",
+			body: func(p programBuilder) {
+				p.newObject("java/lang/Object")
+				p.op(OpAstore2)
+				p.op(OpNew, p.class.class("java/lang/ref/WeakReference"))
+				p.op(OpDup)
+				p.op(OpAload2)
+				p.op(OpInvokespecial, p.class.methodRef("java/lang/ref/WeakReference", "<init>", "(Ljava/lang/Object;)V", false))
+				p.op(OpAstore1)
+				gc(p)
+				p.println("(Z)V", func() {
+					p.op(OpAload1)
+					p.op(OpAload2)
+					p.invoke(false, reference, "refersTo", "(Ljava/lang/Object;)Z")
+				})
+			},
+			stdout: "true\n",
+		},
+		{
+			name: "soft reference kept until memory runs out",
+			body: func(p programBuilder) {
+				newReference(p, "java/lang/ref/SoftReference", "java/lang/Object", false)
+				gc(p)
+				cleared(p)
+				// new long[1 << 28] doesn't fit in the default heap
+				start := p.pc()
+				p.op(OpLdcW, p.class.integer(1<<28))
+				p.op(OpNewarray, uint8(11))
+				p.op(OpPop)
+				end := p.pc()
+				p.op(OpGoto, int16(4))
+				p.catch(start, end, p.pc(), "java/lang/OutOfMemoryError")
+				p.op(OpPop)
+				cleared(p)
+			},
+			stdout: "false\ntrue\n",
+		},
+		{
+			name: "phantom reference enqueued after finalization",
+			body: func(p programBuilder) {
+				p.newObject(queue)
+				p.op(OpAstore2)
+				newReference(p, "java/lang/ref/PhantomReference", "Finalizable", true)
+				// The first collection finalizes the object, the second
+				// one frees it
+				for range 2 {
+					gc(p)
+					p.println("(Z)V", func() {
+						p.op(OpAload1)
+						p.op(OpAload2)
+						p.invoke(false, queue, "poll", "()Ljava/lang/ref/Reference;")
+						p.invoke(false, "java/lang/Object", "equals", "(Ljava/lang/Object;)Z")
+					})
+				}
+			},
+			stdout: "finalized\nfalse\ntrue\n",
+		},
+		{
+			name: "cleaner action",
+			body: func(p programBuilder) {
+				p.invoke(true, "java/lang/ref/Cleaner", "create", "()Ljava/lang/ref/Cleaner;")
+				p.op(OpAstore1)
+				p.op(OpAload1)
+				p.newObject("java/lang/Object")
+				p.newObject("Action")
+				p.invoke(false, "java/lang/ref/Cleaner", "register", "(Ljava/lang/Object;Ljava/lang/Runnable;)Ljava/lang/ref/Cleaner$Cleanable;")
+				p.op(OpPop)
+				p.println("(Ljava/lang/String;)V", func() { p.ldc("collecting") })
+				gc(p)
+			},
+			stdout: "collecting\ncleaned\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, stderr := runProgram(t, buildProgram(t, test.body, finalizable, action))
+			if want := "Running main function code\n" + test.stdout; stdout != want {
+				t.Errorf("stdout = %q, want %q", stdout, want)
+			}
+			if stderr != "" {
+				t.Errorf("stderr = %q", stderr)
+			}
+		})
+	}
+}
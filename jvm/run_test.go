@@ -0,0 +1,527 @@
+package jvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// runProgram runs the main class at path against the embedded class
+// library and returns what it printed
+func runProgram(t *testing.T, path string) (stdout, stderr string) {
+	t.Helper()
+	jvm, err := NewJvm(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, errOut bytes.Buffer
+	jvm.Stdout, jvm.Stderr = &out, &errOut
+	RunJvm(jvm)
+	return out.String(), errOut.String()
+}
+
+// programBuilder writes the main method of a generated Main class
+type programBuilder struct {
+	*codeBuilder
+}
+
+// buildProgram generates a Main class whose main method runs the code
+// written by body, and returns the path of its class file. The classes it
+// uses are written next to it
+func buildProgram(t *testing.T, body func(p programBuilder), classes ...*classBuilder) string {
+	t.Helper()
+	class := newClassBuilder("Main", "java/lang/Object", AccPublic|AccSuper)
+	code := class.addMethod(AccPublic|AccStatic, "main", "([Ljava/lang/String;)V")
+	code.maxStack, code.maxLocals = 8, 4
+	body(programBuilder{code})
+	code.op(OpReturn)
+	dir := t.TempDir()
+	for _, c := range append(classes, class) {
+		// Written as version 49, verified by type inference, so that the
+		// code may branch without stack map frames
+		classFile := c.Bytes()
+		binary.BigEndian.PutUint16(classFile[6:], 49)
+		if err := os.WriteFile(filepath.Join(dir, c.name+".class"), classFile, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "Main.class")
+}
+
+// ldc pushes a String constant
+func (p programBuilder) ldc(s string) {
+	p.op(OpLdcW, p.class.string(s))
+}
+
+// invoke calls a method, virtual unless static is set
+func (p programBuilder) invoke(static bool, class, name, methodDescriptor string) {
+	op := OpInvokevirtual
+	if static {
+		op = OpInvokestatic
+	}
+	p.op(op, p.class.methodRef(class, name, methodDescriptor, false))
+}
+
+// println prints what push leaves on the stack with System.out.println
+func (p programBuilder) println(methodDescriptor string, push func()) {
+	p.op(OpGetstatic, p.class.fieldRef("java/lang/System", "out", "Ljava/io/PrintStream;"))
+	push()
+	p.invoke(false, "java/io/PrintStream", "println", methodDescriptor)
+}
+
+// newObject creates an object with its no argument constructor
+func (p programBuilder) newObject(class string) {
+	p.op(OpNew, p.class.class(class))
+	p.op(OpDup)
+	p.op(OpInvokespecial, p.class.methodRef(class, "<init>", "()V", false))
+}
+
+func TestRunMainClass(t *testing.T) {
+	stdout, stderr := runProgram(t, filepath.Join("..", "Main.class"))
+	if want := "Running main function code\nMy First Java Program.\n20\n181\n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+	if stderr != "" {
+		t.Errorf("stderr = %q", stderr)
+	}
+}
+
+func TestRunLibraryPrograms(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           func(p programBuilder)
+		stdout, stderr string
+	}{
+		{
+			name: "strings",
+			body: func(p programBuilder) {
+				builder := "Ljava/lang/StringBuilder;"
+				p.println("(Ljava/lang/String;)V", func() {
+					p.newObject("java/lang/StringBuilder")
+					p.ldc("x=")
+					p.invoke(false, "java/lang/StringBuilder", "append", "(Ljava/lang/String;)"+builder)
+					p.op(OpBipush, int8(42))
+					p.invoke(false, "java/lang/StringBuilder", "append", "(I)"+builder)
+					p.op(OpBipush, int8(' '))
+					p.invoke(false, "java/lang/StringBuilder", "append", "(C)"+builder)
+					// 1.0 / 3
+					p.op(OpDconst1)
+					p.op(OpIconst3)
+					p.op(OpI2d)
+					p.op(OpDdiv)
+					p.invoke(false, "java/lang/StringBuilder", "append", "(D)"+builder)
+					p.op(OpIconst1)
+					p.invoke(false, "java/lang/StringBuilder", "append", "(Z)"+builder)
+					p.invoke(false, "java/lang/StringBuilder", "toString", "()Ljava/lang/String;")
+				})
+				p.println("(Ljava/lang/String;)V", func() {
+					p.ldc("Hello, World")
+					p.invoke(false, "java/lang/String", "toUpperCase", "()Ljava/lang/String;")
+					p.op(OpBipush, int8(7))
+					p.invoke(false, "java/lang/String", "substring", "(I)Ljava/lang/String;")
+				})
+				// String.format("%05d|%-4s|", 42, "ab")
+				p.println("(Ljava/lang/String;)V", func() {
+					p.ldc("%05d|%-4s|")
+					p.op(OpIconst2)
+					p.op(OpAnewarray, p.class.class("java/lang/Object"))
+					p.op(OpDup)
+					p.op(OpIconst0)
+					p.op(OpBipush, int8(42))
+					p.invoke(true, "java/lang/Integer", "valueOf", "(I)Ljava/lang/Integer;")
+					p.op(OpAastore)
+					p.op(OpDup)
+					p.op(OpIconst1)
+					p.ldc("ab")
+					p.op(OpAastore)
+					p.invoke(true, "java/lang/String", "format", "(Ljava/lang/String;[Ljava/lang/Object;)Ljava/lang/String;")
+				})
+				p.println("(Ljava/lang/String;)V", func() {
+					p.op(OpSipush, int16(255))
+					p.invoke(true, "java/lang/Integer", "toHexString", "(I)Ljava/lang/String;")
+				})
+			},
+			stdout: "x=42 0.3333333333333333true\nWORLD\n00042|ab  |\nff\n",
+		},
+		{
+			name: "collections",
+			body: func(p programBuilder) {
+				p.newObject("java/util/ArrayList")
+				p.op(OpAstore1)
+				p.op(OpAload1)
+				p.op(OpIconst3)
+				p.invoke(true, "java/lang/Integer", "valueOf", "(I)Ljava/lang/Integer;")
+				p.invoke(false, "java/util/ArrayList", "add", "(Ljava/lang/Object;)Z")
+				p.op(OpPop)
+				p.op(OpAload1)
+				p.ldc("two")
+				p.invoke(false, "java/util/ArrayList", "add", "(Ljava/lang/Object;)Z")
+				p.op(OpPop)
+				p.println("(Ljava/lang/Object;)V", func() { p.op(OpAload1) })
+				p.println("(I)V", func() {
+					p.op(OpAload1)
+					p.invoke(false, "java/util/ArrayList", "size", "()I")
+				})
+				p.println("(Z)V", func() {
+					p.op(OpAload1)
+					p.op(OpIconst3)
+					p.invoke(true, "java/lang/Integer", "valueOf", "(I)Ljava/lang/Integer;")
+					p.invoke(false, "java/util/ArrayList", "contains", "(Ljava/lang/Object;)Z")
+				})
+
+				p.newObject("java/util/HashMap")
+				p.op(OpAstore2)
+				for i, key := range []string{"a", "b"} {
+					p.op(OpAload2)
+					p.ldc(key)
+					p.op(OpBipush, int8(i+1))
+					p.invoke(true, "java/lang/Integer", "valueOf", "(I)Ljava/lang/Integer;")
+					p.invoke(false, "java/util/HashMap", "put", "(Ljava/lang/Object;Ljava/lang/Object;)Ljava/lang/Object;")
+					p.op(OpPop)
+				}
+				p.println("(Ljava/lang/Object;)V", func() {
+					p.op(OpAload2)
+					p.ldc("b")
+					p.invoke(false, "java/util/HashMap", "get", "(Ljava/lang/Object;)Ljava/lang/Object;")
+				})
+				p.println("(Ljava/lang/Object;)V", func() { p.op(OpAload2) })
+				p.println("(I)V", func() {
+					p.ldc("-123")
+					p.invoke(true, "java/lang/Integer", "parseInt", "(Ljava/lang/String;)I")
+				})
+			},
+			stdout: "[3, two]\n2\ntrue\n2\n{a=1, b=2}\n-123\n",
+		},
+		{
+			name: "string builders",
+			body: func(p programBuilder) {
+				builder := "Ljava/lang/StringBuilder;"
+				p.op(OpNew, p.class.class("java/lang/StringBuilder"))
+				p.op(OpDup)
+				p.ldc("hello")
+				p.op(OpInvokespecial, p.class.methodRef("java/lang/StringBuilder", "<init>", "(Ljava/lang/String;)V", false))
+				p.op(OpAstore1)
+				// "say hello", "say42 hello", "say hello", "ay hello"
+				p.op(OpAload1)
+				p.op(OpIconst0)
+				p.ldc("say ")
+				p.invoke(false, "java/lang/StringBuilder", "insert", "(ILjava/lang/String;)"+builder)
+				p.op(OpIconst3)
+				p.op(OpBipush, int8(42))
+				p.invoke(false, "java/lang/StringBuilder", "insert", "(II)"+builder)
+				p.op(OpDup)
+				p.println("(Ljava/lang/Object;)V", func() { p.op(OpSwap) })
+				p.op(OpIconst3)
+				p.op(OpIconst5)
+				p.invoke(false, "java/lang/StringBuilder", "delete", "(II)"+builder)
+				p.op(OpIconst0)
+				p.invoke(false, "java/lang/StringBuilder", "deleteCharAt", "(I)"+builder)
+				p.op(OpPop)
+				p.println("(Ljava/lang/Object;)V", func() { p.op(OpAload1) })
+				// "ay", then "ay\U0001F600!" reversed keeping the surrogate pair
+				p.op(OpAload1)
+				p.op(OpIconst2)
+				p.invoke(false, "java/lang/StringBuilder", "setLength", "(I)V")
+				p.op(OpAload1)
+				p.op(OpLdcW, p.class.integer(0x1F600))
+				p.invoke(false, "java/lang/StringBuilder", "appendCodePoint", "(I)"+builder)
+				p.op(OpBipush, int8('!'))
+				p.invoke(false, "java/lang/StringBuilder", "append", "(C)"+builder)
+				p.invoke(false, "java/lang/StringBuilder", "reverse", "()"+builder)
+				p.op(OpPop)
+				p.println("(Ljava/lang/Object;)V", func() { p.op(OpAload1) })
+				p.println("(I)V", func() {
+					p.op(OpAload1)
+					p.invoke(false, "java/lang/StringBuilder", "length", "()I")
+				})
+				// Growing with setLength pads with \u0000
+				p.op(OpAload1)
+				p.op(OpBipush, int8(7))
+				p.invoke(false, "java/lang/StringBuilder", "setLength", "(I)V")
+				p.println("(I)V", func() {
+					p.op(OpAload1)
+					p.op(OpBipush, int8(6))
+					p.invoke(false, "java/lang/StringBuilder", "charAt", "(I)C")
+				})
+
+				buffer := "Ljava/lang/StringBuffer;"
+				p.println("(Ljava/lang/Object;)V", func() {
+					p.newObject("java/lang/StringBuffer")
+					p.ldc("ab")
+					p.invoke(false, "java/lang/StringBuffer", "append", "(Ljava/lang/String;)"+buffer)
+					p.op(OpFconst1)
+					p.invoke(false, "java/lang/StringBuffer", "append", "(F)"+buffer)
+					p.op(OpIconst1)
+					p.op(OpIconst1)
+					p.invoke(false, "java/lang/StringBuffer", "insert", "(IZ)"+buffer)
+					p.op(OpDconst1)
+					p.invoke(false, "java/lang/StringBuffer", "append", "(D)"+buffer)
+					p.invoke(false, "java/lang/StringBuffer", "reverse", "()"+buffer)
+				})
+			},
+			stdout: "say42 hello\nay hello\n!\U0001F600ya\n5\n0\n0.10.1beurta\n",
+		},
+		{
+			// Character.toString('\uD800') and String.valueOf(new char[] {'\uD800', 'a'})
+			// keep the lone surrogate
+			name: "lone surrogates",
+			body: func(p programBuilder) {
+				charAt := func(index int8) {
+					p.op(OpBipush, index)
+					p.invoke(false, "java/lang/String", "charAt", "(I)C")
+					p.op(OpI2c)
+				}
+				p.println("(I)V", func() {
+					p.op(OpLdcW, p.class.integer(0xD800))
+					p.invoke(true, "java/lang/Character", "toString", "(C)Ljava/lang/String;")
+					charAt(0)
+				})
+				p.println("(I)V", func() {
+					p.op(OpIconst2)
+					p.op(OpNewarray, uint8(5))
+					p.op(OpDup)
+					p.op(OpIconst0)
+					p.op(OpLdcW, p.class.integer(0xD800))
+					p.op(OpCastore)
+					p.op(OpDup)
+					p.op(OpIconst1)
+					p.op(OpBipush, int8('a'))
+					p.op(OpCastore)
+					p.invoke(true, "java/lang/String", "valueOf", "([C)Ljava/lang/String;")
+					charAt(0)
+				})
+			},
+			stdout: "55296\n55296\n",
+		},
+		{
+			name: "string methods on lone surrogates",
+			body: func(p programBuilder) {
+				// Modified UTF-8 of a lone U+D800
+				const surrogate = "\xed\xa0\x80"
+				str := "Ljava/lang/String;"
+				charAt1 := func() {
+					p.op(OpIconst1)
+					p.invoke(false, "java/lang/String", "charAt", "(I)C")
+				}
+				p.println("(I)V", func() {
+					p.ldc(" a" + surrogate + " ")
+					p.invoke(false, "java/lang/String", "strip", "()"+str)
+					charAt1()
+				})
+				p.println("(I)V", func() {
+					p.ldc("a" + surrogate)
+					p.invoke(false, "java/lang/String", "toUpperCase", "()"+str)
+					charAt1()
+				})
+				p.println("(I)V", func() {
+					p.ldc("x" + surrogate + ",y")
+					p.ldc(",")
+					p.invoke(false, "java/lang/String", "split", "("+str+")["+str)
+					p.op(OpIconst0)
+					p.op(OpAaload)
+					charAt1()
+				})
+				p.println("(I)V", func() {
+					p.ldc("a" + surrogate)
+					p.ldc("a")
+					p.ldc("b")
+					p.invoke(false, "java/lang/String", "replace", "(Ljava/lang/CharSequence;Ljava/lang/CharSequence;)"+str)
+					charAt1()
+				})
+				p.println("(I)V", func() {
+					p.ldc("a" + surrogate)
+					p.invoke(false, "java/lang/String", "getBytes", "()[B")
+					p.op(OpIconst1)
+					p.op(OpBaload)
+				})
+				p.println("(Z)V", func() {
+					p.ldc("A" + surrogate)
+					p.ldc("a" + surrogate)
+					p.invoke(false, "java/lang/String", "equalsIgnoreCase", "("+str+")Z")
+				})
+			},
+			stdout: "55296\n55296\n55296\n55296\n63\ntrue\n",
+		},
+		{
+			name: "java whitespace",
+			body: func(p programBuilder) {
+				// U+2028 and U+001C are whitespace to Java, U+00A0 isn't
+				p.println("(I)V", func() {
+					p.ldc("\u2028a\u00a0")
+					p.invoke(false, "java/lang/String", "strip", "()Ljava/lang/String;")
+					p.invoke(false, "java/lang/String", "length", "()I")
+				})
+				p.println("(Z)V", func() {
+					p.ldc("\u001c")
+					p.invoke(false, "java/lang/String", "isBlank", "()Z")
+				})
+				p.println("(Z)V", func() {
+					p.ldc("\u00a0")
+					p.invoke(false, "java/lang/String", "isBlank", "()Z")
+				})
+			},
+			stdout: "2\ntrue\nfalse\n",
+		},
+		{
+			name: "uncaught exception",
+			body: func(p programBuilder) {
+				p.println("(Ljava/lang/String;)V", func() { p.ldc("before") })
+				p.ldc("abc")
+				p.op(OpIconst5)
+				p.invoke(false, "java/lang/String", "charAt", "(I)C")
+				p.op(OpPop)
+			},
+			stdout: "before\n",
+			stderr: "Exception in thread \"main\" java.lang.StringIndexOutOfBoundsException: Index 5 out of bounds for length 3\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, stderr := runProgram(t, buildProgram(t, test.body))
+			if want := "Running main function code\n" + test.stdout; stdout != want {
+				t.Errorf("stdout = %q, want %q", stdout, want)
+			}
+			if stderr != test.stderr {
+				t.Errorf("stderr = %q, want %q", stderr, test.stderr)
+			}
+		})
+	}
+}
+
+func TestCatchLinkageErrors(t *testing.T) {
+	other := newClassBuilder("Other", "java/lang/Object", AccPublic|AccSuper)
+	other.addField(AccPrivate|AccStatic, "hidden", "I")
+	instance := other.addMethod(AccPublic, "instance", "()V")
+	instance.maxLocals = 1
+	instance.op(OpReturn)
+	orphan := newClassBuilder("Orphan", "Missing", AccPublic|AccSuper)
+	tests := []struct {
+		name string
+		// call throws the linkage error
+		call   func(p programBuilder)
+		stdout string
+	}{
+		{
+			name:   "missing class",
+			call:   func(p programBuilder) { p.newObject("Missing") },
+			stdout: "java.lang.NoClassDefFoundError: Missing\n",
+		},
+		{
+			name:   "missing super class",
+			call:   func(p programBuilder) { p.newObject("Orphan") },
+			stdout: "java.lang.NoClassDefFoundError: Missing\n",
+		},
+		{
+			name:   "private field",
+			call:   func(p programBuilder) { p.op(OpGetstatic, p.class.fieldRef("Other", "hidden", "I")) },
+			stdout: "java.lang.IllegalAccessError: class Main tried to access private member Other.hidden\n",
+		},
+		{
+			name:   "instance method called statically",
+			call:   func(p programBuilder) { p.invoke(true, "Other", "instance", "()V") },
+			stdout: "java.lang.IncompatibleClassChangeError: Expected static method 'void Other.instance()'\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := buildProgram(t, func(p programBuilder) {
+				start := p.pc()
+				test.call(p)
+				end := p.pc()
+				p.op(OpReturn)
+				// catch (Throwable t) { System.out.println(t); }
+				p.catch(start, end, p.pc(), "java/lang/Throwable")
+				p.op(OpAstore1)
+				p.println("(Ljava/lang/Object;)V", func() { p.op(OpAload1) })
+			}, other, orphan)
+			stdout, stderr := runProgram(t, path)
+			if want := "Running main function code\n" + test.stdout; stdout != want {
+				t.Errorf("stdout = %q, want %q", stdout, want)
+			}
+			if stderr != "" {
+				t.Errorf("stderr = %q", stderr)
+			}
+		})
+	}
+}
+
+func TestPatchModule(t *testing.T) {
+	// Main extends Base, which only the patch directory has
+	base := newClassBuilder("Base", "java/lang/Object", AccPublic|AccSuper)
+	greet := base.addMethod(AccPublic|AccStatic, "greet", "()V")
+	greet.maxStack = 2
+	greet.op(OpGetstatic, base.fieldRef("java/lang/System", "out", "Ljava/io/PrintStream;"))
+	greet.op(OpLdcW, base.string("patched"))
+	greet.op(OpInvokevirtual, base.methodRef("java/io/PrintStream", "println", "(Ljava/lang/String;)V", false))
+	greet.op(OpReturn)
+	main := newClassBuilder("Main", "Base", AccPublic|AccSuper)
+	code := main.addMethod(AccPublic|AccStatic, "main", "([Ljava/lang/String;)V")
+	code.maxLocals = 1
+	code.op(OpInvokestatic, main.methodRef("Base", "greet", "()V", false))
+	code.op(OpReturn)
+
+	classPath, patch := t.TempDir(), t.TempDir()
+	for dir, class := range map[string]*classBuilder{classPath: main, patch: base} {
+		if err := os.WriteFile(filepath.Join(dir, class.name+".class"), class.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jvm, err := NewJvm(filepath.Join(classPath, "Main.class"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jvm.PatchModule(patch)
+	var out, errOut bytes.Buffer
+	jvm.Stdout, jvm.Stderr = &out, &errOut
+	RunJvm(jvm)
+	if want := "Running main function code\npatched\n"; out.String() != want {
+		t.Errorf("stdout = %q, want %q", out.String(), want)
+	}
+	if errOut.String() != "" {
+		t.Errorf("stderr = %q", errOut.String())
+	}
+}
+
+func TestClassInstanceFields(t *testing.T) {
+	// The Class of the JDK caches its name and reflection data in instance
+	// fields, the patched one declares a public field for Main to use
+	class := newClassBuilder("java/lang/Class", "java/lang/Object", AccPublic|AccFinal|AccSuper)
+	class.addField(AccPublic, "name", "Ljava/lang/String;")
+	patch := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(patch, "java", "lang"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(patch, class.name+".class"), class.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := buildProgram(t, func(p programBuilder) {
+		name := p.class.fieldRef("java/lang/Class", "name", "Ljava/lang/String;")
+		p.println("(Ljava/lang/Object;)V", func() {
+			p.op(OpLdcW, p.class.class("Main"))
+			p.op(OpGetfield, name)
+		})
+		p.op(OpLdcW, p.class.class("Main"))
+		p.ldc("Main")
+		p.op(OpPutfield, name)
+		p.println("(Ljava/lang/String;)V", func() {
+			p.op(OpLdcW, p.class.class("Main"))
+			p.op(OpGetfield, name)
+		})
+	})
+	jvm, err := NewJvm(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jvm.PatchModule(patch)
+	var out, errOut bytes.Buffer
+	jvm.Stdout, jvm.Stderr = &out, &errOut
+	RunJvm(jvm)
+	if want := "Running main function code\nnull\nMain\n"; out.String() != want {
+		t.Errorf("stdout = %q, want %q", out.String(), want)
+	}
+	if errOut.String() != "" {
+		t.Errorf("stderr = %q", errOut.String())
+	}
+}
@@ -0,0 +1,279 @@
+package signature
+
+import (
+	"fmt"
+	"strings"
+)
+
+type parser struct {
+	signature string
+	pos       int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{p.signature, p.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.signature) {
+		return 0
+	}
+	return p.signature[p.pos]
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		if p.pos >= len(p.signature) {
+			return p.errorf("expected %q, found end", c)
+		}
+		return p.errorf("expected %q, found %q", c, p.peek())
+	}
+	p.pos += 1
+	return nil
+}
+
+func (p *parser) end() error {
+	if p.pos != len(p.signature) {
+		return p.errorf("trailing characters")
+	}
+	return nil
+}
+
+// identifier reads an unqualified name, which can't contain . ; [ / < > :
+func (p *parser) identifier() (string, error) {
+	start := p.pos
+	for p.pos < len(p.signature) && !strings.ContainsRune(".;[/<>:", rune(p.signature[p.pos])) {
+		p.pos += 1
+	}
+	if start == p.pos {
+		return "", p.errorf("expected identifier")
+	}
+	return p.signature[start:p.pos], nil
+}
+
+func (p *parser) typeParameters() (TypeParameters, error) {
+	if p.peek() != '<' {
+		return nil, nil
+	}
+	p.pos += 1
+	params := make(TypeParameters, 0)
+	for p.peek() != '>' {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		param := TypeParameter{Name: name}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		if c := p.peek(); c == 'L' || c == 'T' || c == '[' {
+			if param.ClassBound, err = p.referenceType(); err != nil {
+				return nil, err
+			}
+		}
+		for p.peek() == ':' {
+			p.pos += 1
+			bound, err := p.referenceType()
+			if err != nil {
+				return nil, err
+			}
+			param.InterfaceBounds = append(param.InterfaceBounds, bound)
+		}
+		params = append(params, param)
+	}
+	if len(params) == 0 {
+		return nil, p.errorf("empty type parameters")
+	}
+	p.pos += 1
+	return params, nil
+}
+
+func (p *parser) typeArguments() ([]TypeArgument, error) {
+	if p.peek() != '<' {
+		return nil, nil
+	}
+	p.pos += 1
+	args := make([]TypeArgument, 0)
+	for p.peek() != '>' {
+		arg := TypeArgument{}
+		switch c := WildcardIndicator(p.peek()); c {
+		case Unbounded:
+			p.pos += 1
+			args = append(args, TypeArgument{Wildcard: Unbounded})
+			continue
+		case Extends, Super:
+			arg.Wildcard = c
+			p.pos += 1
+		}
+		var err error
+		if arg.Type, err = p.referenceType(); err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 0 {
+		return nil, p.errorf("empty type arguments")
+	}
+	p.pos += 1
+	return args, nil
+}
+
+func (p *parser) simpleClassType() (SimpleClassTypeSignature, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return SimpleClassTypeSignature{}, err
+	}
+	args, err := p.typeArguments()
+	return SimpleClassTypeSignature{Name: name, TypeArguments: args}, err
+}
+
+func (p *parser) classType() (*ClassTypeSignature, error) {
+	if err := p.expect('L'); err != nil {
+		return nil, err
+	}
+	signature := &ClassTypeSignature{}
+
+	// The package is every identifier followed by a slash
+	start := p.pos
+	for {
+		if _, err := p.identifier(); err != nil {
+			return nil, err
+		}
+		if p.peek() != '/' {
+			break
+		}
+		p.pos += 1
+		signature.Package = p.signature[start:p.pos]
+	}
+	p.pos = start + len(signature.Package)
+
+	for {
+		class, err := p.simpleClassType()
+		if err != nil {
+			return nil, err
+		}
+		signature.Classes = append(signature.Classes, class)
+		if p.peek() != '.' {
+			break
+		}
+		p.pos += 1
+	}
+	if err := p.expect(';'); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+func (p *parser) referenceType() (ReferenceTypeSignature, error) {
+	switch p.peek() {
+	case 'L':
+		return p.classType()
+	case 'T':
+		p.pos += 1
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(';'); err != nil {
+			return nil, err
+		}
+		return &TypeVariableSignature{Name: name}, nil
+	case '[':
+		p.pos += 1
+		component, err := p.javaType()
+		if err != nil {
+			return nil, err
+		}
+		return &ArrayTypeSignature{Component: component}, nil
+	case 0:
+		return nil, p.errorf("expected reference type, found end")
+	}
+	return nil, p.errorf("expected reference type, found %q", p.peek())
+}
+
+func (p *parser) javaType() (JavaTypeSignature, error) {
+	switch c := BaseType(p.peek()); c {
+	case Byte, Char, Double, Float, Int, Long, Short, Boolean:
+		p.pos += 1
+		return c, nil
+	}
+	return p.referenceType()
+}
+
+// ParseClass decodes the Signature attribute of a class
+func ParseClass(signature string) (*ClassSignature, error) {
+	p := &parser{signature: signature}
+	class := &ClassSignature{}
+	var err error
+	if class.TypeParameters, err = p.typeParameters(); err != nil {
+		return nil, err
+	}
+	if class.SuperClass, err = p.classType(); err != nil {
+		return nil, err
+	}
+	for p.peek() == 'L' {
+		iface, err := p.classType()
+		if err != nil {
+			return nil, err
+		}
+		class.Interfaces = append(class.Interfaces, iface)
+	}
+	return class, p.end()
+}
+
+// ParseMethod decodes the Signature attribute of a method
+func ParseMethod(signature string) (*MethodSignature, error) {
+	p := &parser{signature: signature}
+	method := &MethodSignature{Params: make([]JavaTypeSignature, 0)}
+	var err error
+	if method.TypeParameters, err = p.typeParameters(); err != nil {
+		return nil, err
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	for p.peek() != ')' {
+		param, err := p.javaType()
+		if err != nil {
+			return nil, err
+		}
+		method.Params = append(method.Params, param)
+	}
+	p.pos += 1
+
+	if p.peek() == byte(Void) {
+		p.pos += 1
+		method.Result = Void
+	} else if method.Result, err = p.javaType(); err != nil {
+		return nil, err
+	}
+
+	for p.peek() == '^' {
+		p.pos += 1
+		var throws ReferenceTypeSignature
+		switch p.peek() {
+		case 'L':
+			throws, err = p.classType()
+		case 'T':
+			throws, err = p.referenceType()
+		default:
+			return nil, p.errorf("expected class type or type variable in throws")
+		}
+		if err != nil {
+			return nil, err
+		}
+		method.Throws = append(method.Throws, throws)
+	}
+	return method, p.end()
+}
+
+// ParseField decodes the Signature attribute of a field, record component
+// or local variable
+func ParseField(signature string) (ReferenceTypeSignature, error) {
+	p := &parser{signature: signature}
+	field, err := p.referenceType()
+	if err != nil {
+		return nil, err
+	}
+	return field, p.end()
+}
@@ -0,0 +1,349 @@
+// Package signature decodes the generic type signatures stored in Signature
+// attributes (JVMS §4.7.9.1)
+package signature
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// JavaTypeSignature is a base type or a reference type signature
+type JavaTypeSignature interface {
+	// Signature returns the type back in signature form
+	Signature() string
+	// String returns the type as written in Java source
+	String() string
+}
+
+// ReferenceTypeSignature is a class type, type variable or array type
+// signature
+type ReferenceTypeSignature interface {
+	JavaTypeSignature
+	isReference()
+}
+
+type BaseType byte
+
+const (
+	Byte    BaseType = 'B'
+	Char    BaseType = 'C'
+	Double  BaseType = 'D'
+	Float   BaseType = 'F'
+	Int     BaseType = 'I'
+	Long    BaseType = 'J'
+	Short   BaseType = 'S'
+	Boolean BaseType = 'Z'
+	Void    BaseType = 'V'
+)
+
+func (t BaseType) Signature() string {
+	return string(t)
+}
+
+func (t BaseType) String() string {
+	return descriptor.BaseType(t).String()
+}
+
+type WildcardIndicator byte
+
+const (
+	NoWildcard WildcardIndicator = 0
+	// ? extends T
+	Extends WildcardIndicator = '+'
+	// ? super T
+	Super WildcardIndicator = '-'
+	// ?
+	Unbounded WildcardIndicator = '*'
+)
+
+type TypeArgument struct {
+	Wildcard WildcardIndicator
+	// nil for unbounded wildcards
+	Type ReferenceTypeSignature
+}
+
+func (a TypeArgument) Signature() string {
+	switch a.Wildcard {
+	case Unbounded:
+		return "*"
+	case NoWildcard:
+		return a.Type.Signature()
+	}
+	return string(a.Wildcard) + a.Type.Signature()
+}
+
+func (a TypeArgument) String() string {
+	switch a.Wildcard {
+	case Unbounded:
+		return "?"
+	case Extends:
+		return "? extends " + a.Type.String()
+	case Super:
+		return "? super " + a.Type.String()
+	}
+	return a.Type.String()
+}
+
+type SimpleClassTypeSignature struct {
+	Name          string
+	TypeArguments []TypeArgument
+}
+
+func (s SimpleClassTypeSignature) Signature() string {
+	if len(s.TypeArguments) == 0 {
+		return s.Name
+	}
+	var signature strings.Builder
+	signature.WriteString(s.Name)
+	signature.WriteByte('<')
+	for _, arg := range s.TypeArguments {
+		signature.WriteString(arg.Signature())
+	}
+	signature.WriteByte('>')
+	return signature.String()
+}
+
+func (s SimpleClassTypeSignature) String() string {
+	if len(s.TypeArguments) == 0 {
+		return s.Name
+	}
+	args := make([]string, len(s.TypeArguments))
+	for i, arg := range s.TypeArguments {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s<%s>", s.Name, strings.Join(args, ", "))
+}
+
+type ClassTypeSignature struct {
+	// Package in internal form with its trailing slash, like java/util/
+	Package string
+	// The top level class followed by its inner classes
+	Classes []SimpleClassTypeSignature
+}
+
+func (*ClassTypeSignature) isReference() {}
+
+func (s *ClassTypeSignature) Signature() string {
+	names := make([]string, len(s.Classes))
+	for i, class := range s.Classes {
+		names[i] = class.Signature()
+	}
+	return "L" + s.Package + strings.Join(names, ".") + ";"
+}
+
+func (s *ClassTypeSignature) String() string {
+	names := make([]string, len(s.Classes))
+	for i, class := range s.Classes {
+		names[i] = class.String()
+	}
+	return strings.ReplaceAll(s.Package, "/", ".") + strings.Join(names, ".")
+}
+
+// ClassName returns the internal name of the erased class, inner classes
+// joined with $
+func (s *ClassTypeSignature) ClassName() string {
+	names := make([]string, len(s.Classes))
+	for i, class := range s.Classes {
+		names[i] = class.Name
+	}
+	return s.Package + strings.Join(names, "$")
+}
+
+type TypeVariableSignature struct {
+	Name string
+}
+
+func (*TypeVariableSignature) isReference() {}
+
+func (s *TypeVariableSignature) Signature() string {
+	return "T" + s.Name + ";"
+}
+
+func (s *TypeVariableSignature) String() string {
+	return s.Name
+}
+
+type ArrayTypeSignature struct {
+	Component JavaTypeSignature
+}
+
+func (*ArrayTypeSignature) isReference() {}
+
+func (s *ArrayTypeSignature) Signature() string {
+	return "[" + s.Component.Signature()
+}
+
+func (s *ArrayTypeSignature) String() string {
+	return s.Component.String() + "[]"
+}
+
+type TypeParameter struct {
+	Name string
+	// nil when the parameter is only bound by interfaces
+	ClassBound      ReferenceTypeSignature
+	InterfaceBounds []ReferenceTypeSignature
+}
+
+func (p TypeParameter) Signature() string {
+	var signature strings.Builder
+	signature.WriteString(p.Name)
+	signature.WriteByte(':')
+	if p.ClassBound != nil {
+		signature.WriteString(p.ClassBound.Signature())
+	}
+	for _, bound := range p.InterfaceBounds {
+		signature.WriteByte(':')
+		signature.WriteString(bound.Signature())
+	}
+	return signature.String()
+}
+
+func (p TypeParameter) String() string {
+	bounds := make([]string, 0, len(p.InterfaceBounds)+1)
+	if p.ClassBound != nil && p.ClassBound.Signature() != "Ljava/lang/Object;" {
+		bounds = append(bounds, p.ClassBound.String())
+	}
+	for _, bound := range p.InterfaceBounds {
+		bounds = append(bounds, bound.String())
+	}
+	if len(bounds) == 0 {
+		return p.Name
+	}
+	return p.Name + " extends " + strings.Join(bounds, " & ")
+}
+
+type TypeParameters []TypeParameter
+
+func (p TypeParameters) Signature() string {
+	if len(p) == 0 {
+		return ""
+	}
+	var signature strings.Builder
+	signature.WriteByte('<')
+	for _, param := range p {
+		signature.WriteString(param.Signature())
+	}
+	signature.WriteByte('>')
+	return signature.String()
+}
+
+func (p TypeParameters) String() string {
+	if len(p) == 0 {
+		return ""
+	}
+	params := make([]string, len(p))
+	for i, param := range p {
+		params[i] = param.String()
+	}
+	return "<" + strings.Join(params, ", ") + ">"
+}
+
+type ClassSignature struct {
+	TypeParameters TypeParameters
+	SuperClass     *ClassTypeSignature
+	Interfaces     []*ClassTypeSignature
+}
+
+func (s *ClassSignature) Signature() string {
+	var signature strings.Builder
+	signature.WriteString(s.TypeParameters.Signature())
+	signature.WriteString(s.SuperClass.Signature())
+	for _, iface := range s.Interfaces {
+		signature.WriteString(iface.Signature())
+	}
+	return signature.String()
+}
+
+func (s *ClassSignature) String() string {
+	return s.Format("")
+}
+
+// Format returns the class declaration in Java syntax, like
+// `Box<T extends java.lang.Number> extends java.lang.Object implements java.lang.Comparable<Box<T>>`
+func (s *ClassSignature) Format(name string) string {
+	var declaration strings.Builder
+	declaration.WriteString(name)
+	declaration.WriteString(s.TypeParameters.String())
+	if declaration.Len() != 0 {
+		declaration.WriteByte(' ')
+	}
+	declaration.WriteString("extends ")
+	declaration.WriteString(s.SuperClass.String())
+	for i, iface := range s.Interfaces {
+		if i == 0 {
+			declaration.WriteString(" implements ")
+		} else {
+			declaration.WriteString(", ")
+		}
+		declaration.WriteString(iface.String())
+	}
+	return declaration.String()
+}
+
+type MethodSignature struct {
+	TypeParameters TypeParameters
+	Params         []JavaTypeSignature
+	// Void for methods returning nothing
+	Result JavaTypeSignature
+	// Class type or type variable signatures
+	Throws []ReferenceTypeSignature
+}
+
+func (s *MethodSignature) Signature() string {
+	var signature strings.Builder
+	signature.WriteString(s.TypeParameters.Signature())
+	signature.WriteByte('(')
+	for _, param := range s.Params {
+		signature.WriteString(param.Signature())
+	}
+	signature.WriteByte(')')
+	signature.WriteString(s.Result.Signature())
+	for _, throws := range s.Throws {
+		signature.WriteByte('^')
+		signature.WriteString(throws.Signature())
+	}
+	return signature.String()
+}
+
+func (s *MethodSignature) String() string {
+	return s.Format("")
+}
+
+// Format returns the method declaration in Java syntax, like
+// `<T> java.util.List<T> name(T[]) throws java.io.IOException`
+func (s *MethodSignature) Format(name string) string {
+	var declaration strings.Builder
+	if len(s.TypeParameters) != 0 {
+		declaration.WriteString(s.TypeParameters.String())
+		declaration.WriteByte(' ')
+	}
+	declaration.WriteString(s.Result.String())
+	declaration.WriteByte(' ')
+	declaration.WriteString(name)
+	params := make([]string, len(s.Params))
+	for i, param := range s.Params {
+		params[i] = param.String()
+	}
+	fmt.Fprintf(&declaration, "(%s)", strings.Join(params, ", "))
+	for i, throws := range s.Throws {
+		if i == 0 {
+			declaration.WriteString(" throws ")
+		} else {
+			declaration.WriteString(", ")
+		}
+		declaration.WriteString(throws.String())
+	}
+	return declaration.String()
+}
+
+type SyntaxError struct {
+	Signature string
+	Pos       int
+	Msg       string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid signature %q at %d: %s", e.Signature, e.Pos, e.Msg)
+}
@@ -0,0 +1,140 @@
+package signature
+
+import "testing"
+
+func TestParseFieldRoundTrip(t *testing.T) {
+	tests := []struct {
+		signature string
+		java      string
+	}{
+		{"Ljava/lang/String;", "java.lang.String"},
+		{"TT;", "T"},
+		{"[[TE;", "E[][]"},
+		{"[I", "int[]"},
+		{"Ljava/util/Map<Ljava/lang/String;Ljava/util/List<+Ljava/lang/Number;>;>;", "java.util.Map<java.lang.String, java.util.List<? extends java.lang.Number>>"},
+		{"Ljava/util/Comparator<-TT;>;", "java.util.Comparator<? super T>"},
+		{"Ljava/lang/Class<*>;", "java.lang.Class<?>"},
+		{"LOuter<TT;>.Inner<TU;>;", "Outer<T>.Inner<U>"},
+		{"Ljava/util/Map<TK;TV;>.Entry<TK;TV;>;", "java.util.Map<K, V>.Entry<K, V>"},
+		{"[Ljava/util/List<[Ljava/lang/String;>;", "java.util.List<java.lang.String[]>[]"},
+	}
+	for _, test := range tests {
+		field, err := ParseField(test.signature)
+		if err != nil {
+			t.Errorf("ParseField(%q): %v", test.signature, err)
+			continue
+		}
+		if got := field.Signature(); got != test.signature {
+			t.Errorf("ParseField(%q).Signature() = %q", test.signature, got)
+		}
+		if got := field.String(); got != test.java {
+			t.Errorf("ParseField(%q).String() = %q, want %q", test.signature, got, test.java)
+		}
+	}
+}
+
+func TestClassName(t *testing.T) {
+	field, err := ParseField("Ljava/util/Map<TK;TV;>.Entry<TK;TV;>;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	class := field.(*ClassTypeSignature)
+	if class.Package != "java/util/" {
+		t.Errorf("Package = %q", class.Package)
+	}
+	if name := class.ClassName(); name != "java/util/Map$Entry" {
+		t.Errorf("ClassName() = %q", name)
+	}
+}
+
+func TestParseClassRoundTrip(t *testing.T) {
+	tests := []struct {
+		signature string
+		java      string
+	}{
+		{"<T:Ljava/lang/Object;>Ljava/lang/Object;", "<T> extends java.lang.Object"},
+		{
+			"<T:Ljava/lang/Number;:Ljava/lang/Comparable<TT;>;>Ljava/lang/Object;Ljava/lang/Comparable<LBox<TT;>;>;",
+			"<T extends java.lang.Number & java.lang.Comparable<T>> extends java.lang.Object implements java.lang.Comparable<Box<T>>",
+		},
+		{"<E::Ljava/lang/Runnable;>Ljava/util/AbstractList<TE;>;Ljava/util/List<TE;>;Ljava/io/Serializable;",
+			"<E extends java.lang.Runnable> extends java.util.AbstractList<E> implements java.util.List<E>, java.io.Serializable"},
+	}
+	for _, test := range tests {
+		class, err := ParseClass(test.signature)
+		if err != nil {
+			t.Errorf("ParseClass(%q): %v", test.signature, err)
+			continue
+		}
+		if got := class.Signature(); got != test.signature {
+			t.Errorf("ParseClass(%q).Signature() = %q", test.signature, got)
+		}
+		if got := class.String(); got != test.java {
+			t.Errorf("ParseClass(%q).String() = %q, want %q", test.signature, got, test.java)
+		}
+	}
+}
+
+func TestParseMethodRoundTrip(t *testing.T) {
+	tests := []struct {
+		signature string
+		java      string
+	}{
+		{"()V", "void ()"},
+		{"<T:Ljava/lang/Object;>([TT;)Ljava/util/List<TT;>;", "<T> java.util.List<T> (T[])"},
+		{"(Ljava/util/Map<-TK;+TV;>;IJ)TV;^Ljava/io/IOException;^TX;", "V (java.util.Map<? super K, ? extends V>, int, long) throws java.io.IOException, X"},
+	}
+	for _, test := range tests {
+		method, err := ParseMethod(test.signature)
+		if err != nil {
+			t.Errorf("ParseMethod(%q): %v", test.signature, err)
+			continue
+		}
+		if got := method.Signature(); got != test.signature {
+			t.Errorf("ParseMethod(%q).Signature() = %q", test.signature, got)
+		}
+		if got := method.String(); got != test.java {
+			t.Errorf("ParseMethod(%q).String() = %q, want %q", test.signature, got, test.java)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	parsers := map[string]func(string) error{
+		"field":  func(s string) error { _, err := ParseField(s); return err },
+		"class":  func(s string) error { _, err := ParseClass(s); return err },
+		"method": func(s string) error { _, err := ParseMethod(s); return err },
+	}
+	tests := []struct {
+		kind      string
+		signature string
+		want      string
+	}{
+		{"field", "I", `invalid signature "I" at 0: expected reference type, found 'I'`},
+		{"field", "TT", `invalid signature "TT" at 2: expected ';', found end`},
+		{"field", "L;", `invalid signature "L;" at 1: expected identifier`},
+		{"field", "Ljava//List;", `invalid signature "Ljava//List;" at 6: expected identifier`},
+		{"field", "Ljava/util/List<>;", `invalid signature "Ljava/util/List<>;" at 16: empty type arguments`},
+		{"field", "Ljava/util/List<Ljava/lang/String;", `invalid signature "Ljava/util/List<Ljava/lang/String;" at 34: expected reference type, found end`},
+		{"field", "Ljava/util/List<?Ljava/lang/String;>;", `invalid signature "Ljava/util/List<?Ljava/lang/String;>;" at 16: expected reference type, found '?'`},
+		{"field", "LOuter.;", `invalid signature "LOuter.;" at 7: expected identifier`},
+		{"field", "Ljava/lang/String;;", `invalid signature "Ljava/lang/String;;" at 18: trailing characters`},
+		{"class", "<>Ljava/lang/Object;", `invalid signature "<>Ljava/lang/Object;" at 1: empty type parameters`},
+		{"class", "<T>Ljava/lang/Object;", `invalid signature "<T>Ljava/lang/Object;" at 2: expected ':', found '>'`},
+		{"class", "TT;", `invalid signature "TT;" at 0: expected 'L', found 'T'`},
+		{"method", "(I", `invalid signature "(I" at 2: expected reference type, found end`},
+		{"method", "()V^I", `invalid signature "()V^I" at 4: expected class type or type variable in throws`},
+		{"method", "()VX", `invalid signature "()VX" at 3: trailing characters`},
+		{"method", "V", `invalid signature "V" at 0: expected '(', found 'V'`},
+	}
+	for _, test := range tests {
+		err := parsers[test.kind](test.signature)
+		if err == nil {
+			t.Errorf("%s %q parsed, want %s", test.kind, test.signature, test.want)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("%s %q: got %s\nwant %s", test.kind, test.signature, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package jvm
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type VerificationTypeTag uint8
+
+const (
+	ItemTop               VerificationTypeTag = 0
+	ItemInteger           VerificationTypeTag = 1
+	ItemFloat             VerificationTypeTag = 2
+	ItemDouble            VerificationTypeTag = 3
+	ItemLong              VerificationTypeTag = 4
+	ItemNull              VerificationTypeTag = 5
+	ItemUninitializedThis VerificationTypeTag = 6
+	ItemObject            VerificationTypeTag = 7
+	ItemUninitialized     VerificationTypeTag = 8
+)
+
+type VerificationTypeInfo struct {
+	Tag VerificationTypeTag
+	// Constant pool index of the class for ItemObject
+	CpoolIndex uint16
+	// Offset of the new instruction for ItemUninitialized
+	Offset uint16
+}
+
+type StackMapFrame struct {
+	FrameType   uint8
+	OffsetDelta uint16
+	// Number of trailing locals removed by a chop frame
+	Chopped int
+	// Locals appended by an append frame or all the locals of a full frame
+	Locals []VerificationTypeInfo
+	Stack  []VerificationTypeInfo
+}
+
+type StackMapTableAttribute []StackMapFrame
+
+func readVerificationTypeInfo(info []byte, offset *int) (VerificationTypeInfo, error) {
+	if *offset >= len(info) {
+		return VerificationTypeInfo{}, fmt.Errorf("truncated verification type info")
+	}
+	typeInfo := VerificationTypeInfo{Tag: VerificationTypeTag(info[*offset])}
+	*offset += 1
+	switch typeInfo.Tag {
+	case ItemTop, ItemInteger, ItemFloat, ItemDouble, ItemLong, ItemNull, ItemUninitializedThis:
+	case ItemObject, ItemUninitialized:
+		if *offset+2 > len(info) {
+			return typeInfo, fmt.Errorf("truncated verification type info")
+		}
+		if typeInfo.Tag == ItemObject {
+			typeInfo.CpoolIndex = binary.BigEndian.Uint16(info[*offset:])
+		} else {
+			typeInfo.Offset = binary.BigEndian.Uint16(info[*offset:])
+		}
+		*offset += 2
+	default:
+		return typeInfo, fmt.Errorf("invalid verification type tag %d", typeInfo.Tag)
+	}
+	return typeInfo, nil
+}
+
+func readVerificationTypeInfos(info []byte, offset *int, count int) ([]VerificationTypeInfo, error) {
+	types := make([]VerificationTypeInfo, count)
+	for i := range count {
+		typeInfo, err := readVerificationTypeInfo(info, offset)
+		if err != nil {
+			return nil, err
+		}
+		types[i] = typeInfo
+	}
+	return types, nil
+}
+
+func ReadStackMapTable(info []byte) (StackMapTableAttribute, error) {
+	if len(info) < 2 {
+		return nil, fmt.Errorf("truncated StackMapTable")
+	}
+	numberOfEntries := binary.BigEndian.Uint16(info)
+	offset := 2
+	table := make(StackMapTableAttribute, numberOfEntries)
+	for i := range numberOfEntries {
+		if offset >= len(info) {
+			return nil, fmt.Errorf("truncated StackMapTable")
+		}
+		frame := StackMapFrame{FrameType: info[offset]}
+		offset += 1
+
+		var err error
+		switch {
+		case frame.FrameType <= 63: // same_frame
+			frame.OffsetDelta = uint16(frame.FrameType)
+		case frame.FrameType <= 127: // same_locals_1_stack_item_frame
+			frame.OffsetDelta = uint16(frame.FrameType - 64)
+			frame.Stack, err = readVerificationTypeInfos(info, &offset, 1)
+		case frame.FrameType < 247:
+			return nil, fmt.Errorf("reserved stack map frame type %d", frame.FrameType)
+		default:
+			if offset+2 > len(info) {
+				return nil, fmt.Errorf("truncated StackMapTable")
+			}
+			frame.OffsetDelta = binary.BigEndian.Uint16(info[offset:])
+			offset += 2
+
+			switch {
+			case frame.FrameType == 247: // same_locals_1_stack_item_frame_extended
+				frame.Stack, err = readVerificationTypeInfos(info, &offset, 1)
+			case frame.FrameType <= 250: // chop_frame
+				frame.Chopped = 251 - int(frame.FrameType)
+			case frame.FrameType == 251: // same_frame_extended
+			case frame.FrameType <= 254: // append_frame
+				frame.Locals, err = readVerificationTypeInfos(info, &offset, int(frame.FrameType)-251)
+			default: // full_frame
+				if offset+2 > len(info) {
+					return nil, fmt.Errorf("truncated StackMapTable")
+				}
+				numberOfLocals := int(binary.BigEndian.Uint16(info[offset:]))
+				offset += 2
+				if frame.Locals, err = readVerificationTypeInfos(info, &offset, numberOfLocals); err != nil {
+					break
+				}
+				if offset+2 > len(info) {
+					return nil, fmt.Errorf("truncated StackMapTable")
+				}
+				numberOfStackItems := int(binary.BigEndian.Uint16(info[offset:]))
+				offset += 2
+				frame.Stack, err = readVerificationTypeInfos(info, &offset, numberOfStackItems)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		table[i] = frame
+	}
+	return table, nil
+}
@@ -0,0 +1,878 @@
+package jvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// Coders of String.value
+const (
+	CoderLatin1 byte = 0
+	CoderUTF16  byte = 1
+)
+
+// String is a java.lang.String laid out like the compact strings of the
+// JDK: Value holds one byte per char when every char fits in Latin-1, and
+// two little endian bytes per char otherwise
+type String struct {
+	Header
+	Value []byte
+	Coder byte
+	// Cached hashCode, hashIsZero tells a computed 0 from a missing one
+	hash       int32
+	hashIsZero bool
+}
+
+// newStringFromChars returns the string of UTF-16 chars, compacted to
+// Latin-1 when possible
+func newStringFromChars(chars []uint16) *String {
+	latin1 := true
+	for _, c := range chars {
+		if c > 0xFF {
+			latin1 = false
+			break
+		}
+	}
+	if latin1 {
+		value := make([]byte, len(chars))
+		for i, c := range chars {
+			value[i] = byte(c)
+		}
+		return &String{Value: value, Coder: CoderLatin1}
+	}
+	value := make([]byte, 2*len(chars))
+	for i, c := range chars {
+		binary.LittleEndian.PutUint16(value[2*i:], c)
+	}
+	return &String{Value: value, Coder: CoderUTF16}
+}
+
+// NewString returns a new string holding s, which can be in UTF-8 or in the
+// modified UTF-8 of class files (JVMS §4.4.7)
+func NewString(s string) *String {
+	return newStringFromChars(decodeModifiedUTF8(s))
+}
+
+// decodeModifiedUTF8 decodes the bytes of s into UTF-16 chars. Modified
+// UTF-8 encodes supplementary characters as two 3-byte surrogates and NUL on
+// two bytes, both are decoded along with the 4-byte sequences of UTF-8.
+// Malformed bytes are decoded as Latin-1
+func decodeModifiedUTF8(s string) []uint16 {
+	chars := make([]uint16, 0, len(s))
+	continuation := func(i int) bool {
+		return i < len(s) && s[i]&0xC0 == 0x80
+	}
+	for i := 0; i < len(s); {
+		b := s[i]
+		switch {
+		case b < 0x80:
+			chars = append(chars, uint16(b))
+			i++
+		case b&0xE0 == 0xC0 && continuation(i+1):
+			chars = append(chars, uint16(b&0x1F)<<6|uint16(s[i+1]&0x3F))
+			i += 2
+		case b&0xF0 == 0xE0 && continuation(i+1) && continuation(i+2):
+			chars = append(chars, uint16(b&0x0F)<<12|uint16(s[i+1]&0x3F)<<6|uint16(s[i+2]&0x3F))
+			i += 3
+		case b&0xF8 == 0xF0 && continuation(i+1) && continuation(i+2) && continuation(i+3):
+			r := rune(b&0x07)<<18 | rune(s[i+1]&0x3F)<<12 | rune(s[i+2]&0x3F)<<6 | rune(s[i+3]&0x3F)
+			high, low := utf16.EncodeRune(r)
+			chars = append(chars, uint16(high), uint16(low))
+			i += 4
+		default:
+			chars = append(chars, uint16(b))
+			i++
+		}
+	}
+	return chars
+}
+
+// Length returns the number of chars
+func (s *String) Length() int {
+	if s.Coder == CoderLatin1 {
+		return len(s.Value)
+	}
+	return len(s.Value) / 2
+}
+
+// CharAt returns the char at index, which must be in range
+func (s *String) CharAt(index int) uint16 {
+	if s.Coder == CoderLatin1 {
+		return uint16(s.Value[index])
+	}
+	return binary.LittleEndian.Uint16(s.Value[2*index:])
+}
+
+// Chars returns the string as UTF-16 chars
+func (s *String) Chars() []uint16 {
+	chars := make([]uint16, s.Length())
+	for i := range chars {
+		chars[i] = s.CharAt(i)
+	}
+	return chars
+}
+
+// Substring returns the chars from begin to end, which must be in range
+func (s *String) Substring(begin, end int) *String {
+	if begin == 0 && end == s.Length() {
+		return s
+	}
+	// Recompacted, the chars left may all fit in Latin-1
+	return newStringFromChars(s.Chars()[begin:end])
+}
+
+// Concat returns the string followed by other
+func (s *String) Concat(other *String) *String {
+	if other.Length() == 0 {
+		return s
+	}
+	if s.Length() == 0 {
+		return other
+	}
+	if s.Coder == CoderLatin1 && other.Coder == CoderLatin1 {
+		return &String{Value: append(append([]byte(nil), s.Value...), other.Value...), Coder: CoderLatin1}
+	}
+	return newStringFromChars(append(s.Chars(), other.Chars()...))
+}
+
+// Equals compares the chars of two strings. Strings are always compacted
+// when they can be, so strings with different coders differ
+func (s *String) Equals(other *String) bool {
+	return s.Coder == other.Coder && bytes.Equal(s.Value, other.Value)
+}
+
+// HashCode returns s[0]*31^(n-1) + s[1]*31^(n-2) + ... + s[n-1]
+func (s *String) HashCode() int32 {
+	if s.hash != 0 || s.hashIsZero {
+		return s.hash
+	}
+	hash := int32(0)
+	for i, n := 0, s.Length(); i < n; i++ {
+		hash = 31*hash + int32(s.CharAt(i))
+	}
+	if hash == 0 {
+		s.hashIsZero = true
+	}
+	s.hash = hash
+	return hash
+}
+
+// String converts the string to UTF-8, unpaired surrogates become U+FFFD
+func (s *String) String() string {
+	return string(utf16.Decode(s.Chars()))
+}
+
+// utf8 encodes the string as UTF-8. Unpaired surrogates become '?' the way
+// getBytes encodes them, or keep their three byte form when keepSurrogates
+// is set, which NewString decodes back. Go's regexp reads those as invalid
+// bytes, so they survive a match
+func (s *String) utf8(keepSurrogates bool) []byte {
+	chars := s.Chars()
+	out := make([]byte, 0, len(chars))
+	for i := 0; i < len(chars); i++ {
+		c := chars[i]
+		if !utf16.IsSurrogate(rune(c)) {
+			out = utf8.AppendRune(out, rune(c))
+			continue
+		}
+		if i+1 < len(chars) {
+			if r := utf16.DecodeRune(rune(c), rune(chars[i+1])); r != unicode.ReplacementChar {
+				out = utf8.AppendRune(out, r)
+				i++
+				continue
+			}
+		}
+		if keepSurrogates {
+			out = append(out, 0xE0|byte(c>>12), 0x80|byte(c>>6)&0x3F, 0x80|byte(c)&0x3F)
+		} else {
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// field reads a field of the String class of the JDK, whose code accesses
+// them. value is a copy, strings are immutable once constructed
+func (s *String) field(name string) StackData {
+	switch name {
+	case "value":
+		value := NewArray("[B", len(s.Value))
+		for i, b := range s.Value {
+			value.Elements[i] = intValue(int32(int8(b)))
+		}
+		return referenceValue(value)
+	case "coder":
+		return intValue(int32(s.Coder))
+	case "hash":
+		return intValue(s.hash)
+	case "hashIsZero":
+		return booleanValue(s.hashIsZero)
+	}
+	return zeroValue("I")
+}
+
+// setField writes a field of the String class of the JDK, done by its
+// constructors and hashCode
+func (s *String) setField(name string, v StackData) {
+	switch name {
+	case "value":
+		s.Value = nil
+		if value, ok := v.Data.(*Array); ok {
+			s.Value = make([]byte, len(value.Elements))
+			for i, b := range value.Elements {
+				s.Value[i] = byte(b.Int())
+			}
+		}
+	case "coder":
+		s.Coder = byte(v.Int())
+	case "hash":
+		s.hash = v.Int()
+	case "hashIsZero":
+		s.hashIsZero = v.Int() != 0
+	}
+}
+
+// Intern returns the canonical instance of the string, the one string
+// literals evaluate to
+func (jvm *Jvm) Intern(s *String) *String {
+	key := string(s.Coder) + string(s.Value)
+	if interned, ok := jvm.strings[key]; ok {
+		return interned
+	}
+	jvm.strings[key] = s
+	return s
+}
+
+// internString returns the interned string of a string constant
+func (jvm *Jvm) internString(s string) *String {
+	return jvm.Intern(NewString(s))
+}
+
+// toJavaString converts a value of type t to a string the way string
+// concatenation does
+func (jvm *Jvm) toJavaString(value StackData, t descriptor.Type) (*String, error) {
+	if t == descriptor.Char {
+		return newStringFromChars([]uint16{uint16(value.Int())}), nil
+	}
+	if _, ok := t.(descriptor.BaseType); !ok {
+		switch reference := value.Data.(type) {
+		case nil:
+			return NewString("null"), nil
+		case *String:
+			return reference, nil
+		case *Array:
+			if reference.Descriptor == "[C" && t.Descriptor() == "[C" {
+				chars, err := arrayChars(value, 0, len(reference.Elements))
+				if err != nil {
+					return nil, err
+				}
+				return newStringFromChars(chars), nil
+			}
+		case *Object:
+			result, err := jvm.InvokeVirtual("java/lang/Object", "toString", "()Ljava/lang/String;", []StackData{value})
+			if err != nil || result.IsNull() {
+				return NewString("null"), err
+			}
+			return result.Data.(*String), nil
+		}
+	}
+	s, err := jvm.javaString(value, t)
+	if err != nil {
+		return nil, err
+	}
+	return NewString(s), nil
+}
+
+// indexOfChars returns the first index of needle in chars from from, -1 if
+// there is none
+func indexOfChars(chars, needle []uint16, from int) int {
+	from = max(from, 0)
+	for i := from; i+len(needle) <= len(chars); i++ {
+		if slices.Equal(chars[i:i+len(needle)], needle) {
+			return i
+		}
+	}
+	return -1
+}
+
+// lastIndexOfChars returns the last index of needle in chars at or before
+// from, -1 if there is none
+func lastIndexOfChars(chars, needle []uint16, from int) int {
+	for i := min(from, len(chars)-len(needle)); i >= 0; i-- {
+		if slices.Equal(chars[i:i+len(needle)], needle) {
+			return i
+		}
+	}
+	return -1
+}
+
+// codePointChars returns the chars of a code point, a surrogate pair for
+// the supplementary ones
+func codePointChars(codePoint int32) []uint16 {
+	if codePoint > 0xFFFF {
+		high, low := utf16.EncodeRune(rune(codePoint))
+		return []uint16{uint16(high), uint16(low)}
+	}
+	return []uint16{uint16(codePoint)}
+}
+
+// mapCodePoints applies f to the code points of chars, unpaired surrogates
+// are kept as they are
+func mapCodePoints(chars []uint16, f func(rune) rune) []uint16 {
+	mapped := make([]uint16, 0, len(chars))
+	for i := 0; i < len(chars); i++ {
+		c := chars[i]
+		if utf16.IsSurrogate(rune(c)) {
+			if i+1 < len(chars) {
+				if r := utf16.DecodeRune(rune(c), rune(chars[i+1])); r != unicode.ReplacementChar {
+					mapped = utf16.AppendRune(mapped, f(r))
+					i++
+					continue
+				}
+			}
+			mapped = append(mapped, c)
+			continue
+		}
+		mapped = utf16.AppendRune(mapped, f(rune(c)))
+	}
+	return mapped
+}
+
+// foldCase maps a char the way the case insensitive comparisons of String
+// do, to the lower case of its upper case
+func foldCase(c uint16) rune {
+	return unicode.ToLower(unicode.ToUpper(rune(c)))
+}
+
+// CompareTo compares two strings lexicographically by char, the way
+// String.compareTo does
+func (s *String) CompareTo(other *String) int32 {
+	n, m := s.Length(), other.Length()
+	for i := 0; i < min(n, m); i++ {
+		if a, b := s.CharAt(i), other.CharAt(i); a != b {
+			return int32(a) - int32(b)
+		}
+	}
+	return int32(n - m)
+}
+
+// charSequence converts a CharSequence argument to a string with its
+// toString method
+func (jvm *Jvm) charSequence(value StackData) (*String, error) {
+	if value.IsNull() {
+		return nil, throwable("java/lang/NullPointerException", "")
+	}
+	return jvm.toJavaString(value, &descriptor.ObjectType{ClassName: "java/lang/Object"})
+}
+
+// charArray returns a char[] holding chars
+func charArray(chars []uint16) *Array {
+	array := NewArray("[C", len(chars))
+	for i, c := range chars {
+		array.Elements[i] = intValue(int32(c))
+	}
+	return array
+}
+
+// arrayChars returns the chars of the range of a char[] argument
+func arrayChars(value StackData, offset, count int) ([]uint16, error) {
+	array, ok := value.Data.(*Array)
+	if !ok {
+		return nil, throwable("java/lang/NullPointerException", "")
+	}
+	if offset < 0 || count < 0 || offset+count > len(array.Elements) {
+		return nil, stringIndexOutOfBounds("offset %d, count %d, length %d", offset, count, len(array.Elements))
+	}
+	chars := make([]uint16, count)
+	for i := range chars {
+		chars[i] = uint16(array.Elements[offset+i].Int())
+	}
+	return chars, nil
+}
+
+// javaRegexp compiles a regular expression of java.util.regex. The syntax
+// of Go's regexp package is close enough for the common expressions
+func javaRegexp(regex string) (*regexp.Regexp, error) {
+	compiled, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, throwable("java/util/regex/PatternSyntaxException", "%s", err)
+	}
+	return compiled, nil
+}
+
+// javaReplacement converts the group references of a Java replacement,
+// like $1, to the ones of Go, like ${1}, and unescapes \$
+func javaReplacement(replacement string) string {
+	var out strings.Builder
+	for i := 0; i < len(replacement); i++ {
+		switch c := replacement[i]; {
+		case c == '\\' && i+1 < len(replacement):
+			i++
+			if replacement[i] == '$' {
+				out.WriteString("$$")
+			} else {
+				out.WriteByte(replacement[i])
+			}
+		case c == '$':
+			j := i + 1
+			for j < len(replacement) && replacement[j] >= '0' && replacement[j] <= '9' {
+				j++
+			}
+			out.WriteString("${" + replacement[i+1:j] + "}")
+			i = j - 1
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// splitString implements String.split: trailing empty strings are removed
+// when limit is 0, and a zero width match at the start adds no leading
+// empty string
+func splitString(s string, re *regexp.Regexp, limit int) []string {
+	var parts []string
+	start := 0
+	for _, match := range re.FindAllStringIndex(s, -1) {
+		if limit > 0 && len(parts) == limit-1 {
+			break
+		}
+		if match[1] == 0 {
+			continue
+		}
+		parts = append(parts, s[start:match[0]])
+		start = match[1]
+	}
+	if parts == nil {
+		return []string{s}
+	}
+	parts = append(parts, s[start:])
+	if limit == 0 {
+		for len(parts) > 0 && parts[len(parts)-1] == "" {
+			parts = parts[:len(parts)-1]
+		}
+	}
+	return parts
+}
+
+// joinStrings joins the string form of elements with delimiter
+func (jvm *Jvm) joinStrings(delimiter *String, elements []StackData) (StackData, error) {
+	var joined []uint16
+	for i, element := range elements {
+		s, err := jvm.toJavaString(element, &descriptor.ObjectType{ClassName: "java/lang/Object"})
+		if err != nil {
+			return StackData{}, err
+		}
+		if i > 0 {
+			joined = append(joined, delimiter.Chars()...)
+		}
+		joined = append(joined, s.Chars()...)
+	}
+	return referenceValue(newStringFromChars(joined)), nil
+}
+
+func stringIndexOutOfBounds(format string, a ...interface{}) error {
+	return throwable("java/lang/StringIndexOutOfBoundsException", format, a...)
+}
+
+func init() {
+	receiver := func(call *NativeCall) *String {
+		return call.String(0)
+	}
+	RegisterNative("java/lang/String", "length", "()I", func(call *NativeCall) (StackData, error) {
+		return intValue(int32(receiver(call).Length())), nil
+	})
+	RegisterNative("java/lang/String", "isEmpty", "()Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(receiver(call).Length() == 0), nil
+	})
+	RegisterNative("java/lang/String", "charAt", "(I)C", func(call *NativeCall) (StackData, error) {
+		s, index := receiver(call), int(call.Int(1))
+		if index < 0 || index >= s.Length() {
+			return StackData{}, stringIndexOutOfBounds("Index %d out of bounds for length %d", index, s.Length())
+		}
+		return intValue(int32(s.CharAt(index))), nil
+	})
+	substring := func(call *NativeCall) (StackData, error) {
+		s := receiver(call)
+		begin, end := int(call.Int(1)), s.Length()
+		if len(call.Args) == 3 {
+			end = int(call.Int(2))
+		}
+		if begin < 0 || begin > end || end > s.Length() {
+			return StackData{}, stringIndexOutOfBounds("begin %d, end %d, length %d", begin, end, s.Length())
+		}
+		return referenceValue(s.Substring(begin, end)), nil
+	}
+	RegisterNative("java/lang/String", "substring", "(I)Ljava/lang/String;", substring)
+	RegisterNative("java/lang/String", "substring", "(II)Ljava/lang/String;", substring)
+	RegisterNative("java/lang/String", "equals", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		s, other := receiver(call), call.String(1)
+		return booleanValue(other != nil && (other == s || s.Equals(other))), nil
+	})
+	RegisterNative("java/lang/String", "hashCode", "()I", func(call *NativeCall) (StackData, error) {
+		return intValue(receiver(call).HashCode()), nil
+	})
+	RegisterNative("java/lang/String", "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return call.Args[0], nil
+	})
+	RegisterNative("java/lang/String", "intern", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.Intern(receiver(call))), nil
+	})
+	RegisterNative("java/lang/String", "concat", "(Ljava/lang/String;)Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		other := call.String(1)
+		if other == nil {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		return referenceValue(receiver(call).Concat(other)), nil
+	})
+
+	construct := func(call *NativeCall) (StackData, error) {
+		var value *String
+		switch call.Descriptor {
+		case "()V":
+			value = NewString("")
+		case "([C)V":
+			chars, err := arrayChars(call.Args[1], 0, len(call.Reference(1).(*Array).Elements))
+			if err != nil {
+				return StackData{}, err
+			}
+			value = newStringFromChars(chars)
+		case "([CII)V":
+			chars, err := arrayChars(call.Args[1], int(call.Int(2)), int(call.Int(3)))
+			if err != nil {
+				return StackData{}, err
+			}
+			value = newStringFromChars(chars)
+		case "([B)V":
+			bytes := call.Reference(1).(*Array).Elements
+			utf8 := make([]byte, len(bytes))
+			for i, b := range bytes {
+				utf8[i] = byte(b.Int())
+			}
+			value = NewString(strings.ToValidUTF8(string(utf8), "\uFFFD"))
+		default:
+			var err error
+			if value, err = call.Jvm.charSequence(call.Args[1]); err != nil {
+				return StackData{}, err
+			}
+		}
+		s := receiver(call)
+		s.Value, s.Coder = value.Value, value.Coder
+		return StackData{}, nil
+	}
+	for _, methodDescriptor := range []string{"()V", "(Ljava/lang/String;)V", "([C)V", "([CII)V", "([B)V", "(Ljava/lang/StringBuilder;)V", "(Ljava/lang/StringBuffer;)V"} {
+		RegisterNative("java/lang/String", "<init>", methodDescriptor, construct)
+	}
+
+	indexOf := func(call *NativeCall) (StackData, error) {
+		s := receiver(call)
+		var needle []uint16
+		if other := call.String(1); other != nil {
+			needle = other.Chars()
+		} else if call.Args[1].Type == StackTypeInt {
+			needle = codePointChars(call.Int(1))
+		} else {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		last := call.Name == "lastIndexOf"
+		from := 0
+		if last {
+			from = s.Length()
+		}
+		if len(call.Args) == 3 {
+			from = int(call.Int(2))
+		}
+		if last {
+			return intValue(int32(lastIndexOfChars(s.Chars(), needle, from))), nil
+		}
+		return intValue(int32(indexOfChars(s.Chars(), needle, from))), nil
+	}
+	for _, name := range []string{"indexOf", "lastIndexOf"} {
+		for _, methodDescriptor := range []string{"(I)I", "(II)I", "(Ljava/lang/String;)I", "(Ljava/lang/String;I)I"} {
+			RegisterNative("java/lang/String", name, methodDescriptor, indexOf)
+		}
+	}
+	RegisterNative("java/lang/String", "contains", "(Ljava/lang/CharSequence;)Z", func(call *NativeCall) (StackData, error) {
+		other, err := call.Jvm.charSequence(call.Args[1])
+		if err != nil {
+			return StackData{}, err
+		}
+		return booleanValue(indexOfChars(receiver(call).Chars(), other.Chars(), 0) >= 0), nil
+	})
+	startsWith := func(call *NativeCall) (StackData, error) {
+		s, prefix := receiver(call), call.String(1)
+		if prefix == nil {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		offset := 0
+		if len(call.Args) == 3 {
+			offset = int(call.Int(2))
+		}
+		if call.Name == "endsWith" {
+			offset = s.Length() - prefix.Length()
+		}
+		if offset < 0 || offset+prefix.Length() > s.Length() {
+			return booleanValue(false), nil
+		}
+		return booleanValue(slices.Equal(s.Chars()[offset:offset+prefix.Length()], prefix.Chars())), nil
+	}
+	RegisterNative("java/lang/String", "startsWith", "(Ljava/lang/String;)Z", startsWith)
+	RegisterNative("java/lang/String", "startsWith", "(Ljava/lang/String;I)Z", startsWith)
+	RegisterNative("java/lang/String", "endsWith", "(Ljava/lang/String;)Z", startsWith)
+
+	mapString := func(f func(rune) rune) Native {
+		return func(call *NativeCall) (StackData, error) {
+			chars := receiver(call).Chars()
+			if mapped := mapCodePoints(chars, f); !slices.Equal(mapped, chars) {
+				return referenceValue(newStringFromChars(mapped)), nil
+			}
+			return call.Args[0], nil
+		}
+	}
+	RegisterNative("java/lang/String", "toUpperCase", "()Ljava/lang/String;", mapString(unicode.ToUpper))
+	RegisterNative("java/lang/String", "toLowerCase", "()Ljava/lang/String;", mapString(unicode.ToLower))
+	RegisterNative("java/lang/String", "toUpperCase", "(Ljava/util/Locale;)Ljava/lang/String;", mapString(unicode.ToUpper))
+	RegisterNative("java/lang/String", "toLowerCase", "(Ljava/util/Locale;)Ljava/lang/String;", mapString(unicode.ToLower))
+	// The chars trimmed are all in the BMP, so no surrogate is
+	trimString := func(trimmed func(rune) bool, leading, trailing bool) Native {
+		return func(call *NativeCall) (StackData, error) {
+			s := receiver(call)
+			begin, end := 0, s.Length()
+			for leading && begin < end && trimmed(rune(s.CharAt(begin))) {
+				begin++
+			}
+			for trailing && end > begin && trimmed(rune(s.CharAt(end-1))) {
+				end--
+			}
+			return referenceValue(s.Substring(begin, end)), nil
+		}
+	}
+	RegisterNative("java/lang/String", "trim", "()Ljava/lang/String;", trimString(func(r rune) bool { return r <= ' ' }, true, true))
+	RegisterNative("java/lang/String", "strip", "()Ljava/lang/String;", trimString(isJavaWhitespace, true, true))
+	RegisterNative("java/lang/String", "stripLeading", "()Ljava/lang/String;", trimString(isJavaWhitespace, true, false))
+	RegisterNative("java/lang/String", "stripTrailing", "()Ljava/lang/String;", trimString(isJavaWhitespace, false, true))
+	RegisterNative("java/lang/String", "isBlank", "()Z", func(call *NativeCall) (StackData, error) {
+		for _, c := range receiver(call).Chars() {
+			if !isJavaWhitespace(rune(c)) {
+				return booleanValue(false), nil
+			}
+		}
+		return booleanValue(true), nil
+	})
+	RegisterNative("java/lang/String", "repeat", "(I)Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		count := int(call.Int(1))
+		if count < 0 {
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "count is negative: %d", count)
+		}
+		chars := receiver(call).Chars()
+		repeated := make([]uint16, 0, len(chars)*count)
+		for range count {
+			repeated = append(repeated, chars...)
+		}
+		return referenceValue(newStringFromChars(repeated)), nil
+	})
+	RegisterNative("java/lang/String", "replace", "(CC)Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		chars := receiver(call).Chars()
+		old, replacement := uint16(call.Int(1)), uint16(call.Int(2))
+		for i, c := range chars {
+			if c == old {
+				chars[i] = replacement
+			}
+		}
+		return referenceValue(newStringFromChars(chars)), nil
+	})
+	RegisterNative("java/lang/String", "replace", "(Ljava/lang/CharSequence;Ljava/lang/CharSequence;)Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		target, err := call.Jvm.charSequence(call.Args[1])
+		if err != nil {
+			return StackData{}, err
+		}
+		replacement, err := call.Jvm.charSequence(call.Args[2])
+		if err != nil {
+			return StackData{}, err
+		}
+		chars, targetChars, replacementChars := receiver(call).Chars(), target.Chars(), replacement.Chars()
+		// An empty target matches before every char and at the end
+		if len(targetChars) == 0 {
+			replaced := append([]uint16(nil), replacementChars...)
+			for _, c := range chars {
+				replaced = append(append(replaced, c), replacementChars...)
+			}
+			return referenceValue(newStringFromChars(replaced)), nil
+		}
+		var replaced []uint16
+		start := 0
+		for i := indexOfChars(chars, targetChars, 0); i >= 0; i = indexOfChars(chars, targetChars, start) {
+			replaced = append(append(replaced, chars[start:i]...), replacementChars...)
+			start = i + len(targetChars)
+		}
+		if start == 0 {
+			return call.Args[0], nil
+		}
+		return referenceValue(newStringFromChars(append(replaced, chars[start:]...))), nil
+	})
+	regexNative := func(f func(call *NativeCall, s string, re *regexp.Regexp) StackData) Native {
+		return func(call *NativeCall) (StackData, error) {
+			if call.String(1) == nil {
+				return StackData{}, throwable("java/lang/NullPointerException", "")
+			}
+			re, err := javaRegexp(call.GoString(1))
+			if err != nil {
+				return StackData{}, err
+			}
+			return f(call, string(receiver(call).utf8(true)), re), nil
+		}
+	}
+	split := regexNative(func(call *NativeCall, s string, re *regexp.Regexp) StackData {
+		limit := 0
+		if len(call.Args) == 3 {
+			limit = int(call.Int(2))
+		}
+		return referenceValue(call.Jvm.stringArray(splitString(s, re, limit)))
+	})
+	RegisterNative("java/lang/String", "split", "(Ljava/lang/String;)[Ljava/lang/String;", split)
+	RegisterNative("java/lang/String", "split", "(Ljava/lang/String;I)[Ljava/lang/String;", split)
+	RegisterNative("java/lang/String", "matches", "(Ljava/lang/String;)Z", regexNative(func(call *NativeCall, s string, re *regexp.Regexp) StackData {
+		match := re.FindStringIndex(s)
+		// The whole string has to match
+		if match == nil || match[0] != 0 || match[1] != len(s) {
+			anchored, err := regexp.Compile(`^(?:` + re.String() + `)$`)
+			return booleanValue(err == nil && anchored.MatchString(s))
+		}
+		return booleanValue(true)
+	}))
+	RegisterNative("java/lang/String", "replaceAll", "(Ljava/lang/String;Ljava/lang/String;)Ljava/lang/String;", regexNative(func(call *NativeCall, s string, re *regexp.Regexp) StackData {
+		return referenceValue(NewString(re.ReplaceAllString(s, javaReplacement(call.GoString(2)))))
+	}))
+	RegisterNative("java/lang/String", "replaceFirst", "(Ljava/lang/String;Ljava/lang/String;)Ljava/lang/String;", regexNative(func(call *NativeCall, s string, re *regexp.Regexp) StackData {
+		match := re.FindStringSubmatchIndex(s)
+		if match == nil {
+			return call.Args[0]
+		}
+		replaced := re.ExpandString(nil, javaReplacement(call.GoString(2)), s, match)
+		return referenceValue(NewString(s[:match[0]] + string(replaced) + s[match[1]:]))
+	}))
+
+	RegisterNative("java/lang/String", "toCharArray", "()[C", func(call *NativeCall) (StackData, error) {
+		return referenceValue(charArray(receiver(call).Chars())), nil
+	})
+	RegisterNative("java/lang/String", "getBytes", "()[B", func(call *NativeCall) (StackData, error) {
+		encoded := receiver(call).utf8(false)
+		array := NewArray("[B", len(encoded))
+		for i, b := range encoded {
+			array.Elements[i] = intValue(int32(int8(b)))
+		}
+		return referenceValue(array), nil
+	})
+	RegisterNative("java/lang/String", "codePointAt", "(I)I", func(call *NativeCall) (StackData, error) {
+		s, index := receiver(call), int(call.Int(1))
+		if index < 0 || index >= s.Length() {
+			return StackData{}, stringIndexOutOfBounds("Index %d out of bounds for length %d", index, s.Length())
+		}
+		c := s.CharAt(index)
+		if utf16.IsSurrogate(rune(c)) && index+1 < s.Length() {
+			if r := utf16.DecodeRune(rune(c), rune(s.CharAt(index+1))); r != unicode.ReplacementChar {
+				return intValue(int32(r)), nil
+			}
+		}
+		return intValue(int32(c)), nil
+	})
+	compareTo := func(call *NativeCall) (StackData, error) {
+		other := call.String(1)
+		if other == nil {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		s := receiver(call)
+		if call.Name == "compareToIgnoreCase" {
+			for i, n := 0, min(s.Length(), other.Length()); i < n; i++ {
+				if a, b := foldCase(s.CharAt(i)), foldCase(other.CharAt(i)); a != b {
+					return intValue(a - b), nil
+				}
+			}
+			return intValue(int32(s.Length() - other.Length())), nil
+		}
+		return intValue(s.CompareTo(other)), nil
+	}
+	RegisterNative("java/lang/String", "compareTo", "(Ljava/lang/String;)I", compareTo)
+	RegisterNative("java/lang/String", "compareTo", "(Ljava/lang/Object;)I", compareTo)
+	RegisterNative("java/lang/String", "compareToIgnoreCase", "(Ljava/lang/String;)I", compareTo)
+	RegisterNative("java/lang/String", "equalsIgnoreCase", "(Ljava/lang/String;)Z", func(call *NativeCall) (StackData, error) {
+		s, other := receiver(call), call.String(1)
+		if other == nil || other.Length() != s.Length() {
+			return booleanValue(false), nil
+		}
+		for i, n := 0, s.Length(); i < n; i++ {
+			if a, b := s.CharAt(i), other.CharAt(i); a != b && foldCase(a) != foldCase(b) {
+				return booleanValue(false), nil
+			}
+		}
+		return booleanValue(true), nil
+	})
+	RegisterNative("java/lang/String", "contentEquals", "(Ljava/lang/CharSequence;)Z", func(call *NativeCall) (StackData, error) {
+		other, err := call.Jvm.charSequence(call.Args[1])
+		if err != nil {
+			return StackData{}, err
+		}
+		return booleanValue(receiver(call).Equals(other)), nil
+	})
+
+	// Static methods
+	valueOf := func(call *NativeCall) (StackData, error) {
+		methodType, err := descriptor.ParseMethod(call.Descriptor)
+		if err != nil {
+			return StackData{}, err
+		}
+		s, err := call.Jvm.toJavaString(call.Args[0], methodType.Params[0])
+		return referenceValue(s), err
+	}
+	for _, methodDescriptor := range []string{"(Ljava/lang/Object;)", "(I)", "(J)", "(F)", "(D)", "(Z)", "(C)", "([C)"} {
+		RegisterNative("java/lang/String", "valueOf", methodDescriptor+"Ljava/lang/String;", valueOf)
+	}
+	copyValueOf := func(call *NativeCall) (StackData, error) {
+		array, ok := call.Reference(0).(*Array)
+		if !ok {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		offset, count := 0, len(array.Elements)
+		if len(call.Args) == 3 {
+			offset, count = int(call.Int(1)), int(call.Int(2))
+		}
+		chars, err := arrayChars(call.Args[0], offset, count)
+		if err != nil {
+			return StackData{}, err
+		}
+		return referenceValue(newStringFromChars(chars)), nil
+	}
+	RegisterNative("java/lang/String", "copyValueOf", "([C)Ljava/lang/String;", copyValueOf)
+	RegisterNative("java/lang/String", "valueOf", "([CII)Ljava/lang/String;", copyValueOf)
+	RegisterNative("java/lang/String", "copyValueOf", "([CII)Ljava/lang/String;", copyValueOf)
+	RegisterNative("java/lang/String", "join", "(Ljava/lang/CharSequence;[Ljava/lang/CharSequence;)Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		delimiter, err := call.Jvm.charSequence(call.Args[0])
+		if err != nil {
+			return StackData{}, err
+		}
+		elements, ok := call.Reference(1).(*Array)
+		if !ok {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		return call.Jvm.joinStrings(delimiter, elements.Elements)
+	})
+	RegisterNative("java/lang/String", "join", "(Ljava/lang/CharSequence;Ljava/lang/Iterable;)Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		delimiter, err := call.Jvm.charSequence(call.Args[0])
+		if err != nil {
+			return StackData{}, err
+		}
+		elements, err := call.Jvm.collectionElements(call.Args[1])
+		if err != nil {
+			return StackData{}, err
+		}
+		return call.Jvm.joinStrings(delimiter, elements)
+	})
+}
@@ -0,0 +1,368 @@
+package jvm
+
+import (
+	"slices"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+const (
+	builderValue = "java/lang/AbstractStringBuilder.value"
+	builderCount = "java/lang/AbstractStringBuilder.count"
+)
+
+// builderChars returns the chars of a StringBuilder, sharing its buffer
+func builderChars(builder *Object) []StackData {
+	value, _ := builder.Fields[builderValue].Data.(*Array)
+	if value == nil {
+		return nil
+	}
+	return value.Elements[:builder.Fields[builderCount].Int()]
+}
+
+// setBuilderChars makes chars the content of a StringBuilder, growing its
+// buffer the way AbstractStringBuilder does when they don't fit
+func setBuilderChars(builder *Object, chars []StackData) {
+	value, _ := builder.Fields[builderValue].Data.(*Array)
+	count := int(builder.Fields[builderCount].Int())
+	if value == nil || len(value.Elements) < len(chars) {
+		capacity := 0
+		if value != nil {
+			capacity = len(value.Elements)
+		}
+		grown := NewArray("[C", max(capacity*2+2, len(chars)))
+		copy(grown.Elements, chars)
+		builder.Fields[builderValue] = referenceValue(grown)
+	} else {
+		copy(value.Elements, chars)
+		for i := len(chars); i < count; i++ {
+			value.Elements[i] = intValue(0)
+		}
+	}
+	builder.Fields[builderCount] = intValue(int32(len(chars)))
+}
+
+// appendString appends the chars of s to a StringBuilder
+func appendString(builder *Object, s *String) {
+	chars := builderChars(builder)
+	for _, c := range s.Chars() {
+		chars = append(chars, intValue(int32(c)))
+	}
+	setBuilderChars(builder, chars)
+}
+
+// builderString returns the content of a StringBuilder
+func builderString(builder *Object) *String {
+	chars := builderChars(builder)
+	utf16 := make([]uint16, len(chars))
+	for i, c := range chars {
+		utf16[i] = uint16(c.Int())
+	}
+	return newStringFromChars(utf16)
+}
+
+// builderUTF16 returns a copy of the chars of a StringBuilder
+func builderUTF16(builder *Object) []uint16 {
+	chars := builderChars(builder)
+	utf16 := make([]uint16, len(chars))
+	for i, c := range chars {
+		utf16[i] = uint16(c.Int())
+	}
+	return utf16
+}
+
+// setBuilderUTF16 makes chars the content of a StringBuilder
+func setBuilderUTF16(builder *Object, chars []uint16) {
+	values := make([]StackData, len(chars))
+	for i, c := range chars {
+		values[i] = intValue(int32(c))
+	}
+	setBuilderChars(builder, values)
+}
+
+// reverseChars reverses chars in place, keeping the surrogate pairs in
+// order like AbstractStringBuilder.reverse
+func reverseChars(chars []uint16) {
+	for i, j := 0, len(chars)-1; i < j; i, j = i+1, j-1 {
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	for i := 0; i+1 < len(chars); i++ {
+		if utf16.IsSurrogate(rune(chars[i])) && chars[i] >= 0xdc00 && chars[i+1] < 0xdc00 && utf16.IsSurrogate(rune(chars[i+1])) {
+			chars[i], chars[i+1] = chars[i+1], chars[i]
+			i++
+		}
+	}
+}
+
+// builderArgument returns the chars that append and insert add for the
+// argument i of type t, start and end giving a range of it when the
+// method takes one
+func (jvm *Jvm) builderArgument(call *NativeCall, i int, t descriptor.Type) ([]uint16, error) {
+	if t.Descriptor() == "[C" {
+		array, ok := call.Args[i].Data.(*Array)
+		if !ok {
+			return nil, throwable("java/lang/NullPointerException", "")
+		}
+		offset, count := 0, len(array.Elements)
+		if len(call.Args) > i+2 {
+			offset, count = int(call.Int(i+1)), int(call.Int(i+2))
+			if offset < 0 || count < 0 || offset > len(array.Elements)-count {
+				return nil, throwable("java/lang/IndexOutOfBoundsException", "start %d, end %d, length %d", offset, offset+count, len(array.Elements))
+			}
+		}
+		return arrayChars(call.Args[i], offset, count)
+	}
+	s, err := jvm.toJavaString(call.Args[i], t)
+	if err != nil {
+		return nil, err
+	}
+	chars := s.Chars()
+	if len(call.Args) > i+2 {
+		start, end := int(call.Int(i+1)), int(call.Int(i+2))
+		if start < 0 || start > end || end > len(chars) {
+			return nil, throwable("java/lang/IndexOutOfBoundsException", "start %d, end %d, length %d", start, end, len(chars))
+		}
+		chars = chars[start:end]
+	}
+	return chars, nil
+}
+
+// checkBuilderRange throws like AbstractStringBuilder.checkRangeSIOOBE
+// unless start and end delimit a range of count chars
+func checkBuilderRange(start, end, count int) error {
+	if start < 0 || start > end || end > count {
+		return stringIndexOutOfBounds("start %d, end %d, length %d", start, end, count)
+	}
+	return nil
+}
+
+// builderClasses are the classes sharing the natives of
+// AbstractStringBuilder, whose append methods return their own type.
+// StringBuffer needs no locking of its own as natives run under the vm
+// lock
+var builderClasses = []string{"java/lang/StringBuilder", "java/lang/StringBuffer"}
+
+func init() {
+	for _, className := range builderClasses {
+		self := "L" + className + ";"
+		construct := func(call *NativeCall) (StackData, error) {
+			builder := call.Object(0)
+			switch call.Descriptor {
+			case "(I)V":
+				if call.Int(1) < 0 {
+					return StackData{}, throwable("java/lang/NegativeArraySizeException", "%d", call.Int(1))
+				}
+				builder.Fields[builderValue] = referenceValue(NewArray("[C", int(call.Int(1))))
+			case "()V":
+				builder.Fields[builderValue] = referenceValue(NewArray("[C", 16))
+			default:
+				s, err := call.Jvm.charSequence(call.Args[1])
+				if err != nil {
+					return StackData{}, err
+				}
+				builder.Fields[builderValue] = referenceValue(NewArray("[C", s.Length()+16))
+				appendString(builder, s)
+			}
+			return StackData{}, nil
+		}
+		for _, methodDescriptor := range []string{"()V", "(I)V", "(Ljava/lang/String;)V", "(Ljava/lang/CharSequence;)V"} {
+			RegisterNative(className, "<init>", methodDescriptor, construct)
+		}
+
+		appendValue := func(call *NativeCall) (StackData, error) {
+			methodType, err := descriptor.ParseMethod(call.Descriptor)
+			if err != nil {
+				return StackData{}, err
+			}
+			chars, err := call.Jvm.builderArgument(call, 1, methodType.Params[0])
+			if err != nil {
+				return StackData{}, err
+			}
+			builder := call.Object(0)
+			setBuilderUTF16(builder, append(builderUTF16(builder), chars...))
+			return call.Args[0], nil
+		}
+		for _, params := range []string{"Ljava/lang/String;", "Ljava/lang/Object;", "Ljava/lang/CharSequence;", "Ljava/lang/StringBuffer;", "I", "J", "C", "Z", "F", "D", "[C", "[CII", "Ljava/lang/CharSequence;II"} {
+			RegisterNative(className, "append", "("+params+")"+self, appendValue)
+		}
+		RegisterNative(className, "appendCodePoint", "(I)"+self, func(call *NativeCall) (StackData, error) {
+			if call.Int(1) < 0 || call.Int(1) > unicode.MaxRune {
+				return StackData{}, throwable("java/lang/IllegalArgumentException", "Not a valid Unicode code point: 0x%X", uint32(call.Int(1)))
+			}
+			builder := call.Object(0)
+			setBuilderUTF16(builder, append(builderUTF16(builder), codePointChars(call.Int(1))...))
+			return call.Args[0], nil
+		})
+
+		insert := func(call *NativeCall) (StackData, error) {
+			methodType, err := descriptor.ParseMethod(call.Descriptor)
+			if err != nil {
+				return StackData{}, err
+			}
+			builder, offset := call.Object(0), int(call.Int(1))
+			current := builderUTF16(builder)
+			if offset < 0 || offset > len(current) {
+				return StackData{}, stringIndexOutOfBounds("offset %d, length %d", offset, len(current))
+			}
+			chars, err := call.Jvm.builderArgument(call, 2, methodType.Params[1])
+			if err != nil {
+				return StackData{}, err
+			}
+			setBuilderUTF16(builder, slices.Insert(current, offset, chars...))
+			return call.Args[0], nil
+		}
+		for _, params := range []string{"Ljava/lang/String;", "Ljava/lang/Object;", "Ljava/lang/CharSequence;", "I", "J", "C", "Z", "F", "D", "[C", "[CII", "Ljava/lang/CharSequence;II"} {
+			RegisterNative(className, "insert", "(I"+params+")"+self, insert)
+		}
+
+		RegisterNative(className, "delete", "(II)"+self, func(call *NativeCall) (StackData, error) {
+			builder := call.Object(0)
+			chars := builderUTF16(builder)
+			start, end := int(call.Int(1)), min(int(call.Int(2)), len(chars))
+			if err := checkBuilderRange(start, end, len(chars)); err != nil {
+				return StackData{}, err
+			}
+			setBuilderUTF16(builder, slices.Delete(chars, start, end))
+			return call.Args[0], nil
+		})
+		RegisterNative(className, "deleteCharAt", "(I)"+self, func(call *NativeCall) (StackData, error) {
+			builder, index := call.Object(0), int(call.Int(1))
+			chars := builderUTF16(builder)
+			if index < 0 || index >= len(chars) {
+				return StackData{}, stringIndexOutOfBounds("index %d,length %d", index, len(chars))
+			}
+			setBuilderUTF16(builder, slices.Delete(chars, index, index+1))
+			return call.Args[0], nil
+		})
+		RegisterNative(className, "replace", "(IILjava/lang/String;)"+self, func(call *NativeCall) (StackData, error) {
+			builder := call.Object(0)
+			chars := builderUTF16(builder)
+			start, end := int(call.Int(1)), min(int(call.Int(2)), len(chars))
+			if err := checkBuilderRange(start, end, len(chars)); err != nil {
+				return StackData{}, err
+			}
+			s := call.String(3)
+			if s == nil {
+				return StackData{}, throwable("java/lang/NullPointerException", "")
+			}
+			setBuilderUTF16(builder, slices.Replace(chars, start, end, s.Chars()...))
+			return call.Args[0], nil
+		})
+		RegisterNative(className, "reverse", "()"+self, func(call *NativeCall) (StackData, error) {
+			builder := call.Object(0)
+			chars := builderUTF16(builder)
+			reverseChars(chars)
+			setBuilderUTF16(builder, chars)
+			return call.Args[0], nil
+		})
+		RegisterNative(className, "setLength", "(I)V", func(call *NativeCall) (StackData, error) {
+			builder, length := call.Object(0), int(call.Int(1))
+			if length < 0 {
+				return StackData{}, stringIndexOutOfBounds("String index out of range: %d", length)
+			}
+			chars := builderUTF16(builder)
+			if length <= len(chars) {
+				chars = chars[:length]
+			} else {
+				chars = append(chars, make([]uint16, length-len(chars))...)
+			}
+			setBuilderUTF16(builder, chars)
+			return StackData{}, nil
+		})
+		RegisterNative(className, "setCharAt", "(IC)V", func(call *NativeCall) (StackData, error) {
+			chars, index := builderChars(call.Object(0)), int(call.Int(1))
+			if index < 0 || index >= len(chars) {
+				return StackData{}, stringIndexOutOfBounds("index %d,length %d", index, len(chars))
+			}
+			chars[index] = intValue(call.Int(2))
+			return StackData{}, nil
+		})
+
+		substring := func(call *NativeCall) (StackData, error) {
+			chars := builderUTF16(call.Object(0))
+			start, end := int(call.Int(1)), len(chars)
+			if len(call.Args) == 3 {
+				end = int(call.Int(2))
+			}
+			if err := checkBuilderRange(start, end, len(chars)); err != nil {
+				return StackData{}, err
+			}
+			return referenceValue(newStringFromChars(chars[start:end])), nil
+		}
+		RegisterNative(className, "substring", "(I)Ljava/lang/String;", substring)
+		RegisterNative(className, "substring", "(II)Ljava/lang/String;", substring)
+		RegisterNative(className, "subSequence", "(II)Ljava/lang/CharSequence;", substring)
+
+		indexOf := func(call *NativeCall) (StackData, error) {
+			needle := call.String(1)
+			if needle == nil {
+				return StackData{}, throwable("java/lang/NullPointerException", "")
+			}
+			chars := builderUTF16(call.Object(0))
+			if call.Name == "lastIndexOf" {
+				from := len(chars)
+				if len(call.Args) == 3 {
+					from = int(call.Int(2))
+				}
+				return intValue(int32(lastIndexOfChars(chars, needle.Chars(), from))), nil
+			}
+			from := 0
+			if len(call.Args) == 3 {
+				from = int(call.Int(2))
+			}
+			return intValue(int32(indexOfChars(chars, needle.Chars(), from))), nil
+		}
+		for _, name := range []string{"indexOf", "lastIndexOf"} {
+			RegisterNative(className, name, "(Ljava/lang/String;)I", indexOf)
+			RegisterNative(className, name, "(Ljava/lang/String;I)I", indexOf)
+		}
+
+		RegisterNative(className, "compareTo", "("+self+")I", func(call *NativeCall) (StackData, error) {
+			other := call.Object(1)
+			if other == nil {
+				return StackData{}, throwable("java/lang/NullPointerException", "")
+			}
+			return intValue(builderString(call.Object(0)).CompareTo(builderString(other))), nil
+		})
+		RegisterNative(className, "capacity", "()I", func(call *NativeCall) (StackData, error) {
+			value, _ := call.Object(0).Fields[builderValue].Data.(*Array)
+			if value == nil {
+				return intValue(0), nil
+			}
+			return intValue(int32(len(value.Elements))), nil
+		})
+		RegisterNative(className, "ensureCapacity", "(I)V", func(call *NativeCall) (StackData, error) {
+			builder := call.Object(0)
+			value, _ := builder.Fields[builderValue].Data.(*Array)
+			if value != nil && int(call.Int(1)) > len(value.Elements) {
+				grown := NewArray("[C", max(len(value.Elements)*2+2, int(call.Int(1))))
+				copy(grown.Elements, value.Elements)
+				builder.Fields[builderValue] = referenceValue(grown)
+			}
+			return StackData{}, nil
+		})
+		RegisterNative(className, "trimToSize", "()V", func(call *NativeCall) (StackData, error) {
+			builder := call.Object(0)
+			chars := builderChars(builder)
+			trimmed := NewArray("[C", len(chars))
+			copy(trimmed.Elements, chars)
+			builder.Fields[builderValue] = referenceValue(trimmed)
+			return StackData{}, nil
+		})
+		RegisterNative(className, "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+			return referenceValue(builderString(call.Object(0))), nil
+		})
+		RegisterNative(className, "length", "()I", func(call *NativeCall) (StackData, error) {
+			return call.Object(0).Fields[builderCount], nil
+		})
+		RegisterNative(className, "charAt", "(I)C", func(call *NativeCall) (StackData, error) {
+			chars, index := builderChars(call.Object(0)), int(call.Int(1))
+			if index < 0 || index >= len(chars) {
+				return StackData{}, stringIndexOutOfBounds("index %d,length %d", index, len(chars))
+			}
+			return chars[index], nil
+		})
+	}
+}
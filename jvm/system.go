@@ -0,0 +1,417 @@
+package jvm
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"math/rand"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// SystemExit is returned by the methods running when System.exit is
+// called, to unwind the interpreter
+type SystemExit struct {
+	Status int32
+}
+
+func (e *SystemExit) Error() string {
+	return fmt.Sprintf("exit status %d", e.Status)
+}
+
+var processStart = time.Now()
+
+// Properties System.getProperty knows about
+var systemProperties = map[string]func() string{
+	"line.separator": func() string { return "\n" },
+	"file.separator": func() string { return string(os.PathSeparator) },
+	"path.separator": func() string { return string(os.PathListSeparator) },
+	"java.io.tmpdir": os.TempDir,
+	"os.name":        func() string { return runtime.GOOS },
+	"os.arch":        func() string { return runtime.GOARCH },
+	"user.dir": func() string {
+		dir, _ := os.Getwd()
+		return dir
+	},
+	"user.home": func() string {
+		dir, _ := os.UserHomeDir()
+		return dir
+	},
+	"java.vm.name":  func() string { return "go-jvm" },
+	"file.encoding": func() string { return "UTF-8" },
+}
+
+// arraysCompatible tells whether arraycopy can copy the elements of src into
+// dest: primitive arrays only go to arrays of the same type
+func arraysCompatible(src, dest *Array) bool {
+	srcPrimitive := src.Descriptor[1] != 'L' && src.Descriptor[1] != '['
+	destPrimitive := dest.Descriptor[1] != 'L' && dest.Descriptor[1] != '['
+	if srcPrimitive || destPrimitive {
+		return src.Descriptor == dest.Descriptor
+	}
+	return true
+}
+
+func init() {
+	RegisterNative("java/lang/System", "<clinit>", "()V", func(call *NativeCall) (StackData, error) {
+		jvm := call.Jvm
+		for _, stream := range []struct {
+			name, class string
+			fd          int32
+		}{{"in", "java/io/FileInputStream", 0}, {"out", "java/io/PrintStream", 1}, {"err", "java/io/PrintStream", 2}} {
+			object, err := jvm.libraryObject(stream.class)
+			if err != nil {
+				return StackData{}, err
+			}
+			object.Fields[stream.class+".fd"] = intValue(stream.fd)
+			if stream.class == "java/io/PrintStream" {
+				object.Fields[printStreamAutoFlush] = booleanValue(true)
+			}
+			jvm.StaticFields["java/lang/System."+stream.name] = referenceValue(object)
+		}
+		return StackData{}, nil
+	})
+	for _, stream := range []string{"in", "out", "err"} {
+		key := "java/lang/System." + stream
+		setter := "set" + strings.ToUpper(stream[:1]) + stream[1:]
+		RegisterNative("java/lang/System", setter, "", func(call *NativeCall) (StackData, error) {
+			call.Jvm.StaticFields[key] = call.Args[0]
+			return StackData{}, nil
+		})
+	}
+	RegisterNative("java/lang/System", "currentTimeMillis", "()J", func(call *NativeCall) (StackData, error) {
+		return longValue(time.Now().UnixMilli()), nil
+	})
+	RegisterNative("java/lang/System", "nanoTime", "()J", func(call *NativeCall) (StackData, error) {
+		return longValue(time.Since(processStart).Nanoseconds()), nil
+	})
+	RegisterNative("java/lang/System", "identityHashCode", "(Ljava/lang/Object;)I", func(call *NativeCall) (StackData, error) {
+		if call.Reference(0) == nil {
+			return intValue(0), nil
+		}
+		return intValue(call.Jvm.identityHash(call.Reference(0))), nil
+	})
+	RegisterNative("java/lang/System", "arraycopy", "(Ljava/lang/Object;ILjava/lang/Object;II)V", func(call *NativeCall) (StackData, error) {
+		src, srcOk := call.Reference(0).(*Array)
+		dest, destOk := call.Reference(2).(*Array)
+		srcPos, destPos, length := int(call.Int(1)), int(call.Int(3)), int(call.Int(4))
+		switch {
+		case call.Reference(0) == nil || call.Reference(2) == nil:
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		case !srcOk:
+			return StackData{}, throwable("java/lang/ArrayStoreException", "arraycopy: source type %s is not an array", strings.ReplaceAll(call.Jvm.referenceClassName(call.Args[0]), "/", "."))
+		case !destOk:
+			return StackData{}, throwable("java/lang/ArrayStoreException", "arraycopy: destination type %s is not an array", strings.ReplaceAll(call.Jvm.referenceClassName(call.Args[2]), "/", "."))
+		case !arraysCompatible(src, dest):
+			return StackData{}, throwable("java/lang/ArrayStoreException", "arraycopy: type mismatch: can not copy %s into %s", typeNameOf(src.Descriptor), typeNameOf(dest.Descriptor))
+		case srcPos < 0 || destPos < 0 || length < 0 || srcPos+length > len(src.Elements) || destPos+length > len(dest.Elements):
+			return StackData{}, throwable("java/lang/ArrayIndexOutOfBoundsException", "arraycopy: last source index %d out of bounds for length %d", srcPos+length, len(src.Elements))
+		}
+		if !call.Jvm.isAssignable(src.Descriptor, dest.Descriptor) {
+			// The elements are stored one by one, the ones before a
+			// mismatch are copied
+			for i := 0; i < length; i++ {
+				element := src.Elements[srcPos+i]
+				if !element.IsNull() && !call.Jvm.isAssignable(call.Jvm.referenceClassName(element), componentName(dest.Descriptor)) {
+					return StackData{}, throwable("java/lang/ArrayStoreException", "arraycopy: element type mismatch: can not cast one of the elements of %s to the type of the destination array, %s",
+						typeNameOf(src.Descriptor), typeNameOf(dest.Descriptor[1:]))
+				}
+				dest.Elements[destPos+i] = element
+			}
+			return StackData{}, nil
+		}
+		copy(dest.Elements[destPos:destPos+length], src.Elements[srcPos:srcPos+length])
+		return StackData{}, nil
+	})
+	RegisterNative("java/lang/System", "gc", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, call.Jvm.GC()
+	})
+	RegisterNative("java/lang/System", "runFinalization", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, call.Jvm.runReferenceHandlers()
+	})
+	RegisterNative("java/lang/System", "exit", "(I)V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, &SystemExit{Status: call.Int(0)}
+	})
+	RegisterNative("java/lang/System", "lineSeparator", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(call.Jvm.internString("\n")), nil
+	})
+	getProperty := func(call *NativeCall) (StackData, error) {
+		if call.String(0) == nil {
+			return StackData{}, throwable("java/lang/NullPointerException", "key can't be null")
+		}
+		if property, ok := systemProperties[call.GoString(0)]; ok {
+			return referenceValue(NewString(property())), nil
+		}
+		if len(call.Args) == 2 {
+			return call.Args[1], nil
+		}
+		return nullReference, nil
+	}
+	RegisterNative("java/lang/System", "getProperty", "(Ljava/lang/String;)Ljava/lang/String;", getProperty)
+	RegisterNative("java/lang/System", "getProperty", "(Ljava/lang/String;Ljava/lang/String;)Ljava/lang/String;", getProperty)
+	RegisterNative("java/lang/System", "getenv", "(Ljava/lang/String;)Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		if value, ok := os.LookupEnv(call.GoString(0)); ok {
+			return referenceValue(NewString(value)), nil
+		}
+		return nullReference, nil
+	})
+
+	// System.in
+	read := func(call *NativeCall) (StackData, error) {
+		var buffer []byte
+		offset := 0
+		if len(call.Args) == 1 {
+			buffer = make([]byte, 1)
+		} else {
+			array, ok := call.Reference(1).(*Array)
+			if !ok {
+				return StackData{}, throwable("java/lang/NullPointerException", "")
+			}
+			length := len(array.Elements)
+			if len(call.Args) == 4 {
+				offset, length = int(call.Int(2)), int(call.Int(3))
+			}
+			if offset < 0 || length < 0 || offset+length > len(array.Elements) {
+				return StackData{}, throwable("java/lang/IndexOutOfBoundsException", "Range [%d, %d + %d) out of bounds for length %d", offset, offset, length, len(array.Elements))
+			}
+			if length == 0 {
+				return intValue(0), nil
+			}
+			buffer = make([]byte, length)
+		}
+		n, err := call.Jvm.Stdin.Read(buffer)
+		if n == 0 && err == io.EOF {
+			return intValue(-1), nil
+		}
+		if err != nil && err != io.EOF {
+			return StackData{}, throwable("java/io/IOException", "%s", err)
+		}
+		if len(call.Args) == 1 {
+			return intValue(int32(buffer[0])), nil
+		}
+		elements := call.Reference(1).(*Array).Elements
+		for i, b := range buffer[:n] {
+			elements[offset+i] = intValue(int32(int8(b)))
+		}
+		return intValue(int32(n)), nil
+	}
+	RegisterNative("java/io/FileInputStream", "read", "()I", read)
+	RegisterNative("java/io/FileInputStream", "read", "([B)I", read)
+	RegisterNative("java/io/FileInputStream", "read", "([BII)I", read)
+	RegisterNative("java/io/FileInputStream", "available", "()I", func(call *NativeCall) (StackData, error) {
+		return intValue(0), nil
+	})
+	for _, class := range []string{"java/io/InputStream", "java/io/OutputStream"} {
+		RegisterNative(class, "<init>", "()V", func(call *NativeCall) (StackData, error) {
+			return StackData{}, nil
+		})
+		RegisterNative(class, "close", "()V", func(call *NativeCall) (StackData, error) {
+			return StackData{}, nil
+		})
+	}
+
+	// java.lang.Math, StrictMath gives the same results
+	for _, class := range []string{"java/lang/Math", "java/lang/StrictMath"} {
+		registerMath(class)
+	}
+}
+
+func registerMath(class string) {
+	doubleFunction := func(f func(float64) float64) Native {
+		return func(call *NativeCall) (StackData, error) {
+			return doubleValue(f(call.Double(0))), nil
+		}
+	}
+	doubleFunction2 := func(f func(float64, float64) float64) Native {
+		return func(call *NativeCall) (StackData, error) {
+			return doubleValue(f(call.Double(0), call.Double(1))), nil
+		}
+	}
+	for name, f := range map[string]func(float64) float64{
+		"sqrt": math.Sqrt, "cbrt": math.Cbrt, "exp": math.Exp, "expm1": math.Expm1,
+		"log": math.Log, "log10": math.Log10, "log1p": math.Log1p,
+		"sin": math.Sin, "cos": math.Cos, "tan": math.Tan, "asin": math.Asin, "acos": math.Acos, "atan": math.Atan,
+		"sinh": math.Sinh, "cosh": math.Cosh, "tanh": math.Tanh,
+		"floor": math.Floor, "ceil": math.Ceil, "rint": math.RoundToEven, "abs": math.Abs,
+		"toRadians": func(v float64) float64 { return v / 180 * math.Pi },
+		"toDegrees": func(v float64) float64 { return v * 180 / math.Pi },
+		"signum": func(v float64) float64 {
+			if v == 0 || math.IsNaN(v) {
+				return v
+			}
+			return math.Copysign(1, v)
+		},
+	} {
+		RegisterNative(class, name, "(D)D", doubleFunction(f))
+	}
+	for name, f := range map[string]func(float64, float64) float64{
+		"pow": math.Pow, "atan2": math.Atan2, "hypot": math.Hypot, "max": math.Max, "min": math.Min,
+		"IEEEremainder": math.Remainder,
+	} {
+		RegisterNative(class, name, "(DD)D", doubleFunction2(f))
+	}
+	RegisterNative(class, "abs", "(F)F", func(call *NativeCall) (StackData, error) {
+		return floatValue(float32(math.Abs(float64(call.Float(0))))), nil
+	})
+	RegisterNative(class, "signum", "(F)F", func(call *NativeCall) (StackData, error) {
+		v := call.Float(0)
+		if v == 0 || v != v {
+			return floatValue(v), nil
+		}
+		return floatValue(float32(math.Copysign(1, float64(v)))), nil
+	})
+	RegisterNative(class, "max", "(FF)F", func(call *NativeCall) (StackData, error) {
+		return floatValue(float32(math.Max(float64(call.Float(0)), float64(call.Float(1))))), nil
+	})
+	RegisterNative(class, "min", "(FF)F", func(call *NativeCall) (StackData, error) {
+		return floatValue(float32(math.Min(float64(call.Float(0)), float64(call.Float(1))))), nil
+	})
+	// Rounds half up, saturating like d2l and f2i
+	round := func(v float64) float64 {
+		floor := math.Floor(v)
+		if v-floor >= 0.5 {
+			floor++
+		}
+		return floor
+	}
+	RegisterNative(class, "round", "(D)J", func(call *NativeCall) (StackData, error) {
+		return longValue(javaF2L(round(call.Double(0)))), nil
+	})
+	RegisterNative(class, "round", "(F)I", func(call *NativeCall) (StackData, error) {
+		return intValue(javaF2I(round(float64(call.Float(0))))), nil
+	})
+	RegisterNative(class, "random", "()D", func(call *NativeCall) (StackData, error) {
+		return doubleValue(rand.Float64()), nil
+	})
+
+	RegisterNative(class, "abs", "(I)I", func(call *NativeCall) (StackData, error) {
+		if v := call.Int(0); v < 0 {
+			return intValue(-v), nil
+		}
+		return call.Args[0], nil
+	})
+	RegisterNative(class, "abs", "(J)J", func(call *NativeCall) (StackData, error) {
+		if v := call.Long(0); v < 0 {
+			return longValue(-v), nil
+		}
+		return call.Args[0], nil
+	})
+	RegisterNative(class, "max", "(II)I", func(call *NativeCall) (StackData, error) {
+		return intValue(max(call.Int(0), call.Int(1))), nil
+	})
+	RegisterNative(class, "min", "(II)I", func(call *NativeCall) (StackData, error) {
+		return intValue(min(call.Int(0), call.Int(1))), nil
+	})
+	RegisterNative(class, "max", "(JJ)J", func(call *NativeCall) (StackData, error) {
+		return longValue(max(call.Long(0), call.Long(1))), nil
+	})
+	RegisterNative(class, "min", "(JJ)J", func(call *NativeCall) (StackData, error) {
+		return longValue(min(call.Long(0), call.Long(1))), nil
+	})
+	RegisterNative(class, "floorDiv", "(II)I", func(call *NativeCall) (StackData, error) {
+		x, y := call.Int(0), call.Int(1)
+		if y == 0 {
+			return StackData{}, throwable("java/lang/ArithmeticException", "/ by zero")
+		}
+		q := x / y
+		if (x%y != 0) && ((x < 0) != (y < 0)) {
+			q--
+		}
+		return intValue(q), nil
+	})
+	RegisterNative(class, "floorMod", "(II)I", func(call *NativeCall) (StackData, error) {
+		x, y := call.Int(0), call.Int(1)
+		if y == 0 {
+			return StackData{}, throwable("java/lang/ArithmeticException", "/ by zero")
+		}
+		m := x % y
+		if m != 0 && ((m < 0) != (y < 0)) {
+			m += y
+		}
+		return intValue(m), nil
+	})
+	RegisterNative(class, "floorDiv", "(JJ)J", func(call *NativeCall) (StackData, error) {
+		x, y := call.Long(0), call.Long(1)
+		if y == 0 {
+			return StackData{}, throwable("java/lang/ArithmeticException", "/ by zero")
+		}
+		q := x / y
+		if (x%y != 0) && ((x < 0) != (y < 0)) {
+			q--
+		}
+		return longValue(q), nil
+	})
+	RegisterNative(class, "floorMod", "(JJ)J", func(call *NativeCall) (StackData, error) {
+		x, y := call.Long(0), call.Long(1)
+		if y == 0 {
+			return StackData{}, throwable("java/lang/ArithmeticException", "/ by zero")
+		}
+		m := x % y
+		if m != 0 && ((m < 0) != (y < 0)) {
+			m += y
+		}
+		return longValue(m), nil
+	})
+
+	intOverflow := func() error { return throwable("java/lang/ArithmeticException", "integer overflow") }
+	longOverflow := func() error { return throwable("java/lang/ArithmeticException", "long overflow") }
+	RegisterNative(class, "addExact", "(II)I", func(call *NativeCall) (StackData, error) {
+		r := int64(call.Int(0)) + int64(call.Int(1))
+		if r != int64(int32(r)) {
+			return StackData{}, intOverflow()
+		}
+		return intValue(int32(r)), nil
+	})
+	RegisterNative(class, "subtractExact", "(II)I", func(call *NativeCall) (StackData, error) {
+		r := int64(call.Int(0)) - int64(call.Int(1))
+		if r != int64(int32(r)) {
+			return StackData{}, intOverflow()
+		}
+		return intValue(int32(r)), nil
+	})
+	RegisterNative(class, "multiplyExact", "(II)I", func(call *NativeCall) (StackData, error) {
+		r := int64(call.Int(0)) * int64(call.Int(1))
+		if r != int64(int32(r)) {
+			return StackData{}, intOverflow()
+		}
+		return intValue(int32(r)), nil
+	})
+	RegisterNative(class, "addExact", "(JJ)J", func(call *NativeCall) (StackData, error) {
+		x, y := call.Long(0), call.Long(1)
+		r := x + y
+		if (x^r)&(y^r) < 0 {
+			return StackData{}, longOverflow()
+		}
+		return longValue(r), nil
+	})
+	RegisterNative(class, "subtractExact", "(JJ)J", func(call *NativeCall) (StackData, error) {
+		x, y := call.Long(0), call.Long(1)
+		r := x - y
+		if (x^y)&(x^r) < 0 {
+			return StackData{}, longOverflow()
+		}
+		return longValue(r), nil
+	})
+	RegisterNative(class, "multiplyExact", "(JJ)J", func(call *NativeCall) (StackData, error) {
+		x, y := call.Long(0), call.Long(1)
+		hi, lo := bits.Mul64(uint64(absInt64(x)), uint64(absInt64(y)))
+		limit := uint64(math.MaxInt64)
+		if (x < 0) != (y < 0) {
+			limit++
+		}
+		if hi != 0 || lo > limit {
+			return StackData{}, longOverflow()
+		}
+		return longValue(x * y), nil
+	})
+}
+
+func absInt64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
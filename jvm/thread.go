@@ -0,0 +1,546 @@
+package jvm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	threadName        = "java/lang/Thread.name"
+	threadID          = "java/lang/Thread.tid"
+	threadPriority    = "java/lang/Thread.priority"
+	threadDaemon      = "java/lang/Thread.daemon"
+	threadInterrupted = "java/lang/Thread.interrupted"
+	threadStatus      = "java/lang/Thread.threadStatus"
+	threadTarget      = "java/lang/Thread.target"
+	threadHandler     = "java/lang/Thread.uncaughtExceptionHandler"
+	// The handler of the threads without one
+	threadDefaultHandler = "java/lang/Thread.defaultUncaughtExceptionHandler"
+	// Native thread of a JDK thread, not 0 while the thread is alive
+	threadEETop = "java/lang/Thread.eetop"
+)
+
+// Instructions a thread runs before it lets the threads waiting for the vm
+// run, and the ones a volatile read counts for
+const (
+	yieldInterval = 1 << 10
+	volatileTicks = yieldInterval >> 4
+)
+
+// ThreadState is the state of a thread, the one of java.lang.Thread.State
+type ThreadState int
+
+const (
+	ThreadNew ThreadState = iota
+	ThreadRunnable
+	ThreadBlocked
+	ThreadWaiting
+	ThreadTimedWaiting
+	ThreadTerminated
+)
+
+func (s ThreadState) String() string {
+	return [...]string{"NEW", "RUNNABLE", "BLOCKED", "WAITING", "TIMED_WAITING", "TERMINATED"}[s]
+}
+
+// Thread is a thread of the program. Each one runs on its own goroutine
+// with its own frames, but only the one holding the lock of the vm runs:
+// the others wait for it to block, to end or to reach the point where it
+// lets them run
+type Thread struct {
+	// The java.lang.Thread, nil until the program asks for the one of a
+	// thread the vm started
+	Object *Object
+	// Identifier and name of a thread the vm started, the ones its Object
+	// gets
+	id     int64
+	name   string
+	Daemon bool
+	State  ThreadState
+	// Frames of the methods being run, the innermost last
+	frames []*Frame
+	// References the natives being run hold, and the handles of Go code
+	handles []StackData
+	// Wakes the thread when it parks, see park
+	wakeups chan struct{}
+	// Objects the thread locked without a Monitor, in locking order. An
+	// object locked again is in it again
+	lockStack []headed
+	// Object whose monitor the thread is blocked entering or waits on
+	blockedOn headed
+}
+
+func newThread(object *Object, name string, daemon bool) *Thread {
+	return &Thread{Object: object, name: name, Daemon: daemon, State: ThreadRunnable, wakeups: make(chan struct{}, 1)}
+}
+
+// wakeUp makes the thread check whether it may stop parking. It may be
+// called without the lock of the vm
+func (t *Thread) wakeUp() {
+	select {
+	case t.wakeups <- struct{}{}:
+	default:
+	}
+}
+
+// acquire waits for the lock of the vm and makes t the running thread
+func (jvm *Jvm) acquire(t *Thread) {
+	jvm.contenders.Add(1)
+	jvm.lock.Lock()
+	jvm.contenders.Add(-1)
+	jvm.thread = t
+}
+
+// release lets the other threads run
+func (jvm *Jvm) release() {
+	jvm.lock.Unlock()
+}
+
+// safepoint lets the threads waiting for the vm run once the running one
+// has run for a while
+func (jvm *Jvm) safepoint() {
+	jvm.ticks++
+	if jvm.ticks < yieldInterval {
+		return
+	}
+	jvm.ticks = 0
+	if jvm.contenders.Load() > 0 {
+		t := jvm.thread
+		jvm.release()
+		runtime.Gosched()
+		jvm.acquire(t)
+	}
+}
+
+// volatileRead brings the next safepoint closer. A thread spinning until
+// another one writes a volatile field lets it run sooner, the accesses
+// themselves need no fence, see atomic.go
+func (jvm *Jvm) volatileRead() {
+	jvm.ticks += volatileTicks - 1
+	jvm.safepoint()
+}
+
+// park blocks the running thread until done returns true, checking it
+// whenever a thread wakes the others, see wakeAll. It stops at the
+// deadline unless it is zero, and reports whether it stopped because the
+// thread was interrupted, clearing its interrupt status
+func (jvm *Jvm) park(state ThreadState, deadline time.Time, interruptible bool, done func() bool) bool {
+	t := jvm.thread
+	if !deadline.IsZero() {
+		timer := time.AfterFunc(time.Until(deadline), t.wakeUp)
+		defer timer.Stop()
+	}
+	previous := t.State
+	t.State = state
+	defer func() { t.State = previous }()
+	for !done() {
+		if interruptible && jvm.clearInterrupt(t) {
+			return true
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return false
+		}
+		jvm.release()
+		<-t.wakeups
+		jvm.acquire(t)
+	}
+	return false
+}
+
+// wakeAll makes the parked threads check whether they may go on
+func (jvm *Jvm) wakeAll() {
+	for _, t := range jvm.threads {
+		t.wakeUp()
+	}
+}
+
+// deadline returns the time a wait of the given milliseconds and
+// nanoseconds ends, zero for a wait without timeout
+func deadline(millis int64, nanos int32) time.Time {
+	if millis == 0 && nanos == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(millis)*time.Millisecond + time.Duration(nanos))
+}
+
+// sleep parks the running thread for the given time
+func (jvm *Jvm) sleep(d time.Duration) error {
+	if d <= 0 {
+		if jvm.clearInterrupt(jvm.thread) {
+			return throwable("java/lang/InterruptedException", "sleep interrupted")
+		}
+		return nil
+	}
+	if jvm.park(ThreadTimedWaiting, time.Now().Add(d), true, func() bool { return false }) {
+		return throwable("java/lang/InterruptedException", "sleep interrupted")
+	}
+	return nil
+}
+
+// clearInterrupt clears the interrupt status of t and tells whether it was
+// set
+func (jvm *Jvm) clearInterrupt(t *Thread) bool {
+	if t.Object == nil || t.Object.Fields[threadInterrupted].Int() == 0 {
+		return false
+	}
+	t.Object.Fields[threadInterrupted] = booleanValue(false)
+	return true
+}
+
+// threadOf returns the thread of a started java.lang.Thread, nil if it has
+// not started or has ended
+func (jvm *Jvm) threadOf(object *Object) *Thread {
+	for _, t := range jvm.threads {
+		if t.Object == object {
+			return t
+		}
+	}
+	return nil
+}
+
+// threadObject returns the java.lang.Thread of t. The embedded class
+// library creates the one of the threads the vm started when it is first
+// asked for
+func (jvm *Jvm) threadObject(t *Thread) (*Object, error) {
+	if t.Object != nil || jvm.hasJDK() {
+		return t.Object, nil
+	}
+	object, err := jvm.libraryObject("java/lang/Thread")
+	if err != nil {
+		return nil, err
+	}
+	jvm.initThreadObject(object, t.id, t.name)
+	object.Fields[threadDaemon] = booleanValue(t.Daemon)
+	object.Fields[threadStatus] = intValue(int32(ThreadRunnable))
+	t.Object = object
+	return object, nil
+}
+
+// initThreadObject gives a java.lang.Thread of the embedded class library
+// its identifier and name, and the priority and daemon status of the
+// running thread
+func (jvm *Jvm) initThreadObject(object *Object, id int64, name string) {
+	object.Fields[threadID] = longValue(id)
+	object.Fields[threadName] = referenceValue(NewString(name))
+	object.Fields[threadPriority] = intValue(5)
+	if current := jvm.thread.Object; current != nil {
+		object.Fields[threadPriority] = current.Fields[threadPriority]
+		object.Fields[threadDaemon] = current.Fields[threadDaemon]
+	}
+}
+
+// threadDisplayName returns the name of a thread for messages
+func (jvm *Jvm) threadDisplayName(t *Thread) string {
+	if t.Object != nil {
+		if name, ok := t.Object.Fields[threadName].Data.(*String); ok {
+			return name.String()
+		}
+	}
+	return t.name
+}
+
+// startThread runs the run method of a java.lang.Thread on a new thread
+func (jvm *Jvm) startThread(object *Object) error {
+	daemon, err := jvm.InvokeVirtual("java/lang/Thread", "isDaemon", "()Z", []StackData{referenceValue(object)})
+	if err != nil {
+		return err
+	}
+	t := newThread(object, "", daemon.Int() != 0)
+	jvm.threads = append(jvm.threads, t)
+	if !t.Daemon {
+		jvm.nonDaemons.Add(1)
+	}
+	if _, ok := object.Fields[threadEETop]; ok {
+		object.Fields[threadEETop] = longValue(int64(len(jvm.threads)))
+	}
+	go func() {
+		jvm.acquire(t)
+		defer jvm.release()
+		_, err := jvm.InvokeVirtual("java/lang/Thread", "run", "()V", []StackData{referenceValue(object)})
+		if err != nil {
+			jvm.uncaughtException(t, err)
+		}
+		jvm.endThread(t)
+	}()
+	return nil
+}
+
+// uncaughtException hands what a thread threw to its uncaught exception
+// handler. An exit ends the vm from any thread
+func (jvm *Jvm) uncaughtException(t *Thread, err error) {
+	var exit *SystemExit
+	if errors.As(err, &exit) {
+		jvm.Flush()
+		os.Exit(int(exit.Status))
+	}
+	if thrown, ok := catchable(err); ok {
+		if thrown.Object == nil {
+			thrown.Object = jvm.throwableObject(thrown.ClassName, thrown.Message)
+		}
+		object, objectErr := jvm.threadObject(t)
+		if thrown.Object != nil && object != nil && objectErr == nil {
+			_, err = jvm.InvokeVirtual("java/lang/Thread", "dispatchUncaughtException", "(Ljava/lang/Throwable;)V",
+				[]StackData{referenceValue(object), referenceValue(thrown.Object)})
+			if err == nil {
+				return
+			}
+		}
+	}
+	jvm.Flush()
+	fmt.Fprintf(jvm.Stderr, "Exception in thread \"%s\" %s\n", jvm.threadDisplayName(t), err)
+}
+
+// endThread removes a thread which returned from its run method and wakes
+// the threads joining it
+func (jvm *Jvm) endThread(t *Thread) {
+	jvm.releaseMonitors(t)
+	t.State = ThreadTerminated
+	for i, other := range jvm.threads {
+		if other == t {
+			jvm.threads = append(jvm.threads[:i], jvm.threads[i+1:]...)
+			break
+		}
+	}
+	if t.Object != nil {
+		t.Object.Fields[threadStatus] = intValue(int32(ThreadTerminated))
+		if _, ok := t.Object.Fields[threadEETop]; ok {
+			t.Object.Fields[threadEETop] = longValue(0)
+		}
+	}
+	jvm.wakeAll()
+	if !t.Daemon {
+		jvm.nonDaemons.Done()
+	}
+}
+
+// awaitThreads ends the main thread: the vm exits once the threads which
+// are not daemons have ended
+func (jvm *Jvm) awaitThreads() {
+	main := jvm.thread
+	jvm.releaseMonitors(main)
+	main.State = ThreadTerminated
+	for i, other := range jvm.threads {
+		if other == main {
+			jvm.threads = append(jvm.threads[:i], jvm.threads[i+1:]...)
+			break
+		}
+	}
+	jvm.wakeAll()
+	jvm.release()
+	jvm.nonDaemons.Wait()
+	jvm.acquire(main)
+}
+
+func init() {
+	const threadClass = "java/lang/Thread"
+	RegisterNative(threadClass, "<clinit>", "()V", func(call *NativeCall) (StackData, error) {
+		call.Jvm.StaticFields[threadDefaultHandler] = nullReference
+		return StackData{}, nil
+	})
+	construct := func(call *NativeCall) (StackData, error) {
+		object := call.Object(0)
+		if len(call.Args) > 1 && call.Descriptor != "(Ljava/lang/String;)V" {
+			object.Fields[threadTarget] = call.Args[1]
+		}
+		var name string
+		if strings.HasSuffix(call.Descriptor, "Ljava/lang/String;)V") {
+			if call.Args[len(call.Args)-1].IsNull() {
+				return StackData{}, throwable("java/lang/NullPointerException", "'name' is null")
+			}
+			name = call.GoString(len(call.Args) - 1)
+		} else {
+			name = fmt.Sprintf("Thread-%d", call.Jvm.threadNumber)
+			call.Jvm.threadNumber++
+		}
+		call.Jvm.threadIDs++
+		call.Jvm.initThreadObject(object, call.Jvm.threadIDs, name)
+		return StackData{}, nil
+	}
+	for _, methodDescriptor := range []string{"()V", "(Ljava/lang/Runnable;)V", "(Ljava/lang/Runnable;Ljava/lang/String;)V", "(Ljava/lang/String;)V"} {
+		RegisterNative(threadClass, "<init>", methodDescriptor, construct)
+	}
+	RegisterNative(threadClass, "start", "()V", func(call *NativeCall) (StackData, error) {
+		object := call.Object(0)
+		if ThreadState(object.Fields[threadStatus].Int()) != ThreadNew {
+			return StackData{}, throwable("java/lang/IllegalThreadStateException", "")
+		}
+		object.Fields[threadStatus] = intValue(int32(ThreadRunnable))
+		return StackData{}, call.Jvm.startThread(object)
+	})
+	RegisterNative(threadClass, "start0", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, call.Jvm.startThread(call.Object(0))
+	})
+	RegisterNative(threadClass, "run", "()V", func(call *NativeCall) (StackData, error) {
+		target := call.Object(0).Fields[threadTarget]
+		if target.IsNull() {
+			return StackData{}, nil
+		}
+		_, err := call.Jvm.InvokeVirtual("java/lang/Runnable", "run", "()V", []StackData{target})
+		return StackData{}, err
+	})
+	RegisterNative(threadClass, "currentThread", "()Ljava/lang/Thread;", func(call *NativeCall) (StackData, error) {
+		object, err := call.Jvm.threadObject(call.Jvm.thread)
+		if err != nil || object == nil {
+			return nullReference, err
+		}
+		return referenceValue(object), nil
+	})
+
+	sleep := func(call *NativeCall) (StackData, error) {
+		millis, nanos := call.Long(0), int32(0)
+		if len(call.Args) == 2 {
+			nanos = call.Int(1)
+		}
+		switch {
+		case millis < 0:
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "timeout value is negative")
+		case nanos < 0 || nanos > 999999:
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "nanosecond timeout value out of range")
+		}
+		return StackData{}, call.Jvm.sleep(time.Duration(millis)*time.Millisecond + time.Duration(nanos))
+	}
+	RegisterNative(threadClass, "sleep", "(J)V", sleep)
+	RegisterNative(threadClass, "sleep", "(JI)V", sleep)
+	// The one of JDK 21 takes nanoseconds
+	RegisterNative(threadClass, "sleep0", "(J)V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, call.Jvm.sleep(time.Duration(call.Long(0)))
+	})
+	yield := func(call *NativeCall) (StackData, error) {
+		t := call.Jvm.thread
+		call.Jvm.release()
+		runtime.Gosched()
+		call.Jvm.acquire(t)
+		return StackData{}, nil
+	}
+	RegisterNative(threadClass, "yield", "()V", yield)
+	RegisterNative(threadClass, "yield0", "()V", yield)
+	RegisterNative(threadClass, "onSpinWait", "()V", yield)
+
+	join := func(call *NativeCall) (StackData, error) {
+		object := call.Object(0)
+		var millis int64
+		if len(call.Args) == 2 {
+			if millis = call.Long(1); millis < 0 {
+				return StackData{}, throwable("java/lang/IllegalArgumentException", "timeout value is negative")
+			}
+		}
+		ended := func() bool { return call.Jvm.threadOf(object) == nil }
+		if call.Jvm.park(ThreadWaiting, deadline(millis, 0), true, ended) {
+			return StackData{}, throwable("java/lang/InterruptedException", "")
+		}
+		return StackData{}, nil
+	}
+	RegisterNative(threadClass, "join", "()V", join)
+	RegisterNative(threadClass, "join", "(J)V", join)
+	RegisterNative(threadClass, "isAlive", "()Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(call.Jvm.threadOf(call.Object(0)) != nil), nil
+	})
+
+	interrupt := func(call *NativeCall) (StackData, error) {
+		object := call.Object(0)
+		object.Fields[threadInterrupted] = booleanValue(true)
+		if t := call.Jvm.threadOf(object); t != nil {
+			t.wakeUp()
+		}
+		return StackData{}, nil
+	}
+	RegisterNative(threadClass, "interrupt", "()V", interrupt)
+	RegisterNative(threadClass, "interrupt0", "()V", interrupt)
+	RegisterNative(threadClass, "isInterrupted", "()Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(call.Object(0).Fields[threadInterrupted].Int() != 0), nil
+	})
+	RegisterNative(threadClass, "interrupted", "()Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(call.Jvm.clearInterrupt(call.Jvm.thread)), nil
+	})
+	RegisterNative(threadClass, "clearInterruptEvent", "()V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, nil
+	})
+
+	RegisterNative(threadClass, "getName", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return call.Object(0).Fields[threadName], nil
+	})
+	RegisterNative(threadClass, "setName", "(Ljava/lang/String;)V", func(call *NativeCall) (StackData, error) {
+		if call.Args[1].IsNull() {
+			return StackData{}, throwable("java/lang/NullPointerException", "'name' is null")
+		}
+		call.Object(0).Fields[threadName] = call.Args[1]
+		return StackData{}, nil
+	})
+	getID := func(call *NativeCall) (StackData, error) {
+		return call.Object(0).Fields[threadID], nil
+	}
+	RegisterNative(threadClass, "getId", "()J", getID)
+	RegisterNative(threadClass, "threadId", "()J", getID)
+	RegisterNative(threadClass, "isDaemon", "()Z", func(call *NativeCall) (StackData, error) {
+		return call.Object(0).Fields[threadDaemon], nil
+	})
+	RegisterNative(threadClass, "setDaemon", "(Z)V", func(call *NativeCall) (StackData, error) {
+		object := call.Object(0)
+		if ThreadState(object.Fields[threadStatus].Int()) != ThreadNew {
+			return StackData{}, throwable("java/lang/IllegalThreadStateException", "")
+		}
+		object.Fields[threadDaemon] = booleanValue(call.Boolean(1))
+		return StackData{}, nil
+	})
+	RegisterNative(threadClass, "getPriority", "()I", func(call *NativeCall) (StackData, error) {
+		return call.Object(0).Fields[threadPriority], nil
+	})
+	RegisterNative(threadClass, "setPriority", "(I)V", func(call *NativeCall) (StackData, error) {
+		if call.Int(1) < 1 || call.Int(1) > 10 {
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "")
+		}
+		call.Object(0).Fields[threadPriority] = call.Args[1]
+		return StackData{}, nil
+	})
+	RegisterNative(threadClass, "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		object := call.Object(0)
+		group := "main"
+		if ThreadState(object.Fields[threadStatus].Int()) == ThreadTerminated {
+			group = ""
+		}
+		name := object.Fields[threadName].Data.(*String).String()
+		return referenceValue(NewString(fmt.Sprintf("Thread[#%d,%s,%d,%s]", object.Fields[threadID].Long(), name, object.Fields[threadPriority].Int(), group))), nil
+	})
+
+	RegisterNative(threadClass, "getUncaughtExceptionHandler", "()Ljava/lang/Thread$UncaughtExceptionHandler;", func(call *NativeCall) (StackData, error) {
+		return call.Object(0).Fields[threadHandler], nil
+	})
+	RegisterNative(threadClass, "setUncaughtExceptionHandler", "(Ljava/lang/Thread$UncaughtExceptionHandler;)V", func(call *NativeCall) (StackData, error) {
+		call.Object(0).Fields[threadHandler] = call.Args[1]
+		return StackData{}, nil
+	})
+	RegisterNative(threadClass, "getDefaultUncaughtExceptionHandler", "()Ljava/lang/Thread$UncaughtExceptionHandler;", func(call *NativeCall) (StackData, error) {
+		return call.Jvm.StaticFields[threadDefaultHandler], nil
+	})
+	RegisterNative(threadClass, "setDefaultUncaughtExceptionHandler", "(Ljava/lang/Thread$UncaughtExceptionHandler;)V", func(call *NativeCall) (StackData, error) {
+		call.Jvm.StaticFields[threadDefaultHandler] = call.Args[0]
+		return StackData{}, nil
+	})
+	RegisterNative(threadClass, "dispatchUncaughtException", "(Ljava/lang/Throwable;)V", func(call *NativeCall) (StackData, error) {
+		// The handler of the thread, else the default one, else the trace
+		// goes to System.err like ThreadGroup prints it
+		handler := call.Object(0).Fields[threadHandler]
+		if handler.IsNull() {
+			handler = call.Jvm.StaticFields[threadDefaultHandler]
+		}
+		if !handler.IsNull() {
+			_, err := call.Jvm.InvokeVirtual("java/lang/Thread$UncaughtExceptionHandler", "uncaughtException", "(Ljava/lang/Thread;Ljava/lang/Throwable;)V",
+				[]StackData{handler, call.Args[0], call.Args[1]})
+			return StackData{}, err
+		}
+		stream, err := call.Jvm.systemStream("err")
+		if err != nil {
+			return StackData{}, err
+		}
+		name := call.Object(0).Fields[threadName].Data.(*String).String()
+		if err := call.Jvm.writeStream(stream, fmt.Sprintf("Exception in thread \"%s\" ", name), false); err != nil {
+			return StackData{}, err
+		}
+		_, err = call.Jvm.InvokeVirtual("java/lang/Throwable", "printStackTrace", "()V", call.Args[1:])
+		return StackData{}, err
+	})
+}
@@ -0,0 +1,180 @@
+package jvm
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ThreadDump writes the stacks of the threads of the program to w the way
+// jstack prints them, with the monitors they hold and wait for, followed
+// by the deadlocks among them. It waits for the running thread to reach a
+// safepoint, so it must not be called by a native
+func (jvm *Jvm) ThreadDump(w io.Writer) error {
+	jvm.contenders.Add(1)
+	jvm.lock.Lock()
+	jvm.contenders.Add(-1)
+	defer jvm.lock.Unlock()
+	// What the program printed comes first
+	jvm.Flush()
+	return jvm.writeThreadDump(w)
+}
+
+func (jvm *Jvm) writeThreadDump(w io.Writer) error {
+	var dump strings.Builder
+	fmt.Fprintf(&dump, "%s\nFull thread dump go-jvm:\n\n", time.Now().Format(time.DateTime))
+	for _, t := range jvm.threads {
+		fmt.Fprintf(&dump, "%s\n   java.lang.Thread.State: %s\n", jvm.threadHeader(t), jvm.threadStateDescription(t))
+		jvm.writeStack(&dump, t)
+		dump.WriteString("\n")
+	}
+
+	deadlocks := jvm.deadlocks()
+	for _, cycle := range deadlocks {
+		dump.WriteString("Found one Java-level deadlock:\n=============================\n")
+		for i, t := range cycle {
+			owner := cycle[(i+1)%len(cycle)]
+			fmt.Fprintf(&dump, "\"%s\":\n  waiting to lock monitor %s (object %s, a %s),\n  which is held by \"%s\"\n",
+				jvm.threadDisplayName(t), address(jvm.monitors[t.blockedOn]), address(t.blockedOn), jvm.monitorClassName(t.blockedOn), jvm.threadDisplayName(owner))
+		}
+		dump.WriteString("\nJava stack information for the threads listed above:\n===================================================\n")
+		for _, t := range cycle {
+			fmt.Fprintf(&dump, "\"%s\":\n", jvm.threadDisplayName(t))
+			jvm.writeStack(&dump, t)
+		}
+		dump.WriteString("\n")
+	}
+	switch len(deadlocks) {
+	case 0:
+	case 1:
+		dump.WriteString("Found 1 deadlock.\n\n")
+	default:
+		fmt.Fprintf(&dump, "Found %d deadlocks.\n\n", len(deadlocks))
+	}
+	_, err := io.WriteString(w, dump.String())
+	return err
+}
+
+// threadHeader returns the line naming a thread in a dump
+func (jvm *Jvm) threadHeader(t *Thread) string {
+	id, priority := t.id, int32(5)
+	if t.Object != nil {
+		if value, ok := t.Object.Fields[threadID]; ok {
+			id = value.Long()
+		}
+		if value, ok := t.Object.Fields[threadPriority]; ok {
+			priority = value.Int()
+		}
+	}
+	daemon := ""
+	if t.Daemon {
+		daemon = " daemon"
+	}
+	condition := "runnable"
+	switch {
+	case t.State == ThreadBlocked:
+		condition = "waiting for monitor entry"
+	case t.blockedOn != nil:
+		condition = "in Object.wait()"
+	case t.State == ThreadWaiting || t.State == ThreadTimedWaiting:
+		condition = "waiting on condition"
+	}
+	return fmt.Sprintf("\"%s\" #%d%s prio=%d %s", jvm.threadDisplayName(t), id, daemon, priority, condition)
+}
+
+// threadStateDescription returns the state of a thread with what it
+// waits for
+func (jvm *Jvm) threadStateDescription(t *Thread) string {
+	switch {
+	case t.State == ThreadBlocked || t.blockedOn != nil && (t.State == ThreadWaiting || t.State == ThreadTimedWaiting):
+		return t.State.String() + " (on object monitor)"
+	case t.State == ThreadTimedWaiting:
+		return t.State.String() + " (sleeping)"
+	}
+	return t.State.String()
+}
+
+// writeStack writes the frames of a thread, the innermost first, each
+// followed by the monitors its method locked. The monitor the thread is
+// blocked on goes under the innermost frame
+func (jvm *Jvm) writeStack(dump *strings.Builder, t *Thread) {
+	for i := len(t.frames) - 1; i >= 0; i-- {
+		frame := t.frames[i]
+		fmt.Fprintf(dump, "\tat %s\n", stackFrameString(frame))
+		if i == len(t.frames)-1 && t.blockedOn != nil {
+			action := "waiting on"
+			if t.State == ThreadBlocked {
+				action = "waiting to lock"
+			}
+			fmt.Fprintf(dump, "\t- %s <%s> (a %s)\n", action, address(t.blockedOn), jvm.monitorClassName(t.blockedOn))
+		}
+		for j := len(frame.Monitors) - 1; j >= 0; j-- {
+			reference := frame.Monitors[j]
+			// A monitor entered again is listed once
+			if slices.Contains(frame.Monitors[j+1:], reference) {
+				continue
+			}
+			fmt.Fprintf(dump, "\t- locked <%s> (a %s)\n", address(reference), jvm.monitorClassName(reference))
+		}
+	}
+}
+
+// stackFrameString returns a frame the way StackTraceElement prints it
+func stackFrameString(frame *Frame) string {
+	location := "Unknown Source"
+	if source := frame.Class.SourceFile(); source != "" {
+		location = source
+		if line := frame.Code.LineNumber(frame.Pc); line >= 0 {
+			location = fmt.Sprintf("%s:%d", source, line)
+		}
+	}
+	return fmt.Sprintf("%s.%s(%s)", strings.ReplaceAll(frame.Class.Name(), "/", "."), frame.Method.Name, location)
+}
+
+// monitorClassName returns the class of a locked object for a dump, the
+// one a Class stands for with it
+func (jvm *Jvm) monitorClassName(reference headed) string {
+	if mirror, ok := reference.(*ClassMirror); ok {
+		return "java.lang.Class for " + mirror.Name()
+	}
+	return strings.ReplaceAll(jvm.referenceClassName(referenceValue(reference)), "/", ".")
+}
+
+// address returns the address of an object or a Monitor for a dump
+func address(pointer interface{}) string {
+	return fmt.Sprintf("0x%016x", reflect.ValueOf(pointer).Pointer())
+}
+
+// deadlocks returns the cycles of threads each blocked entering the
+// monitor the next one owns
+func (jvm *Jvm) deadlocks() [][]*Thread {
+	var cycles [][]*Thread
+	visited := map[*Thread]bool{}
+	for _, t := range jvm.threads {
+		var path []*Thread
+		for next := t; next != nil && !visited[next]; next = jvm.blockingOwner(next) {
+			visited[next] = true
+			path = append(path, next)
+			if i := slices.Index(path, jvm.blockingOwner(next)); i >= 0 {
+				cycles = append(cycles, path[i:])
+				break
+			}
+		}
+	}
+	return cycles
+}
+
+// blockingOwner returns the thread owning the monitor t is blocked
+// entering, nil if t is not blocked
+func (jvm *Jvm) blockingOwner(t *Thread) *Thread {
+	if t.State != ThreadBlocked || t.blockedOn == nil {
+		return nil
+	}
+	if m, ok := jvm.monitors[t.blockedOn]; ok {
+		return m.owner
+	}
+	return nil
+}
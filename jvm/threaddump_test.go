@@ -0,0 +1,112 @@
+package jvm
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lockInOrder generates a Runnable which locks the Object in the static
+// field first of Shared, flags that it holds it, waits for the other
+// thread to hold its lock, then locks the one in second
+func lockInOrder(name, first, second, flag, otherFlag string) *classBuilder {
+	return runnable(name, 2, 3, func(c *codeBuilder) {
+		c.op(OpGetstatic, c.class.fieldRef("Shared", first, "Ljava/lang/Object;"))
+		c.op(OpDup)
+		c.op(OpAstore1)
+		c.op(OpMonitorenter)
+		c.op(OpIconst1)
+		sharedInt(c, OpPutstatic, flag)
+		wait := c.code.Len()
+		sharedInt(c, OpGetstatic, otherFlag)
+		branch(c, OpIfeq, wait)
+		c.op(OpGetstatic, c.class.fieldRef("Shared", second, "Ljava/lang/Object;"))
+		c.op(OpDup)
+		c.op(OpAstore2)
+		c.op(OpMonitorenter)
+		c.op(OpAload2)
+		c.op(OpMonitorexit)
+		c.op(OpAload1)
+		c.op(OpMonitorexit)
+	})
+}
+
+func TestThreadDumpDeadlock(t *testing.T) {
+	// static Object a = new Object(), b = new Object();
+	// static volatile int aLocked, bLocked;
+	shared := newClassBuilder("Shared", "java/lang/Object", AccSuper)
+	shared.addField(AccStatic|AccVolatile, "aLocked", "I")
+	shared.addField(AccStatic|AccVolatile, "bLocked", "I")
+	clinit := shared.addMethod(AccStatic, "<clinit>", "()V")
+	clinit.maxStack = 2
+	for _, name := range []string{"a", "b"} {
+		shared.addField(AccStatic, name, "Ljava/lang/Object;")
+		clinit.op(OpNew, shared.class("java/lang/Object"))
+		clinit.op(OpDup)
+		clinit.op(OpInvokespecial, shared.methodRef("java/lang/Object", "<init>", "()V", false))
+		clinit.op(OpPutstatic, shared.fieldRef("Shared", name, "Ljava/lang/Object;"))
+	}
+	clinit.op(OpReturn)
+	forward := lockInOrder("Forward", "a", "b", "aLocked", "bLocked")
+	backward := lockInOrder("Backward", "b", "a", "bLocked", "aLocked")
+
+	path := buildProgram(t, func(p programBuilder) {
+		for _, thread := range []string{"Forward", "Backward"} {
+			p.op(OpNew, p.class.class("java/lang/Thread"))
+			p.op(OpDup)
+			p.newObject(thread)
+			p.op(OpInvokespecial, p.class.methodRef("java/lang/Thread", "<init>", "(Ljava/lang/Runnable;)V", false))
+			p.invoke(false, "java/lang/Thread", "start", "()V")
+		}
+	}, shared, forward, backward)
+	jvm, err := NewJvm(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jvm.Stdout, jvm.Stderr = io.Discard, io.Discard
+	// The deadlocked threads never end, neither does the vm
+	go RunJvm(jvm)
+
+	var dump bytes.Buffer
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(dump.String(), "Found 1 deadlock."); {
+		if time.Now().After(deadline) {
+			t.Fatalf("no deadlock found:\n%s", dump.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+		dump.Reset()
+		if err := jvm.ThreadDump(&dump); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := dump.String()
+	for _, pattern := range []string{
+		`(?m)^"Thread-0" #\d+ prio=5 waiting for monitor entry\n   java\.lang\.Thread\.State: BLOCKED \(on object monitor\)\n` +
+			`\tat Forward\.run\(Unknown Source\)\n\t- waiting to lock <(0x[0-9a-f]{16})> \(a java\.lang\.Object\)\n\t- locked <(0x[0-9a-f]{16})> \(a java\.lang\.Object\)\n`,
+		`(?m)^"Thread-1" #\d+ prio=5 waiting for monitor entry\n   java\.lang\.Thread\.State: BLOCKED \(on object monitor\)\n` +
+			`\tat Backward\.run\(Unknown Source\)\n\t- waiting to lock <(0x[0-9a-f]{16})> \(a java\.lang\.Object\)\n\t- locked <(0x[0-9a-f]{16})> \(a java\.lang\.Object\)\n`,
+		"Found one Java-level deadlock:\n=============================\n",
+		`"Thread-[01]":\n  waiting to lock monitor 0x[0-9a-f]{16} \(object 0x[0-9a-f]{16}, a java\.lang\.Object\),\n  which is held by "Thread-[01]"\n`,
+		"\nJava stack information for the threads listed above:\n===================================================\n",
+	} {
+		if !regexp.MustCompile(pattern).MatchString(out) {
+			t.Errorf("dump doesn't match %q:\n%s", pattern, out)
+		}
+	}
+
+	// Each thread waits for the object the other one locked
+	forwardLocks := regexp.MustCompile(`Forward\.run\(Unknown Source\)\n\t- waiting to lock <(\S+)> .*\n\t- locked <(\S+)>`).FindStringSubmatch(out)
+	backwardLocks := regexp.MustCompile(`Backward\.run\(Unknown Source\)\n\t- waiting to lock <(\S+)> .*\n\t- locked <(\S+)>`).FindStringSubmatch(out)
+	if forwardLocks == nil || backwardLocks == nil {
+		t.Fatalf("lock lines missing:\n%s", out)
+	}
+	if forwardLocks[1] != backwardLocks[2] || backwardLocks[1] != forwardLocks[2] {
+		t.Errorf("threads don't wait for each other's lock:\n%s", out)
+	}
+	if n := strings.Count(out, "Found one Java-level deadlock"); n != 1 {
+		t.Errorf("%d deadlocks reported, want 1", n)
+	}
+}
@@ -0,0 +1,141 @@
+package jvm
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	throwableMessage = "java/lang/Throwable.detailMessage"
+	throwableCause   = "java/lang/Throwable.cause"
+)
+
+// throwableObject creates the instance of an exception raised by the vm,
+// nil if its class can't be loaded
+func (jvm *Jvm) throwableObject(className, message string) *Object {
+	object, err := jvm.libraryObject(className)
+	if err != nil || !jvm.isSubclass(object.Class, "java/lang/Throwable") {
+		return nil
+	}
+	if message != "" {
+		object.Fields[throwableMessage] = referenceValue(NewString(message))
+	}
+	return object
+}
+
+// messageField returns the detail message of a thrown object, ok is false
+// for a null message
+func (object *Object) messageField() (message string, ok bool) {
+	if object == nil {
+		return "", false
+	}
+	s, ok := object.Fields[throwableMessage].Data.(*String)
+	if !ok {
+		return "", false
+	}
+	return s.String(), true
+}
+
+// throwableString returns the toString of a throwable
+func (jvm *Jvm) throwableString(value StackData) (string, error) {
+	s, err := jvm.InvokeVirtual("java/lang/Throwable", "toString", "()Ljava/lang/String;", []StackData{value})
+	if err != nil || s.IsNull() {
+		return "null", err
+	}
+	return s.Data.(*String).String(), nil
+}
+
+func init() {
+	const throwableClass = "java/lang/Throwable"
+	construct := func(call *NativeCall) (StackData, error) {
+		object := call.Object(0)
+		switch call.Descriptor {
+		case "(Ljava/lang/String;)V":
+			object.Fields[throwableMessage] = call.Args[1]
+		case "(Ljava/lang/String;Ljava/lang/Throwable;)V", "(Ljava/lang/String;Ljava/lang/Throwable;ZZ)V":
+			object.Fields[throwableMessage] = call.Args[1]
+			object.Fields[throwableCause] = call.Args[2]
+		case "(Ljava/lang/Throwable;)V":
+			// The message of the cause becomes the message
+			object.Fields[throwableCause] = call.Args[1]
+			if !call.Args[1].IsNull() {
+				message, err := call.Jvm.throwableString(call.Args[1])
+				if err != nil {
+					return StackData{}, err
+				}
+				object.Fields[throwableMessage] = referenceValue(NewString(message))
+			}
+		}
+		return StackData{}, nil
+	}
+	for _, methodDescriptor := range []string{"()V", "(Ljava/lang/String;)V", "(Ljava/lang/String;Ljava/lang/Throwable;)V", "(Ljava/lang/Throwable;)V", "(Ljava/lang/String;Ljava/lang/Throwable;ZZ)V"} {
+		RegisterNative(throwableClass, "<init>", methodDescriptor, construct)
+	}
+	RegisterNative(throwableClass, "getMessage", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return call.Object(0).Fields[throwableMessage], nil
+	})
+	RegisterNative(throwableClass, "getLocalizedMessage", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return call.Jvm.InvokeVirtual(throwableClass, "getMessage", "()Ljava/lang/String;", call.Args[:1])
+	})
+	RegisterNative(throwableClass, "getCause", "()Ljava/lang/Throwable;", func(call *NativeCall) (StackData, error) {
+		return call.Object(0).Fields[throwableCause], nil
+	})
+	RegisterNative(throwableClass, "initCause", "(Ljava/lang/Throwable;)Ljava/lang/Throwable;", func(call *NativeCall) (StackData, error) {
+		object := call.Object(0)
+		if !object.Fields[throwableCause].IsNull() {
+			return StackData{}, throwable("java/lang/IllegalStateException", "Can't overwrite cause")
+		}
+		if call.Object(1) == object {
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "Self-causation not permitted")
+		}
+		object.Fields[throwableCause] = call.Args[1]
+		return call.Args[0], nil
+	})
+	RegisterNative(throwableClass, "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		name := strings.ReplaceAll(call.Object(0).Class.Name(), "/", ".")
+		message, err := call.Jvm.InvokeVirtual(throwableClass, "getLocalizedMessage", "()Ljava/lang/String;", call.Args[:1])
+		if err != nil {
+			return StackData{}, err
+		}
+		if message.IsNull() {
+			return referenceValue(NewString(name)), nil
+		}
+		return referenceValue(NewString(name + ": " + message.Data.(*String).String())), nil
+	})
+	printStackTrace := func(call *NativeCall) (StackData, error) {
+		// The vm keeps no stack trace, the causes are printed
+		stream := call.Object(len(call.Args) - 1)
+		if len(call.Args) == 1 {
+			var err error
+			if stream, err = call.Jvm.systemStream("err"); err != nil {
+				return StackData{}, err
+			}
+		} else if stream == nil {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		var trace strings.Builder
+		prefix := ""
+		seen := map[*Object]bool{}
+		for value := call.Args[0]; !value.IsNull() && !seen[value.Data.(*Object)]; value = value.Data.(*Object).Fields[throwableCause] {
+			seen[value.Data.(*Object)] = true
+			s, err := call.Jvm.throwableString(value)
+			if err != nil {
+				return StackData{}, err
+			}
+			fmt.Fprintf(&trace, "%s%s\n", prefix, s)
+			prefix = "Caused by: "
+		}
+		return StackData{}, call.Jvm.writeStream(stream, trace.String(), false)
+	}
+	RegisterNative(throwableClass, "printStackTrace", "()V", printStackTrace)
+	RegisterNative(throwableClass, "printStackTrace", "(Ljava/io/PrintStream;)V", printStackTrace)
+	RegisterNative(throwableClass, "fillInStackTrace", "()Ljava/lang/Throwable;", func(call *NativeCall) (StackData, error) {
+		return call.Args[0], nil
+	})
+	RegisterNative(throwableClass, "getStackTrace", "()[Ljava/lang/StackTraceElement;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(NewArray("[Ljava/lang/StackTraceElement;", 0)), nil
+	})
+	RegisterNative(throwableClass, "setStackTrace", "([Ljava/lang/StackTraceElement;)V", func(call *NativeCall) (StackData, error) {
+		return StackData{}, nil
+	})
+}
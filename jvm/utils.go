@@ -2,10 +2,11 @@ package jvm
 
 import (
 	"bufio"
+	"io"
 )
 
 func ReadSection(javaClassFile *bufio.Reader, buffer []byte) error {
-	if _, err := javaClassFile.Read(buffer); err != nil {
+	if _, err := io.ReadFull(javaClassFile, buffer); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,1038 @@
+package jvm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+type VerifyError struct {
+	ClassName  string
+	MethodName string
+	Descriptor string
+	// Offset of the failing instruction, -1 if the whole method is wrong
+	Pc     int
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	if e.Pc < 0 {
+		return fmt.Sprintf("java.lang.VerifyError: %s.%s%s: %s", e.ClassName, e.MethodName, e.Descriptor, e.Reason)
+	}
+	return fmt.Sprintf("java.lang.VerifyError: %s.%s%s @%d: %s", e.ClassName, e.MethodName, e.Descriptor, e.Pc, e.Reason)
+}
+
+// VerifyClass checks the bytecode of every method of the class before it
+// can be run
+func VerifyClass(class *JavaClass, hierarchy ClassHierarchy) error {
+	for _, method := range class.Methods {
+		if err := VerifyMethod(class, method, hierarchy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func VerifyMethod(class *JavaClass, method *MethodInfo, hierarchy ClassHierarchy) error {
+	v, err := newMethodVerifier(class, method, hierarchy)
+	if err != nil || v == nil {
+		return err
+	}
+	switch {
+	case class.MajorVersion >= 51:
+		return v.typeCheck()
+	case class.MajorVersion == 50:
+		// Version 50 class files may carry a broken StackMapTable, like
+		// HotSpot they fail over to type inference
+		if err := v.typeCheck(); err != nil {
+			return v.inferTypes()
+		}
+		return nil
+	default:
+		return v.inferTypes()
+	}
+}
+
+type verifierInstruction struct {
+	Op     Opcode
+	Length int
+	// Offsets the instruction can jump to
+	Targets []int
+	// The next instruction is not reachable from this one
+	Unconditional bool
+}
+
+type methodVerifier struct {
+	class      *JavaClass
+	className  string
+	method     *MethodInfo
+	code       *CodeAttribute
+	hierarchy  ClassHierarchy
+	args       []VerifierType
+	returnType *VerifierType
+	// Whether each offset of the code starts an instruction
+	instructionStarts []bool
+}
+
+func newMethodVerifier(class *JavaClass, method *MethodInfo, hierarchy ClassHierarchy) (*methodVerifier, error) {
+	v := &methodVerifier{
+		class:     class,
+		className: GetClassName(class.ConstantPool, class.ThisClass),
+		method:    method,
+		code:      method.Code(),
+		hierarchy: hierarchy,
+	}
+	flags := AccessFlag(method.AccessFlags)
+	if v.code == nil {
+		if flags&(AccAbstract|AccNative) == 0 {
+			return nil, v.errorf(-1, "Missing Code attribute")
+		}
+		return nil, nil
+	}
+	if flags&(AccAbstract|AccNative) != 0 {
+		return nil, v.errorf(-1, "Abstract or native method with a Code attribute")
+	}
+
+	args, returnType, err := verifierMethodDescriptor(method.Descriptor)
+	if err != nil {
+		return nil, v.errorf(-1, "%s", err)
+	}
+	v.args = args
+	v.returnType = returnType
+
+	code := v.code.Code
+	if len(code) == 0 {
+		return nil, v.errorf(-1, "Empty code")
+	}
+	v.instructionStarts = make([]bool, len(code))
+	for pc := 0; pc < len(code); {
+		length, err := InstructionLength(code, pc)
+		if err != nil {
+			return nil, v.errorf(pc, "%s", err)
+		}
+		if pc+length > len(code) {
+			return nil, v.errorf(pc, "Instruction %s extends past the end of the code", Opcode(code[pc]))
+		}
+		v.instructionStarts[pc] = true
+		pc += length
+	}
+
+	for _, handler := range v.code.ExceptionsTable {
+		if !v.isInstructionStart(int(handler.StartPc)) || int(handler.StartPc) >= int(handler.EndPc) ||
+			(int(handler.EndPc) != len(code) && !v.isInstructionStart(int(handler.EndPc))) {
+			return nil, v.errorf(-1, "Illegal exception table range [%d, %d)", handler.StartPc, handler.EndPc)
+		}
+		if !v.isInstructionStart(int(handler.HandlerPc)) {
+			return nil, v.errorf(-1, "Illegal exception table handler %d", handler.HandlerPc)
+		}
+	}
+	return v, nil
+}
+
+func (v *methodVerifier) errorf(pc int, format string, args ...any) *VerifyError {
+	return &VerifyError{
+		ClassName:  v.className,
+		MethodName: v.method.Name,
+		Descriptor: v.method.Descriptor,
+		Pc:         pc,
+		Reason:     fmt.Sprintf(format, args...),
+	}
+}
+
+func (v *methodVerifier) isInstructionStart(pc int) bool {
+	return pc >= 0 && pc < len(v.instructionStarts) && v.instructionStarts[pc]
+}
+
+func (v *methodVerifier) isStatic() bool {
+	return AccessFlag(v.method.AccessFlags)&AccStatic != 0
+}
+
+func (v *methodVerifier) superClassName() string {
+	if v.class.SuperClass == 0 {
+		return ""
+	}
+	return GetClassName(v.class.ConstantPool, v.class.SuperClass)
+}
+
+// initialFrame builds the frame on method entry from its descriptor
+func (v *methodVerifier) initialFrame() (*VerifierFrame, error) {
+	frame := &VerifierFrame{
+		Locals: make([]VerifierType, v.code.MaxLocals),
+		Stack:  make([]VerifierType, 0, v.code.MaxStack),
+	}
+	for i := range frame.Locals {
+		frame.Locals[i] = vTop
+	}
+
+	index := 0
+	if !v.isStatic() {
+		if int(v.code.MaxLocals) < 1 {
+			return nil, v.errorf(-1, "Arguments can't fit into locals")
+		}
+		if v.method.Name == "<init>" && v.className != "java/lang/Object" {
+			frame.Locals[0] = vUninitializedThis
+			frame.FlagThisUninit = true
+		} else {
+			frame.Locals[0] = vReference(v.className)
+		}
+		index += 1
+	}
+	for _, arg := range v.args {
+		if index+arg.Size() > int(v.code.MaxLocals) {
+			return nil, v.errorf(-1, "Arguments can't fit into locals")
+		}
+		frame.Locals[index] = arg
+		index += arg.Size()
+	}
+	return frame, nil
+}
+
+func (v *methodVerifier) push(pc int, frame *VerifierFrame, t VerifierType) error {
+	if frame.StackSize()+t.Size() > int(v.code.MaxStack) {
+		return v.errorf(pc, "Operand stack overflow")
+	}
+	frame.Stack = append(frame.Stack, t)
+	return nil
+}
+
+func (v *methodVerifier) pop(pc int, frame *VerifierFrame, expected VerifierType) (VerifierType, error) {
+	if len(frame.Stack) == 0 {
+		return vTop, v.errorf(pc, "Operand stack underflow")
+	}
+	top := frame.Stack[len(frame.Stack)-1]
+	if !IsAssignable(v.hierarchy, top, expected) {
+		return vTop, v.errorf(pc, "Bad type on operand stack: Type %s (current frame, stack[%d]) is not assignable to %s", top, len(frame.Stack)-1, expected)
+	}
+	frame.Stack = frame.Stack[:len(frame.Stack)-1]
+	return top, nil
+}
+
+// popAny pops a value of any type of the given computational category
+func (v *methodVerifier) popAny(pc int, frame *VerifierFrame, category int) (VerifierType, error) {
+	if len(frame.Stack) == 0 {
+		return vTop, v.errorf(pc, "Operand stack underflow")
+	}
+	top := frame.Stack[len(frame.Stack)-1]
+	if top.Size() != category {
+		return vTop, v.errorf(pc, "Bad type on operand stack: Type %s (current frame, stack[%d]) is not a category %d value", top, len(frame.Stack)-1, category)
+	}
+	frame.Stack = frame.Stack[:len(frame.Stack)-1]
+	return top, nil
+}
+
+// popReference pops any reference, including uninitialized objects
+func (v *methodVerifier) popReference(pc int, frame *VerifierFrame) (VerifierType, error) {
+	if len(frame.Stack) == 0 {
+		return vTop, v.errorf(pc, "Operand stack underflow")
+	}
+	top := frame.Stack[len(frame.Stack)-1]
+	if !top.IsReference() {
+		return vTop, v.errorf(pc, "Bad type on operand stack: Type %s (current frame, stack[%d]) is not a reference", top, len(frame.Stack)-1)
+	}
+	frame.Stack = frame.Stack[:len(frame.Stack)-1]
+	return top, nil
+}
+
+// popArray pops null or an array whose descriptor is one of the given ones,
+// an empty list accepts any array of references
+func (v *methodVerifier) popArray(pc int, frame *VerifierFrame, descriptors ...string) (VerifierType, error) {
+	if len(frame.Stack) == 0 {
+		return vTop, v.errorf(pc, "Operand stack underflow")
+	}
+	top := frame.Stack[len(frame.Stack)-1]
+	ok := top.Kind == VerifierNull
+	if top.IsArray() {
+		if len(descriptors) == 0 {
+			ok = top.ComponentType().Kind == VerifierReference
+		}
+		for _, descriptor := range descriptors {
+			ok = ok || top.Name == descriptor
+		}
+	}
+	if !ok {
+		expected := "array of references"
+		if len(descriptors) != 0 {
+			expected = strings.Join(descriptors, " or ")
+		}
+		return vTop, v.errorf(pc, "Bad type on operand stack: Type %s (current frame, stack[%d]) is not assignable to %s", top, len(frame.Stack)-1, expected)
+	}
+	frame.Stack = frame.Stack[:len(frame.Stack)-1]
+	return top, nil
+}
+
+func (v *methodVerifier) load(pc int, frame *VerifierFrame, index int, expected VerifierType) error {
+	if index+expected.Size() > len(frame.Locals) {
+		return v.errorf(pc, "Illegal local variable number %d", index)
+	}
+	local := frame.Locals[index]
+	if expected.Kind == VerifierReference {
+		if !local.IsReference() {
+			return v.errorf(pc, "Bad local variable type: Type %s (current frame, locals[%d]) is not a reference", local, index)
+		}
+		return v.push(pc, frame, local)
+	}
+	if local != expected {
+		return v.errorf(pc, "Bad local variable type: Type %s (current frame, locals[%d]) is not assignable to %s", local, index, expected)
+	}
+	return v.push(pc, frame, expected)
+}
+
+func (v *methodVerifier) store(pc int, frame *VerifierFrame, index int, t VerifierType) error {
+	if index+t.Size() > len(frame.Locals) {
+		return v.errorf(pc, "Illegal local variable number %d", index)
+	}
+	// Overwriting the second half of a long or double invalidates it
+	if index > 0 && frame.Locals[index-1].Size() == 2 {
+		frame.Locals[index-1] = vTop
+	}
+	frame.Locals[index] = t
+	if t.Size() == 2 {
+		frame.Locals[index+1] = vTop
+	}
+	return nil
+}
+
+// replaceAll substitutes every occurrence of from in the frame, used when an
+// uninitialized object gets initialized
+func (frame *VerifierFrame) replaceAll(from, to VerifierType) {
+	for i := range frame.Locals {
+		if frame.Locals[i] == from {
+			frame.Locals[i] = to
+		}
+	}
+	for i := range frame.Stack {
+		if frame.Stack[i] == from {
+			frame.Stack[i] = to
+		}
+	}
+}
+
+func (v *methodVerifier) u1(pc int) int {
+	return int(v.code.Code[pc])
+}
+
+func (v *methodVerifier) u2(pc int) uint16 {
+	return binary.BigEndian.Uint16(v.code.Code[pc:])
+}
+
+func (v *methodVerifier) s2(pc int) int {
+	return int(int16(binary.BigEndian.Uint16(v.code.Code[pc:])))
+}
+
+func (v *methodVerifier) s4(pc int) int {
+	return int(int32(binary.BigEndian.Uint32(v.code.Code[pc:])))
+}
+
+func (v *methodVerifier) checkTarget(pc, target int) error {
+	if !v.isInstructionStart(target) {
+		return v.errorf(pc, "Illegal target of jump or branch %d", target)
+	}
+	return nil
+}
+
+// switchTargets decodes the default and the case targets of a tableswitch
+// or lookupswitch
+func (v *methodVerifier) switchTargets(pc int) ([]int, error) {
+	base := pc + 1 + (3 - pc%4)
+	for i := pc + 1; i < base; i++ {
+		if v.code.Code[i] != 0 && v.class.MajorVersion >= 51 {
+			return nil, v.errorf(pc, "Nonzero padding bytes in switch")
+		}
+	}
+	targets := []int{pc + v.s4(base)}
+	if Opcode(v.code.Code[pc]) == OpTableswitch {
+		low := v.s4(base + 4)
+		high := v.s4(base + 8)
+		for i := 0; i <= high-low; i++ {
+			targets = append(targets, pc+v.s4(base+12+i*4))
+		}
+	} else {
+		npairs := v.s4(base + 4)
+		for i := 0; i < npairs; i++ {
+			if i > 0 && v.s4(base+8+i*8) <= v.s4(base+8+(i-1)*8) {
+				return nil, v.errorf(pc, "Bad lookupswitch instruction, keys are not sorted")
+			}
+			targets = append(targets, pc+v.s4(base+12+i*8))
+		}
+	}
+	for _, target := range targets {
+		if err := v.checkTarget(pc, target); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+func (v *methodVerifier) constantTag(pc int, index uint16) (ConstantPoolTag, error) {
+	if index == 0 || int(index) > len(v.class.ConstantPool) || v.class.ConstantPool[index-1] == nil {
+		return 0, v.errorf(pc, "Illegal constant pool index %d", index)
+	}
+	return v.class.ConstantPool[index-1].Tag, nil
+}
+
+func (v *methodVerifier) classConstant(pc int, index uint16) (string, error) {
+	tag, err := v.constantTag(pc, index)
+	if err != nil {
+		return "", err
+	}
+	if tag != ConstantClassTag {
+		return "", v.errorf(pc, "Illegal type at constant pool entry %d, expected class", index)
+	}
+	return GetClassName(v.class.ConstantPool, index), nil
+}
+
+func (v *methodVerifier) memberConstant(pc int, index uint16, tags ...ConstantPoolTag) (string, string, string, error) {
+	tag, err := v.constantTag(pc, index)
+	if err != nil {
+		return "", "", "", err
+	}
+	for _, expected := range tags {
+		if tag == expected {
+			className, name, descriptor := GetMemberRef(v.class.ConstantPool, index)
+			return className, name, descriptor, nil
+		}
+	}
+	return "", "", "", v.errorf(pc, "Illegal type at constant pool entry %d, found %s", index, tag)
+}
+
+var arrayLoadTypes = map[Opcode]struct {
+	value       VerifierType
+	descriptors []string
+}{
+	OpIaload: {vInt, []string{"[I"}}, OpLaload: {vLong, []string{"[J"}},
+	OpFaload: {vFloat, []string{"[F"}}, OpDaload: {vDouble, []string{"[D"}},
+	OpBaload: {vInt, []string{"[B", "[Z"}}, OpCaload: {vInt, []string{"[C"}},
+	OpSaload: {vInt, []string{"[S"}},
+}
+
+var arrayStoreTypes = map[Opcode]struct {
+	value       VerifierType
+	descriptors []string
+}{
+	OpIastore: {vInt, []string{"[I"}}, OpLastore: {vLong, []string{"[J"}},
+	OpFastore: {vFloat, []string{"[F"}}, OpDastore: {vDouble, []string{"[D"}},
+	OpBastore: {vInt, []string{"[B", "[Z"}}, OpCastore: {vInt, []string{"[C"}},
+	OpSastore: {vInt, []string{"[S"}},
+}
+
+// Operand types popped and the result pushed by the instructions which only
+// work with primitive values
+var primitiveInstructions = map[Opcode]struct {
+	operands []VerifierType
+	result   *VerifierType
+}{
+	OpIadd: {[]VerifierType{vInt, vInt}, &vInt}, OpLadd: {[]VerifierType{vLong, vLong}, &vLong},
+	OpFadd: {[]VerifierType{vFloat, vFloat}, &vFloat}, OpDadd: {[]VerifierType{vDouble, vDouble}, &vDouble},
+	OpIsub: {[]VerifierType{vInt, vInt}, &vInt}, OpLsub: {[]VerifierType{vLong, vLong}, &vLong},
+	OpFsub: {[]VerifierType{vFloat, vFloat}, &vFloat}, OpDsub: {[]VerifierType{vDouble, vDouble}, &vDouble},
+	OpImul: {[]VerifierType{vInt, vInt}, &vInt}, OpLmul: {[]VerifierType{vLong, vLong}, &vLong},
+	OpFmul: {[]VerifierType{vFloat, vFloat}, &vFloat}, OpDmul: {[]VerifierType{vDouble, vDouble}, &vDouble},
+	OpIdiv: {[]VerifierType{vInt, vInt}, &vInt}, OpLdiv: {[]VerifierType{vLong, vLong}, &vLong},
+	OpFdiv: {[]VerifierType{vFloat, vFloat}, &vFloat}, OpDdiv: {[]VerifierType{vDouble, vDouble}, &vDouble},
+	OpIrem: {[]VerifierType{vInt, vInt}, &vInt}, OpLrem: {[]VerifierType{vLong, vLong}, &vLong},
+	OpFrem: {[]VerifierType{vFloat, vFloat}, &vFloat}, OpDrem: {[]VerifierType{vDouble, vDouble}, &vDouble},
+	OpIneg: {[]VerifierType{vInt}, &vInt}, OpLneg: {[]VerifierType{vLong}, &vLong},
+	OpFneg: {[]VerifierType{vFloat}, &vFloat}, OpDneg: {[]VerifierType{vDouble}, &vDouble},
+	OpIshl: {[]VerifierType{vInt, vInt}, &vInt}, OpLshl: {[]VerifierType{vInt, vLong}, &vLong},
+	OpIshr: {[]VerifierType{vInt, vInt}, &vInt}, OpLshr: {[]VerifierType{vInt, vLong}, &vLong},
+	OpIushr: {[]VerifierType{vInt, vInt}, &vInt}, OpLushr: {[]VerifierType{vInt, vLong}, &vLong},
+	OpIand: {[]VerifierType{vInt, vInt}, &vInt}, OpLand: {[]VerifierType{vLong, vLong}, &vLong},
+	OpIor: {[]VerifierType{vInt, vInt}, &vInt}, OpLor: {[]VerifierType{vLong, vLong}, &vLong},
+	OpIxor: {[]VerifierType{vInt, vInt}, &vInt}, OpLxor: {[]VerifierType{vLong, vLong}, &vLong},
+	OpI2l: {[]VerifierType{vInt}, &vLong}, OpI2f: {[]VerifierType{vInt}, &vFloat},
+	OpI2d: {[]VerifierType{vInt}, &vDouble}, OpL2i: {[]VerifierType{vLong}, &vInt},
+	OpL2f: {[]VerifierType{vLong}, &vFloat}, OpL2d: {[]VerifierType{vLong}, &vDouble},
+	OpF2i: {[]VerifierType{vFloat}, &vInt}, OpF2l: {[]VerifierType{vFloat}, &vLong},
+	OpF2d: {[]VerifierType{vFloat}, &vDouble}, OpD2i: {[]VerifierType{vDouble}, &vInt},
+	OpD2l: {[]VerifierType{vDouble}, &vLong}, OpD2f: {[]VerifierType{vDouble}, &vFloat},
+	OpI2b: {[]VerifierType{vInt}, &vInt}, OpI2c: {[]VerifierType{vInt}, &vInt},
+	OpI2s:   {[]VerifierType{vInt}, &vInt},
+	OpLcmp:  {[]VerifierType{vLong, vLong}, &vInt},
+	OpFcmpl: {[]VerifierType{vFloat, vFloat}, &vInt}, OpFcmpg: {[]VerifierType{vFloat, vFloat}, &vInt},
+	OpDcmpl: {[]VerifierType{vDouble, vDouble}, &vInt}, OpDcmpg: {[]VerifierType{vDouble, vDouble}, &vInt},
+	OpIfeq: {[]VerifierType{vInt}, nil}, OpIfne: {[]VerifierType{vInt}, nil},
+	OpIflt: {[]VerifierType{vInt}, nil}, OpIfge: {[]VerifierType{vInt}, nil},
+	OpIfgt: {[]VerifierType{vInt}, nil}, OpIfle: {[]VerifierType{vInt}, nil},
+	OpIfIcmpeq: {[]VerifierType{vInt, vInt}, nil}, OpIfIcmpne: {[]VerifierType{vInt, vInt}, nil},
+	OpIfIcmplt: {[]VerifierType{vInt, vInt}, nil}, OpIfIcmpge: {[]VerifierType{vInt, vInt}, nil},
+	OpIfIcmpgt: {[]VerifierType{vInt, vInt}, nil}, OpIfIcmple: {[]VerifierType{vInt, vInt}, nil},
+}
+
+// Local variable type and index of the load and store instructions, index
+// is -1 when it is an operand
+var localInstructions = map[Opcode]struct {
+	t     VerifierType
+	index int
+	store bool
+}{
+	OpIload: {vInt, -1, false}, OpLload: {vLong, -1, false}, OpFload: {vFloat, -1, false},
+	OpDload: {vDouble, -1, false}, OpAload: {vObject, -1, false},
+	OpIload0: {vInt, 0, false}, OpIload1: {vInt, 1, false}, OpIload2: {vInt, 2, false}, OpIload3: {vInt, 3, false},
+	OpLload0: {vLong, 0, false}, OpLload1: {vLong, 1, false}, OpLload2: {vLong, 2, false}, OpLload3: {vLong, 3, false},
+	OpFload0: {vFloat, 0, false}, OpFload1: {vFloat, 1, false}, OpFload2: {vFloat, 2, false}, OpFload3: {vFloat, 3, false},
+	OpDload0: {vDouble, 0, false}, OpDload1: {vDouble, 1, false}, OpDload2: {vDouble, 2, false}, OpDload3: {vDouble, 3, false},
+	OpAload0: {vObject, 0, false}, OpAload1: {vObject, 1, false}, OpAload2: {vObject, 2, false}, OpAload3: {vObject, 3, false},
+	OpIstore: {vInt, -1, true}, OpLstore: {vLong, -1, true}, OpFstore: {vFloat, -1, true},
+	OpDstore: {vDouble, -1, true}, OpAstore: {vObject, -1, true},
+	OpIstore0: {vInt, 0, true}, OpIstore1: {vInt, 1, true}, OpIstore2: {vInt, 2, true}, OpIstore3: {vInt, 3, true},
+	OpLstore0: {vLong, 0, true}, OpLstore1: {vLong, 1, true}, OpLstore2: {vLong, 2, true}, OpLstore3: {vLong, 3, true},
+	OpFstore0: {vFloat, 0, true}, OpFstore1: {vFloat, 1, true}, OpFstore2: {vFloat, 2, true}, OpFstore3: {vFloat, 3, true},
+	OpDstore0: {vDouble, 0, true}, OpDstore1: {vDouble, 1, true}, OpDstore2: {vDouble, 2, true}, OpDstore3: {vDouble, 3, true},
+	OpAstore0: {vObject, 0, true}, OpAstore1: {vObject, 1, true}, OpAstore2: {vObject, 2, true}, OpAstore3: {vObject, 3, true},
+}
+
+var newarrayTypes = map[int]string{
+	4: "[Z", 5: "[C", 6: "[F", 7: "[D", 8: "[B", 9: "[S", 10: "[I", 11: "[J",
+}
+
+// step applies the effect of the instruction at pc to frame. jsr and ret
+// are left to the callers since they depend on the verification algorithm
+func (v *methodVerifier) step(pc int, frame *VerifierFrame) (*verifierInstruction, error) {
+	code := v.code.Code
+	op := Opcode(code[pc])
+	length, _ := InstructionLength(code, pc)
+	inst := &verifierInstruction{Op: op, Length: length}
+
+	if op == OpWide {
+		op = Opcode(code[pc+1])
+		index := int(v.u2(pc + 2))
+		if op == OpIinc {
+			if index >= len(frame.Locals) || frame.Locals[index] != vInt {
+				return nil, v.errorf(pc, "Bad local variable type for iinc at locals[%d]", index)
+			}
+			return inst, nil
+		}
+		local, ok := localInstructions[op]
+		if !ok || local.index != -1 {
+			return nil, v.errorf(pc, "Bad wide instruction %s", op)
+		}
+		return inst, v.localInstruction(pc, frame, index, local.t, local.store)
+	}
+
+	if local, ok := localInstructions[op]; ok {
+		index := local.index
+		if index == -1 {
+			index = v.u1(pc + 1)
+		}
+		return inst, v.localInstruction(pc, frame, index, local.t, local.store)
+	}
+
+	if primitive, ok := primitiveInstructions[op]; ok {
+		for _, operand := range primitive.operands {
+			if _, err := v.pop(pc, frame, operand); err != nil {
+				return nil, err
+			}
+		}
+		if primitive.result != nil {
+			if err := v.push(pc, frame, *primitive.result); err != nil {
+				return nil, err
+			}
+		}
+		if op >= OpIfeq && op <= OpIfIcmple {
+			target := pc + v.s2(pc+1)
+			inst.Targets = []int{target}
+			return inst, v.checkTarget(pc, target)
+		}
+		return inst, nil
+	}
+
+	if array, ok := arrayLoadTypes[op]; ok {
+		if _, err := v.pop(pc, frame, vInt); err != nil {
+			return nil, err
+		}
+		if _, err := v.popArray(pc, frame, array.descriptors...); err != nil {
+			return nil, err
+		}
+		return inst, v.push(pc, frame, array.value)
+	}
+
+	if array, ok := arrayStoreTypes[op]; ok {
+		if _, err := v.pop(pc, frame, array.value); err != nil {
+			return nil, err
+		}
+		if _, err := v.pop(pc, frame, vInt); err != nil {
+			return nil, err
+		}
+		_, err := v.popArray(pc, frame, array.descriptors...)
+		return inst, err
+	}
+
+	var err error
+	switch op {
+	case OpNop:
+	case OpAconstNull:
+		err = v.push(pc, frame, vNull)
+	case OpIconstM1, OpIconst0, OpIconst1, OpIconst2, OpIconst3, OpIconst4, OpIconst5, OpBipush, OpSipush:
+		err = v.push(pc, frame, vInt)
+	case OpLconst0, OpLconst1:
+		err = v.push(pc, frame, vLong)
+	case OpFconst0, OpFconst1, OpFconst2:
+		err = v.push(pc, frame, vFloat)
+	case OpDconst0, OpDconst1:
+		err = v.push(pc, frame, vDouble)
+	case OpLdc, OpLdcW, OpLdc2W:
+		index := uint16(v.u1(pc + 1))
+		if op != OpLdc {
+			index = v.u2(pc + 1)
+		}
+		tag, err := v.constantTag(pc, index)
+		if err != nil {
+			return nil, err
+		}
+		var t VerifierType
+		switch {
+		case op == OpLdc2W && tag == ConstantLongTag:
+			t = vLong
+		case op == OpLdc2W && tag == ConstantDoubleTag:
+			t = vDouble
+		case op != OpLdc2W && tag == ConstantIntegerTag:
+			t = vInt
+		case op != OpLdc2W && tag == ConstantFloatTag:
+			t = vFloat
+		case op != OpLdc2W && tag == ConstantStringTag:
+			t = vString
+		case op != OpLdc2W && tag == ConstantClassTag:
+			t = vClass
+		case op != OpLdc2W && tag == ConstantMethodTypeTag:
+			t = vReference("java/lang/invoke/MethodType")
+		case op != OpLdc2W && tag == ConstantMethodHandleTag:
+			t = vReference("java/lang/invoke/MethodHandle")
+		default:
+			return nil, v.errorf(pc, "Invalid index in %s, found %s", op, tag)
+		}
+		return inst, v.push(pc, frame, t)
+	case OpIinc:
+		index := v.u1(pc + 1)
+		if index >= len(frame.Locals) || frame.Locals[index] != vInt {
+			return nil, v.errorf(pc, "Bad local variable type for iinc at locals[%d]", index)
+		}
+	case OpAaload:
+		if _, err := v.pop(pc, frame, vInt); err != nil {
+			return nil, err
+		}
+		array, err := v.popArray(pc, frame)
+		if err != nil {
+			return nil, err
+		}
+		if array.Kind == VerifierNull {
+			return inst, v.push(pc, frame, vNull)
+		}
+		return inst, v.push(pc, frame, array.ComponentType())
+	case OpAastore:
+		if _, err := v.pop(pc, frame, vObject); err != nil {
+			return nil, err
+		}
+		if _, err := v.pop(pc, frame, vInt); err != nil {
+			return nil, err
+		}
+		_, err = v.popArray(pc, frame)
+	case OpPop:
+		_, err = v.popAny(pc, frame, 1)
+	case OpPop2:
+		err = v.stackShuffle(pc, frame, op)
+	case OpDup, OpDupX1, OpDupX2, OpDup2, OpDup2X1, OpDup2X2, OpSwap:
+		err = v.stackShuffle(pc, frame, op)
+	case OpIfAcmpeq, OpIfAcmpne:
+		if _, err := v.popReference(pc, frame); err != nil {
+			return nil, err
+		}
+		fallthrough
+	case OpIfnull, OpIfnonnull:
+		if _, err := v.popReference(pc, frame); err != nil {
+			return nil, err
+		}
+		inst.Targets = []int{pc + v.s2(pc+1)}
+		err = v.checkTarget(pc, inst.Targets[0])
+	case OpGoto, OpGotoW:
+		target := pc + v.s2(pc+1)
+		if op == OpGotoW {
+			target = pc + v.s4(pc+1)
+		}
+		inst.Targets = []int{target}
+		inst.Unconditional = true
+		err = v.checkTarget(pc, target)
+	case OpJsr, OpJsrW, OpRet:
+		return nil, v.errorf(pc, "Instruction %s is not allowed in class file version %d", op, v.class.MajorVersion)
+	case OpTableswitch, OpLookupswitch:
+		if _, err := v.pop(pc, frame, vInt); err != nil {
+			return nil, err
+		}
+		inst.Targets, err = v.switchTargets(pc)
+		inst.Unconditional = true
+	case OpIreturn, OpLreturn, OpFreturn, OpDreturn, OpAreturn:
+		expected := map[Opcode]VerifierType{OpIreturn: vInt, OpLreturn: vLong, OpFreturn: vFloat, OpDreturn: vDouble}[op]
+		if v.returnType == nil || (op == OpAreturn && v.returnType.Kind != VerifierReference) ||
+			(op != OpAreturn && *v.returnType != expected) {
+			return nil, v.errorf(pc, "Method expects a return value of a different type than %s", op)
+		}
+		_, err = v.pop(pc, frame, *v.returnType)
+		inst.Unconditional = true
+	case OpReturn:
+		if v.returnType != nil {
+			return nil, v.errorf(pc, "Method expects a return value")
+		}
+		if frame.FlagThisUninit {
+			return nil, v.errorf(pc, "Constructor must call super() or this() before return")
+		}
+		inst.Unconditional = true
+	case OpGetstatic, OpPutstatic, OpGetfield, OpPutfield:
+		err = v.fieldInstruction(pc, frame, op)
+	case OpInvokevirtual, OpInvokespecial, OpInvokestatic, OpInvokeinterface, OpInvokedynamic:
+		err = v.invokeInstruction(pc, frame, op)
+	case OpNew:
+		className, err := v.classConstant(pc, v.u2(pc+1))
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(className, "[") {
+			return nil, v.errorf(pc, "Illegal new instruction for array class %s", className)
+		}
+		uninitialized := vUninitialized(pc)
+		for _, t := range frame.Stack {
+			if t == uninitialized {
+				return nil, v.errorf(pc, "Uninitialized object exists on backward branch %d", pc)
+			}
+		}
+		frame.replaceAll(uninitialized, vTop)
+		return inst, v.push(pc, frame, uninitialized)
+	case OpNewarray:
+		descriptor, ok := newarrayTypes[v.u1(pc+1)]
+		if !ok {
+			return nil, v.errorf(pc, "Illegal newarray type %d", v.u1(pc+1))
+		}
+		if _, err := v.pop(pc, frame, vInt); err != nil {
+			return nil, err
+		}
+		err = v.push(pc, frame, vReference(descriptor))
+	case OpAnewarray:
+		className, err := v.classConstant(pc, v.u2(pc+1))
+		if err != nil {
+			return nil, err
+		}
+		if strings.Count(className, "[") >= 255 {
+			return nil, v.errorf(pc, "Array with too many dimensions")
+		}
+		if _, err := v.pop(pc, frame, vInt); err != nil {
+			return nil, err
+		}
+		return inst, v.push(pc, frame, vReference(className).ArrayOf())
+	case OpArraylength:
+		if len(frame.Stack) == 0 {
+			return nil, v.errorf(pc, "Operand stack underflow")
+		}
+		top := frame.Stack[len(frame.Stack)-1]
+		if top.Kind != VerifierNull && !top.IsArray() {
+			return nil, v.errorf(pc, "Bad type on operand stack: Type %s (current frame, stack[%d]) is not an array", top, len(frame.Stack)-1)
+		}
+		frame.Stack = frame.Stack[:len(frame.Stack)-1]
+		err = v.push(pc, frame, vInt)
+	case OpAthrow:
+		_, err = v.pop(pc, frame, vThrowable)
+		inst.Unconditional = true
+	case OpCheckcast:
+		className, err := v.classConstant(pc, v.u2(pc+1))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := v.pop(pc, frame, vObject); err != nil {
+			return nil, err
+		}
+		return inst, v.push(pc, frame, vReference(className))
+	case OpInstanceof:
+		if _, err := v.classConstant(pc, v.u2(pc+1)); err != nil {
+			return nil, err
+		}
+		if _, err := v.pop(pc, frame, vObject); err != nil {
+			return nil, err
+		}
+		err = v.push(pc, frame, vInt)
+	case OpMonitorenter, OpMonitorexit:
+		_, err = v.pop(pc, frame, vObject)
+	case OpMultianewarray:
+		className, err := v.classConstant(pc, v.u2(pc+1))
+		if err != nil {
+			return nil, err
+		}
+		dimensions := v.u1(pc + 3)
+		if dimensions == 0 || strings.Count(className, "[") < dimensions ||
+			!strings.HasPrefix(className, strings.Repeat("[", dimensions)) {
+			return nil, v.errorf(pc, "Illegal dimension in multianewarray instruction: %d", dimensions)
+		}
+		for range dimensions {
+			if _, err := v.pop(pc, frame, vInt); err != nil {
+				return nil, err
+			}
+		}
+		return inst, v.push(pc, frame, vReference(className))
+	default:
+		return nil, v.errorf(pc, "Bad instruction 0x%02X", uint8(op))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+func (v *methodVerifier) localInstruction(pc int, frame *VerifierFrame, index int, t VerifierType, store bool) error {
+	if !store {
+		return v.load(pc, frame, index, t)
+	}
+	if t.Kind != VerifierReference {
+		if _, err := v.pop(pc, frame, t); err != nil {
+			return err
+		}
+		return v.store(pc, frame, index, t)
+	}
+	// astore also takes uninitialized objects and return addresses
+	if len(frame.Stack) == 0 {
+		return v.errorf(pc, "Operand stack underflow")
+	}
+	top := frame.Stack[len(frame.Stack)-1]
+	if !top.IsReference() && top.Kind != VerifierReturnAddress {
+		return v.errorf(pc, "Bad type on operand stack: Type %s (current frame, stack[%d]) is not a reference", top, len(frame.Stack)-1)
+	}
+	frame.Stack = frame.Stack[:len(frame.Stack)-1]
+	return v.store(pc, frame, index, top)
+}
+
+// stackShuffle implements the pop2, dup and swap family using the
+// computational category of the values on the stack
+func (v *methodVerifier) stackShuffle(pc int, frame *VerifierFrame, op Opcode) error {
+	popCategory1 := func() (VerifierType, error) { return v.popAny(pc, frame, 1) }
+	// Pops either one category 2 value or two category 1 values, top first
+	popForm2 := func() ([]VerifierType, error) {
+		if len(frame.Stack) == 0 {
+			return nil, v.errorf(pc, "Operand stack underflow")
+		}
+		if frame.Stack[len(frame.Stack)-1].Size() == 2 {
+			t, _ := v.popAny(pc, frame, 2)
+			return []VerifierType{t}, nil
+		}
+		t1, err := popCategory1()
+		if err != nil {
+			return nil, err
+		}
+		t2, err := popCategory1()
+		if err != nil {
+			return nil, err
+		}
+		return []VerifierType{t1, t2}, nil
+	}
+	pushAll := func(values ...[]VerifierType) error {
+		for _, group := range values {
+			for i := len(group) - 1; i >= 0; i-- {
+				if err := v.push(pc, frame, group[i]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	switch op {
+	case OpPop2:
+		_, err := popForm2()
+		return err
+	case OpDup:
+		t, err := popCategory1()
+		if err != nil {
+			return err
+		}
+		return pushAll([]VerifierType{t}, []VerifierType{t})
+	case OpDupX1:
+		t1, err := popCategory1()
+		if err != nil {
+			return err
+		}
+		t2, err := popCategory1()
+		if err != nil {
+			return err
+		}
+		return pushAll([]VerifierType{t1}, []VerifierType{t2}, []VerifierType{t1})
+	case OpDupX2:
+		t1, err := popCategory1()
+		if err != nil {
+			return err
+		}
+		under, err := popForm2()
+		if err != nil {
+			return err
+		}
+		return pushAll([]VerifierType{t1}, under, []VerifierType{t1})
+	case OpDup2:
+		top, err := popForm2()
+		if err != nil {
+			return err
+		}
+		return pushAll(top, top)
+	case OpDup2X1:
+		top, err := popForm2()
+		if err != nil {
+			return err
+		}
+		t, err := popCategory1()
+		if err != nil {
+			return err
+		}
+		return pushAll(top, []VerifierType{t}, top)
+	case OpDup2X2:
+		top, err := popForm2()
+		if err != nil {
+			return err
+		}
+		under, err := popForm2()
+		if err != nil {
+			return err
+		}
+		return pushAll(top, under, top)
+	case OpSwap:
+		t1, err := popCategory1()
+		if err != nil {
+			return err
+		}
+		t2, err := popCategory1()
+		if err != nil {
+			return err
+		}
+		return pushAll([]VerifierType{t1}, []VerifierType{t2})
+	}
+	return nil
+}
+
+func (v *methodVerifier) fieldInstruction(pc int, frame *VerifierFrame, op Opcode) error {
+	className, name, fieldDescriptor, err := v.memberConstant(pc, v.u2(pc+1), ConstantFieldRefTag)
+	if err != nil {
+		return err
+	}
+	parsed, err := descriptor.ParseField(fieldDescriptor)
+	if err != nil {
+		return v.errorf(pc, "Illegal field descriptor %s", fieldDescriptor)
+	}
+	fieldType := verifierTypeOf(parsed)
+
+	switch op {
+	case OpGetstatic:
+		return v.push(pc, frame, fieldType)
+	case OpPutstatic:
+		_, err := v.pop(pc, frame, fieldType)
+		return err
+	case OpGetfield:
+		if _, err := v.pop(pc, frame, vReference(className)); err != nil {
+			return err
+		}
+		return v.push(pc, frame, fieldType)
+	default:
+		if _, err := v.pop(pc, frame, fieldType); err != nil {
+			return err
+		}
+		// Constructors can set their own fields before calling super()
+		if len(frame.Stack) != 0 && frame.Stack[len(frame.Stack)-1] == vUninitializedThis && className == v.className {
+			for _, field := range v.class.Fields {
+				if field.Name == name && field.Descriptor == fieldDescriptor {
+					frame.Stack = frame.Stack[:len(frame.Stack)-1]
+					return nil
+				}
+			}
+		}
+		_, err := v.pop(pc, frame, vReference(className))
+		return err
+	}
+}
+
+func (v *methodVerifier) invokeInstruction(pc int, frame *VerifierFrame, op Opcode) error {
+	var className, name, methodDescriptor string
+	var err error
+	switch op {
+	case OpInvokedynamic:
+		if v.u2(pc+3) != 0 {
+			return v.errorf(pc, "Third and fourth operand bytes of invokedynamic must be zero")
+		}
+		if _, err := v.constantTag(pc, v.u2(pc+1)); err != nil {
+			return err
+		}
+		dynamic, ok := v.class.ConstantPool[v.u2(pc+1)-1].Data.(ConstantInvokeDynamic)
+		if !ok {
+			return v.errorf(pc, "Illegal type at constant pool entry %d, expected invoke dynamic", v.u2(pc+1))
+		}
+		name, methodDescriptor = GetNameAndType(v.class.ConstantPool, dynamic.NameAndTypeIndex)
+	case OpInvokeinterface:
+		className, name, methodDescriptor, err = v.memberConstant(pc, v.u2(pc+1), ConstantInterfaceMethodRefTag)
+	case OpInvokevirtual:
+		className, name, methodDescriptor, err = v.memberConstant(pc, v.u2(pc+1), ConstantMethodRefTag)
+	default:
+		className, name, methodDescriptor, err = v.memberConstant(pc, v.u2(pc+1), ConstantMethodRefTag, ConstantInterfaceMethodRefTag)
+	}
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(name, "<") && !(op == OpInvokespecial && name == "<init>") {
+		return v.errorf(pc, "Illegal call to internal method %s", name)
+	}
+
+	args, returnType, err := verifierMethodDescriptor(methodDescriptor)
+	if err != nil {
+		return v.errorf(pc, "%s", err)
+	}
+	if op == OpInvokeinterface {
+		argsSize := 1
+		for _, arg := range args {
+			argsSize += arg.Size()
+		}
+		if v.u1(pc+3) != argsSize {
+			return v.errorf(pc, "Inconsistent args count operand in invokeinterface")
+		}
+		if v.u1(pc+4) != 0 {
+			return v.errorf(pc, "Fourth operand byte of invokeinterface must be zero")
+		}
+	}
+	for i := len(args) - 1; i >= 0; i-- {
+		if _, err := v.pop(pc, frame, args[i]); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case op == OpInvokespecial && name == "<init>":
+		if returnType != nil {
+			return v.errorf(pc, "Constructor %s must return void", methodDescriptor)
+		}
+		receiver, err := v.popReference(pc, frame)
+		if err != nil {
+			return err
+		}
+		switch receiver.Kind {
+		case VerifierUninitializedThis:
+			if className != v.className && className != v.superClassName() {
+				return v.errorf(pc, "Bad <init> method call, %s is not the current class or its super class", className)
+			}
+			frame.replaceAll(receiver, vReference(v.className))
+			frame.FlagThisUninit = false
+		case VerifierUninitialized:
+			if !v.isInstructionStart(receiver.Offset) || Opcode(v.code.Code[receiver.Offset]) != OpNew {
+				return v.errorf(pc, "Expecting new instruction at %d", receiver.Offset)
+			}
+			newClass := GetClassName(v.class.ConstantPool, v.u2(receiver.Offset+1))
+			if newClass != className {
+				return v.errorf(pc, "Call to wrong <init> method, expected %s found %s", newClass, className)
+			}
+			frame.replaceAll(receiver, vReference(newClass))
+		default:
+			return v.errorf(pc, "Bad type on operand stack: Type %s is not an uninitialized object", receiver)
+		}
+	case op == OpInvokespecial:
+		if _, err := v.pop(pc, frame, vReference(v.className)); err != nil {
+			return err
+		}
+	case op == OpInvokevirtual || op == OpInvokeinterface:
+		if _, err := v.pop(pc, frame, vReference(className)); err != nil {
+			return err
+		}
+	}
+
+	if returnType != nil {
+		return v.push(pc, frame, *returnType)
+	}
+	return nil
+}
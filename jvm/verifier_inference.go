@@ -0,0 +1,378 @@
+package jvm
+
+import (
+	"slices"
+	"strings"
+)
+
+// Verification by type inference (JVMS §4.10.2), used by class files older
+// than version 50 which carry no StackMapTable. The frames are computed by
+// a data-flow analysis merging the state of every path reaching an
+// instruction.
+
+type subroutine struct {
+	entry int
+	// Offsets of the jsr instructions calling the subroutine
+	callers []int
+	// Offsets of the ret instructions returning from the subroutine
+	rets []int
+	// Local variables read or written while the subroutine runs
+	usedLocals map[int]bool
+}
+
+// controlFlow returns the offsets an instruction can transfer control to
+// without looking at the frame, jsr targets are not included
+func (v *methodVerifier) controlFlow(pc int) ([]int, bool, error) {
+	op := Opcode(v.code.Code[pc])
+	switch {
+	case op >= OpIfeq && op <= OpIfAcmpne, op == OpIfnull, op == OpIfnonnull:
+		target := pc + v.s2(pc+1)
+		return []int{target}, false, v.checkTarget(pc, target)
+	case op == OpGoto:
+		target := pc + v.s2(pc+1)
+		return []int{target}, true, v.checkTarget(pc, target)
+	case op == OpGotoW:
+		target := pc + v.s4(pc+1)
+		return []int{target}, true, v.checkTarget(pc, target)
+	case op == OpTableswitch, op == OpLookupswitch:
+		targets, err := v.switchTargets(pc)
+		return targets, true, err
+	case op >= OpIreturn && op <= OpReturn, op == OpAthrow, op == OpRet:
+		return nil, true, nil
+	case op == OpWide && Opcode(v.code.Code[pc+1]) == OpRet:
+		return nil, true, nil
+	}
+	return nil, false, nil
+}
+
+// localAccess returns the local variables touched by the instruction at pc
+func (v *methodVerifier) localAccess(pc int) []int {
+	op := Opcode(v.code.Code[pc])
+	index := -1
+	if op == OpWide {
+		op = Opcode(v.code.Code[pc+1])
+		index = int(v.u2(pc + 2))
+	}
+	if op == OpIinc || op == OpRet {
+		if index == -1 {
+			index = v.u1(pc + 1)
+		}
+		return []int{index}
+	}
+	local, ok := localInstructions[op]
+	if !ok {
+		return nil
+	}
+	if index == -1 {
+		index = local.index
+		if index == -1 {
+			index = v.u1(pc + 1)
+		}
+	}
+	if local.t.Size() == 2 {
+		return []int{index, index + 1}
+	}
+	return []int{index}
+}
+
+func (v *methodVerifier) jsrTarget(pc int) int {
+	if Opcode(v.code.Code[pc]) == OpJsrW {
+		return pc + v.s4(pc+1)
+	}
+	return pc + v.s2(pc+1)
+}
+
+// findSubroutines walks every subroutine from its entry to its ret
+// instructions, collecting the local variables it uses
+func (v *methodVerifier) findSubroutines() (map[int]*subroutine, error) {
+	subroutines := map[int]*subroutine{}
+	code := v.code.Code
+	for pc := 0; pc < len(code); pc++ {
+		if !v.isInstructionStart(pc) {
+			continue
+		}
+		if op := Opcode(code[pc]); op == OpJsr || op == OpJsrW {
+			target := v.jsrTarget(pc)
+			if err := v.checkTarget(pc, target); err != nil {
+				return nil, err
+			}
+			if subroutines[target] == nil {
+				subroutines[target] = &subroutine{entry: target, usedLocals: map[int]bool{}}
+			}
+		}
+	}
+
+	nested := map[int][]int{}
+	for entry, sub := range subroutines {
+		visited := map[int]bool{}
+		pending := []int{entry}
+		for len(pending) != 0 {
+			pc := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if visited[pc] {
+				continue
+			}
+			visited[pc] = true
+
+			for _, index := range v.localAccess(pc) {
+				sub.usedLocals[index] = true
+			}
+			op := Opcode(code[pc])
+			if op == OpRet || (op == OpWide && Opcode(code[pc+1]) == OpRet) {
+				sub.rets = append(sub.rets, pc)
+			}
+
+			targets, unconditional, err := v.controlFlow(pc)
+			if err != nil {
+				return nil, err
+			}
+			if op == OpJsr || op == OpJsrW {
+				nested[entry] = append(nested[entry], v.jsrTarget(pc))
+			}
+			length, _ := InstructionLength(code, pc)
+			if !unconditional && pc+length < len(code) {
+				pending = append(pending, pc+length)
+			}
+			pending = append(pending, targets...)
+			for _, handler := range v.code.ExceptionsTable {
+				if pc >= int(handler.StartPc) && pc < int(handler.EndPc) {
+					pending = append(pending, int(handler.HandlerPc))
+				}
+			}
+		}
+	}
+
+	// Locals used by a nested subroutine are used by its caller too
+	for changed := true; changed; {
+		changed = false
+		for entry, calls := range nested {
+			for _, call := range calls {
+				for index := range subroutines[call].usedLocals {
+					if !subroutines[entry].usedLocals[index] {
+						subroutines[entry].usedLocals[index] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return subroutines, nil
+}
+
+// leastCommonSuperClass merges two reference types, classes which can't be
+// found merge to java/lang/Object
+func leastCommonSuperClass(hierarchy ClassHierarchy, a, b string) string {
+	if a == b {
+		return a
+	}
+	aArray := strings.HasPrefix(a, "[")
+	bArray := strings.HasPrefix(b, "[")
+	if aArray || bArray {
+		if !aArray || !bArray {
+			return "java/lang/Object"
+		}
+		aComponent := vReference(a).ComponentType()
+		bComponent := vReference(b).ComponentType()
+		if aComponent.Kind != VerifierReference || bComponent.Kind != VerifierReference {
+			return "java/lang/Object"
+		}
+		return vReference(leastCommonSuperClass(hierarchy, aComponent.Name, bComponent.Name)).ArrayOf().Name
+	}
+	if hierarchy == nil {
+		return "java/lang/Object"
+	}
+
+	ancestors := map[string]bool{}
+	for class := a; class != ""; {
+		ancestors[class] = true
+		super, isInterface, ok := hierarchy.LookupClass(class)
+		if !ok || isInterface {
+			return "java/lang/Object"
+		}
+		class = super
+	}
+	for class := b; class != ""; {
+		if ancestors[class] {
+			return class
+		}
+		super, isInterface, ok := hierarchy.LookupClass(class)
+		if !ok || isInterface {
+			return "java/lang/Object"
+		}
+		class = super
+	}
+	return "java/lang/Object"
+}
+
+func mergeVerifierTypes(hierarchy ClassHierarchy, a, b VerifierType) VerifierType {
+	switch {
+	case a == b:
+		return a
+	case a.Kind == VerifierNull && b.Kind == VerifierReference:
+		return b
+	case a.Kind == VerifierReference && b.Kind == VerifierNull:
+		return a
+	case a.Kind == VerifierReference && b.Kind == VerifierReference:
+		return vReference(leastCommonSuperClass(hierarchy, a.Name, b.Name))
+	}
+	return vTop
+}
+
+// mergeInto merges frame into the one already recorded at pc, reporting
+// whether the recorded one changed
+func (v *methodVerifier) mergeInto(frames map[int]*VerifierFrame, pc int, frame *VerifierFrame) (bool, error) {
+	current, ok := frames[pc]
+	if !ok {
+		frames[pc] = frame.Copy()
+		return true, nil
+	}
+	if len(current.Stack) != len(frame.Stack) {
+		return false, v.errorf(pc, "Inconsistent stack height %d != %d", current.StackSize(), frame.StackSize())
+	}
+
+	changed := false
+	for i := range current.Locals {
+		merged := mergeVerifierTypes(v.hierarchy, current.Locals[i], frame.Locals[i])
+		if merged != current.Locals[i] {
+			current.Locals[i] = merged
+			changed = true
+		}
+	}
+	for i := range current.Stack {
+		merged := mergeVerifierTypes(v.hierarchy, current.Stack[i], frame.Stack[i])
+		if merged.Kind == VerifierTop {
+			return false, v.errorf(pc, "Mismatched stack types %s and %s at stack[%d]", current.Stack[i], frame.Stack[i], i)
+		}
+		if merged != current.Stack[i] {
+			current.Stack[i] = merged
+			changed = true
+		}
+	}
+	if frame.FlagThisUninit && !current.FlagThisUninit {
+		current.FlagThisUninit = true
+		changed = true
+	}
+	return changed, nil
+}
+
+func (v *methodVerifier) inferTypes() error {
+	initial, err := v.initialFrame()
+	if err != nil {
+		return err
+	}
+	subroutines, err := v.findSubroutines()
+	if err != nil {
+		return err
+	}
+
+	code := v.code.Code
+	frames := map[int]*VerifierFrame{0: initial}
+	changed := map[int]bool{0: true}
+	merge := func(pc int, frame *VerifierFrame) error {
+		if pc >= len(code) {
+			return v.errorf(-1, "Falling off the end of the code")
+		}
+		isChanged, err := v.mergeInto(frames, pc, frame)
+		if isChanged {
+			changed[pc] = true
+		}
+		return err
+	}
+
+	for len(changed) != 0 {
+		pc := -1
+		for candidate := range changed {
+			if pc == -1 || candidate < pc {
+				pc = candidate
+			}
+		}
+		delete(changed, pc)
+		current := frames[pc]
+
+		for _, handler := range v.code.ExceptionsTable {
+			if pc < int(handler.StartPc) || pc >= int(handler.EndPc) {
+				continue
+			}
+			exception := vThrowable
+			if handler.CatchType != 0 {
+				className, err := v.classConstant(pc, handler.CatchType)
+				if err != nil {
+					return err
+				}
+				exception = vReference(className)
+			}
+			if v.code.MaxStack < 1 {
+				return v.errorf(pc, "Operand stack overflow")
+			}
+			exceptionFrame := &VerifierFrame{
+				Locals:         current.Locals,
+				Stack:          []VerifierType{exception},
+				FlagThisUninit: current.FlagThisUninit,
+			}
+			if err := merge(int(handler.HandlerPc), exceptionFrame); err != nil {
+				return err
+			}
+		}
+
+		length, _ := InstructionLength(code, pc)
+		next := current.Copy()
+		op := Opcode(code[pc])
+		isRet := op == OpRet || (op == OpWide && Opcode(code[pc+1]) == OpRet)
+
+		switch {
+		case op == OpJsr || op == OpJsrW:
+			target := v.jsrTarget(pc)
+			if err := v.push(pc, next, VerifierType{Kind: VerifierReturnAddress, Offset: target}); err != nil {
+				return err
+			}
+			if err := merge(target, next); err != nil {
+				return err
+			}
+			sub := subroutines[target]
+			if !slices.Contains(sub.callers, pc) {
+				sub.callers = append(sub.callers, pc)
+			}
+			// The caller frame feeds what follows the jsr once ret runs
+			for _, ret := range sub.rets {
+				if frames[ret] != nil {
+					changed[ret] = true
+				}
+			}
+		case isRet:
+			index := v.localAccess(pc)[0]
+			if index >= len(current.Locals) || current.Locals[index].Kind != VerifierReturnAddress {
+				return v.errorf(pc, "Bad local variable type for ret at locals[%d]", index)
+			}
+			sub := subroutines[current.Locals[index].Offset]
+			for _, caller := range sub.callers {
+				callerFrame := frames[caller]
+				returned := current.Copy()
+				for i := range returned.Locals {
+					if !sub.usedLocals[i] {
+						returned.Locals[i] = callerFrame.Locals[i]
+					}
+				}
+				callerLength, _ := InstructionLength(code, caller)
+				if err := merge(caller+callerLength, returned); err != nil {
+					return err
+				}
+			}
+		default:
+			inst, err := v.step(pc, next)
+			if err != nil {
+				return err
+			}
+			for _, target := range inst.Targets {
+				if err := merge(target, next); err != nil {
+					return err
+				}
+			}
+			if !inst.Unconditional {
+				if err := merge(pc+length, next); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package jvm
+
+import "testing"
+
+// testPool is the constant pool of the classes the verifier tests assemble
+type testPool []*ConstantInfo
+
+func (p *testPool) add(tag ConstantPoolTag, data interface{}) uint16 {
+	*p = append(*p, &ConstantInfo{Tag: tag, Data: data})
+	return uint16(len(*p))
+}
+
+func (p *testPool) class(name string) uint16 {
+	return p.add(ConstantClassTag, ConstantClass{NameIndex: p.add(ConstantUtf8Tag, name)})
+}
+
+func (p *testPool) methodRef(class, name, methodDescriptor string) uint16 {
+	nameAndType := p.add(ConstantNameAndTypeTag, ConstantNameAndType{NameIndex: p.add(ConstantUtf8Tag, name), DescriptorIndex: p.add(ConstantUtf8Tag, methodDescriptor)})
+	return p.add(ConstantMethodRefTag, &ConstantMethodRef{ClassIndex: p.class(class), NameAndTypeIndex: nameAndType})
+}
+
+// The entries every test class has
+var (
+	testPoolEntries testPool
+	testThisClass   = testPoolEntries.class("Test")
+	testSuperClass  = testPoolEntries.class("java/lang/Object")
+	testThrowable   = testPoolEntries.class("java/lang/Throwable")
+	testObjectInit  = testPoolEntries.methodRef("java/lang/Object", "<init>", "()V")
+)
+
+type verifierTest struct {
+	name       string
+	major      uint16
+	flags      AccessFlag
+	method     string
+	descriptor string
+	maxStack   uint16
+	maxLocals  uint16
+	code       []byte
+	handlers   []ExceptionTableEntry
+	frames     StackMapTableAttribute
+	// The message of the VerifyError, empty if the method is valid
+	want string
+}
+
+// verify assembles the method of a test in the class Test and verifies it
+func (test verifierTest) verify() error {
+	code := CodeAttribute{
+		MaxStack:        test.maxStack,
+		MaxLocals:       test.maxLocals,
+		CodeLength:      uint32(len(test.code)),
+		Code:            test.code,
+		ExceptionsTable: test.handlers,
+	}
+	if test.frames != nil {
+		code.Attributes = []*AttributeInfo{{AttributeType: StackMapTableAttr, Data: test.frames}}
+	}
+	method := &MethodInfo{
+		AccessFlags: uint16(test.flags),
+		Name:        test.method,
+		Descriptor:  test.descriptor,
+		Attributes:  []*AttributeInfo{{AttributeType: CodeAttr, Data: code}},
+	}
+	class := &JavaClass{
+		MajorVersion: test.major,
+		ConstantPool: testPoolEntries,
+		Methods:      []*MethodInfo{method},
+		AccessFlags:  AccPublic,
+		ThisClass:    testThisClass,
+		SuperClass:   testSuperClass,
+	}
+	return VerifyMethod(class, method, nil)
+}
+
+func runVerifierTests(t *testing.T, tests []verifierTest) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.verify()
+			switch {
+			case test.want == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.want != "" && err == nil:
+				t.Fatalf("verified, want %q", test.want)
+			case test.want != "" && err.Error() != test.want:
+				t.Fatalf("got %q\nwant %q", err.Error(), test.want)
+			}
+		})
+	}
+}
+
+func TestTypeChecking(t *testing.T) {
+	throwableItem := VerificationTypeInfo{Tag: ItemObject, CpoolIndex: testThrowable}
+	objectItem := VerificationTypeInfo{Tag: ItemObject, CpoolIndex: testSuperClass}
+	intItem := VerificationTypeInfo{Tag: ItemInteger}
+
+	runVerifierTests(t, []verifierTest{
+		{
+			name: "valid", major: 52, flags: AccStatic, method: "m", descriptor: "()I", maxStack: 1,
+			code: []byte{byte(OpIconst0), byte(OpIreturn)},
+		},
+		{
+			name: "valid constructor", major: 52, method: "<init>", descriptor: "()V", maxStack: 1, maxLocals: 1,
+			code: []byte{byte(OpAload0), byte(OpInvokespecial), byte(testObjectInit >> 8), byte(testObjectInit), byte(OpReturn)},
+		},
+		{
+			name: "stack overflow", major: 52, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1,
+			code: []byte{byte(OpIconst0), byte(OpIconst0), byte(OpPop), byte(OpPop), byte(OpReturn)},
+			want: "java.lang.VerifyError: Test.m()V @1: Operand stack overflow",
+		},
+		{
+			name: "stack underflow", major: 52, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1,
+			code: []byte{byte(OpPop), byte(OpReturn)},
+			want: "java.lang.VerifyError: Test.m()V @0: Operand stack underflow",
+		},
+		{
+			name: "bad operand type", major: 52, flags: AccStatic, method: "m", descriptor: "()I", maxStack: 1,
+			code: []byte{byte(OpAconstNull), byte(OpIreturn)},
+			want: "java.lang.VerifyError: Test.m()I @1: Bad type on operand stack: Type null (current frame, stack[0]) is not assignable to integer",
+		},
+		{
+			name: "falling off the end", major: 52, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1,
+			code: []byte{byte(OpIconst0), byte(OpPop)},
+			want: "java.lang.VerifyError: Test.m()V: Falling off the end of the code",
+		},
+		{
+			name: "missing frame at branch target", major: 52, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1,
+			code: []byte{byte(OpIconst0), byte(OpIfeq), 0, 4, byte(OpNop), byte(OpReturn)},
+			want: "java.lang.VerifyError: Test.m()V @1: Expecting a stackmap frame at branch target 5",
+		},
+		{
+			// local 0 is only set on the path falling through the ifeq
+			name: "branch target frame mismatch", major: 52, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1, maxLocals: 1,
+			code: []byte{
+				byte(OpIconst0), byte(OpIfeq), 0, 6, byte(OpIconst1), byte(OpIstore0), byte(OpNop),
+				byte(OpIload0), byte(OpPop), byte(OpReturn),
+			},
+			frames: StackMapTableAttribute{{FrameType: 255, OffsetDelta: 7, Locals: []VerificationTypeInfo{intItem}}},
+			want:   "java.lang.VerifyError: Test.m()V @1: Inconsistent stackmap frames at branch target 7: Type top (current frame, locals[0]) is not assignable to integer (stack map, locals[0])",
+		},
+		{
+			name: "swap", major: 52, flags: AccStatic, method: "m", descriptor: "()I", maxStack: 2,
+			code: []byte{byte(OpIconst0), byte(OpFconst0), byte(OpSwap), byte(OpIreturn)},
+		},
+		{
+			name: "uninitializedThis returned from <init>", major: 52, method: "<init>", descriptor: "()V", maxLocals: 1,
+			code: []byte{byte(OpReturn)},
+			want: "java.lang.VerifyError: Test.<init>()V @0: Constructor must call super() or this() before return",
+		},
+		{
+			name: "uninitializedThis thrown from <init>", major: 52, method: "<init>", descriptor: "()V", maxStack: 1, maxLocals: 1,
+			code: []byte{byte(OpAload0), byte(OpAthrow)},
+			want: "java.lang.VerifyError: Test.<init>()V @1: Bad type on operand stack: Type uninitializedThis (current frame, stack[0]) is not assignable to 'java/lang/Throwable'",
+		},
+		{
+			name: "valid handler", major: 52, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1, maxLocals: 1,
+			code:     []byte{byte(OpIconst0), byte(OpIstore0), byte(OpReturn), byte(OpAthrow)},
+			handlers: []ExceptionTableEntry{{StartPc: 0, EndPc: 2, HandlerPc: 3, CatchType: testThrowable}},
+			frames:   StackMapTableAttribute{{FrameType: 64 + 3, OffsetDelta: 3, Stack: []VerificationTypeInfo{throwableItem}}},
+		},
+		{
+			name: "bad handler frame", major: 52, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1, maxLocals: 1,
+			code:     []byte{byte(OpIconst0), byte(OpIstore0), byte(OpReturn), byte(OpAthrow)},
+			handlers: []ExceptionTableEntry{{StartPc: 0, EndPc: 2, HandlerPc: 3, CatchType: testThrowable}},
+			frames:   StackMapTableAttribute{{FrameType: 255, OffsetDelta: 3, Locals: []VerificationTypeInfo{intItem}, Stack: []VerificationTypeInfo{throwableItem}}},
+			want:     "java.lang.VerifyError: Test.m()V @0: Stack map does not match the one at exception handler 3: Type top (current frame, locals[0]) is not assignable to integer (stack map, locals[0])",
+		},
+		{
+			name: "missing handler frame", major: 52, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1,
+			code:     []byte{byte(OpNop), byte(OpReturn), byte(OpAthrow)},
+			handlers: []ExceptionTableEntry{{StartPc: 0, EndPc: 1, HandlerPc: 2}},
+			want:     "java.lang.VerifyError: Test.m()V @2: Expecting a stackmap frame at branch target 2",
+		},
+		{
+			// The handler accepts the frame before istore_0 but not the
+			// one after it
+			name: "handler frame after a store", major: 52, flags: AccStatic, method: "m", descriptor: "(Ljava/lang/Object;)V", maxStack: 1, maxLocals: 1,
+			code:     []byte{byte(OpIconst0), byte(OpIstore0), byte(OpReturn), byte(OpAthrow)},
+			handlers: []ExceptionTableEntry{{StartPc: 0, EndPc: 2, HandlerPc: 3, CatchType: testThrowable}},
+			frames:   StackMapTableAttribute{{FrameType: 255, OffsetDelta: 3, Locals: []VerificationTypeInfo{objectItem}, Stack: []VerificationTypeInfo{throwableItem}}},
+			want:     "java.lang.VerifyError: Test.m(Ljava/lang/Object;)V @1: Stack map does not match the one at exception handler 3: Type integer (current frame, locals[0]) is not assignable to 'java/lang/Object' (stack map, locals[0])",
+		},
+	})
+}
+
+func TestTypeInference(t *testing.T) {
+	runVerifierTests(t, []verifierTest{
+		{
+			// Each caller gets back its own type of local 1, which the
+			// subroutine doesn't touch
+			name: "jsr and ret merge", major: 49, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1, maxLocals: 2,
+			code: []byte{
+				byte(OpIconst1), byte(OpIstore1), byte(OpJsr), 0, 13, byte(OpIload1), byte(OpPop),
+				byte(OpFconst1), byte(OpFstore1), byte(OpJsr), 0, 6, byte(OpFload1), byte(OpPop), byte(OpReturn),
+				byte(OpAstore0), byte(OpRet), 0,
+			},
+		},
+		{
+			// Local 2 set by the inner subroutine reaches the code after
+			// the outer jsr
+			name: "nested subroutines", major: 49, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1, maxLocals: 3,
+			code: []byte{
+				byte(OpJsr), 0, 6, byte(OpIload2), byte(OpPop), byte(OpReturn),
+				byte(OpAstore0), byte(OpJsr), 0, 5, byte(OpRet), 0,
+				byte(OpAstore1), byte(OpIconst5), byte(OpIstore2), byte(OpRet), 1,
+			},
+		},
+		{
+			name: "ret without a return address", major: 49, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1, maxLocals: 1,
+			code: []byte{byte(OpIconst0), byte(OpIstore0), byte(OpRet), 0},
+			want: "java.lang.VerifyError: Test.m()V @2: Bad local variable type for ret at locals[0]",
+		},
+		{
+			name: "merge of different types", major: 49, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1, maxLocals: 1,
+			code: []byte{
+				byte(OpIconst0), byte(OpIfeq), 0, 6, byte(OpIconst1), byte(OpIstore0), byte(OpNop),
+				byte(OpIload0), byte(OpPop), byte(OpReturn),
+			},
+			want: "java.lang.VerifyError: Test.m()V @7: Bad local variable type: Type top (current frame, locals[0]) is not assignable to integer",
+		},
+		{
+			// Without a frame at the branch target type checking fails, so
+			// version 50 falls back to inference
+			name: "version 50 fallback", major: 50, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1,
+			code: []byte{byte(OpIconst0), byte(OpIfeq), 0, 4, byte(OpNop), byte(OpReturn)},
+		},
+		{
+			name: "version 50 fallback with jsr", major: 50, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1, maxLocals: 1,
+			code: []byte{byte(OpJsr), 0, 4, byte(OpReturn), byte(OpAstore0), byte(OpRet), 0},
+		},
+		{
+			name: "version 51 has no fallback", major: 51, flags: AccStatic, method: "m", descriptor: "()V", maxStack: 1,
+			code: []byte{byte(OpIconst0), byte(OpIfeq), 0, 4, byte(OpNop), byte(OpReturn)},
+			want: "java.lang.VerifyError: Test.m()V @1: Expecting a stackmap frame at branch target 5",
+		},
+	})
+}
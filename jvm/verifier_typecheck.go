@@ -0,0 +1,240 @@
+package jvm
+
+import "slices"
+
+// Verification by type checking (JVMS §4.10.1), every branch target and
+// exception handler of the method must have a frame in its StackMapTable
+
+func (v *methodVerifier) verificationType(pc int, info VerificationTypeInfo) (VerifierType, error) {
+	switch info.Tag {
+	case ItemTop:
+		return vTop, nil
+	case ItemInteger:
+		return vInt, nil
+	case ItemFloat:
+		return vFloat, nil
+	case ItemLong:
+		return vLong, nil
+	case ItemDouble:
+		return vDouble, nil
+	case ItemNull:
+		return vNull, nil
+	case ItemUninitializedThis:
+		return vUninitializedThis, nil
+	case ItemObject:
+		tag, err := v.constantTag(pc, info.CpoolIndex)
+		if err != nil {
+			return vTop, err
+		}
+		if tag != ConstantClassTag {
+			return vTop, v.errorf(pc, "Bad class index %d in stack map frame", info.CpoolIndex)
+		}
+		return vReference(GetClassName(v.class.ConstantPool, info.CpoolIndex)), nil
+	default:
+		offset := int(info.Offset)
+		if !v.isInstructionStart(offset) || Opcode(v.code.Code[offset]) != OpNew {
+			return vTop, v.errorf(pc, "Expecting new instruction at %d in stack map frame", offset)
+		}
+		return vUninitialized(offset), nil
+	}
+}
+
+func (v *methodVerifier) verificationTypes(pc int, infos []VerificationTypeInfo) ([]VerifierType, error) {
+	types := make([]VerifierType, len(infos))
+	for i, info := range infos {
+		t, err := v.verificationType(pc, info)
+		if err != nil {
+			return nil, err
+		}
+		types[i] = t
+	}
+	return types, nil
+}
+
+// expandFrame turns the compressed locals of a stack map frame, where longs
+// and doubles take a single entry, into a full frame
+func (v *methodVerifier) expandFrame(pc int, locals, stack []VerifierType) (*VerifierFrame, error) {
+	frame := &VerifierFrame{
+		Locals: make([]VerifierType, 0, v.code.MaxLocals),
+		Stack:  append(make([]VerifierType, 0, v.code.MaxStack), stack...),
+	}
+	for _, t := range locals {
+		frame.Locals = append(frame.Locals, t)
+		if t.Size() == 2 {
+			frame.Locals = append(frame.Locals, vTop)
+		}
+		if t == vUninitializedThis {
+			frame.FlagThisUninit = true
+		}
+	}
+	if len(frame.Locals) > int(v.code.MaxLocals) {
+		return nil, v.errorf(pc, "StackMapTable error: locals size %d exceeds max locals %d", len(frame.Locals), v.code.MaxLocals)
+	}
+	for len(frame.Locals) < int(v.code.MaxLocals) {
+		frame.Locals = append(frame.Locals, vTop)
+	}
+	if frame.StackSize() > int(v.code.MaxStack) {
+		return nil, v.errorf(pc, "StackMapTable error: stack size %d exceeds max stack %d", frame.StackSize(), v.code.MaxStack)
+	}
+	return frame, nil
+}
+
+// stackMapFrames decodes the StackMapTable of the method into full frames
+// keyed by the offset they apply to
+func (v *methodVerifier) stackMapFrames() (map[int]*VerifierFrame, error) {
+	frames := map[int]*VerifierFrame{}
+
+	// The implicit initial frame, in compressed form
+	locals := make([]VerifierType, 0, len(v.args)+1)
+	if !v.isStatic() {
+		if v.method.Name == "<init>" && v.className != "java/lang/Object" {
+			locals = append(locals, vUninitializedThis)
+		} else {
+			locals = append(locals, vReference(v.className))
+		}
+	}
+	locals = append(locals, v.args...)
+
+	offset := -1
+	for _, mapFrame := range v.code.StackMapTable() {
+		offset += int(mapFrame.OffsetDelta) + 1
+		if !v.isInstructionStart(offset) {
+			return nil, v.errorf(offset, "StackMapTable error: bad offset")
+		}
+
+		var stack []VerifierType
+		var err error
+		switch {
+		case mapFrame.FrameType <= 127 || mapFrame.FrameType == 247:
+			stack, err = v.verificationTypes(offset, mapFrame.Stack)
+		case mapFrame.FrameType <= 250:
+			if mapFrame.Chopped > len(locals) {
+				return nil, v.errorf(offset, "StackMapTable error: chop frame removes more locals than present")
+			}
+			locals = locals[:len(locals)-mapFrame.Chopped]
+		case mapFrame.FrameType == 251:
+		case mapFrame.FrameType <= 254:
+			appended, err := v.verificationTypes(offset, mapFrame.Locals)
+			if err != nil {
+				return nil, err
+			}
+			locals = append(locals[:len(locals):len(locals)], appended...)
+		default:
+			if locals, err = v.verificationTypes(offset, mapFrame.Locals); err != nil {
+				return nil, err
+			}
+			stack, err = v.verificationTypes(offset, mapFrame.Stack)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		frame, err := v.expandFrame(offset, locals, stack)
+		if err != nil {
+			return nil, err
+		}
+		frames[offset] = frame
+	}
+	return frames, nil
+}
+
+// checkHandlers makes sure the frame seen by each exception handler
+// protecting pc is compatible with the one it declares. It runs with the
+// frame before the instruction and, when the instruction changes the
+// locals, with the frame after it
+func (v *methodVerifier) checkHandlers(pc int, frame *VerifierFrame, frames map[int]*VerifierFrame) error {
+	for _, handler := range v.code.ExceptionsTable {
+		if pc < int(handler.StartPc) || pc >= int(handler.EndPc) {
+			continue
+		}
+		exception := vThrowable
+		if handler.CatchType != 0 {
+			className, err := v.classConstant(pc, handler.CatchType)
+			if err != nil {
+				return err
+			}
+			if !isJavaAssignable(v.hierarchy, className, vThrowable.Name) {
+				return v.errorf(pc, "Catch type %s is not a subclass of Throwable", className)
+			}
+			exception = vReference(className)
+		}
+		if v.code.MaxStack < 1 {
+			return v.errorf(pc, "Operand stack overflow")
+		}
+		exceptionFrame := &VerifierFrame{
+			Locals:         frame.Locals,
+			Stack:          []VerifierType{exception},
+			FlagThisUninit: frame.FlagThisUninit,
+		}
+		if reason := exceptionFrame.isAssignableTo(v.hierarchy, frames[int(handler.HandlerPc)]); reason != "" {
+			return v.errorf(pc, "Stack map does not match the one at exception handler %d: %s", handler.HandlerPc, reason)
+		}
+	}
+	return nil
+}
+
+func (v *methodVerifier) typeCheck() error {
+	current, err := v.initialFrame()
+	if err != nil {
+		return err
+	}
+	frames, err := v.stackMapFrames()
+	if err != nil {
+		return err
+	}
+	for _, handler := range v.code.ExceptionsTable {
+		if frames[int(handler.HandlerPc)] == nil {
+			return v.errorf(int(handler.HandlerPc), "Expecting a stackmap frame at branch target %d", handler.HandlerPc)
+		}
+	}
+
+	code := v.code.Code
+	for pc := 0; pc < len(code); {
+		if mapFrame, ok := frames[pc]; ok {
+			if current != nil {
+				if reason := current.isAssignableTo(v.hierarchy, mapFrame); reason != "" {
+					return v.errorf(pc, "Instruction type does not match stack map: %s", reason)
+				}
+			}
+			current = mapFrame.Copy()
+		} else if current == nil {
+			return v.errorf(pc, "Expecting a stack map frame")
+		}
+
+		if err := v.checkHandlers(pc, current, frames); err != nil {
+			return err
+		}
+
+		next := current.Copy()
+		inst, err := v.step(pc, next)
+		if err != nil {
+			return err
+		}
+		// A store is seen by the handlers with the local it changed too
+		if !slices.Equal(current.Locals, next.Locals) || current.FlagThisUninit != next.FlagThisUninit {
+			if err := v.checkHandlers(pc, next, frames); err != nil {
+				return err
+			}
+		}
+		for _, target := range inst.Targets {
+			mapFrame, ok := frames[target]
+			if !ok {
+				return v.errorf(pc, "Expecting a stackmap frame at branch target %d", target)
+			}
+			if reason := next.isAssignableTo(v.hierarchy, mapFrame); reason != "" {
+				return v.errorf(pc, "Inconsistent stackmap frames at branch target %d: %s", target, reason)
+			}
+		}
+
+		if inst.Unconditional {
+			current = nil
+		} else {
+			current = next
+		}
+		pc += inst.Length
+	}
+	if current != nil {
+		return v.errorf(-1, "Falling off the end of the code")
+	}
+	return nil
+}
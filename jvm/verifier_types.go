@@ -0,0 +1,277 @@
+package jvm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+type VerifierTypeKind uint8
+
+const (
+	VerifierTop VerifierTypeKind = iota
+	VerifierInt
+	VerifierFloat
+	VerifierLong
+	VerifierDouble
+	VerifierNull
+	VerifierUninitializedThis
+	VerifierUninitialized
+	VerifierReference
+	// Return address pushed by jsr, only seen by the type inference verifier
+	VerifierReturnAddress
+)
+
+type VerifierType struct {
+	Kind VerifierTypeKind
+	// Internal class name or array descriptor of a reference
+	Name string
+	// Offset of the new instruction of an uninitialized type, or the
+	// subroutine entry of a return address
+	Offset int
+}
+
+var (
+	vTop               = VerifierType{Kind: VerifierTop}
+	vInt               = VerifierType{Kind: VerifierInt}
+	vFloat             = VerifierType{Kind: VerifierFloat}
+	vLong              = VerifierType{Kind: VerifierLong}
+	vDouble            = VerifierType{Kind: VerifierDouble}
+	vNull              = VerifierType{Kind: VerifierNull}
+	vUninitializedThis = VerifierType{Kind: VerifierUninitializedThis}
+	vObject            = VerifierType{Kind: VerifierReference, Name: "java/lang/Object"}
+	vString            = VerifierType{Kind: VerifierReference, Name: "java/lang/String"}
+	vClass             = VerifierType{Kind: VerifierReference, Name: "java/lang/Class"}
+	vThrowable         = VerifierType{Kind: VerifierReference, Name: "java/lang/Throwable"}
+)
+
+func vReference(name string) VerifierType {
+	return VerifierType{Kind: VerifierReference, Name: name}
+}
+
+func vUninitialized(offset int) VerifierType {
+	return VerifierType{Kind: VerifierUninitialized, Offset: offset}
+}
+
+// Size is the number of local variable or operand stack slots taken
+func (t VerifierType) Size() int {
+	if t.Kind == VerifierLong || t.Kind == VerifierDouble {
+		return 2
+	}
+	return 1
+}
+
+func (t VerifierType) IsReference() bool {
+	switch t.Kind {
+	case VerifierNull, VerifierUninitializedThis, VerifierUninitialized, VerifierReference:
+		return true
+	}
+	return false
+}
+
+func (t VerifierType) IsArray() bool {
+	return t.Kind == VerifierReference && strings.HasPrefix(t.Name, "[")
+}
+
+// ComponentType returns the element type of an array reference
+func (t VerifierType) ComponentType() VerifierType {
+	component := t.Name[1:]
+	switch component[0] {
+	case 'L':
+		return vReference(component[1 : len(component)-1])
+	case '[':
+		return vReference(component)
+	case 'F':
+		return vFloat
+	case 'J':
+		return vLong
+	case 'D':
+		return vDouble
+	default:
+		return vInt
+	}
+}
+
+// ArrayOf returns the array type with t as its element type
+func (t VerifierType) ArrayOf() VerifierType {
+	if strings.HasPrefix(t.Name, "[") {
+		return vReference("[" + t.Name)
+	}
+	return vReference("[L" + t.Name + ";")
+}
+
+func (t VerifierType) String() string {
+	switch t.Kind {
+	case VerifierTop:
+		return "top"
+	case VerifierInt:
+		return "integer"
+	case VerifierFloat:
+		return "float"
+	case VerifierLong:
+		return "long"
+	case VerifierDouble:
+		return "double"
+	case VerifierNull:
+		return "null"
+	case VerifierUninitializedThis:
+		return "uninitializedThis"
+	case VerifierUninitialized:
+		return fmt.Sprintf("uninitialized(%d)", t.Offset)
+	case VerifierReturnAddress:
+		return fmt.Sprintf("returnAddress(%d)", t.Offset)
+	default:
+		return fmt.Sprintf("'%s'", t.Name)
+	}
+}
+
+// ClassHierarchy gives the verifier access to the classes known by the vm
+type ClassHierarchy interface {
+	// LookupClass returns the super class of name and whether it is an
+	// interface. ok is false if the class can't be found
+	LookupClass(name string) (superClass string, isInterface bool, ok bool)
+}
+
+// IsAssignable reports whether a value of type from can be used where a
+// value of type to is expected (JVMS §4.10.1.2)
+func IsAssignable(hierarchy ClassHierarchy, from, to VerifierType) bool {
+	if from == to || to.Kind == VerifierTop {
+		return true
+	}
+	switch from.Kind {
+	case VerifierNull:
+		return to.Kind == VerifierReference
+	case VerifierReference:
+		return to.Kind == VerifierReference && isJavaAssignable(hierarchy, from.Name, to.Name)
+	}
+	return false
+}
+
+// Classes which can't be found are assumed to be assignable, the vm has no
+// class loader able to bring them in yet
+func isJavaAssignable(hierarchy ClassHierarchy, from, to string) bool {
+	if from == to || to == "java/lang/Object" {
+		return true
+	}
+
+	fromArray := strings.HasPrefix(from, "[")
+	toArray := strings.HasPrefix(to, "[")
+	if fromArray {
+		if !toArray {
+			return to == "java/lang/Cloneable" || to == "java/io/Serializable"
+		}
+		fromComponent := vReference(from).ComponentType()
+		toComponent := vReference(to).ComponentType()
+		if fromComponent.Kind != VerifierReference || toComponent.Kind != VerifierReference {
+			return from == to
+		}
+		return isJavaAssignable(hierarchy, fromComponent.Name, toComponent.Name)
+	}
+	if toArray {
+		return false
+	}
+
+	if hierarchy == nil {
+		return true
+	}
+	// Interfaces are treated like java/lang/Object by the verifier
+	_, isInterface, ok := hierarchy.LookupClass(to)
+	if !ok || isInterface {
+		return true
+	}
+	for class := from; class != ""; {
+		if class == to {
+			return true
+		}
+		super, _, ok := hierarchy.LookupClass(class)
+		if !ok {
+			return true
+		}
+		class = super
+	}
+	return false
+}
+
+// verifierTypeOf maps a descriptor type to its verification type, the
+// types smaller than int are verified as int
+func verifierTypeOf(t descriptor.Type) VerifierType {
+	switch t {
+	case descriptor.Float:
+		return vFloat
+	case descriptor.Long:
+		return vLong
+	case descriptor.Double:
+		return vDouble
+	case descriptor.Byte, descriptor.Char, descriptor.Int, descriptor.Short, descriptor.Boolean:
+		return vInt
+	}
+	if object, ok := t.(*descriptor.ObjectType); ok {
+		return vReference(object.ClassName)
+	}
+	return vReference(t.Descriptor())
+}
+
+// verifierMethodDescriptor decodes the arguments and the return type of a
+// method descriptor, the return type is nil for void methods
+func verifierMethodDescriptor(desc string) ([]VerifierType, *VerifierType, error) {
+	method, err := descriptor.ParseMethod(desc)
+	if err != nil {
+		return nil, nil, err
+	}
+	args := make([]VerifierType, len(method.Params))
+	for i, param := range method.Params {
+		args[i] = verifierTypeOf(param)
+	}
+	if method.Return == descriptor.Void {
+		return args, nil, nil
+	}
+	ret := verifierTypeOf(method.Return)
+	return args, &ret, nil
+}
+
+type VerifierFrame struct {
+	// One entry per local variable, longs and doubles are followed by top
+	Locals []VerifierType
+	// One entry per value, longs and doubles take a single entry
+	Stack          []VerifierType
+	FlagThisUninit bool
+}
+
+func (f *VerifierFrame) Copy() *VerifierFrame {
+	return &VerifierFrame{
+		Locals:         append([]VerifierType(nil), f.Locals...),
+		Stack:          append([]VerifierType(nil), f.Stack...),
+		FlagThisUninit: f.FlagThisUninit,
+	}
+}
+
+// StackSize is the operand stack depth in slots
+func (f *VerifierFrame) StackSize() int {
+	size := 0
+	for _, t := range f.Stack {
+		size += t.Size()
+	}
+	return size
+}
+
+// isAssignableTo implements frameIsAssignable of JVMS §4.10.1.4
+func (f *VerifierFrame) isAssignableTo(hierarchy ClassHierarchy, to *VerifierFrame) string {
+	if len(f.Stack) != len(to.Stack) {
+		return fmt.Sprintf("inconsistent stack height %d != %d", f.StackSize(), to.StackSize())
+	}
+	for i := range f.Locals {
+		if !IsAssignable(hierarchy, f.Locals[i], to.Locals[i]) {
+			return fmt.Sprintf("Type %s (current frame, locals[%d]) is not assignable to %s (stack map, locals[%d])", f.Locals[i], i, to.Locals[i], i)
+		}
+	}
+	for i := range f.Stack {
+		if !IsAssignable(hierarchy, f.Stack[i], to.Stack[i]) {
+			return fmt.Sprintf("Type %s (current frame, stack[%d]) is not assignable to %s (stack map, stack[%d])", f.Stack[i], i, to.Stack[i], i)
+		}
+	}
+	if f.FlagThisUninit && !to.FlagThisUninit {
+		return "flagThisUninit of the current frame is not in the stack map frame"
+	}
+	return ""
+}
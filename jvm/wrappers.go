@@ -0,0 +1,663 @@
+package jvm
+
+import (
+	"cmp"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/Stolkerve/go-jvm/jvm/descriptor"
+)
+
+// newWrapper boxes a primitive value of type t in a new wrapper object
+func (jvm *Jvm) newWrapper(t descriptor.BaseType, value StackData) (StackData, error) {
+	wrapper := wrapperClasses[t]
+	object, err := jvm.libraryObject(wrapper)
+	if err != nil {
+		return StackData{}, err
+	}
+	object.Fields[wrapper+".value"] = value
+	return referenceValue(object), nil
+}
+
+// boxCaches are the classes holding the wrappers valueOf shares, keyed by
+// the type they box, with the lowest value they hold. Integer caches up to
+// Jvm.AutoBoxCacheMax, the others up to 127
+var boxCaches = map[descriptor.BaseType]struct {
+	class string
+	low   int64
+}{
+	descriptor.Byte:  {"java/lang/Byte$ByteCache", -128},
+	descriptor.Short: {"java/lang/Short$ShortCache", -128},
+	descriptor.Char:  {"java/lang/Character$CharacterCache", 0},
+	descriptor.Int:   {"java/lang/Integer$IntegerCache", -128},
+	descriptor.Long:  {"java/lang/Long$LongCache", -128},
+}
+
+// valueOf boxes a primitive value of type t like the valueOf methods of
+// the wrappers: the values of a cache, and the booleans, always box to the
+// same object
+func (jvm *Jvm) valueOf(t descriptor.BaseType, value StackData) (StackData, error) {
+	if t == descriptor.Boolean {
+		class, err := jvm.LoadClass("java/lang/Boolean")
+		if err == nil {
+			err = jvm.InitializeClass(class)
+		}
+		if err != nil {
+			return StackData{}, err
+		}
+		if value.Int() != 0 {
+			return jvm.StaticFields["java/lang/Boolean.TRUE"], nil
+		}
+		return jvm.StaticFields["java/lang/Boolean.FALSE"], nil
+	}
+	cache, ok := boxCaches[t]
+	if !ok {
+		return jvm.newWrapper(t, value)
+	}
+	class, err := jvm.LoadClass(cache.class)
+	if err == nil {
+		err = jvm.InitializeClass(class)
+	}
+	if err != nil {
+		return StackData{}, err
+	}
+	boxes := jvm.StaticFields[cache.class+".cache"].Data.(*Array).Elements
+	var i int64
+	if t == descriptor.Long {
+		i = value.Long()
+	} else {
+		i = int64(value.Int())
+	}
+	if i -= cache.low; i < 0 || i >= int64(len(boxes)) {
+		return jvm.newWrapper(t, value)
+	}
+	// Boxed when first asked for
+	if boxes[i].IsNull() {
+		if boxes[i], err = jvm.newWrapper(t, value); err != nil {
+			return StackData{}, err
+		}
+	}
+	return boxes[i], nil
+}
+
+// convertNumber converts a primitive value to t the way the primitive
+// conversion instructions do, for the xxxValue methods of Number
+func convertNumber(value StackData, t descriptor.BaseType) StackData {
+	var i int64
+	var f float64
+	isFloat := false
+	switch value.Type {
+	case StackTypeLong:
+		i = value.Long()
+	case StackTypeFloat:
+		f, isFloat = float64(value.Float()), true
+	case StackTypeDouble:
+		f, isFloat = value.Double(), true
+	default:
+		i = int64(value.Int())
+	}
+	if isFloat {
+		switch t {
+		case descriptor.Long:
+			return longValue(javaF2L(f))
+		case descriptor.Float:
+			return floatValue(float32(f))
+		case descriptor.Double:
+			return doubleValue(f)
+		}
+		i = int64(javaF2I(f))
+	}
+	switch t {
+	case descriptor.Byte:
+		return intValue(int32(int8(i)))
+	case descriptor.Short:
+		return intValue(int32(int16(i)))
+	case descriptor.Char:
+		return intValue(int32(uint16(i)))
+	case descriptor.Long:
+		return longValue(i)
+	case descriptor.Float:
+		return floatValue(float32(i))
+	case descriptor.Double:
+		return doubleValue(float64(i))
+	}
+	return intValue(int32(i))
+}
+
+// canonicalDoubleBits returns the bits of Double.doubleToLongBits, every
+// NaN is the same
+func canonicalDoubleBits(v float64) uint64 {
+	if math.IsNaN(v) {
+		return 0x7ff8000000000000
+	}
+	return math.Float64bits(v)
+}
+
+// compareDoubles implements Double.compare: -0.0 is less than 0.0, NaN is
+// greater than everything and equal to itself
+func compareDoubles(a, b float64) int32 {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	x, y := int64(canonicalDoubleBits(a)), int64(canonicalDoubleBits(b))
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func numberFormatError(s *String, radix int) error {
+	if s == nil {
+		return throwable("java/lang/NumberFormatException", "Cannot parse null string: null")
+	}
+	if radix != 10 {
+		return throwable("java/lang/NumberFormatException", "For input string: \"%s\" under radix %d", s, radix)
+	}
+	return throwable("java/lang/NumberFormatException", "For input string: \"%s\"", s)
+}
+
+// parseInteger implements Integer.parseInt and Long.parseLong
+func parseInteger(s *String, radix, bitSize int) (int64, error) {
+	if radix < 2 || radix > 36 {
+		return 0, throwable("java/lang/NumberFormatException", "radix %d out of range", radix)
+	}
+	if s == nil {
+		return 0, numberFormatError(s, radix)
+	}
+	text := s.String()
+	// Go also accepts underscores with some prefixes, Java never does
+	if strings.ContainsRune(text, '_') {
+		return 0, numberFormatError(s, radix)
+	}
+	v, err := strconv.ParseInt(text, radix, bitSize)
+	if err != nil {
+		return 0, numberFormatError(s, radix)
+	}
+	return v, nil
+}
+
+// javaFloatLiteral is the syntax Double.parseDouble accepts, once trimmed
+var javaFloatLiteral = regexp.MustCompile(`^[+-]?(NaN|Infinity|((\d+\.?\d*|\.\d+)([eE][+-]?\d+)?|0[xX]([0-9a-fA-F]+\.?[0-9a-fA-F]*|\.[0-9a-fA-F]+)[pP][+-]?\d+)[fFdD]?)$`)
+
+// parseFloatingPoint implements Double.parseDouble and Float.parseFloat
+func parseFloatingPoint(s *String, bitSize int) (float64, error) {
+	if s == nil {
+		return 0, throwable("java/lang/NullPointerException", "")
+	}
+	text := strings.TrimFunc(s.String(), func(r rune) bool { return r <= ' ' })
+	if text == "" {
+		return 0, throwable("java/lang/NumberFormatException", "empty String")
+	}
+	if !javaFloatLiteral.MatchString(text) {
+		return 0, throwable("java/lang/NumberFormatException", "For input string: \"%s\"", s)
+	}
+	text = strings.TrimRight(text, "fFdD")
+	v, err := strconv.ParseFloat(text, bitSize)
+	if err != nil && !strings.Contains(err.Error(), "range") {
+		return 0, throwable("java/lang/NumberFormatException", "For input string: \"%s\"", s)
+	}
+	return v, nil
+}
+
+// registerWrapper registers the natives of the wrapper class of t
+func registerWrapper(t descriptor.BaseType) {
+	class := wrapperClasses[t]
+	valueKey := class + ".value"
+	primitive := t.Descriptor()
+	self := "L" + class + ";"
+	value := func(call *NativeCall) StackData {
+		return call.Object(0).Fields[valueKey]
+	}
+	toString := func(v StackData) string {
+		switch t {
+		case descriptor.Boolean:
+			return strconv.FormatBool(v.Int() != 0)
+		case descriptor.Long:
+			return strconv.FormatInt(v.Long(), 10)
+		case descriptor.Float:
+			return formatFloat(float64(v.Float()), 32)
+		case descriptor.Double:
+			return formatFloat(v.Double(), 64)
+		}
+		return strconv.Itoa(int(v.Int()))
+	}
+	hashCode := func(v StackData) int32 {
+		switch t {
+		case descriptor.Boolean:
+			if v.Int() != 0 {
+				return 1231
+			}
+			return 1237
+		case descriptor.Long:
+			return int32(v.Long() ^ int64(uint64(v.Long())>>32))
+		case descriptor.Float:
+			f := v.Float()
+			if f != f {
+				return 0x7fc00000
+			}
+			return int32(math.Float32bits(f))
+		case descriptor.Double:
+			bits := canonicalDoubleBits(v.Double())
+			return int32(bits ^ bits>>32)
+		}
+		return v.Int()
+	}
+	compare := func(a, b StackData) int32 {
+		switch t {
+		case descriptor.Boolean:
+			return int32(cmp.Compare(a.Int()&1, b.Int()&1))
+		case descriptor.Byte, descriptor.Short, descriptor.Char:
+			// The difference, which cannot overflow
+			return a.Int() - b.Int()
+		case descriptor.Long:
+			return int32(cmp.Compare(a.Long(), b.Long()))
+		case descriptor.Float:
+			return compareDoubles(float64(a.Float()), float64(b.Float()))
+		case descriptor.Double:
+			return compareDoubles(a.Double(), b.Double())
+		}
+		return int32(cmp.Compare(a.Int(), b.Int()))
+	}
+	parse := func(call *NativeCall) (StackData, error) {
+		radix := 10
+		if len(call.Args) == 2 {
+			radix = int(call.Int(1))
+		}
+		switch t {
+		case descriptor.Boolean:
+			s := call.String(0)
+			return booleanValue(s != nil && strings.EqualFold(s.String(), "true")), nil
+		case descriptor.Byte, descriptor.Short:
+			v, err := parseInteger(call.String(0), radix, 32)
+			if err == nil && convertNumber(intValue(int32(v)), t).Int() != int32(v) {
+				err = throwable("java/lang/NumberFormatException", "Value out of range. Value:\"%s\" Radix:%d", call.String(0), radix)
+			}
+			return intValue(int32(v)), err
+		case descriptor.Long:
+			v, err := parseInteger(call.String(0), radix, 64)
+			return longValue(v), err
+		case descriptor.Float:
+			v, err := parseFloatingPoint(call.String(0), 32)
+			return floatValue(float32(v)), err
+		case descriptor.Double:
+			v, err := parseFloatingPoint(call.String(0), 64)
+			return doubleValue(v), err
+		}
+		v, err := parseInteger(call.String(0), radix, 32)
+		return intValue(int32(v)), err
+	}
+
+	RegisterNative(class, "valueOf", "("+primitive+")"+self, func(call *NativeCall) (StackData, error) {
+		return call.Jvm.valueOf(t, call.Args[0])
+	})
+	RegisterNative(class, "<init>", "("+primitive+")V", func(call *NativeCall) (StackData, error) {
+		call.Object(0).Fields[valueKey] = call.Args[1]
+		return StackData{}, nil
+	})
+	switch t {
+	case descriptor.Boolean:
+		RegisterNative(class, "booleanValue", "()Z", func(call *NativeCall) (StackData, error) {
+			return value(call), nil
+		})
+	case descriptor.Char:
+		RegisterNative(class, "charValue", "()C", func(call *NativeCall) (StackData, error) {
+			return value(call), nil
+		})
+	default:
+		for _, number := range []descriptor.BaseType{descriptor.Byte, descriptor.Short, descriptor.Int, descriptor.Long, descriptor.Float, descriptor.Double} {
+			RegisterNative(class, number.String()+"Value", "()"+number.Descriptor(), func(call *NativeCall) (StackData, error) {
+				return convertNumber(value(call), number), nil
+			})
+		}
+	}
+
+	// Every wrapper but Character parses strings
+	if t != descriptor.Char {
+		valueOfString := func(call *NativeCall) (StackData, error) {
+			v, err := parse(call)
+			if err != nil {
+				return StackData{}, err
+			}
+			return call.Jvm.valueOf(t, v)
+		}
+		construct := func(call *NativeCall) (StackData, error) {
+			v, err := parse(&NativeCall{Jvm: call.Jvm, Args: call.Args[1:]})
+			call.Object(0).Fields[valueKey] = v
+			return StackData{}, err
+		}
+		parseName := "parse" + strings.ToUpper(t.String()[:1]) + t.String()[1:]
+		RegisterNative(class, parseName, "(Ljava/lang/String;)"+primitive, parse)
+		RegisterNative(class, "valueOf", "(Ljava/lang/String;)"+self, valueOfString)
+		RegisterNative(class, "<init>", "(Ljava/lang/String;)V", construct)
+		switch t {
+		case descriptor.Byte, descriptor.Short, descriptor.Int, descriptor.Long:
+			RegisterNative(class, parseName, "(Ljava/lang/String;I)"+primitive, parse)
+			RegisterNative(class, "valueOf", "(Ljava/lang/String;I)"+self, valueOfString)
+		}
+	}
+	// A char becomes a string of its UTF-16 char, a lone surrogate is no
+	// rune
+	stringOf := func(v StackData) *String {
+		if t == descriptor.Char {
+			return newStringFromChars([]uint16{uint16(v.Int())})
+		}
+		return NewString(toString(v))
+	}
+	RegisterNative(class, "toString", "()Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(stringOf(value(call))), nil
+	})
+	RegisterNative(class, "toString", "("+primitive+")Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		return referenceValue(stringOf(call.Args[0])), nil
+	})
+	RegisterNative(class, "hashCode", "()I", func(call *NativeCall) (StackData, error) {
+		return intValue(hashCode(value(call))), nil
+	})
+	RegisterNative(class, "hashCode", "("+primitive+")I", func(call *NativeCall) (StackData, error) {
+		return intValue(hashCode(call.Args[0])), nil
+	})
+	RegisterNative(class, "equals", "(Ljava/lang/Object;)Z", func(call *NativeCall) (StackData, error) {
+		other := call.Object(1)
+		if other == nil || other.Class.Name() != class {
+			return booleanValue(false), nil
+		}
+		a, b := value(call), other.Fields[valueKey]
+		switch t {
+		case descriptor.Float:
+			return booleanValue(hashCode(a) == hashCode(b)), nil
+		case descriptor.Double:
+			return booleanValue(canonicalDoubleBits(a.Double()) == canonicalDoubleBits(b.Double())), nil
+		}
+		return booleanValue(a.Data == b.Data), nil
+	})
+	compareTo := func(call *NativeCall) (StackData, error) {
+		other := call.Object(1)
+		if other == nil {
+			return StackData{}, throwable("java/lang/NullPointerException", "")
+		}
+		return intValue(compare(value(call), other.Fields[valueKey])), nil
+	}
+	RegisterNative(class, "compareTo", "("+self+")I", compareTo)
+	// Bridge of Comparable.compareTo
+	RegisterNative(class, "compareTo", "(Ljava/lang/Object;)I", compareTo)
+	RegisterNative(class, "compare", "("+primitive+primitive+")I", func(call *NativeCall) (StackData, error) {
+		return intValue(compare(call.Args[0], call.Args[1])), nil
+	})
+
+	// The arithmetic helpers used as method references, like Integer::sum
+	switch t {
+	case descriptor.Int:
+		RegisterNative(class, "sum", "(II)I", func(call *NativeCall) (StackData, error) {
+			return intValue(call.Int(0) + call.Int(1)), nil
+		})
+		RegisterNative(class, "max", "(II)I", func(call *NativeCall) (StackData, error) {
+			return intValue(max(call.Int(0), call.Int(1))), nil
+		})
+		RegisterNative(class, "min", "(II)I", func(call *NativeCall) (StackData, error) {
+			return intValue(min(call.Int(0), call.Int(1))), nil
+		})
+	case descriptor.Long:
+		RegisterNative(class, "sum", "(JJ)J", func(call *NativeCall) (StackData, error) {
+			return longValue(call.Long(0) + call.Long(1)), nil
+		})
+		RegisterNative(class, "max", "(JJ)J", func(call *NativeCall) (StackData, error) {
+			return longValue(max(call.Long(0), call.Long(1))), nil
+		})
+		RegisterNative(class, "min", "(JJ)J", func(call *NativeCall) (StackData, error) {
+			return longValue(min(call.Long(0), call.Long(1))), nil
+		})
+	case descriptor.Double:
+		RegisterNative(class, "sum", "(DD)D", func(call *NativeCall) (StackData, error) {
+			return doubleValue(call.Double(0) + call.Double(1)), nil
+		})
+		RegisterNative(class, "max", "(DD)D", func(call *NativeCall) (StackData, error) {
+			return doubleValue(math.Max(call.Double(0), call.Double(1))), nil
+		})
+		RegisterNative(class, "min", "(DD)D", func(call *NativeCall) (StackData, error) {
+			return doubleValue(math.Min(call.Double(0), call.Double(1))), nil
+		})
+		RegisterNative(class, "isNaN", "(D)Z", func(call *NativeCall) (StackData, error) {
+			return booleanValue(math.IsNaN(call.Double(0))), nil
+		})
+		RegisterNative(class, "isInfinite", "(D)Z", func(call *NativeCall) (StackData, error) {
+			return booleanValue(math.IsInf(call.Double(0), 0)), nil
+		})
+		RegisterNative(class, "isFinite", "(D)Z", func(call *NativeCall) (StackData, error) {
+			return booleanValue(!math.IsInf(call.Double(0), 0) && !math.IsNaN(call.Double(0))), nil
+		})
+		RegisterNative(class, "doubleToLongBits", "(D)J", func(call *NativeCall) (StackData, error) {
+			return longValue(int64(canonicalDoubleBits(call.Double(0)))), nil
+		})
+	case descriptor.Float:
+		RegisterNative(class, "sum", "(FF)F", func(call *NativeCall) (StackData, error) {
+			return floatValue(call.Float(0) + call.Float(1)), nil
+		})
+		RegisterNative(class, "max", "(FF)F", func(call *NativeCall) (StackData, error) {
+			return floatValue(float32(math.Max(float64(call.Float(0)), float64(call.Float(1))))), nil
+		})
+		RegisterNative(class, "min", "(FF)F", func(call *NativeCall) (StackData, error) {
+			return floatValue(float32(math.Min(float64(call.Float(0)), float64(call.Float(1))))), nil
+		})
+		RegisterNative(class, "isNaN", "(F)Z", func(call *NativeCall) (StackData, error) {
+			return booleanValue(math.IsNaN(float64(call.Float(0)))), nil
+		})
+		RegisterNative(class, "isInfinite", "(F)Z", func(call *NativeCall) (StackData, error) {
+			return booleanValue(math.IsInf(float64(call.Float(0)), 0)), nil
+		})
+		RegisterNative(class, "isFinite", "(F)Z", func(call *NativeCall) (StackData, error) {
+			return booleanValue(!math.IsInf(float64(call.Float(0)), 0) && !math.IsNaN(float64(call.Float(0)))), nil
+		})
+		RegisterNative(class, "floatToIntBits", "(F)I", func(call *NativeCall) (StackData, error) {
+			return intValue(hashCode(call.Args[0])), nil
+		})
+	case descriptor.Boolean:
+		RegisterNative(class, "logicalAnd", "(ZZ)Z", func(call *NativeCall) (StackData, error) {
+			return booleanValue(call.Boolean(0) && call.Boolean(1)), nil
+		})
+		RegisterNative(class, "logicalOr", "(ZZ)Z", func(call *NativeCall) (StackData, error) {
+			return booleanValue(call.Boolean(0) || call.Boolean(1)), nil
+		})
+		RegisterNative(class, "logicalXor", "(ZZ)Z", func(call *NativeCall) (StackData, error) {
+			return booleanValue(call.Boolean(0) != call.Boolean(1)), nil
+		})
+	case descriptor.Byte, descriptor.Short:
+		mask := int32(0xff)
+		if t == descriptor.Short {
+			mask = 0xffff
+		}
+		RegisterNative(class, "toUnsignedInt", "("+primitive+")I", func(call *NativeCall) (StackData, error) {
+			return intValue(call.Int(0) & mask), nil
+		})
+		RegisterNative(class, "toUnsignedLong", "("+primitive+")J", func(call *NativeCall) (StackData, error) {
+			return longValue(int64(call.Int(0) & mask)), nil
+		})
+	}
+	if t == descriptor.Int || t == descriptor.Long {
+		unsigned := func(v StackData) uint64 {
+			if t == descriptor.Long {
+				return uint64(v.Long())
+			}
+			return uint64(uint32(v.Int()))
+		}
+		for name, base := range map[string]int{"toHexString": 16, "toOctalString": 8, "toBinaryString": 2} {
+			RegisterNative(class, name, "("+primitive+")Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+				return referenceValue(NewString(strconv.FormatUint(unsigned(call.Args[0]), base))), nil
+			})
+		}
+		RegisterNative(class, "toString", "("+primitive+"I)Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+			radix := int(call.Int(len(call.Args) - 1))
+			if radix < 2 || radix > 36 {
+				radix = 10
+			}
+			v := int64(call.Int(0))
+			if t == descriptor.Long {
+				v = call.Long(0)
+			}
+			return referenceValue(NewString(strconv.FormatInt(v, radix))), nil
+		})
+	}
+}
+
+// characterDigit implements Character.digit: the value of a decimal digit
+// of any script or of a latin letter in radix, -1 if it is none
+func characterDigit(r rune, radix int32) int32 {
+	if radix < 2 || radix > 36 {
+		return -1
+	}
+	v := int32(-1)
+	switch {
+	case r >= 'a' && r <= 'z':
+		v = r - 'a' + 10
+	case r >= 'A' && r <= 'Z':
+		v = r - 'A' + 10
+	case unicode.IsDigit(r):
+		// The decimal digits come in runs from 0 to 9
+		for _, digits := range unicode.Nd.R16 {
+			if r >= rune(digits.Lo) && r <= rune(digits.Hi) {
+				v = (r - rune(digits.Lo)) % 10
+			}
+		}
+		for _, digits := range unicode.Nd.R32 {
+			if r >= rune(digits.Lo) && r <= rune(digits.Hi) {
+				v = (r - rune(digits.Lo)) % 10
+			}
+		}
+	}
+	if v >= radix {
+		return -1
+	}
+	return v
+}
+
+// isJavaWhitespace implements Character.isWhitespace: the separators but
+// the no-break spaces, and the ASCII control characters for tabs, lines and
+// files
+func isJavaWhitespace(r rune) bool {
+	switch r {
+	case '\u00a0', '\u2007', '\u202f':
+		return false
+	}
+	return unicode.In(r, unicode.Zs, unicode.Zl, unicode.Zp) || r >= '\t' && r <= '\r' || r >= 0x1c && r <= 0x1f
+}
+
+// registerCharacter registers the static methods of Character classifying
+// and converting characters, for char and code point arguments alike
+func registerCharacter() {
+	const class = "java/lang/Character"
+	for name, test := range map[string]func(rune) bool{
+		"isDigit":         unicode.IsDigit,
+		"isLetter":        unicode.IsLetter,
+		"isLetterOrDigit": func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) },
+		"isAlphabetic":    func(r rune) bool { return unicode.In(r, unicode.Letter, unicode.Nl, unicode.Other_Alphabetic) },
+		"isUpperCase":     unicode.IsUpper,
+		"isLowerCase":     unicode.IsLower,
+		"isWhitespace":    isJavaWhitespace,
+		"isSpaceChar":     func(r rune) bool { return unicode.In(r, unicode.Zs, unicode.Zl, unicode.Zp) },
+		"isISOControl":    func(r rune) bool { return r <= 0x1f || r >= 0x7f && r <= 0x9f },
+	} {
+		native := func(call *NativeCall) (StackData, error) {
+			return booleanValue(test(rune(call.Int(0)))), nil
+		}
+		RegisterNative(class, name, "(C)Z", native)
+		RegisterNative(class, name, "(I)Z", native)
+	}
+	for name, convert := range map[string]func(rune) rune{"toUpperCase": unicode.ToUpper, "toLowerCase": unicode.ToLower} {
+		RegisterNative(class, name, "(C)C", func(call *NativeCall) (StackData, error) {
+			// A char stays one when its case mapping is not
+			if r := convert(rune(call.Int(0))); r <= 0xffff {
+				return intValue(r), nil
+			}
+			return call.Args[0], nil
+		})
+		RegisterNative(class, name, "(I)I", func(call *NativeCall) (StackData, error) {
+			return intValue(convert(rune(call.Int(0)))), nil
+		})
+	}
+	digit := func(call *NativeCall) (StackData, error) {
+		return intValue(characterDigit(rune(call.Int(0)), call.Int(1))), nil
+	}
+	RegisterNative(class, "digit", "(CI)I", digit)
+	RegisterNative(class, "digit", "(II)I", digit)
+	getNumericValue := func(call *NativeCall) (StackData, error) {
+		return intValue(characterDigit(rune(call.Int(0)), 36)), nil
+	}
+	RegisterNative(class, "getNumericValue", "(C)I", getNumericValue)
+	RegisterNative(class, "getNumericValue", "(I)I", getNumericValue)
+	RegisterNative(class, "forDigit", "(II)C", func(call *NativeCall) (StackData, error) {
+		d, radix := call.Int(0), call.Int(1)
+		switch {
+		case radix < 2 || radix > 36 || d < 0 || d >= radix:
+			return intValue(0), nil
+		case d < 10:
+			return intValue('0' + d), nil
+		}
+		return intValue('a' + d - 10), nil
+	})
+	RegisterNative(class, "toString", "(I)Ljava/lang/String;", func(call *NativeCall) (StackData, error) {
+		codePoint := call.Int(0)
+		switch {
+		case codePoint < 0 || codePoint > unicode.MaxRune:
+			return StackData{}, throwable("java/lang/IllegalArgumentException", "Not a valid Unicode code point: 0x%X", uint32(codePoint))
+		case codePoint < 0x10000:
+			return referenceValue(newStringFromChars([]uint16{uint16(codePoint)})), nil
+		}
+		high, low := utf16.EncodeRune(codePoint)
+		return referenceValue(newStringFromChars([]uint16{uint16(high), uint16(low)})), nil
+	})
+	RegisterNative(class, "charCount", "(I)I", func(call *NativeCall) (StackData, error) {
+		if call.Int(0) >= 0x10000 {
+			return intValue(2), nil
+		}
+		return intValue(1), nil
+	})
+	RegisterNative(class, "isSurrogate", "(C)Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(utf16.IsSurrogate(rune(call.Int(0)))), nil
+	})
+	RegisterNative(class, "isHighSurrogate", "(C)Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(call.Int(0) >= 0xd800 && call.Int(0) <= 0xdbff), nil
+	})
+	RegisterNative(class, "isLowSurrogate", "(C)Z", func(call *NativeCall) (StackData, error) {
+		return booleanValue(call.Int(0) >= 0xdc00 && call.Int(0) <= 0xdfff), nil
+	})
+	RegisterNative(class, "toCodePoint", "(CC)I", func(call *NativeCall) (StackData, error) {
+		return intValue(utf16.DecodeRune(rune(call.Int(0)), rune(call.Int(1)))), nil
+	})
+}
+
+func init() {
+	for t := range wrapperClasses {
+		registerWrapper(t)
+	}
+	registerCharacter()
+	for t, cache := range boxCaches {
+		RegisterNative(cache.class, "<clinit>", "()V", func(call *NativeCall) (StackData, error) {
+			high := int64(127)
+			if t == descriptor.Int {
+				// Lowered like IntegerCache does, so that the cache has no
+				// more than Integer.MAX_VALUE entries
+				high = min(max(high, int64(call.Jvm.AutoBoxCacheMax)), math.MaxInt32+cache.low-1)
+			}
+			call.Jvm.StaticFields[cache.class+".cache"] = referenceValue(NewArray("[L"+wrapperClasses[t]+";", int(high-cache.low+1)))
+			return StackData{}, nil
+		})
+	}
+	RegisterNative("java/lang/Boolean", "<clinit>", "()V", func(call *NativeCall) (StackData, error) {
+		for name, value := range map[string]bool{"TRUE": true, "FALSE": false} {
+			box, err := call.Jvm.newWrapper(descriptor.Boolean, booleanValue(value))
+			if err != nil {
+				return StackData{}, err
+			}
+			call.Jvm.StaticFields["java/lang/Boolean."+name] = box
+		}
+		return StackData{}, nil
+	})
+}
@@ -3,12 +3,60 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 
 	_jvm "github.com/Stolkerve/go-jvm/jvm"
 )
 
 func main() {
 	args := os.Args[1:]
+	// Options before the class file: --system <java home> boots the class
+	// library of a JDK, --patch-module [<module>=]<dir> overrides its classes,
+	// -Xmx<size> and -Xms<size> size the heap, -Xlog:gc logs collections and
+	// -XX:AutoBoxCacheMax=<n> is the highest int Integer.valueOf caches
+	var javaHome string
+	var patches []string
+	var maxHeap, initialHeap int64
+	var logGC, setAutoBoxCacheMax bool
+	var autoBoxCacheMax int64
+	for len(args) > 1 && strings.HasPrefix(args[0], "-") {
+		option := args[0]
+		args = args[1:]
+		var err error
+		switch {
+		case option == "--system":
+			javaHome, args = args[0], args[1:]
+		case option == "--patch-module":
+			patch := args[0]
+			if _, dir, ok := strings.Cut(patch, "="); ok {
+				patch = dir
+			}
+			patches, args = append(patches, patch), args[1:]
+		case strings.HasPrefix(option, "-Xmx"):
+			maxHeap, err = _jvm.ParseMemorySize(option[len("-Xmx"):])
+		case strings.HasPrefix(option, "-Xms"):
+			initialHeap, err = _jvm.ParseMemorySize(option[len("-Xms"):])
+		case option == "-Xlog:gc" || option == "-Xlog:gc*" || option == "-verbose:gc":
+			logGC = true
+		case strings.HasPrefix(option, "-XX:AutoBoxCacheMax="):
+			// Lower values are accepted, the cache still reaches 127
+			if autoBoxCacheMax, err = strconv.ParseInt(option[len("-XX:AutoBoxCacheMax="):], 10, 32); err != nil {
+				fmt.Fprintf(os.Stderr, "Improperly specified VM option '%s'\n", option[len("-XX:"):])
+				os.Exit(1)
+			}
+			setAutoBoxCacheMax = true
+		default:
+			fmt.Fprintf(os.Stderr, "unknown option %s\n", option)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid heap size: %s\n", option)
+			os.Exit(1)
+		}
+	}
 	if len(args) == 0 {
 		fmt.Fprintln(os.Stderr, "java class file expected")
 		os.Exit(1)
@@ -19,6 +67,40 @@ func main() {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	if javaHome != "" {
+		if err := jvm.UseJDK(javaHome); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	for _, dir := range patches {
+		jvm.PatchModule(dir)
+	}
+	if maxHeap > 0 {
+		jvm.Heap.MaxSize = maxHeap
+	}
+	if initialHeap > 0 {
+		jvm.Heap.InitialSize = initialHeap
+	}
+	if initialHeap > jvm.Heap.MaxSize {
+		fmt.Fprintln(os.Stderr, "Initial heap size set to a larger value than the maximum heap size")
+		os.Exit(1)
+	}
+	if logGC {
+		jvm.Heap.Log = jvm.Stdout
+	}
+	if setAutoBoxCacheMax {
+		jvm.AutoBoxCacheMax = int32(autoBoxCacheMax)
+	}
+
+	// kill -QUIT prints the threads and their deadlocks like HotSpot does
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGQUIT)
+	go func() {
+		for range quit {
+			jvm.ThreadDump(jvm.Stdout)
+		}
+	}()
 
 	_jvm.RunJvm(jvm)
 }